@@ -0,0 +1,336 @@
+package admin
+
+import (
+	"net/http"
+	"slices"
+
+	"McpServer/internal/models"
+	"McpServer/internal/redact"
+	"McpServer/internal/secrets"
+)
+
+// sseAuthConfigPublicKeys auth_config 中不属于凭据、响应中原样返回的字段
+var sseAuthConfigPublicKeys = []string{"header", "username", "token_url", "client_id", "scope"}
+
+// stdioRequest 创建或替换 stdio 配置的请求体，未指定的字段使用表默认值
+type stdioRequest struct {
+	Command           string       `json:"command"`
+	Args              []string     `json:"args"`
+	Workdir           *string      `json:"workdir"`
+	Env               models.JSONB `json:"env"`
+	StartupTimeoutMs  *int         `json:"startup_timeout_ms"`
+	ShutdownTimeoutMs *int         `json:"shutdown_timeout_ms"`
+	ReuseStrategy     string       `json:"reuse_strategy"`
+	MaxConcurrent     *int         `json:"max_concurrent"`
+	IdleTtlMs         *int         `json:"idle_ttl_ms"`
+	MaxRestarts       *int         `json:"max_restarts"`
+	InitParams        models.JSONB `json:"init_params"`
+
+	CredentialPassthrough models.JSONB `json:"credential_passthrough"`
+}
+
+// toModel 转换为 stdio 配置模型并填充默认值
+func (req *stdioRequest) toModel(serverID string) *models.MCPServiceStdio {
+	config := &models.MCPServiceStdio{
+		ServerID:          serverID,
+		Command:           req.Command,
+		Args:              req.Args,
+		Workdir:           req.Workdir,
+		Env:               req.Env,
+		StartupTimeoutMs:  intOrDefault(req.StartupTimeoutMs, 30000),
+		ShutdownTimeoutMs: intOrDefault(req.ShutdownTimeoutMs, 5000),
+		ReuseStrategy:     req.ReuseStrategy,
+		MaxConcurrent:     intOrDefault(req.MaxConcurrent, 10),
+		IdleTtlMs:         intOrDefault(req.IdleTtlMs, 300000),
+		MaxRestarts:       intOrDefault(req.MaxRestarts, 3),
+		InitParams:        req.InitParams,
+
+		CredentialPassthrough: req.CredentialPassthrough,
+	}
+	if config.Args == nil {
+		config.Args = []string{}
+	}
+	if config.Env == nil {
+		config.Env = models.JSONB{}
+	}
+	if config.ReuseStrategy == "" {
+		config.ReuseStrategy = "shared"
+	}
+	if config.InitParams == nil {
+		config.InitParams = models.JSONB{}
+	}
+	if config.CredentialPassthrough == nil {
+		config.CredentialPassthrough = models.JSONB{}
+	}
+	return config
+}
+
+// sseRequest 创建或替换 SSE 配置的请求体，未指定的字段使用表默认值
+type sseRequest struct {
+	BaseURL               string       `json:"base_url"`
+	SSEPath               string       `json:"sse_path"`
+	AuthType              string       `json:"auth_type"`
+	AuthConfig            models.JSONB `json:"auth_config"`
+	TimeoutMs             *int         `json:"timeout_ms"`
+	ConnectTimeoutMs      *int         `json:"connect_timeout_ms"`
+	RetryAttempts         *int         `json:"retry_attempts"`
+	RetryDelayMs          *int         `json:"retry_delay_ms"`
+	HealthCheckEnabled    *bool        `json:"health_check_enabled"`
+	HealthCheckPath       *string      `json:"health_check_path"`
+	HealthCheckIntervalMs *int         `json:"health_check_interval_ms"`
+	Headers               models.JSONB `json:"headers"`
+	QueryParams           models.JSONB `json:"query_params"`
+	ConnectionPoolSize    *int         `json:"connection_pool_size"`
+	KeepAlive             *bool        `json:"keep_alive"`
+	FollowRedirects       *bool        `json:"follow_redirects"`
+	MaxRedirects          *int         `json:"max_redirects"`
+	UserAgent             string       `json:"user_agent"`
+	CredentialPassthrough models.JSONB `json:"credential_passthrough"`
+}
+
+// toModel 转换为 SSE 配置模型并填充默认值
+func (req *sseRequest) toModel(serverID string) *models.MCPServiceSSE {
+	config := &models.MCPServiceSSE{
+		ServerID:              serverID,
+		BaseURL:               req.BaseURL,
+		SSEPath:               req.SSEPath,
+		AuthType:              req.AuthType,
+		AuthConfig:            req.AuthConfig,
+		TimeoutMs:             intOrDefault(req.TimeoutMs, 30000),
+		ConnectTimeoutMs:      intOrDefault(req.ConnectTimeoutMs, 10000),
+		RetryAttempts:         intOrDefault(req.RetryAttempts, 3),
+		RetryDelayMs:          intOrDefault(req.RetryDelayMs, 1000),
+		HealthCheckEnabled:    boolOrDefault(req.HealthCheckEnabled, true),
+		HealthCheckPath:       req.HealthCheckPath,
+		HealthCheckIntervalMs: intOrDefault(req.HealthCheckIntervalMs, 60000),
+		Headers:               req.Headers,
+		QueryParams:           req.QueryParams,
+		ConnectionPoolSize:    intOrDefault(req.ConnectionPoolSize, 5),
+		KeepAlive:             boolOrDefault(req.KeepAlive, true),
+		FollowRedirects:       boolOrDefault(req.FollowRedirects, true),
+		MaxRedirects:          intOrDefault(req.MaxRedirects, 5),
+		UserAgent:             req.UserAgent,
+		CredentialPassthrough: req.CredentialPassthrough,
+	}
+	if config.SSEPath == "" {
+		config.SSEPath = "/sse"
+	}
+	if config.AuthType == "" {
+		config.AuthType = "none"
+	}
+	if config.AuthConfig == nil {
+		config.AuthConfig = models.JSONB{}
+	}
+	if config.HealthCheckPath == nil {
+		defaultPath := "/health"
+		config.HealthCheckPath = &defaultPath
+	}
+	if config.Headers == nil {
+		config.Headers = models.JSONB{}
+	}
+	if config.QueryParams == nil {
+		config.QueryParams = models.JSONB{}
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = "MCP-Proxy/1.0"
+	}
+	if config.CredentialPassthrough == nil {
+		config.CredentialPassthrough = models.JSONB{}
+	}
+	return config
+}
+
+// maskedStdioConfig 返回 env 中明文值被遮蔽的副本，secret:// 引用原样保留
+func maskedStdioConfig(config *models.MCPServiceStdio) *models.MCPServiceStdio {
+	masked := *config
+	masked.Env = maskPlaintext(config.Env, nil)
+	return &masked
+}
+
+// maskedSSEConfig 返回 auth_config 和 headers 中明文值被遮蔽的副本，secret:// 引用原样保留
+func maskedSSEConfig(config *models.MCPServiceSSE) *models.MCPServiceSSE {
+	masked := *config
+	masked.AuthConfig = maskPlaintext(config.AuthConfig, sseAuthConfigPublicKeys)
+	masked.Headers = maskPlaintext(config.Headers, nil)
+	return &masked
+}
+
+// maskPlaintext 将不是 secret:// 引用的字符串值（包括嵌套对象和数组中的）替换为 redact.Mask，
+// publicKeys 中的顶层字段不遮蔽
+func maskPlaintext(values models.JSONB, publicKeys []string) models.JSONB {
+	if values == nil {
+		return nil
+	}
+	masked := make(models.JSONB, len(values))
+	for key, value := range values {
+		if slices.Contains(publicKeys, key) {
+			masked[key] = value
+		} else {
+			masked[key] = maskValue(value)
+		}
+	}
+	return masked
+}
+
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if _, isRef := secrets.ParseRef(v); isRef {
+			return v
+		}
+		return redact.Mask
+	case map[string]interface{}:
+		return map[string]interface{}(maskPlaintext(v, nil))
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(item)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+// intOrDefault 返回指针指向的值，为 nil 时返回默认值
+func intOrDefault(value *int, def int) int {
+	if value == nil {
+		return def
+	}
+	return *value
+}
+
+// boolOrDefault 返回指针指向的值，为 nil 时返回默认值
+func boolOrDefault(value *bool, def bool) bool {
+	if value == nil {
+		return def
+	}
+	return *value
+}
+
+// requireAdapter 读取路径中的服务并检查其适配器类型，不匹配时写入 409
+func (h *Handler) requireAdapter(w http.ResponseWriter, r *http.Request, adapter string) *models.MCPService {
+	service := h.loadService(w, r)
+	if service == nil {
+		return nil
+	}
+	if service.Adapter != adapter {
+		writeError(w, http.StatusConflict, "service %s uses adapter %s, expected %s", service.ServerID, service.Adapter, adapter)
+		return nil
+	}
+	return service
+}
+
+// getStdioConfig GET /admin/services/{id}/stdio，env 中的明文值被遮蔽
+func (h *Handler) getStdioConfig(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	config, err := h.store.GetStdioServiceRecord(serverID)
+	if err != nil {
+		writeStoreError(w, "get stdio config", err)
+		return
+	}
+	if config == nil {
+		writeError(w, http.StatusNotFound, "stdio config for service %s not found", serverID)
+		return
+	}
+	writeJSON(w, http.StatusOK, maskedStdioConfig(config))
+}
+
+// putStdioConfig PUT /admin/services/{id}/stdio，创建或整体替换 stdio 配置
+func (h *Handler) putStdioConfig(w http.ResponseWriter, r *http.Request) {
+	service := h.requireAdapter(w, r, AdapterRemoteStdio)
+	if service == nil {
+		return
+	}
+
+	var req stdioRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	config := req.toModel(service.ServerID)
+	if errs := validateStdioConfig(config); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	if err := h.store.UpsertStdioServiceConfig(config); err != nil {
+		writeStoreError(w, "save stdio config", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, maskedStdioConfig(config))
+}
+
+// deleteStdioConfig DELETE /admin/services/{id}/stdio
+func (h *Handler) deleteStdioConfig(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	found, err := h.store.DeleteStdioServiceConfig(serverID)
+	if err != nil {
+		writeStoreError(w, "delete stdio config", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "stdio config for service %s not found", serverID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getSSEConfig GET /admin/services/{id}/sse，auth_config 和 headers 中的明文凭据被遮蔽
+func (h *Handler) getSSEConfig(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	config, err := h.store.GetSSEServiceRecord(serverID)
+	if err != nil {
+		writeStoreError(w, "get sse config", err)
+		return
+	}
+	if config == nil {
+		writeError(w, http.StatusNotFound, "sse config for service %s not found", serverID)
+		return
+	}
+	writeJSON(w, http.StatusOK, maskedSSEConfig(config))
+}
+
+// putSSEConfig PUT /admin/services/{id}/sse，创建或整体替换 SSE 配置
+func (h *Handler) putSSEConfig(w http.ResponseWriter, r *http.Request) {
+	service := h.requireAdapter(w, r, AdapterRemoteSSE)
+	if service == nil {
+		return
+	}
+
+	var req sseRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	config := req.toModel(service.ServerID)
+	if errs := validateSSEConfig(config); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	if err := h.store.UpsertSSEServiceConfig(config); err != nil {
+		writeStoreError(w, "save sse config", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, maskedSSEConfig(config))
+}
+
+// deleteSSEConfig DELETE /admin/services/{id}/sse
+func (h *Handler) deleteSSEConfig(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	found, err := h.store.DeleteSSEServiceConfig(serverID)
+	if err != nil {
+		writeStoreError(w, "delete sse config", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "sse config for service %s not found", serverID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"McpServer/internal/audit"
+	"McpServer/internal/auth"
+	"McpServer/internal/models"
+)
+
+// 审计记录查询的默认和最大条数
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var (
+	validAuditEventTypes = []string{models.AuditEventToolCall, models.AuditEventAdmin}
+	pathWildcard         = regexp.MustCompile(`\{([^}.]+)(?:\.\.\.)?\}`)
+)
+
+// AuditLog 审计日志的记录、查询和哈希链校验
+type AuditLog interface {
+	Ready() error
+	Record(entry models.AuditEntry, arguments json.RawMessage)
+	List(query models.AuditQuery) ([]models.AuditEntry, error)
+	Verify() (audit.VerifyResult, error)
+}
+
+// SetAudit 启用管理操作审计和审计日志查询端点，需在 Register 之前调用
+func (h *Handler) SetAudit(log AuditLog) {
+	h.audit = log
+}
+
+// statusRecorder 记录管理接口响应的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// audited 记录变更类管理请求：调用方、路由、路径参数、请求体的 SHA-256 和响应状态码。
+// 请求体可能包含密钥明文，不保存原文。审计日志无法写入时返回 503，不执行变更
+func (h *Handler) audited(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	names := pathWildcard.FindAllStringSubmatch(pattern, -1)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.audit.Ready(); err != nil {
+			writeError(w, http.StatusServiceUnavailable, "audit log cannot be written, try again later: %v", err)
+			return
+		}
+		occurredAt := time.Now()
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		user, _ := auth.UserFromContext(r.Context())
+		entry := models.AuditEntry{
+			OccurredAt: occurredAt,
+			EventType:  models.AuditEventAdmin,
+			Actor:      user.Identity(),
+			Action:     pattern,
+			ServerID:   r.PathValue("id"),
+			Target:     r.URL.Path,
+			Status:     strconv.Itoa(recorder.status),
+			Details:    models.JSONB{"remote_addr": r.RemoteAddr},
+		}
+		if user != nil {
+			entry.UserID = user.UserID
+			entry.KeyID = user.KeyID
+		}
+		for _, name := range names {
+			entry.Details[name[1]] = r.PathValue(name[1])
+		}
+		h.audit.Record(entry, body)
+	}
+}
+
+// listAudit GET /admin/audit，按 id 倒序查询审计记录。查询参数：from、to（RFC 3339 或 YYYY-MM-DD），
+// event_type（tool_call、admin），actor、user_id、key_id、server_id、tool、action、status，
+// limit（默认 100，最大 1000），before_id（翻页，传入上一页最后一条的 id）
+func (h *Handler) listAudit(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var errs fieldErrors
+
+	query := models.AuditQuery{
+		EventType: params.Get("event_type"),
+		Actor:     params.Get("actor"),
+		UserID:    params.Get("user_id"),
+		KeyID:     params.Get("key_id"),
+		ServerID:  params.Get("server_id"),
+		ToolName:  params.Get("tool"),
+		Action:    params.Get("action"),
+		Status:    params.Get("status"),
+		Limit:     defaultAuditLimit,
+	}
+	if value := params.Get("from"); value != "" {
+		if from, ok := parseUsageTime(value); ok {
+			query.From = from
+		} else {
+			errs.add("from", "must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if to, ok := parseUsageTime(value); ok {
+			query.To = to
+		} else {
+			errs.add("to", "must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if query.EventType != "" && !oneOf(query.EventType, validAuditEventTypes) {
+		errs.add("event_type", "must be %s or %s", models.AuditEventToolCall, models.AuditEventAdmin)
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			errs.add("limit", "must be an integer between 1 and %d", maxAuditLimit)
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("before_id"); value != "" {
+		beforeID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || beforeID <= 0 {
+			errs.add("before_id", "must be a positive integer")
+		}
+		query.BeforeID = beforeID
+	}
+
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	entries, err := h.audit.List(query)
+	if err != nil {
+		writeStoreError(w, "query audit log", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// verifyAudit GET /admin/audit/verify，校验整条哈希链；链断裂时返回 409 和第一条校验失败的记录
+func (h *Handler) verifyAudit(w http.ResponseWriter, r *http.Request) {
+	result, err := h.audit.Verify()
+	if err != nil {
+		writeStoreError(w, "verify audit log", err)
+		return
+	}
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, result)
+}
@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// maxBodyBytes 管理接口请求体的最大字节数
+const maxBodyBytes = 1 << 20
+
+// Store 管理接口所需的数据库操作（避免循环依赖）
+// 读取方法包含已禁用的记录，记录不存在时返回 nil；更新和删除方法在记录不存在时返回 false
+type Store interface {
+	ListServiceRecords() ([]models.MCPService, error)
+	GetServiceRecord(serverID string) (*models.MCPService, error)
+	CreateService(service *models.MCPService) error
+	UpdateService(service *models.MCPService) (bool, error)
+	SetServiceEnabled(serverID string, enabled bool) (bool, error)
+	DeleteService(serverID string) (bool, error)
+
+	ListToolRecords(serverID string) ([]models.MCPTool, error)
+	GetToolRecord(serverID string, toolID int64) (*models.MCPTool, error)
+	CreateTool(tool *models.MCPTool) error
+	UpdateTool(tool *models.MCPTool) (bool, error)
+	SetToolEnabled(serverID string, toolID int64, enabled bool) (bool, error)
+	DeleteTool(serverID string, toolID int64) (bool, error)
+
+	GetStdioServiceRecord(serverID string) (*models.MCPServiceStdio, error)
+	UpsertStdioServiceConfig(config *models.MCPServiceStdio) error
+	DeleteStdioServiceConfig(serverID string) (bool, error)
+
+	GetSSEServiceRecord(serverID string) (*models.MCPServiceSSE, error)
+	UpsertSSEServiceConfig(config *models.MCPServiceSSE) error
+	DeleteSSEServiceConfig(serverID string) (bool, error)
+}
+
+// HandlerRegistry 用于校验内置工具的 handler_type 是否已注册
+type HandlerRegistry interface {
+	HasHandler(handlerType string) bool
+}
+
+// Handler 管理接口，提供服务、工具及适配器配置的增删改查和热重载
+type Handler struct {
+	store    Store
+	registry HandlerRegistry
+	reloader Reloader
+	secrets  SecretManager
+	usage    UsageReporter
+	audit    AuditLog
+}
+
+// NewHandler 创建管理接口处理器，registry 为 nil 时不校验 handler_type 是否已注册，
+// reloader 为 nil 时不注册热重载端点
+func NewHandler(store Store, registry HandlerRegistry, reloader Reloader) *Handler {
+	return &Handler{
+		store:    store,
+		registry: registry,
+		reloader: reloader,
+	}
+}
+
+// Register 在 mux 上注册管理接口路由，wrap 用于为每个端点添加认证；
+// 认证通过但不是管理员（见 auth.User.IsAdmin）的调用方返回 403
+func (h *Handler) Register(mux *http.ServeMux, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	routes := map[string]http.HandlerFunc{
+		"GET /admin/services":                               h.listServices,
+		"POST /admin/services":                              h.createService,
+		"GET /admin/services/{id}":                          h.getService,
+		"PUT /admin/services/{id}":                          h.updateService,
+		"DELETE /admin/services/{id}":                       h.deleteService,
+		"POST /admin/services/{id}/enable":                  h.setServiceEnabled(true),
+		"POST /admin/services/{id}/disable":                 h.setServiceEnabled(false),
+		"GET /admin/services/{id}/tools":                    h.listTools,
+		"POST /admin/services/{id}/tools":                   h.createTool,
+		"GET /admin/services/{id}/tools/{tool_id}":          h.getTool,
+		"PUT /admin/services/{id}/tools/{tool_id}":          h.updateTool,
+		"DELETE /admin/services/{id}/tools/{tool_id}":       h.deleteTool,
+		"POST /admin/services/{id}/tools/{tool_id}/enable":  h.setToolEnabled(true),
+		"POST /admin/services/{id}/tools/{tool_id}/disable": h.setToolEnabled(false),
+		"GET /admin/services/{id}/stdio":                    h.getStdioConfig,
+		"PUT /admin/services/{id}/stdio":                    h.putStdioConfig,
+		"DELETE /admin/services/{id}/stdio":                 h.deleteStdioConfig,
+		"GET /admin/services/{id}/sse":                      h.getSSEConfig,
+		"PUT /admin/services/{id}/sse":                      h.putSSEConfig,
+		"DELETE /admin/services/{id}/sse":                   h.deleteSSEConfig,
+	}
+
+	if h.reloader != nil {
+		routes["POST /admin/reload"] = h.reloadAll
+		routes["POST /admin/reload/{id}"] = h.reloadService
+	}
+	if h.secrets != nil {
+		routes["GET /admin/secrets"] = h.listSecrets
+		routes["GET /admin/secrets/{name}"] = h.getSecret
+		routes["PUT /admin/secrets/{name}"] = h.putSecret
+		routes["DELETE /admin/secrets/{name}"] = h.deleteSecret
+		routes["POST /admin/secrets/{name}/rotate"] = h.rotateSecret
+		routes["POST /admin/secrets/rekey"] = h.rekeySecrets
+	}
+	if h.usage != nil {
+		routes["GET /admin/usage"] = h.usageReport
+	}
+	if h.audit != nil {
+		// 审计全部变更类端点，查询类端点不记录
+		for pattern, handler := range routes {
+			if !strings.HasPrefix(pattern, http.MethodGet+" ") {
+				routes[pattern] = h.audited(pattern, handler)
+			}
+		}
+		routes["GET /admin/audit"] = h.listAudit
+		routes["GET /admin/audit/verify"] = h.verifyAudit
+	}
+
+	for pattern, handler := range routes {
+		mux.Handle(pattern, wrap(auth.RequireAdmin(handler)))
+	}
+}
+
+// errorResponse 管理接口统一的错误响应
+type errorResponse struct {
+	Error   string       `json:"error"`
+	Details []fieldError `json:"details,omitempty"`
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to encode admin response: %v", err)
+	}
+}
+
+// writeError 写入 JSON 错误响应
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, errorResponse{Error: fmt.Sprintf(format, args...)})
+}
+
+// writeValidationError 写入字段校验失败的响应，列出全部错误字段
+func writeValidationError(w http.ResponseWriter, errs fieldErrors) {
+	writeJSON(w, http.StatusBadRequest, errorResponse{
+		Error:   "validation failed",
+		Details: errs,
+	})
+}
+
+// writeStoreError 将数据库错误映射为 HTTP 状态码，约束冲突返回 4xx，其余错误返回 500
+func writeStoreError(w http.ResponseWriter, action string, err error) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			writeError(w, http.StatusConflict, "%s: record already exists", action)
+			return
+		case "foreign_key_violation":
+			writeError(w, http.StatusConflict, "%s: referenced record does not exist or is still in use", action)
+			return
+		case "check_violation", "not_null_violation", "invalid_text_representation":
+			writeError(w, http.StatusBadRequest, "%s: %s", action, pqErr.Message)
+			return
+		}
+	}
+
+	logger.Error("Admin API failed to %s: %v", action, err)
+	writeError(w, http.StatusInternalServerError, "failed to %s", action)
+}
+
+// isUniqueViolation 错误是否由违反唯一约束引起
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// decodeBody 解析 JSON 请求体，拒绝未知字段
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return false
+	}
+	return true
+}
+
+// toolIDFromPath 解析路径中的工具 ID
+func toolIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	toolID, err := strconv.ParseInt(r.PathValue("tool_id"), 10, 64)
+	if err != nil || toolID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid tool id: %s", r.PathValue("tool_id"))
+		return 0, false
+	}
+	return toolID, true
+}
+
+// loadService 读取路径中的服务，不存在时写入 404 并返回 nil
+func (h *Handler) loadService(w http.ResponseWriter, r *http.Request) *models.MCPService {
+	serverID := r.PathValue("id")
+	service, err := h.store.GetServiceRecord(serverID)
+	if err != nil {
+		writeStoreError(w, "get service", err)
+		return nil
+	}
+	if service == nil {
+		writeError(w, http.StatusNotFound, "service %s not found", serverID)
+		return nil
+	}
+	return service
+}
@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"net/http"
+
+	"McpServer/internal/manager"
+)
+
+// Reloader 热重载服务配置
+type Reloader interface {
+	ReloadService(serverID string) manager.ReloadResult
+	ReloadAll() ([]manager.ReloadResult, error)
+}
+
+// reloadAll POST /admin/reload，重新加载所有服务
+func (h *Handler) reloadAll(w http.ResponseWriter, r *http.Request) {
+	results, err := h.reloader.ReloadAll()
+	if err != nil {
+		writeStoreError(w, "reload services", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// reloadService POST /admin/reload/{id}，重新加载指定服务
+func (h *Handler) reloadService(w http.ResponseWriter, r *http.Request) {
+	result := h.reloader.ReloadService(r.PathValue("id"))
+	status := http.StatusOK
+	if result.Error != "" {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"McpServer/internal/models"
+	"McpServer/internal/secrets"
+)
+
+// SecretManager 加密密钥存储，返回的记录不含明文
+type SecretManager interface {
+	Set(name, description, value string) (*models.Secret, error)
+	Rotate(name, value string) (*models.Secret, error)
+	Describe(name string) (*models.Secret, error)
+	List() ([]models.Secret, error)
+	Delete(name string) (bool, error)
+	Rekey() (int, error)
+}
+
+// SetSecrets 启用密钥管理端点，需在 Register 之前调用
+func (h *Handler) SetSecrets(manager SecretManager) {
+	h.secrets = manager
+}
+
+// secretRequest PUT /admin/secrets/{name} 的请求体
+type secretRequest struct {
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+// rotateRequest POST /admin/secrets/{name}/rotate 的请求体
+type rotateRequest struct {
+	Value string `json:"value"`
+}
+
+// listSecrets GET /admin/secrets，只返回元数据
+func (h *Handler) listSecrets(w http.ResponseWriter, r *http.Request) {
+	list, err := h.secrets.List()
+	if err != nil {
+		writeStoreError(w, "list secrets", err)
+		return
+	}
+	if list == nil {
+		list = []models.Secret{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getSecret GET /admin/secrets/{name}，只返回元数据
+func (h *Handler) getSecret(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	secret, err := h.secrets.Describe(name)
+	if err != nil {
+		writeStoreError(w, "get secret", err)
+		return
+	}
+	if secret == nil {
+		writeError(w, http.StatusNotFound, "secret %s not found", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// putSecret PUT /admin/secrets/{name}，创建或替换密钥
+func (h *Handler) putSecret(w http.ResponseWriter, r *http.Request) {
+	var req secretRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	name := r.PathValue("name")
+	var errs fieldErrors
+	if !secrets.ValidName(name) {
+		errs.add("name", "may only contain letters, digits, '_', '-' and '.' (max 128)")
+	}
+	if req.Value == "" {
+		errs.add("value", "is required")
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	secret, err := h.secrets.Set(name, req.Description, req.Value)
+	if err != nil {
+		writeStoreError(w, "set secret", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// rotateSecret POST /admin/secrets/{name}/rotate，替换已存在密钥的值，保留描述
+func (h *Handler) rotateSecret(w http.ResponseWriter, r *http.Request) {
+	var req rotateRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Value == "" {
+		var errs fieldErrors
+		errs.add("value", "is required")
+		writeValidationError(w, errs)
+		return
+	}
+
+	name := r.PathValue("name")
+	secret, err := h.secrets.Rotate(name, req.Value)
+	if errors.Is(err, secrets.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "secret %s not found", name)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, "rotate secret", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// deleteSecret DELETE /admin/secrets/{name}；仍被引用的密钥删除后，相关服务在下次连接时失败
+func (h *Handler) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	found, err := h.secrets.Delete(name)
+	if err != nil {
+		writeStoreError(w, "delete secret", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "secret %s not found", name)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rekeySecrets POST /admin/secrets/rekey，用当前主密钥重新加密旧主密钥加密的密钥
+func (h *Handler) rekeySecrets(w http.ResponseWriter, r *http.Request) {
+	count, err := h.secrets.Rekey()
+	if err != nil {
+		writeStoreError(w, "re-encrypt secrets", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"reencrypted": count})
+}
@@ -0,0 +1,345 @@
+package admin
+
+import (
+	"net/http"
+
+	"McpServer/internal/models"
+)
+
+// defaultProtocolVersion 未指定 protocol_version 时使用的协议版本
+const defaultProtocolVersion = "2025-03-26"
+
+// serviceRequest 创建或更新服务的请求体
+type serviceRequest struct {
+	ServerID           string       `json:"server_id"`
+	DisplayName        string       `json:"display_name"`
+	ImplementationName string       `json:"implementation_name"`
+	ProtocolVersion    string       `json:"protocol_version"`
+	Enabled            *bool        `json:"enabled"`
+	Metadata           models.JSONB `json:"metadata"`
+	Adapter            string       `json:"adapter"`
+	StartMode          string       `json:"start_mode"`
+}
+
+// toModel 转换为服务模型并填充默认值
+func (req *serviceRequest) toModel() *models.MCPService {
+	service := &models.MCPService{
+		ServerID:           req.ServerID,
+		DisplayName:        req.DisplayName,
+		ImplementationName: req.ImplementationName,
+		ProtocolVersion:    req.ProtocolVersion,
+		Enabled:            true,
+		Metadata:           req.Metadata,
+		Adapter:            req.Adapter,
+		StartMode:          req.StartMode,
+	}
+	if req.Enabled != nil {
+		service.Enabled = *req.Enabled
+	}
+	if service.ImplementationName == "" {
+		service.ImplementationName = service.ServerID
+	}
+	if service.ProtocolVersion == "" {
+		service.ProtocolVersion = defaultProtocolVersion
+	}
+	if service.Metadata == nil {
+		service.Metadata = models.JSONB{}
+	}
+	if service.Adapter == "" {
+		service.Adapter = AdapterBuiltin
+	}
+	if service.StartMode == "" {
+		service.StartMode = "on_demand"
+	}
+	return service
+}
+
+// toolRequest 创建或更新工具的请求体
+type toolRequest struct {
+	Name          string       `json:"name"`
+	Description   string       `json:"description"`
+	ArgsSchema    models.JSONB `json:"args_schema"`
+	OutputSchema  models.JSONB `json:"output_schema"`
+	Enabled       *bool        `json:"enabled"`
+	HandlerType   string       `json:"handler_type"`
+	HandlerConfig models.JSONB `json:"handler_config"`
+}
+
+// toModel 转换为工具模型并填充默认值
+func (req *toolRequest) toModel(serverID string) *models.MCPTool {
+	tool := &models.MCPTool{
+		ServerID:      serverID,
+		Name:          req.Name,
+		Description:   req.Description,
+		ArgsSchema:    req.ArgsSchema,
+		OutputSchema:  req.OutputSchema,
+		Enabled:       true,
+		HandlerType:   req.HandlerType,
+		HandlerConfig: req.HandlerConfig,
+	}
+	if req.Enabled != nil {
+		tool.Enabled = *req.Enabled
+	}
+	if tool.HandlerConfig == nil {
+		tool.HandlerConfig = models.JSONB{}
+	}
+	return tool
+}
+
+// listServices GET /admin/services
+func (h *Handler) listServices(w http.ResponseWriter, r *http.Request) {
+	services, err := h.store.ListServiceRecords()
+	if err != nil {
+		writeStoreError(w, "list services", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"services": services})
+}
+
+// createService POST /admin/services
+func (h *Handler) createService(w http.ResponseWriter, r *http.Request) {
+	var req serviceRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	service := req.toModel()
+	if errs := validateService(service); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	existing, err := h.store.GetServiceRecord(service.ServerID)
+	if err != nil {
+		writeStoreError(w, "create service", err)
+		return
+	}
+	if existing != nil {
+		writeError(w, http.StatusConflict, "service %s already exists", service.ServerID)
+		return
+	}
+
+	if err = h.store.CreateService(service); err != nil {
+		writeStoreError(w, "create service", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, service)
+}
+
+// getService GET /admin/services/{id}
+func (h *Handler) getService(w http.ResponseWriter, r *http.Request) {
+	if service := h.loadService(w, r); service != nil {
+		writeJSON(w, http.StatusOK, service)
+	}
+}
+
+// updateService PUT /admin/services/{id}，整体替换服务字段（server_id 不可修改）
+func (h *Handler) updateService(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	var req serviceRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.ServerID != "" && req.ServerID != serverID {
+		writeError(w, http.StatusBadRequest, "server_id in body (%s) does not match path (%s)", req.ServerID, serverID)
+		return
+	}
+	req.ServerID = serverID
+
+	service := req.toModel()
+	if errs := validateService(service); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	found, err := h.store.UpdateService(service)
+	if err != nil {
+		writeStoreError(w, "update service", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "service %s not found", serverID)
+		return
+	}
+	writeJSON(w, http.StatusOK, service)
+}
+
+// deleteService DELETE /admin/services/{id}，同时删除其工具和适配器配置
+func (h *Handler) deleteService(w http.ResponseWriter, r *http.Request) {
+	serverID := r.PathValue("id")
+
+	found, err := h.store.DeleteService(serverID)
+	if err != nil {
+		writeStoreError(w, "delete service", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "service %s not found", serverID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setServiceEnabled POST /admin/services/{id}/enable|disable
+func (h *Handler) setServiceEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serverID := r.PathValue("id")
+
+		found, err := h.store.SetServiceEnabled(serverID, enabled)
+		if err != nil {
+			writeStoreError(w, "update service", err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "service %s not found", serverID)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"server_id": serverID, "enabled": enabled})
+	}
+}
+
+// listTools GET /admin/services/{id}/tools
+func (h *Handler) listTools(w http.ResponseWriter, r *http.Request) {
+	service := h.loadService(w, r)
+	if service == nil {
+		return
+	}
+
+	tools, err := h.store.ListToolRecords(service.ServerID)
+	if err != nil {
+		writeStoreError(w, "list tools", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"server_id": service.ServerID, "tools": tools})
+}
+
+// createTool POST /admin/services/{id}/tools，只有内置服务可以定义工具，远程服务的工具由上游提供
+func (h *Handler) createTool(w http.ResponseWriter, r *http.Request) {
+	service := h.loadService(w, r)
+	if service == nil {
+		return
+	}
+	if service.Adapter != AdapterBuiltin {
+		writeError(w, http.StatusConflict, "tools can only be defined for builtin services, %s uses adapter %s", service.ServerID, service.Adapter)
+		return
+	}
+
+	var req toolRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	tool := req.toModel(service.ServerID)
+	if errs := validateTool(tool, h.registry); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	if err := h.store.CreateTool(tool); err != nil {
+		writeToolStoreError(w, "create tool", tool, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tool)
+}
+
+// getTool GET /admin/services/{id}/tools/{tool_id}
+func (h *Handler) getTool(w http.ResponseWriter, r *http.Request) {
+	toolID, ok := toolIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	serverID := r.PathValue("id")
+
+	tool, err := h.store.GetToolRecord(serverID, toolID)
+	if err != nil {
+		writeStoreError(w, "get tool", err)
+		return
+	}
+	if tool == nil {
+		writeError(w, http.StatusNotFound, "tool %d not found in service %s", toolID, serverID)
+		return
+	}
+	writeJSON(w, http.StatusOK, tool)
+}
+
+// updateTool PUT /admin/services/{id}/tools/{tool_id}，整体替换工具字段
+func (h *Handler) updateTool(w http.ResponseWriter, r *http.Request) {
+	toolID, ok := toolIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	serverID := r.PathValue("id")
+
+	var req toolRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	tool := req.toModel(serverID)
+	tool.ID = toolID
+	if errs := validateTool(tool, h.registry); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	found, err := h.store.UpdateTool(tool)
+	if err != nil {
+		writeToolStoreError(w, "update tool", tool, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "tool %d not found in service %s", toolID, serverID)
+		return
+	}
+	writeJSON(w, http.StatusOK, tool)
+}
+
+// deleteTool DELETE /admin/services/{id}/tools/{tool_id}
+func (h *Handler) deleteTool(w http.ResponseWriter, r *http.Request) {
+	toolID, ok := toolIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	serverID := r.PathValue("id")
+
+	found, err := h.store.DeleteTool(serverID, toolID)
+	if err != nil {
+		writeStoreError(w, "delete tool", err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "tool %d not found in service %s", toolID, serverID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setToolEnabled POST /admin/services/{id}/tools/{tool_id}/enable|disable
+func (h *Handler) setToolEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		toolID, ok := toolIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		serverID := r.PathValue("id")
+
+		found, err := h.store.SetToolEnabled(serverID, toolID, enabled)
+		if err != nil {
+			writeStoreError(w, "update tool", err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "tool %d not found in service %s", toolID, serverID)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"server_id": serverID, "id": toolID, "enabled": enabled})
+	}
+}
+
+// writeToolStoreError 写入工具的存储错误；同一服务下工具重名（违反 mcp_tool 的唯一约束）时写入 409
+func writeToolStoreError(w http.ResponseWriter, action string, tool *models.MCPTool, err error) {
+	if isUniqueViolation(err) {
+		writeError(w, http.StatusConflict, "tool %s already exists in service %s", tool.Name, tool.ServerID)
+		return
+	}
+	writeStoreError(w, action, err)
+}
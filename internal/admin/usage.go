@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"McpServer/internal/models"
+)
+
+// defaultUsageRange 未指定 from 时报表覆盖的时间范围
+const defaultUsageRange = 7 * 24 * time.Hour
+
+var (
+	validUsageBuckets = []string{"hour", "day", "week", "month"}
+	validUsageGroups  = []string{"key", "user", "caller", "server", "tool"}
+)
+
+// UsageReporter 工具调用用量报表
+type UsageReporter interface {
+	UsageReport(query models.UsageReportQuery) ([]models.UsageReportRow, error)
+}
+
+// SetUsage 启用用量报表端点，需在 Register 之前调用
+func (h *Handler) SetUsage(reporter UsageReporter) {
+	h.usage = reporter
+}
+
+// usageReport GET /admin/usage，按时间桶（UTC）和维度汇总工具调用。查询参数：
+// from、to（RFC 3339 或 YYYY-MM-DD，默认最近 7 天），bucket（hour、day、week、month，默认 day），
+// group_by（逗号分隔的 key、user、caller、server、tool），以及过滤条件 server_id、tool、key_id、user_id
+func (h *Handler) usageReport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var errs fieldErrors
+
+	query := models.UsageReportQuery{
+		To:       time.Now().UTC(),
+		Bucket:   "day",
+		ServerID: params.Get("server_id"),
+		ToolName: params.Get("tool"),
+		KeyID:    params.Get("key_id"),
+		UserID:   params.Get("user_id"),
+	}
+	if value := params.Get("to"); value != "" {
+		if to, ok := parseUsageTime(value); ok {
+			query.To = to
+		} else {
+			errs.add("to", "must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	query.From = query.To.Add(-defaultUsageRange)
+	if value := params.Get("from"); value != "" {
+		if from, ok := parseUsageTime(value); ok {
+			query.From = from
+		} else {
+			errs.add("from", "must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if !query.From.Before(query.To) {
+		errs.add("from", "must be before to")
+	}
+
+	if value := params.Get("bucket"); value != "" {
+		if !oneOf(value, validUsageBuckets) {
+			errs.add("bucket", "must be one of %s", strings.Join(validUsageBuckets, ", "))
+		}
+		query.Bucket = value
+	}
+	if value := params.Get("group_by"); value != "" {
+		seen := make(map[string]bool)
+		for _, group := range strings.Split(value, ",") {
+			group = strings.TrimSpace(group)
+			if !oneOf(group, validUsageGroups) {
+				errs.add("group_by", "must be a comma-separated list of %s", strings.Join(validUsageGroups, ", "))
+				break
+			}
+			if !seen[group] {
+				seen[group] = true
+				query.GroupBy = append(query.GroupBy, group)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	rows, err := h.usage.UsageReport(query)
+	if err != nil {
+		writeStoreError(w, "query usage", err)
+		return
+	}
+	if query.GroupBy == nil {
+		query.GroupBy = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from":     query.From,
+		"to":       query.To,
+		"bucket":   query.Bucket,
+		"group_by": query.GroupBy,
+		"rows":     rows,
+	})
+}
+
+// parseUsageTime 解析 RFC 3339 时间或 YYYY-MM-DD 日期（UTC 零点）
+func parseUsageTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,338 @@
+package admin
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"McpServer/internal/models"
+	"McpServer/internal/redact"
+	"McpServer/internal/schema"
+	"McpServer/internal/secrets"
+)
+
+// 适配器类型
+const (
+	AdapterBuiltin     = "builtin"
+	AdapterRemoteStdio = "remote_stdio"
+	AdapterRemoteSSE   = "remote_sse"
+)
+
+var (
+	// serverIDPattern server_id 会出现在 URL 路径中，只允许安全字符
+	serverIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,255}$`)
+	// toolNamePattern MCP 规范推荐的工具名字符集
+	toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+	validAdapters          = []string{AdapterBuiltin, AdapterRemoteStdio, AdapterRemoteSSE}
+	validStartModes        = []string{"auto", "on_demand"}
+	validReuseStrategies   = []string{"shared", "per_user", "per_session"}
+	validSSEAuthTypes      = []string{"none", "bearer_token", "api_key", "basic_auth", "custom_header", "oauth2_client_credentials"}
+	validClientAuthMethods = []string{"client_secret_basic", "client_secret_post"}
+
+	// headerNamePattern HTTP 头部名称（RFC 9110 token）
+	headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+	// envNamePattern 环境变量名称
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// fieldError 单个字段的校验错误
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrors 收集全部字段校验错误
+type fieldErrors []fieldError
+
+// add 添加一条字段错误
+func (e *fieldErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, fieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// oneOf 检查取值是否在允许列表中
+func oneOf(value string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRange 检查整数字段是否在 [min, max] 范围内，max 小于 0 表示无上限
+func (e *fieldErrors) checkRange(field string, value, min, max int) {
+	if value < min || (max >= 0 && value > max) {
+		if max < 0 {
+			e.add(field, "must be >= %d", min)
+		} else {
+			e.add(field, "must be between %d and %d", min, max)
+		}
+	}
+}
+
+// checkStringMap 检查 JSON 对象的所有值是否都是字符串
+func (e *fieldErrors) checkStringMap(field string, m models.JSONB) {
+	for key, value := range m {
+		if _, ok := value.(string); !ok {
+			e.add(field+"."+key, "must be a string")
+		}
+	}
+}
+
+// checkSecretRefs 检查 JSON 对象（包括嵌套的对象和数组）中 secret://name 引用的名称是否合法，且没有提交遮蔽后的值
+func (e *fieldErrors) checkSecretRefs(field string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if name, ok := secrets.ParseRef(v); ok && !secrets.ValidName(name) {
+			e.add(field, "invalid secret reference %q", v)
+		}
+		// GET 响应中被遮蔽的值原样提交回来会覆盖真实凭据
+		if v == redact.Mask {
+			e.add(field, "must be the actual value or a secret:// reference, not the masked value")
+		}
+	case models.JSONB:
+		e.checkSecretRefs(field, map[string]interface{}(v))
+	case map[string]interface{}:
+		for key, item := range v {
+			e.checkSecretRefs(field+"."+key, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			e.checkSecretRefs(fmt.Sprintf("%s[%d]", field, i), item)
+		}
+	}
+}
+
+// checkObjectSchema 检查 schema 能够转换为 draft 2020-12 且顶层类型为 object
+func (e *fieldErrors) checkObjectSchema(field string, raw models.JSONB) {
+	if raw == nil {
+		return
+	}
+	if schemaType, ok := raw["type"]; ok && schemaType != "object" {
+		e.add(field, "top-level type must be \"object\"")
+		return
+	}
+	if _, err := schema.FromMap(map[string]interface{}(raw)); err != nil {
+		e.add(field, "invalid JSON schema: %v", err)
+	}
+}
+
+// validateService 校验服务字段
+func validateService(service *models.MCPService) fieldErrors {
+	var errs fieldErrors
+
+	if !serverIDPattern.MatchString(service.ServerID) {
+		errs.add("server_id", "is required and may only contain letters, digits, '_', '-' and '.'")
+	}
+	if strings.TrimSpace(service.DisplayName) == "" {
+		errs.add("display_name", "is required")
+	}
+	if !oneOf(service.Adapter, validAdapters) {
+		errs.add("adapter", "must be one of %s", strings.Join(validAdapters, ", "))
+	}
+	if !oneOf(service.StartMode, validStartModes) {
+		errs.add("start_mode", "must be one of %s", strings.Join(validStartModes, ", "))
+	}
+
+	return errs
+}
+
+// validateTool 校验工具字段，registry 为 nil 时不检查 handler_type 是否已注册
+func validateTool(tool *models.MCPTool, registry HandlerRegistry) fieldErrors {
+	var errs fieldErrors
+
+	if !toolNamePattern.MatchString(tool.Name) {
+		errs.add("name", "is required and may only contain letters, digits, '_' and '-' (max 128)")
+	}
+	if tool.HandlerType == "" {
+		errs.add("handler_type", "is required")
+	} else if registry != nil && !registry.HasHandler(tool.HandlerType) {
+		errs.add("handler_type", "unknown handler type %q", tool.HandlerType)
+	}
+	errs.checkObjectSchema("args_schema", tool.ArgsSchema)
+	errs.checkObjectSchema("output_schema", tool.OutputSchema)
+
+	return errs
+}
+
+// validateStdioConfig 校验 stdio 配置，范围与 mcp_service_stdio 表的约束一致
+func validateStdioConfig(config *models.MCPServiceStdio) fieldErrors {
+	var errs fieldErrors
+
+	if strings.TrimSpace(config.Command) == "" {
+		errs.add("command", "is required")
+	}
+	for i, arg := range config.Args {
+		if strings.ContainsRune(arg, 0) {
+			errs.add(fmt.Sprintf("args[%d]", i), "must not contain NUL characters")
+		}
+	}
+	errs.checkStringMap("env", config.Env)
+	errs.checkSecretRefs("env", config.Env)
+	if !oneOf(config.ReuseStrategy, validReuseStrategies) {
+		errs.add("reuse_strategy", "must be one of %s", strings.Join(validReuseStrategies, ", "))
+	}
+	errs.checkRange("startup_timeout_ms", config.StartupTimeoutMs, 1, 300000)
+	errs.checkRange("shutdown_timeout_ms", config.ShutdownTimeoutMs, 1, 60000)
+	errs.checkRange("max_concurrent", config.MaxConcurrent, 0, 1000)
+	errs.checkRange("idle_ttl_ms", config.IdleTtlMs, 0, -1)
+	errs.checkRange("max_restarts", config.MaxRestarts, 0, 10)
+	validateCredentialPassthrough(&errs, AdapterRemoteStdio, config.ReuseStrategy, config.CredentialPassthrough)
+
+	return errs
+}
+
+// validateSSEConfig 校验 SSE 配置，包括各认证类型要求的 auth_config 字段
+func validateSSEConfig(config *models.MCPServiceSSE) fieldErrors {
+	var errs fieldErrors
+
+	if parsed, err := url.Parse(config.BaseURL); err != nil || parsed.Host == "" ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https") {
+		errs.add("base_url", "must be an absolute http or https URL")
+	}
+	if !strings.HasPrefix(config.SSEPath, "/") {
+		errs.add("sse_path", "must start with '/'")
+	}
+
+	if !oneOf(config.AuthType, validSSEAuthTypes) {
+		errs.add("auth_type", "must be one of %s", strings.Join(validSSEAuthTypes, ", "))
+	} else {
+		validateSSEAuthConfig(&errs, config.AuthType, config.AuthConfig)
+	}
+	errs.checkSecretRefs("auth_config", config.AuthConfig)
+
+	errs.checkRange("timeout_ms", config.TimeoutMs, 1, -1)
+	errs.checkRange("connect_timeout_ms", config.ConnectTimeoutMs, 1, -1)
+	errs.checkRange("retry_attempts", config.RetryAttempts, 0, -1)
+	errs.checkRange("retry_delay_ms", config.RetryDelayMs, 0, -1)
+	if config.HealthCheckEnabled {
+		errs.checkRange("health_check_interval_ms", config.HealthCheckIntervalMs, 1, -1)
+	}
+	if config.HealthCheckPath != nil && !strings.HasPrefix(*config.HealthCheckPath, "/") {
+		errs.add("health_check_path", "must start with '/'")
+	}
+	errs.checkStringMap("headers", config.Headers)
+	errs.checkSecretRefs("headers", config.Headers)
+	errs.checkStringMap("query_params", config.QueryParams)
+	errs.checkRange("connection_pool_size", config.ConnectionPoolSize, 1, -1)
+	errs.checkRange("max_redirects", config.MaxRedirects, 0, -1)
+	validateCredentialPassthrough(&errs, AdapterRemoteSSE, "", config.CredentialPassthrough)
+
+	return errs
+}
+
+// validateSSEAuthConfig 按认证类型校验 auth_config 的必填字段
+func validateSSEAuthConfig(errs *fieldErrors, authType string, authConfig models.JSONB) {
+	requireString := func(key string) {
+		if value, _ := authConfig[key].(string); value == "" {
+			errs.add("auth_config."+key, "is required for auth_type %s", authType)
+		}
+	}
+
+	switch authType {
+	case "bearer_token":
+		requireString("token")
+	case "api_key":
+		requireString("key")
+		if header, exists := authConfig["header"]; exists {
+			if value, ok := header.(string); !ok || value == "" {
+				errs.add("auth_config.header", "must be a non-empty string")
+			}
+		}
+	case "basic_auth":
+		requireString("username")
+		requireString("password")
+	case "custom_header":
+		if len(authConfig) == 0 {
+			errs.add("auth_config", "must contain at least one header for auth_type custom_header")
+		}
+		errs.checkStringMap("auth_config", authConfig)
+	case "oauth2_client_credentials":
+		requireString("token_url")
+		requireString("client_id")
+		requireString("client_secret")
+		if tokenURL, ok := authConfig["token_url"].(string); ok && tokenURL != "" {
+			if parsed, err := url.Parse(tokenURL); err != nil || parsed.Host == "" ||
+				(parsed.Scheme != "http" && parsed.Scheme != "https") {
+				errs.add("auth_config.token_url", "must be an absolute http or https URL")
+			}
+		}
+		if scope, exists := authConfig["scope"]; exists {
+			switch v := scope.(type) {
+			case string:
+			case []interface{}:
+				for _, item := range v {
+					if _, ok := item.(string); !ok {
+						errs.add("auth_config.scope", "must be a string or an array of strings")
+						break
+					}
+				}
+			default:
+				errs.add("auth_config.scope", "must be a string or an array of strings")
+			}
+		}
+		if method, exists := authConfig["client_auth_method"]; exists {
+			if value, ok := method.(string); !ok || !oneOf(value, validClientAuthMethods) {
+				errs.add("auth_config.client_auth_method", "must be one of %s", strings.Join(validClientAuthMethods, ", "))
+			}
+		}
+	}
+}
+
+// validateCredentialPassthrough 校验 credential_passthrough：SSE 服务将凭证注入请求头，
+// stdio 服务只能在 per_user 进程启动时注入环境变量
+func validateCredentialPassthrough(errs *fieldErrors, adapter, reuseStrategy string, raw models.JSONB) {
+	passthrough, err := models.ParseCredentialPassthrough(raw)
+	if err != nil {
+		errs.add("credential_passthrough", "invalid: %v", err)
+		return
+	}
+	if passthrough == nil {
+		return
+	}
+
+	if adapter == AdapterRemoteStdio {
+		if len(passthrough.ForwardHeaders) > 0 {
+			errs.add("credential_passthrough.forward_headers", "is only supported for %s services", AdapterRemoteSSE)
+		}
+		if len(passthrough.ForwardClaims) > 0 {
+			errs.add("credential_passthrough.forward_claims", "is only supported for %s services", AdapterRemoteSSE)
+		}
+		if injection := passthrough.UserCredential; injection != nil {
+			if reuseStrategy != "per_user" {
+				errs.add("credential_passthrough.user_credential", "requires reuse_strategy per_user")
+			}
+			if !envNamePattern.MatchString(injection.Env) {
+				errs.add("credential_passthrough.user_credential.env", "must be a valid environment variable name")
+			}
+			if injection.Header != "" || injection.Prefix != "" {
+				errs.add("credential_passthrough.user_credential.header", "is only supported for %s services", AdapterRemoteSSE)
+			}
+		}
+		return
+	}
+
+	for from, to := range passthrough.ForwardHeaders {
+		if !headerNamePattern.MatchString(from) || !headerNamePattern.MatchString(to) {
+			errs.add("credential_passthrough.forward_headers."+from, "must map a header name to a header name")
+		}
+	}
+	for claim, header := range passthrough.ForwardClaims {
+		if claim == "" || !headerNamePattern.MatchString(header) {
+			errs.add("credential_passthrough.forward_claims."+claim, "must map a claim name to a header name")
+		}
+	}
+	if injection := passthrough.UserCredential; injection != nil {
+		if !headerNamePattern.MatchString(injection.Header) {
+			errs.add("credential_passthrough.user_credential.header", "must be a valid header name")
+		}
+		if injection.Env != "" {
+			errs.add("credential_passthrough.user_credential.env", "is only supported for %s services", AdapterRemoteStdio)
+		}
+		if strings.ContainsAny(injection.Prefix, "\r\n") {
+			errs.add("credential_passthrough.user_credential.prefix", "must not contain line breaks")
+		}
+	}
+}
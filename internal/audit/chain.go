@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"McpServer/internal/models"
+)
+
+// verifyPageSize 校验时每次读取的记录数
+const verifyPageSize = 1000
+
+// VerifyResult 哈希链校验结果；Valid 为 false 时 BrokenID 为第一条校验失败的记录。
+// 链只能发现对已有记录的修改和删除，截断末尾的记录需要与外部保存的 LastID、LastHash 比对
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	LastID   int64  `json:"last_id,omitempty"`
+	LastHash string `json:"last_hash,omitempty"`
+	BrokenID int64  `json:"broken_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// hashInput 参与哈希的字段；encoding/json 按字段顺序输出结构体、按键排序输出 map，
+// 参数和详情从数据库读回后仍得到相同的 JSON
+type hashInput struct {
+	PrevHash      string       `json:"prev_hash"`
+	OccurredAt    string       `json:"occurred_at"`
+	EventType     string       `json:"event_type"`
+	Actor         string       `json:"actor"`
+	UserID        string       `json:"user_id"`
+	KeyID         string       `json:"key_id"`
+	Action        string       `json:"action"`
+	ServerID      string       `json:"server_id"`
+	ToolName      string       `json:"tool_name"`
+	Target        string       `json:"target"`
+	ArgumentsHash string       `json:"arguments_hash"`
+	Arguments     models.JSONB `json:"arguments"`
+	Status        string       `json:"status"`
+	Details       models.JSONB `json:"details"`
+}
+
+// Hash 计算记录的哈希：SHA-256(prev_hash 与全部字段的 JSON)，不含 id 和 hash 本身
+func Hash(entry *models.AuditEntry) string {
+	data, _ := json.Marshal(hashInput{
+		PrevHash:      entry.PrevHash,
+		OccurredAt:    entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		EventType:     entry.EventType,
+		Actor:         entry.Actor,
+		UserID:        entry.UserID,
+		KeyID:         entry.KeyID,
+		Action:        entry.Action,
+		ServerID:      entry.ServerID,
+		ToolName:      entry.ToolName,
+		Target:        entry.Target,
+		ArgumentsHash: entry.ArgumentsHash,
+		Arguments:     entry.Arguments,
+		Status:        entry.Status,
+		Details:       entry.Details,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify 按 id 顺序读取全部审计记录，检查每条记录的 prev_hash 与上一条的 hash 一致、hash 与内容一致
+func Verify(store Store) (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+	var afterID int64
+	for {
+		entries, err := store.ListAuditEntriesAfter(afterID, verifyPageSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if entry.PrevHash != result.LastHash {
+				return broken(result, entry.ID, "prev_hash does not match the hash of the previous entry"), nil
+			}
+			if Hash(entry) != entry.Hash {
+				return broken(result, entry.ID, "hash does not match the entry contents"), nil
+			}
+			result.Entries++
+			result.LastID = entry.ID
+			result.LastHash = entry.Hash
+		}
+		if len(entries) < verifyPageSize {
+			return result, nil
+		}
+		afterID = result.LastID
+	}
+}
+
+func broken(result VerifyResult, id int64, reason string) VerifyResult {
+	result.Valid = false
+	result.BrokenID = id
+	result.Reason = reason
+	return result
+}
@@ -0,0 +1,307 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/models"
+)
+
+// memoryStore 模拟 audit_log 表：写入时链接哈希，读回的记录与从 PostgreSQL 读回的一致——
+// jsonb 重新排列键并改变空白，timestamptz 只保存到微秒并按会话时区返回
+type memoryStore struct {
+	mutex   sync.Mutex
+	entries []models.AuditEntry
+	down    bool
+}
+
+func (s *memoryStore) AppendAuditEntries(entries []models.AuditEntry, hash func(entry *models.AuditEntry) string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.down {
+		return errors.New("connection refused")
+	}
+	prevHash := ""
+	if len(s.entries) > 0 {
+		prevHash = s.entries[len(s.entries)-1].Hash
+	}
+	for _, entry := range entries {
+		entry.PrevHash = prevHash
+		entry.Hash = hash(&entry)
+		prevHash = entry.Hash
+
+		entry.ID = int64(len(s.entries) + 1)
+		entry.OccurredAt = entry.OccurredAt.Truncate(time.Microsecond).In(time.FixedZone("CST", 8*3600))
+		entry.Arguments = jsonbRoundTrip(entry.Arguments)
+		entry.Details = jsonbRoundTrip(entry.Details)
+		s.entries = append(s.entries, entry)
+	}
+	return nil
+}
+
+func (s *memoryStore) ListAuditEntries(query models.AuditQuery) ([]models.AuditEntry, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) ListAuditEntriesAfter(afterID int64, limit int) ([]models.AuditEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var page []models.AuditEntry
+	for _, entry := range s.entries {
+		if entry.ID > afterID && len(page) < limit {
+			page = append(page, entry)
+		}
+	}
+	return page, nil
+}
+
+// jsonbRoundTrip 按 JSONB.Value 写入，以 jsonb 的输出格式（键按长度再按字节排序，", " 和 ": " 分隔）经 Scan 读回
+func jsonbRoundTrip(value models.JSONB) models.JSONB {
+	data, err := value.Value()
+	if err != nil || data == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data.([]byte)))
+	decoder.UseNumber()
+	var parsed interface{}
+	if err := decoder.Decode(&parsed); err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	writeJSONB(&buf, parsed)
+
+	var out models.JSONB
+	if err := out.Scan(buf.String()); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func writeJSONB(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		buf.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteString(": ")
+			writeJSONB(buf, v[key])
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeJSONB(buf, item)
+		}
+		buf.WriteString("]")
+	case string:
+		// jsonb 不转义 HTML 字符
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(v)
+		buf.Truncate(buf.Len() - 1)
+	default:
+		data, _ := json.Marshal(v)
+		buf.Write(data)
+	}
+}
+
+func newTestRecorder(t *testing.T, store Store, maxBuffer int) *Recorder {
+	t.Helper()
+	r, err := NewRecorder(&config.AuditConfig{
+		Arguments:     ArgumentsRedacted,
+		RedactKeys:    []string{"token"},
+		FlushInterval: time.Hour,
+		BatchSize:     1000,
+		MaxBuffer:     maxBuffer,
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func toolCall(tool string, details models.JSONB) models.AuditEntry {
+	return models.AuditEntry{
+		OccurredAt: time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC),
+		EventType:  models.AuditEventToolCall,
+		Actor:      "key:1",
+		KeyID:      "1",
+		Action:     "tools/call",
+		ServerID:   "srv",
+		ToolName:   tool,
+		Status:     "success",
+		Details:    details,
+	}
+}
+
+func TestHashVerifyRoundTripThroughJSONB(t *testing.T) {
+	store := &memoryStore{}
+	r := newTestRecorder(t, store, 100)
+
+	r.Record(toolCall("search", models.JSONB{"duration_ms": 12}), json.RawMessage(`{"query":"a < b & c > d","limit":10,"token":"x"}`))
+	r.Record(toolCall("nested", models.JSONB{"duration_ms": int64(1) << 40, "error": "失败: \"quoted\""}),
+		json.RawMessage(`{"b":{"zz":[1,2.5,{"y":null,"x":true}],"a":"é"},"aa":-0.000001,"big":12345678901234567890}`))
+	r.Record(toolCall("empty", nil), json.RawMessage(`{}`))
+	r.Record(models.AuditEntry{
+		EventType: models.AuditEventAdmin,
+		Actor:     "admin",
+		Action:    "PUT /admin/services/{id}",
+		ServerID:  "srv",
+		Target:    "/admin/services/srv",
+		Status:    "200",
+		Details:   models.JSONB{"remote_addr": "127.0.0.1:1234", "id": "srv"},
+	}, json.RawMessage(`{"name":"x"}`))
+	r.flush()
+
+	result, err := Verify(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Entries != 4 {
+		t.Fatalf("Verify() = %+v, want 4 valid entries", result)
+	}
+	if result.LastHash != store.entries[3].Hash {
+		t.Errorf("LastHash = %s, want %s", result.LastHash, store.entries[3].Hash)
+	}
+	if got := store.entries[0].Arguments["token"]; got != redactedValue {
+		t.Errorf("token argument = %v, want %s", got, redactedValue)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(entries []models.AuditEntry) []models.AuditEntry
+		brokenID int64
+	}{
+		{
+			name: "modified details",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[1].Details = models.JSONB{"duration_ms": float64(99)}
+				return entries
+			},
+			brokenID: 2,
+		},
+		{
+			name: "modified status",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[2].Status = "error"
+				return entries
+			},
+			brokenID: 3,
+		},
+		{
+			name: "modified timestamp",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[0].OccurredAt = entries[0].OccurredAt.Add(time.Microsecond)
+				return entries
+			},
+			brokenID: 1,
+		},
+		{
+			name: "deleted entry",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				return append(entries[:1], entries[2:]...)
+			},
+			brokenID: 3,
+		},
+		{
+			name: "rehashed entry",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[1].Status = "error"
+				entries[1].Hash = Hash(&entries[1])
+				return entries
+			},
+			brokenID: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{}
+			r := newTestRecorder(t, store, 100)
+			for i := 0; i < 3; i++ {
+				r.Record(toolCall(fmt.Sprintf("tool%d", i), models.JSONB{"duration_ms": i}), json.RawMessage(`{"n":1}`))
+			}
+			r.flush()
+
+			store.entries = tt.tamper(store.entries)
+			result, err := Verify(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.BrokenID != tt.brokenID {
+				t.Fatalf("Verify() = %+v, want broken at %d", result, tt.brokenID)
+			}
+		})
+	}
+}
+
+func TestRecorderRejectsWhenBufferFull(t *testing.T) {
+	store := &memoryStore{down: true}
+	r := newTestRecorder(t, store, 3)
+
+	for i := 0; i < 3; i++ {
+		if err := r.Ready(); err != nil {
+			t.Fatalf("Ready() with %d buffered entries = %v, want nil", i, err)
+		}
+		r.Record(toolCall(fmt.Sprintf("tool%d", i), nil), nil)
+		r.flush()
+	}
+	if err := r.Ready(); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("Ready() with a full buffer = %v, want ErrBufferFull", err)
+	}
+
+	// 已接受的操作的记录照常保存，不丢弃任何记录
+	r.Record(toolCall("admitted", nil), nil)
+	r.flush()
+	if len(r.buffer) != 4 {
+		t.Fatalf("buffered %d entries, want 4", len(r.buffer))
+	}
+
+	store.mutex.Lock()
+	store.down = false
+	store.mutex.Unlock()
+	r.flush()
+	if err := r.Ready(); err != nil {
+		t.Fatalf("Ready() after the buffer was written = %v, want nil", err)
+	}
+
+	result, err := Verify(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Entries != 4 {
+		t.Fatalf("Verify() = %+v, want 4 valid entries", result)
+	}
+	for i, want := range []string{"tool0", "tool1", "tool2", "admitted"} {
+		if got := store.entries[i].ToolName; got != want {
+			t.Errorf("entry %d tool = %s, want %s", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// 工具参数的记录方式
+const (
+	ArgumentsHash     = "hash"     // 只记录参数的 SHA-256
+	ArgumentsRedacted = "redacted" // 同时记录遮蔽敏感字段后的参数
+)
+
+// redactedValue 遮蔽后的参数值
+const redactedValue = "[REDACTED]"
+
+// ErrBufferFull 数据库不可用，缓冲中等待写入的记录达到 max_buffer
+var ErrBufferFull = errors.New("audit log buffer is full")
+
+// Store 审计日志所需的数据库操作
+type Store interface {
+	// AppendAuditEntries 在一个事务中串行追加记录：依次将 PrevHash 设为上一条记录的 hash，再以 hash 计算本条的 Hash
+	AppendAuditEntries(entries []models.AuditEntry, hash func(entry *models.AuditEntry) string) error
+	ListAuditEntries(query models.AuditQuery) ([]models.AuditEntry, error)
+	ListAuditEntriesAfter(afterID int64, limit int) ([]models.AuditEntry, error)
+}
+
+// Redactor 按规则遮蔽敏感数据（由 redact.Redactor 实现）
+type Redactor interface {
+	Value(value interface{}) interface{}
+	String(s string) string
+}
+
+// Recorder 审计日志记录器：记录在内存中缓冲，按批追加到 audit_log 并在写入时链接哈希，
+// 多个实例共用一条链（写入时持有数据库咨询锁）。缓冲中的记录从不丢弃：达到 max_buffer 后 Ready 返回
+// ErrBufferFull，调用方据此拒绝新的工具调用和管理操作，直到数据库恢复、缓冲写入
+type Recorder struct {
+	store         Store
+	redact        bool
+	redactKeys    []string
+	redactor      Redactor // nil 表示只按 redact_keys 遮蔽
+	flushInterval time.Duration
+	batchSize     int
+	maxBuffer     int
+
+	mutex  sync.Mutex
+	buffer []models.AuditEntry
+
+	flushSignal chan struct{}
+	stopChan    chan struct{}
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewRecorder 校验配置、创建记录器并启动后台写入
+func NewRecorder(cfg *config.AuditConfig, store Store) (*Recorder, error) {
+	if cfg.Arguments != ArgumentsHash && cfg.Arguments != ArgumentsRedacted {
+		return nil, fmt.Errorf("audit.arguments must be %s or %s", ArgumentsHash, ArgumentsRedacted)
+	}
+	r := &Recorder{
+		store:         store,
+		redact:        cfg.Arguments == ArgumentsRedacted,
+		flushInterval: cfg.FlushInterval,
+		batchSize:     cfg.BatchSize,
+		maxBuffer:     cfg.MaxBuffer,
+		flushSignal:   make(chan struct{}, 1),
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, key := range cfg.RedactKeys {
+		r.redactKeys = append(r.redactKeys, strings.ToLower(key))
+	}
+	go r.run()
+	return r, nil
+}
+
+// SetRedactor 设置遮蔽规则，应用于保存的参数、详情和操作对象
+func (r *Recorder) SetRedactor(redactor Redactor) {
+	r.redactor = redactor
+}
+
+// Ready 缓冲达到 max_buffer 时返回 ErrBufferFull。需在执行被审计的操作之前检查，
+// 已经执行的操作的记录由 Record 照常保存
+func (r *Recorder) Ready() error {
+	r.mutex.Lock()
+	buffered := len(r.buffer)
+	r.mutex.Unlock()
+	if buffered >= r.maxBuffer {
+		return fmt.Errorf("%w: %d entries waiting to be written", ErrBufferFull, buffered)
+	}
+	return nil
+}
+
+// Record 记录一条审计事件。arguments 为工具参数或管理请求体，只保存其 SHA-256；
+// 工具调用在 redacted 模式下另外保存遮蔽后的参数，管理请求体（可能包含密钥明文）从不保存
+func (r *Recorder) Record(entry models.AuditEntry, arguments json.RawMessage) {
+	if entry.OccurredAt.IsZero() {
+		entry.OccurredAt = time.Now()
+	}
+	// 数据库只保存到微秒，截断后读回的记录哈希不变
+	entry.OccurredAt = entry.OccurredAt.UTC().Truncate(time.Microsecond)
+
+	if len(arguments) > 0 {
+		sum := sha256.Sum256(arguments)
+		entry.ArgumentsHash = hex.EncodeToString(sum[:])
+		if r.redact && entry.EventType == models.AuditEventToolCall {
+			entry.Arguments = r.redactArguments(arguments)
+		}
+	}
+	if r.redactor != nil {
+		entry.Target = r.redactor.String(entry.Target)
+		entry.Arguments = r.redactJSONB(entry.Arguments)
+		entry.Details = r.redactJSONB(entry.Details)
+	}
+
+	r.mutex.Lock()
+	r.buffer = append(r.buffer, entry)
+	full := len(r.buffer) >= r.batchSize
+	r.mutex.Unlock()
+
+	if full {
+		select {
+		case r.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// List 查询审计记录
+func (r *Recorder) List(query models.AuditQuery) ([]models.AuditEntry, error) {
+	return r.store.ListAuditEntries(query)
+}
+
+// Verify 校验数据库中的哈希链，不包括缓冲中尚未写入的记录
+func (r *Recorder) Verify() (VerifyResult, error) {
+	return Verify(r.store)
+}
+
+// Close 停止后台任务并写入缓冲中剩余的记录
+func (r *Recorder) Close() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.flushSignal:
+			r.flush()
+		case <-r.stopChan:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush 追加缓冲中的记录；失败时放回缓冲，下次重试
+func (r *Recorder) flush() {
+	r.mutex.Lock()
+	batch := r.buffer
+	r.buffer = nil
+	r.mutex.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := r.store.AppendAuditEntries(batch, Hash); err != nil {
+		r.mutex.Lock()
+		r.buffer = append(batch, r.buffer...)
+		buffered := len(r.buffer)
+		r.mutex.Unlock()
+		if buffered >= r.maxBuffer {
+			logger.Error("Failed to append %d audit entries, buffer is full and audited operations are rejected until it is written: %v", buffered, err)
+		} else {
+			logger.Warn("Failed to append %d audit entries, will retry: %v", len(batch), err)
+		}
+	}
+}
+
+// redactArguments 解析参数并遮蔽名称包含 redact_keys 任一项的字段；参数不是 JSON 对象，
+// 或包含数据库 jsonb 不接受的 \u0000 时不保存
+func (r *Recorder) redactArguments(arguments json.RawMessage) models.JSONB {
+	if bytes.Contains(arguments, []byte(`\u0000`)) {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(arguments, &values); err != nil {
+		return nil
+	}
+	return models.JSONB(r.redactValue(values).(map[string]interface{}))
+}
+
+func (r *Recorder) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if r.sensitive(key) {
+				v[key] = redactedValue
+			} else {
+				v[key] = r.redactValue(item)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// redactJSONB 按遮蔽规则处理 JSONB 字段
+func (r *Recorder) redactJSONB(value models.JSONB) models.JSONB {
+	if value == nil {
+		return nil
+	}
+	redacted, ok := r.redactor.Value(map[string]interface{}(value)).(map[string]interface{})
+	if !ok {
+		return value
+	}
+	return models.JSONB(redacted)
+}
+
+// sensitive 参数名是否包含 redact_keys 中的任一项（不区分大小写）
+func (r *Recorder) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, redactKey := range r.redactKeys {
+		if strings.Contains(key, redactKey) {
+			return true
+		}
+	}
+	return false
+}
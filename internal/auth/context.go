@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 认证用户的来源
+const (
+	SourceStatic   = "static"   // 配置文件中的 auth.api_keys
+	SourceDatabase = "database" // user_keys 表
+)
+
+// User 通过认证的调用方信息，由认证中间件放入请求上下文
+type User struct {
+	UserID      string          `json:"user_id,omitempty"`
+	Username    string          `json:"username,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	KeyID       string          `json:"key_id,omitempty"`
+	KeyName     string          `json:"key_name,omitempty"`
+	Permissions json.RawMessage `json:"permissions,omitempty"`
+	Groups      []string        `json:"groups,omitempty"` // JWT 用户组
+	Scopes      []string        `json:"scopes,omitempty"` // JWT 权限范围
+	Source      string          `json:"source"`
+
+	claims   map[string]interface{} // JWT 或内省结果的原始声明
+	access   *Permissions           // 解析后的 Permissions，nil 表示不限制
+	identity string                 // 没有密钥 ID 和用户 ID 时的调用方标识（静态密钥指纹）
+	admin    bool                   // auth.admin_keys 中的静态密钥，或持有 admin_scopes/admin_groups 的 JWT/OAuth 用户
+}
+
+type userContextKey struct{}
+
+// WithUser 返回携带认证用户的上下文
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext 从上下文中获取认证用户，未认证（或认证未启用）时返回 nil, false
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// Identity 调用方标识，用于按调用方限流：数据库密钥按密钥 ID，JWT/OAuth 用户按用户 ID，
+// 静态密钥按密钥指纹；user 为 nil（认证未启用）时为 anonymous
+func (u *User) Identity() string {
+	switch {
+	case u == nil:
+		return "anonymous"
+	case u.KeyID != "":
+		return "key:" + u.KeyID
+	case u.UserID != "":
+		return "user:" + u.UserID
+	case u.identity != "":
+		return u.identity
+	}
+	return "anonymous"
+}
+
+// Claim 返回声明的字符串形式：JWT/OAuth 用户读取令牌声明，sub、username、name 对所有用户可用。
+// 数组以逗号连接，其他非字符串值按 JSON 编码
+func (u *User) Claim(name string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	if value, ok := u.claims[name]; ok {
+		switch v := value.(type) {
+		case string:
+			return v, v != ""
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			return strings.Join(items, ","), len(items) > 0
+		case nil:
+			return "", false
+		default:
+			data, err := json.Marshal(v)
+			return string(data), err == nil
+		}
+	}
+
+	switch name {
+	case "sub", "user_id":
+		return u.UserID, u.UserID != ""
+	case "username", "preferred_username":
+		return u.Username, u.Username != ""
+	case "name":
+		return u.Name, u.Name != ""
+	}
+	return "", false
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+)
+
+// SourceOAuth 通过令牌内省认证的用户来源
+const SourceOAuth = "oauth"
+
+// introspectionEntry 缓存的内省结果，user 为 nil 表示令牌无效
+type introspectionEntry struct {
+	user      *User
+	reason    string
+	expiresAt time.Time
+}
+
+// introspector 通过授权服务器的内省端点（RFC 7662）校验不透明访问令牌
+type introspector struct {
+	config      *config.OAuthConfig
+	audience    []string
+	mapper      *claimMapper
+	client      *http.Client
+	negativeTTL time.Duration
+
+	mutex sync.Mutex
+	cache map[string]introspectionEntry // 令牌哈希 -> 结果
+}
+
+// newIntrospector 创建内省校验器，声明映射沿用 auth.jwt 的配置
+func newIntrospector(authConfig *config.AuthConfig) (*introspector, error) {
+	mapper, err := newClaimMapper(&authConfig.JWT)
+	if err != nil {
+		return nil, err
+	}
+	return &introspector{
+		config:      &authConfig.OAuth,
+		audience:    authConfig.JWT.Audience,
+		mapper:      mapper,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		negativeTTL: authConfig.NegativeCacheTTL,
+		cache:       make(map[string]introspectionEntry),
+	}, nil
+}
+
+// Verify 校验令牌，结果按 introspection_cache_ttl 缓存（不超过令牌的 exp）
+func (in *introspector) Verify(token string) (*User, error) {
+	hash := hashKey(token)
+	now := time.Now()
+
+	in.mutex.Lock()
+	entry, ok := in.cache[hash]
+	in.mutex.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		if entry.user == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, entry.reason)
+		}
+		return entry.user, nil
+	}
+
+	claims, err := in.introspect(token)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = introspectionEntry{expiresAt: now.Add(in.negativeTTL)}
+	if active, _ := claims["active"].(bool); !active {
+		entry.reason = "token is not active"
+	} else if exp, ok := numericClaim(claims, "exp"); ok && !now.Before(exp) {
+		entry.reason = "token expired"
+	} else if err = checkAudience(claims, in.audience); err != nil {
+		entry.reason = "token audience not accepted"
+	} else {
+		entry.user = in.mapper.userFromClaims(claims, SourceOAuth)
+		if entry.user.Username == "" {
+			entry.user.Username, _ = claims["username"].(string)
+		}
+		entry.expiresAt = now.Add(in.config.IntrospectionCacheTTL)
+		if ok && exp.Before(entry.expiresAt) {
+			entry.expiresAt = exp
+		}
+	}
+
+	in.mutex.Lock()
+	if len(in.cache) >= maxCachedKeys {
+		for h, e := range in.cache {
+			if now.After(e.expiresAt) {
+				delete(in.cache, h)
+			}
+		}
+		if len(in.cache) >= maxCachedKeys {
+			in.cache = make(map[string]introspectionEntry)
+		}
+	}
+	in.cache[hash] = entry
+	in.mutex.Unlock()
+
+	if entry.user == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, entry.reason)
+	}
+	return entry.user, nil
+}
+
+// introspect 调用内省端点，使用 client_id/client_secret 进行客户端认证
+func (in *introspector) introspect(token string) (map[string]interface{}, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequest(http.MethodPost, in.config.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.config.ClientID), url.QueryEscape(in.config.ClientSecret))
+	}
+
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("Token introspection returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return nil, fmt.Errorf("token introspection failed: status %d", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,351 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+)
+
+// jwksForcedRefreshInterval 遇到未知 kid 时强制刷新 JWKS 的最小间隔，防止伪造 kid 的请求打满上游
+const jwksForcedRefreshInterval = time.Minute
+
+// JWKS 获取失败后的重试间隔：从 jwksRetryDelay 开始每次失败翻倍，不超过 jwksMaxRetryDelay
+const (
+	jwksRetryDelay    = 5 * time.Second
+	jwksMaxRetryDelay = 5 * time.Minute
+)
+
+// verificationKey 一个验签密钥
+type verificationKey struct {
+	kid string
+	alg string      // JWK 声明的算法，可为空
+	key interface{} // *rsa.PublicKey、*ecdsa.PublicKey 或 HMAC 密钥 []byte
+}
+
+// keySet 验签密钥集合：静态密钥（PEM 公钥、HMAC 密钥）以及按需刷新的 JWKS
+type keySet struct {
+	static          []verificationKey
+	jwksURL         string
+	jwksFile        string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mutex        sync.RWMutex
+	jwks         []verificationKey
+	loaded       bool      // 是否成功获取过 JWKS
+	fetchedAt    time.Time // 最近一次成功获取的时间
+	attemptedAt  time.Time // 最近一次尝试获取的时间，无论成功与否
+	failures     int       // 连续失败次数
+	forcedAt     time.Time
+	refreshMutex sync.Mutex
+}
+
+// newKeySet 加载静态密钥并首次获取 JWKS；JWKS URL 暂时不可用时只记录警告，之后按需重试
+func newKeySet(cfg *config.JWTConfig) (*keySet, error) {
+	ks := &keySet{
+		jwksURL:         cfg.JWKSURL,
+		jwksFile:        cfg.JWKSFile,
+		refreshInterval: cfg.JWKSRefreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, file := range cfg.PublicKeyFiles {
+		key, err := loadPEMPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		ks.static = append(ks.static, verificationKey{key: key})
+	}
+	if cfg.HMACSecret != "" {
+		ks.static = append(ks.static, verificationKey{key: []byte(cfg.HMACSecret)})
+	}
+
+	if ks.jwksURL != "" || ks.jwksFile != "" {
+		if err := ks.refresh(); err != nil {
+			if ks.jwksURL == "" {
+				return nil, err
+			}
+			logger.Warn("Failed to fetch JWKS from %s, will retry on demand: %v", ks.jwksURL, err)
+		}
+	}
+
+	if len(ks.static) == 0 && ks.jwksURL == "" && ks.jwksFile == "" {
+		return nil, fmt.Errorf("no JWT verification keys configured (jwks_url, jwks_file, public_key_files or hmac_secret)")
+	}
+	return ks, nil
+}
+
+// candidates 返回可能用于验证该 kid 的密钥；JWKS 过期时在后台刷新，期间继续使用上次获取的密钥；
+// kid 未知时限频强制刷新。获取失败后按退避间隔重试，不会让每个请求都等待一次获取
+func (ks *keySet) candidates(kid string) []verificationKey {
+	if ks.jwksURL != "" || ks.jwksFile != "" {
+		ks.mutex.RLock()
+		stale := time.Since(ks.fetchedAt) > ks.refreshInterval
+		retryDue := time.Since(ks.attemptedAt) >= jwksBackoff(ks.failures)
+		found := kid == "" || hasKid(ks.jwks, kid)
+		loaded := ks.loaded
+		canForce := time.Since(ks.forcedAt) > jwksForcedRefreshInterval
+		ks.mutex.RUnlock()
+
+		switch {
+		case !retryDue:
+		case stale && loaded && found:
+			go ks.tryRefresh()
+		case stale || (!found && canForce):
+			if !stale {
+				ks.mutex.Lock()
+				ks.forcedAt = time.Now()
+				ks.mutex.Unlock()
+			}
+			ks.tryRefresh()
+		}
+	}
+
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	keys := make([]verificationKey, 0, len(ks.jwks)+len(ks.static))
+	for _, key := range ks.jwks {
+		if kid == "" || key.kid == "" || key.kid == kid {
+			keys = append(keys, key)
+		}
+	}
+	// 静态密钥没有 kid，始终参与验证
+	return append(keys, ks.static...)
+}
+
+func hasKid(keys []verificationKey, kid string) bool {
+	for _, key := range keys {
+		if key.kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// jwksBackoff 连续失败 failures 次后距下次获取的最短间隔
+func jwksBackoff(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	delay := jwksRetryDelay
+	for i := 1; i < failures && delay < jwksMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, jwksMaxRetryDelay)
+}
+
+// refresh 重新加载 JWKS，同一时间只有一个刷新
+func (ks *keySet) refresh() error {
+	ks.refreshMutex.Lock()
+	defer ks.refreshMutex.Unlock()
+	return ks.load()
+}
+
+// tryRefresh 重新加载 JWKS；已有刷新在进行时直接返回，请求不排队等待
+func (ks *keySet) tryRefresh() {
+	if !ks.refreshMutex.TryLock() {
+		return
+	}
+	defer ks.refreshMutex.Unlock()
+
+	if err := ks.load(); err != nil {
+		ks.mutex.RLock()
+		failures, keys := ks.failures, len(ks.jwks)
+		ks.mutex.RUnlock()
+		logger.Warn("Failed to refresh JWKS (%d consecutive failures), keeping %d previously loaded keys and retrying in %s: %v",
+			failures, keys, jwksBackoff(failures), err)
+	}
+}
+
+// load 获取并解析 JWKS，记录尝试时间；失败时保留上次获取的密钥。需持有 refreshMutex
+func (ks *keySet) load() error {
+	var data []byte
+	var err error
+	if ks.jwksURL != "" {
+		data, err = ks.fetch()
+	} else {
+		data, err = os.ReadFile(ks.jwksFile)
+	}
+	var keys []verificationKey
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+
+	ks.mutex.Lock()
+	ks.attemptedAt = time.Now()
+	if err != nil {
+		ks.failures++
+	} else {
+		ks.jwks = keys
+		ks.loaded = true
+		ks.fetchedAt = ks.attemptedAt
+		ks.failures = 0
+	}
+	ks.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Loaded %d JWT verification keys from JWKS", len(keys))
+	return nil
+}
+
+func (ks *keySet) fetch() ([]byte, error) {
+	resp, err := ks.client.Get(ks.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// jwk JSON Web Key（RFC 7517）中用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS 解析 JWKS 文档，跳过非签名用途和不支持的密钥
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make([]verificationKey, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Warn("Skipping JWKS key %s: %v", k.Kid, err)
+			continue
+		}
+		keys = append(keys, verificationKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid k")
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// loadPEMPublicKey 读取 PEM 格式的 RSA/ECDSA 公钥或证书
+func loadPEMPublicKey(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", file)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err1 := x509.ParseCertificate(block.Bytes)
+		if err1 != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", file, err1)
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", file, err)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", key, file)
+	}
+}
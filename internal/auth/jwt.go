@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+)
+
+// ErrInvalidToken Bearer 令牌无效（格式、签名、签发者、受众或有效期不符）
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// SourceJWT 通过 JWT 认证的用户来源
+const SourceJWT = "jwt"
+
+// jwtAlgorithms 支持的签名算法及其摘要算法
+var jwtAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+}
+
+// esCurves ECDSA 算法对应的曲线
+var esCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// claimMapper 按 auth.jwt 中的声明映射配置将令牌声明（JWT 或内省结果）转换为 User
+type claimMapper struct {
+	config     *config.JWTConfig
+	scopeRules map[string][]PermissionRule
+	groupRules map[string][]PermissionRule
+}
+
+// newClaimMapper 解析 scope/用户组的权限规则
+func newClaimMapper(cfg *config.JWTConfig) (*claimMapper, error) {
+	m := &claimMapper{config: cfg}
+
+	var err error
+	if m.scopeRules, err = parseRuleMap(cfg.ScopePermissions); err != nil {
+		return nil, fmt.Errorf("invalid scope_permissions: %w", err)
+	}
+	if m.groupRules, err = parseRuleMap(cfg.GroupPermissions); err != nil {
+		return nil, fmt.Errorf("invalid group_permissions: %w", err)
+	}
+	return m, nil
+}
+
+// jwtVerifier 校验 JWT 并将声明映射为 User
+type jwtVerifier struct {
+	config     *config.JWTConfig
+	keys       *keySet
+	algorithms map[string]bool // nil 表示按密钥类型允许
+	mapper     *claimMapper
+}
+
+// newJWTVerifier 根据配置创建校验器，加载验签密钥并解析 scope/用户组的权限规则
+func newJWTVerifier(cfg *config.JWTConfig) (*jwtVerifier, error) {
+	keys, err := newKeySet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := newClaimMapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &jwtVerifier{
+		config: cfg,
+		keys:   keys,
+		mapper: mapper,
+	}
+
+	if len(cfg.Algorithms) > 0 {
+		v.algorithms = make(map[string]bool)
+		for _, alg := range cfg.Algorithms {
+			if _, ok := jwtAlgorithms[alg]; !ok {
+				return nil, fmt.Errorf("unsupported JWT algorithm %q", alg)
+			}
+			v.algorithms[alg] = true
+		}
+	}
+	return v, nil
+}
+
+// parseRuleMap 解析 YAML 中按名称配置的权限规则
+func parseRuleMap(m map[string][]interface{}) (map[string][]PermissionRule, error) {
+	result := make(map[string][]PermissionRule, len(m))
+	for name, items := range m {
+		data, err := json.Marshal(items)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		rules, err := parseRules(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		result[name] = rules
+	}
+	return result, nil
+}
+
+// looksLikeJWT 判断令牌是否为 JWS 紧凑格式（三段）
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify 校验签名、签发者、受众和有效期，返回令牌对应的用户
+func (v *jwtVerifier) Verify(token string) (*User, error) {
+	claims, err := v.verifyClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	return v.mapper.userFromClaims(claims, SourceJWT), nil
+}
+
+// verifyClaims 校验令牌并返回其声明
+func (v *jwtVerifier) verifyClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %v", ErrInvalidToken, err)
+	}
+	hash, ok := jwtAlgorithms[header.Alg]
+	if !ok || (v.algorithms != nil && !v.algorithms[header.Alg]) {
+		return nil, fmt.Errorf("%w: algorithm %q not allowed", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range v.keys.candidates(header.Kid) {
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, hash, key.key, signingInput, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %v", ErrInvalidToken, err)
+	}
+	if err = v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// verifySignature 按算法验证签名，密钥类型与算法不匹配时返回 false
+func verifySignature(alg string, hash crypto.Hash, key interface{}, input, signature []byte) bool {
+	hasher := hash.New()
+	hasher.Write(input)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		// 曲线必须与算法对应，签名为定长的 r||s
+		if pub.Curve.Params().Name != esCurves[alg] {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+	return false
+}
+
+// checkClaims 校验 exp（必需）、nbf、iat、iss 和 aud
+func (v *jwtVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	skew := v.config.ClockSkew
+
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(exp.Add(skew)) {
+		return fmt.Errorf("%w: token expired at %s", ErrInvalidToken, exp.Format(time.RFC3339))
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(skew).Before(nbf) {
+		return fmt.Errorf("%w: token not valid before %s", ErrInvalidToken, nbf.Format(time.RFC3339))
+	}
+	if iat, ok := numericClaim(claims, "iat"); ok && now.Add(skew).Before(iat) {
+		return fmt.Errorf("%w: token issued in the future", ErrInvalidToken)
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+			return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+		}
+	}
+
+	return checkAudience(claims, v.config.Audience)
+}
+
+// checkAudience aud 声明需包含 expected 之一，expected 为空时不检查
+func checkAudience(claims map[string]interface{}, expected []string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+	audiences := stringsClaim(claims["aud"])
+	for _, want := range expected {
+		for _, aud := range audiences {
+			if aud == want {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: audience %v not accepted", ErrInvalidToken, audiences)
+}
+
+// numericClaim 读取 NumericDate 类型的声明
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// stringsClaim 读取字符串或字符串数组类型的声明
+func stringsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// scopesClaim 读取 scope 声明，兼容空格分隔的字符串和数组
+func scopesClaim(value interface{}) []string {
+	if s, ok := value.(string); ok {
+		return strings.Fields(s)
+	}
+	return stringsClaim(value)
+}
+
+// userFromClaims 将声明映射为 User：持有 admin_scopes/admin_groups 的用户是管理员，不受权限规则限制；
+// 其他用户在配置了 scope/用户组权限或令牌携带权限声明时，权限为所有匹配规则的并集（没有匹配时拒绝一切访问），否则不限制
+func (m *claimMapper) userFromClaims(claims map[string]interface{}, source string) *User {
+	user := &User{
+		Source: source,
+		claims: claims,
+		Groups: stringsClaim(claims[m.config.GroupsClaim]),
+		Scopes: scopesClaim(claims[m.config.ScopeClaim]),
+	}
+	user.UserID, _ = claims[m.config.UserClaim].(string)
+	user.Username, _ = claims[m.config.UsernameClaim].(string)
+	if user.Username == "" {
+		user.Username = user.UserID
+	}
+	user.Name, _ = claims["name"].(string)
+
+	restricted := len(m.scopeRules) > 0 || len(m.groupRules) > 0
+	var rules []PermissionRule
+	for _, scope := range user.Scopes {
+		rules = append(rules, m.scopeRules[scope]...)
+	}
+	for _, group := range user.Groups {
+		rules = append(rules, m.groupRules[group]...)
+	}
+
+	if m.config.PermissionsClaim != "" {
+		if raw, ok := claims[m.config.PermissionsClaim]; ok {
+			restricted = true
+			data, _ := json.Marshal(raw)
+			claimRules, err := parseRules(data)
+			if err != nil {
+				logger.Warn("Invalid %s claim for user %s, ignoring it: %v", m.config.PermissionsClaim, user.UserID, err)
+			} else {
+				user.Permissions = data
+				rules = append(rules, claimRules...)
+			}
+		}
+	}
+
+	user.admin = containsAny(m.config.AdminScopes, user.Scopes) || containsAny(m.config.AdminGroups, user.Groups)
+	if restricted && !user.admin {
+		user.access = &Permissions{rules: rules}
+	}
+	return user
+}
+
+// containsAny values 中是否有任一元素在 allowed 中
+func containsAny(allowed, values []string) bool {
+	for _, value := range values {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"McpServer/internal/config"
+)
+
+var (
+	testRSAKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	testP256Key, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testP384Key, _  = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	testHMACSecret  = []byte("0123456789abcdef0123456789abcdef")
+	testOtherSecret = []byte("fedcba9876543210fedcba9876543210")
+)
+
+// signToken 按 alg 签名，header 中附加 extra 字段
+func signToken(t *testing.T, alg string, key interface{}, claims map[string]interface{}, extra map[string]interface{}) string {
+	t.Helper()
+	header := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	for k, v := range extra {
+		header[k] = v
+	}
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := encode(header) + "." + encode(claims)
+
+	hash := jwtAlgorithms[alg]
+	var signature []byte
+	var err error
+	switch alg[:2] {
+	case "HS":
+		mac := hmac.New(hash.New, key.([]byte))
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case "RS", "PS", "ES":
+		hasher := hash.New()
+		hasher.Write([]byte(input))
+		digest := hasher.Sum(nil)
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			if alg[:2] == "PS" {
+				signature, err = rsa.SignPSS(rand.Reader, k, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			} else {
+				signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+			}
+		case *ecdsa.PrivateKey:
+			r, s, err1 := ecdsa.Sign(rand.Reader, k, digest)
+			err = err1
+			size := (k.Curve.Params().BitSize + 7) / 8
+			signature = make([]byte, 2*size)
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestVerifier(t *testing.T, cfg *config.JWTConfig, keys ...verificationKey) *jwtVerifier {
+	t.Helper()
+	mapper, err := newClaimMapper(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &jwtVerifier{config: cfg, keys: &keySet{static: keys}, mapper: mapper}
+	if len(cfg.Algorithms) > 0 {
+		v.algorithms = make(map[string]bool)
+		for _, alg := range cfg.Algorithms {
+			v.algorithms[alg] = true
+		}
+	}
+	return v
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{"sub": "alice", "exp": float64(time.Now().Add(time.Hour).Unix())}
+}
+
+func TestVerifyAlgorithmAndKeyType(t *testing.T) {
+	rsaKey := verificationKey{key: &testRSAKey.PublicKey}
+	p256Key := verificationKey{key: &testP256Key.PublicKey}
+	p384Key := verificationKey{key: &testP384Key.PublicKey}
+	hmacKey := verificationKey{key: testHMACSecret}
+
+	tests := []struct {
+		name       string
+		algorithms []string
+		keys       []verificationKey
+		alg        string
+		signingKey interface{}
+		header     map[string]interface{}
+		wantErr    bool
+	}{
+		{name: "RS256 with RSA key", keys: []verificationKey{rsaKey}, alg: "RS256", signingKey: testRSAKey},
+		{name: "PS384 with RSA key", keys: []verificationKey{rsaKey}, alg: "PS384", signingKey: testRSAKey},
+		{name: "ES256 with P-256 key", keys: []verificationKey{p256Key}, alg: "ES256", signingKey: testP256Key},
+		{name: "HS256 with shared secret", keys: []verificationKey{hmacKey}, alg: "HS256", signingKey: testHMACSecret},
+		{name: "RS256 token but only EC key", keys: []verificationKey{p256Key}, alg: "RS256", signingKey: testRSAKey, wantErr: true},
+		{name: "ES256 token signed on P-384", keys: []verificationKey{p384Key}, alg: "ES256", signingKey: testP384Key, wantErr: true},
+		{name: "ES384 token against P-256 key", keys: []verificationKey{p256Key}, alg: "ES384", signingKey: testP256Key, wantErr: true},
+		{
+			// 以 RSA 公钥作为 HMAC 密钥伪造的令牌
+			name: "HS256 signed with RSA public key", keys: []verificationKey{rsaKey}, alg: "HS256",
+			signingKey: testRSAKey.PublicKey.N.Bytes(), wantErr: true,
+		},
+		{name: "wrong HMAC secret", keys: []verificationKey{hmacKey}, alg: "HS256", signingKey: testOtherSecret, wantErr: true},
+		{name: "alg none", keys: []verificationKey{hmacKey}, alg: "none", wantErr: true},
+		{name: "alg not in allowed list", algorithms: []string{"RS256"}, keys: []verificationKey{hmacKey}, alg: "HS256", signingKey: testHMACSecret, wantErr: true},
+		{name: "alg in allowed list", algorithms: []string{"RS256", "HS256"}, keys: []verificationKey{hmacKey}, alg: "HS256", signingKey: testHMACSecret},
+		{
+			name: "JWK alg differs from token alg", keys: []verificationKey{{alg: "RS256", key: &testRSAKey.PublicKey}},
+			alg: "PS256", signingKey: testRSAKey, wantErr: true,
+		},
+		{
+			name: "JWK alg matches token alg", keys: []verificationKey{{kid: "k1", alg: "RS256", key: &testRSAKey.PublicKey}},
+			alg: "RS256", signingKey: testRSAKey, header: map[string]interface{}{"kid": "k1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, &config.JWTConfig{UserClaim: "sub", Algorithms: tt.algorithms}, tt.keys...)
+			var token string
+			if tt.signingKey == nil {
+				token = signToken(t, "HS256", testHMACSecret, validClaims(), nil)
+				// 替换为未签名的 alg
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + tt.alg + `"}`))
+				token = header + token[strings.Index(token, "."):]
+			} else {
+				token = signToken(t, tt.alg, tt.signingKey, validClaims(), tt.header)
+			}
+
+			user, err := v.Verify(token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.UserID != "alice" {
+				t.Errorf("UserID = %q, want alice", user.UserID)
+			}
+		})
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	at := func(d time.Duration) float64 { return float64(now.Add(d).Unix()) }
+
+	tests := []struct {
+		name    string
+		config  config.JWTConfig
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "valid", claims: map[string]interface{}{"exp": at(time.Minute)}},
+		{name: "missing exp", claims: map[string]interface{}{}, wantErr: true},
+		{name: "non-numeric exp", claims: map[string]interface{}{"exp": "tomorrow"}, wantErr: true},
+		{name: "expired", claims: map[string]interface{}{"exp": at(-time.Minute)}, wantErr: true},
+		{name: "expired within clock skew", config: config.JWTConfig{ClockSkew: 2 * time.Minute}, claims: map[string]interface{}{"exp": at(-time.Minute)}},
+		{name: "not yet valid", claims: map[string]interface{}{"exp": at(time.Hour), "nbf": at(time.Minute)}, wantErr: true},
+		{name: "nbf within clock skew", config: config.JWTConfig{ClockSkew: 2 * time.Minute}, claims: map[string]interface{}{"exp": at(time.Hour), "nbf": at(time.Minute)}},
+		{name: "nbf in the past", claims: map[string]interface{}{"exp": at(time.Hour), "nbf": at(-time.Minute)}},
+		{name: "issued in the future", claims: map[string]interface{}{"exp": at(time.Hour), "iat": at(time.Minute)}, wantErr: true},
+		{name: "issuer matches", config: config.JWTConfig{Issuer: "https://idp"}, claims: map[string]interface{}{"exp": at(time.Hour), "iss": "https://idp"}},
+		{name: "issuer differs", config: config.JWTConfig{Issuer: "https://idp"}, claims: map[string]interface{}{"exp": at(time.Hour), "iss": "https://evil"}, wantErr: true},
+		{name: "issuer missing", config: config.JWTConfig{Issuer: "https://idp"}, claims: map[string]interface{}{"exp": at(time.Hour)}, wantErr: true},
+		{name: "audience string matches", config: config.JWTConfig{Audience: []string{"gw"}}, claims: map[string]interface{}{"exp": at(time.Hour), "aud": "gw"}},
+		{name: "audience array matches", config: config.JWTConfig{Audience: []string{"other", "gw"}}, claims: map[string]interface{}{"exp": at(time.Hour), "aud": []interface{}{"x", "gw"}}},
+		{name: "audience differs", config: config.JWTConfig{Audience: []string{"gw"}}, claims: map[string]interface{}{"exp": at(time.Hour), "aud": []interface{}{"x"}}, wantErr: true},
+		{name: "audience missing", config: config.JWTConfig{Audience: []string{"gw"}}, claims: map[string]interface{}{"exp": at(time.Hour)}, wantErr: true},
+		{name: "audience not checked", claims: map[string]interface{}{"exp": at(time.Hour), "aud": "anything"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &jwtVerifier{config: &tt.config}
+			err := v.checkClaims(tt.claims, now)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("checkClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("checkClaims() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestUserFromClaimsAdmin(t *testing.T) {
+	rules := map[string][]interface{}{"mcp:read": {"weather"}}
+
+	tests := []struct {
+		name           string
+		config         config.JWTConfig
+		claims         map[string]interface{}
+		wantAdmin      bool
+		wantRestricted bool
+	}{
+		{name: "admin scope without rules", config: config.JWTConfig{AdminScopes: []string{"mcp:admin"}}, claims: map[string]interface{}{"scope": "mcp:admin"}, wantAdmin: true},
+		{name: "admin scope with scope rules", config: config.JWTConfig{AdminScopes: []string{"mcp:admin"}, ScopePermissions: rules}, claims: map[string]interface{}{"scope": "mcp:read mcp:admin"}, wantAdmin: true},
+		{name: "admin group with scope rules", config: config.JWTConfig{AdminGroups: []string{"ops"}, ScopePermissions: rules}, claims: map[string]interface{}{"groups": []interface{}{"ops"}}, wantAdmin: true},
+		{name: "admin scope with permissions claim", config: config.JWTConfig{AdminScopes: []string{"mcp:admin"}, PermissionsClaim: "mcp_permissions"}, claims: map[string]interface{}{"scope": "mcp:admin", "mcp_permissions": []interface{}{"weather"}}, wantAdmin: true},
+		{name: "non-admin with scope rules", config: config.JWTConfig{AdminScopes: []string{"mcp:admin"}, ScopePermissions: rules}, claims: map[string]interface{}{"scope": "mcp:read"}, wantRestricted: true},
+		{name: "non-admin without rules", config: config.JWTConfig{AdminScopes: []string{"mcp:admin"}}, claims: map[string]interface{}{"scope": "mcp:read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.UserClaim, tt.config.ScopeClaim, tt.config.GroupsClaim = "sub", "scope", "groups"
+			mapper, err := newClaimMapper(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := validClaims()
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			user := mapper.userFromClaims(claims, SourceJWT)
+			if user.IsAdmin() != tt.wantAdmin {
+				t.Errorf("IsAdmin() = %v, want %v", user.IsAdmin(), tt.wantAdmin)
+			}
+			if user.Restricted() != tt.wantRestricted {
+				t.Errorf("Restricted() = %v, want %v", user.Restricted(), tt.wantRestricted)
+			}
+		})
+	}
+}
+
+func TestJWKSRefreshBacksOffWhileUnavailable(t *testing.T) {
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(testRSAKey.PublicKey.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	ks, err := newKeySet(&config.JWTConfig{JWKSURL: server.URL, JWKSRefreshInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(ks.candidates("k1")); got != 1 {
+		t.Fatalf("candidates() = %d keys, want 1", got)
+	}
+
+	// JWKS 过期且 URL 不可用：继续使用上次的密钥，失败后按退避间隔重试而不是每个请求都获取
+	down.Store(true)
+	ks.mutex.Lock()
+	ks.fetchedAt = time.Now().Add(-2 * time.Hour)
+	ks.mutex.Unlock()
+	before := fetches.Load()
+	for i := 0; i < 50; i++ {
+		if got := len(ks.candidates("k1")); got != 1 {
+			t.Fatalf("candidates() = %d keys while JWKS is unavailable, want the last good key", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 等待后台刷新结束
+	ks.refreshMutex.Lock()
+	ks.refreshMutex.Unlock()
+	if got := fetches.Load() - before; got != 1 {
+		t.Errorf("fetched JWKS %d times while backing off, want 1", got)
+	}
+
+	// 未知 kid 的强制刷新同样遵守退避
+	before = fetches.Load()
+	ks.candidates("unknown")
+	if got := fetches.Load() - before; got != 0 {
+		t.Errorf("forced refresh fetched JWKS %d times while backing off, want 0", got)
+	}
+
+	// 退避结束后重试成功，恢复正常
+	down.Store(false)
+	ks.mutex.Lock()
+	ks.attemptedAt = time.Now().Add(-jwksMaxRetryDelay)
+	ks.mutex.Unlock()
+	ks.candidates("k1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ks.mutex.RLock()
+		failures := ks.failures
+		ks.mutex.RUnlock()
+		if failures == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failures = %d after the JWKS URL recovered, want 0", failures)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJWKSBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, jwksRetryDelay},
+		{2, 2 * jwksRetryDelay},
+		{3, 4 * jwksRetryDelay},
+		{100, jwksMaxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := jwksBackoff(tt.failures); got != tt.want {
+			t.Errorf("jwksBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// KeyStore 数据库密钥存储接口（由 database.DatabaseService 实现）
+type KeyStore interface {
+	GetUserKeyByValue(keyValue string) (*models.UserKey, error)
+	RecordKeyUsage(keyID string, count int, lastUsedAt time.Time) error
+}
+
+// maxCachedKeys 缓存条目上限，超过时清理过期条目
+const maxCachedKeys = 10000
+
+// keyCacheEntry 缓存的查询结果及解析后的权限，key 为 nil 表示密钥不存在
+type keyCacheEntry struct {
+	key       *models.UserKey
+	access    *Permissions
+	expiresAt time.Time
+}
+
+// keyCache 按密钥哈希缓存 user_keys 查询结果，避免每个请求都访问数据库；
+// 状态和过期时间在每次使用时重新判断，撤销操作最迟在 TTL 后生效
+type keyCache struct {
+	mutex       sync.Mutex
+	entries     map[string]keyCacheEntry
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+func newKeyCache(ttl, negativeTTL time.Duration) *keyCache {
+	return &keyCache{
+		entries:     make(map[string]keyCacheEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+// hashKey 缓存中只保存密钥的哈希
+func hashKey(keyValue string) string {
+	sum := sha256.Sum256([]byte(keyValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// get 返回缓存的查询结果，found 为 false 表示未命中
+func (c *keyCache) get(hash string) (entry keyCacheEntry, found bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[hash]
+	if !ok {
+		return keyCacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, hash)
+		return keyCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *keyCache) put(hash string, entry keyCacheEntry) {
+	ttl := c.ttl
+	if entry.key == nil {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxCachedKeys {
+		for h, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, h)
+			}
+		}
+		// 仍然过多时清空，防止无效密钥撑满内存
+		if len(c.entries) >= maxCachedKeys {
+			c.entries = make(map[string]keyCacheEntry)
+		}
+	}
+	entry.expiresAt = now.Add(ttl)
+	c.entries[hash] = entry
+}
+
+// keyUsage 一个刷新周期内某个密钥的累计使用情况
+type keyUsage struct {
+	count    int
+	lastUsed time.Time
+}
+
+// usageRecorder 在后台合并密钥使用记录并定期写回 user_keys，不阻塞请求
+type usageRecorder struct {
+	store    KeyStore
+	interval time.Duration
+	events   chan string
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newUsageRecorder(store KeyStore, interval time.Duration) *usageRecorder {
+	r := &usageRecorder{
+		store:    store,
+		interval: interval,
+		events:   make(chan string, 1024),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// record 记录一次密钥使用，队列已满时丢弃
+func (r *usageRecorder) record(keyID string) {
+	select {
+	case r.events <- keyID:
+	default:
+		logger.Debug("Key usage queue full, dropping usage event for key %s", keyID)
+	}
+}
+
+func (r *usageRecorder) run() {
+	defer close(r.done)
+
+	pending := make(map[string]*keyUsage)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	add := func(keyID string) {
+		usage, ok := pending[keyID]
+		if !ok {
+			usage = &keyUsage{}
+			pending[keyID] = usage
+		}
+		usage.count++
+		usage.lastUsed = time.Now()
+	}
+
+	flush := func() {
+		for keyID, usage := range pending {
+			if err := r.store.RecordKeyUsage(keyID, usage.count, usage.lastUsed); err != nil {
+				logger.Warn("Failed to update key usage: %v", err)
+			}
+		}
+		pending = make(map[string]*keyUsage)
+	}
+
+	for {
+		select {
+		case keyID := <-r.events:
+			add(keyID)
+		case <-ticker.C:
+			flush()
+		case <-r.stopChan:
+			// 写回队列中剩余的记录
+			for {
+				select {
+				case keyID := <-r.events:
+					add(keyID)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop 停止后台任务并写回未提交的使用记录
+func (r *usageRecorder) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	<-r.done
+}
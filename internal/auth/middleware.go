@@ -2,15 +2,39 @@ package auth
 
 import (
 	"McpServer/internal/logger"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"McpServer/internal/config"
 )
 
+// 认证失败的原因
+var (
+	ErrMissingKey  = errors.New("missing API key")
+	ErrInvalidKey  = errors.New("invalid API key")
+	ErrRevokedKey  = errors.New("API key is revoked or inactive")
+	ErrExpiredKey  = errors.New("API key is expired")
+	ErrUserBlocked = errors.New("user is inactive")
+)
+
 // AuthMiddleware 认证中间件
 type AuthMiddleware struct {
 	config *config.AuthConfig
+
+	// 数据库密钥（可选），未设置时只校验 auth.api_keys
+	keyStore KeyStore
+	keyCache *keyCache
+	usage    *usageRecorder
+
+	// JWT 校验器（可选），未启用时 Bearer 令牌按 API 密钥处理
+	jwt *jwtVerifier
+
+	// OAuth 受保护资源模式（可选）：不透明令牌内省、401 质询
+	oauth        bool
+	introspector *introspector
 }
 
 // NewAuthMiddleware 创建新的认证中间件
@@ -20,24 +44,111 @@ func NewAuthMiddleware(authConfig *config.AuthConfig) *AuthMiddleware {
 	}
 }
 
+// SetKeyStore 启用 user_keys 表中的数据库密钥，查询结果按 auth.cache_ttl 缓存，使用次数在后台批量写回
+func (am *AuthMiddleware) SetKeyStore(store KeyStore) {
+	am.Close()
+	am.keyStore = store
+	am.keyCache = newKeyCache(am.config.CacheTTL, am.config.NegativeCacheTTL)
+	am.usage = newUsageRecorder(store, am.config.UsageFlushInterval)
+	logger.Info("Database API keys enabled (cache ttl: %v, usage flush interval: %v)",
+		am.config.CacheTTL, am.config.UsageFlushInterval)
+}
+
+// EnableJWT 启用 Authorization: Bearer <JWT> 认证，加载 auth.jwt 中配置的验签密钥
+func (am *AuthMiddleware) EnableJWT() error {
+	verifier, err := newJWTVerifier(&am.config.JWT)
+	if err != nil {
+		return fmt.Errorf("failed to set up JWT authentication: %w", err)
+	}
+	am.jwt = verifier
+	logger.Info("JWT authentication enabled (issuer: %q, audience: %v)", am.config.JWT.Issuer, am.config.JWT.Audience)
+	return nil
+}
+
+// Close 停止后台任务并写回未提交的密钥使用记录
+func (am *AuthMiddleware) Close() {
+	if am.usage != nil {
+		am.usage.stop()
+	}
+}
+
 // ValidateAPIKey 验证API密钥
 func (am *AuthMiddleware) ValidateAPIKey(apiKey string) bool {
 	if !am.config.Enabled {
 		return true // 认证未启用，直接通过
 	}
 
+	_, err := am.Authenticate(apiKey)
+	return err == nil
+}
+
+// Authenticate 校验API密钥并返回对应的用户：先检查 auth.api_keys，再查询 user_keys 表。
+// 密钥不存在、被撤销/禁用、已过期或所属用户未激活时返回相应错误
+func (am *AuthMiddleware) Authenticate(apiKey string) (*User, error) {
 	if apiKey == "" {
-		return false
+		return nil, ErrMissingKey
 	}
 
 	// 检查API密钥是否在允许列表中
+	for _, validKey := range am.config.AdminKeys {
+		if apiKey == validKey {
+			return &User{Source: SourceStatic, identity: "static:" + hashKey(apiKey)[:16], admin: true}, nil
+		}
+	}
 	for _, validKey := range am.config.APIKeys {
 		if apiKey == validKey {
-			return true
+			return &User{Source: SourceStatic, identity: "static:" + hashKey(apiKey)[:16]}, nil
+		}
+	}
+
+	if am.keyStore == nil {
+		return nil, ErrInvalidKey
+	}
+
+	hash := hashKey(apiKey)
+	entry, found := am.keyCache.get(hash)
+	if !found {
+		key, err := am.keyStore.GetUserKeyByValue(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		entry = keyCacheEntry{key: key}
+		if key != nil {
+			entry.access, err = ParsePermissions(key.Permissions)
+			if err != nil {
+				// 权限无法解析时拒绝一切访问，而不是放开
+				logger.Warn("Invalid permissions on key %s, denying all access: %v", key.KeyID, err)
+				entry.access = denyAll
+			}
 		}
+		am.keyCache.put(hash, entry)
 	}
 
-	return false
+	key := entry.key
+	if key == nil || !key.IsGatewayCredential() {
+		return nil, ErrInvalidKey
+	}
+	if key.Status != "active" {
+		return nil, ErrRevokedKey
+	}
+	if key.IsExpired(time.Now()) {
+		return nil, ErrExpiredKey
+	}
+	if key.UserStatus != "active" {
+		return nil, ErrUserBlocked
+	}
+
+	am.usage.record(key.KeyID)
+	return &User{
+		UserID:      key.UserID,
+		Username:    key.Username,
+		Name:        key.UserName,
+		KeyID:       key.KeyID,
+		KeyName:     key.KeyName,
+		Permissions: key.Permissions,
+		Source:      SourceDatabase,
+		access:      entry.access,
+	}, nil
 }
 
 // Middleware HTTP中间件函数
@@ -49,26 +160,63 @@ func (am *AuthMiddleware) Middleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// 获取API密钥
-		headerName := am.config.HeaderName
-		if headerName == "" {
-			headerName = "X-API-Key" // 默认头名称
+		// 验证API密钥或 JWT
+		user, err := am.AuthenticateRequest(r)
+		if err != nil {
+			if !isAuthError(err) {
+				logger.ErrorContext(r.Context(), "Failed to look up API key for request %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, "Service Unavailable: authentication backend error", http.StatusServiceUnavailable)
+				return
+			}
+			logger.InfoContext(r.Context(), "Authentication failed for request %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			am.writeUnauthorized(w, r, err)
+			return
 		}
 
-		apiKey := r.Header.Get(headerName)
+		// 之后的日志都带上调用方
+		ctx := logger.WithUser(WithUser(r.Context(), user), user.Identity())
+		if user.Username != "" {
+			logger.InfoContext(ctx, "Authentication successful for request %s %s (user: %s, key: %s)", r.Method, r.URL.Path, user.Username, user.KeyName)
+		} else {
+			logger.InfoContext(ctx, "Authentication successful for request %s %s", r.Method, r.URL.Path)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// AdminMiddleware 管理接口的中间件：认证后只允许管理员访问，见 RequireAdmin
+func (am *AuthMiddleware) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return am.Middleware(RequireAdmin(next))
+}
 
-		// 验证API密钥
-		if !am.ValidateAPIKey(apiKey) {
-			logger.Info("Authentication failed for request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-			http.Error(w, "Unauthorized: Invalid API Key", http.StatusUnauthorized)
+// RequireAdmin 拒绝不是管理员的认证用户（403）。需位于认证中间件之后；
+// 上下文中没有用户（认证未启用）时放行
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := UserFromContext(r.Context()); ok && !user.IsAdmin() {
+			logger.WarnContext(r.Context(), "Denied admin request %s %s from non-admin caller", r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
 			return
 		}
-
-		logger.Info("Authentication successful for request %s %s", r.Method, r.URL.Path)
 		next(w, r)
 	}
 }
 
+// AuthenticateRequest 认证请求：JWT 认证启用时 JWT 格式的令牌按 JWT 校验，其余按API密钥校验；
+// 配置了令牌内省时，不是有效API密钥的 Bearer 令牌再交给授权服务器内省
+func (am *AuthMiddleware) AuthenticateRequest(r *http.Request) (*User, error) {
+	credential := am.ExtractAPIKey(r)
+	if am.jwt != nil && looksLikeJWT(credential) {
+		return am.jwt.Verify(credential)
+	}
+
+	user, err := am.Authenticate(credential)
+	if errors.Is(err, ErrInvalidKey) && am.introspector != nil && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return am.introspector.Verify(credential)
+	}
+	return user, err
+}
+
 // ExtractAPIKey 从请求中提取API密钥
 func (am *AuthMiddleware) ExtractAPIKey(r *http.Request) string {
 	headerName := am.config.HeaderName
@@ -104,3 +252,10 @@ func (am *AuthMiddleware) GetHeaderName() string {
 	}
 	return am.config.HeaderName
 }
+
+// isAuthError 判断是否为密钥本身导致的认证失败（而非数据库错误）
+func isAuthError(err error) bool {
+	return errors.Is(err, ErrMissingKey) || errors.Is(err, ErrInvalidKey) ||
+		errors.Is(err, ErrRevokedKey) || errors.Is(err, ErrExpiredKey) || errors.Is(err, ErrUserBlocked) ||
+		errors.Is(err, ErrInvalidToken)
+}
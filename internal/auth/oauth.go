@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"McpServer/internal/logger"
+)
+
+// ProtectedResourceMetadataPath 受保护资源元数据（RFC 9728）的路径
+const ProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+// protectedResourceMetadata 受保护资源元数据文档
+type protectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	ResourceDocumentation  string   `json:"resource_documentation,omitempty"`
+}
+
+// EnableOAuth 作为 OAuth 2.1 受保护资源工作：提供资源元数据，401 响应携带指向元数据的
+// WWW-Authenticate 质询；JWT 访问令牌由 auth.jwt 校验，不透明令牌通过 introspection_url 内省
+func (am *AuthMiddleware) EnableOAuth() error {
+	oauth := &am.config.OAuth
+	if oauth.IntrospectionURL != "" {
+		in, err := newIntrospector(am.config)
+		if err != nil {
+			return fmt.Errorf("failed to set up token introspection: %w", err)
+		}
+		am.introspector = in
+	}
+	if am.jwt == nil && am.introspector == nil {
+		return fmt.Errorf("OAuth requires auth.jwt.enabled or auth.oauth.introspection_url to validate access tokens")
+	}
+
+	am.oauth = true
+	logger.Info("OAuth protected resource enabled (resource: %q, authorization servers: %v, introspection: %t)",
+		oauth.Resource, oauth.AuthorizationServers, am.introspector != nil)
+	return nil
+}
+
+// resourceURL 网关的资源标识，未配置时按请求推断
+func (am *AuthMiddleware) resourceURL(r *http.Request) string {
+	if am.config.OAuth.Resource != "" {
+		return strings.TrimSuffix(am.config.OAuth.Resource, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ResourceMetadataURL 资源元数据的地址：资源标识的源 + 元数据路径 + 资源标识的路径
+func (am *AuthMiddleware) ResourceMetadataURL(r *http.Request) string {
+	resource := am.resourceURL(r)
+	u, err := url.Parse(resource)
+	if err != nil || u.Host == "" {
+		return resource + ProtectedResourceMetadataPath
+	}
+	return u.Scheme + "://" + u.Host + ProtectedResourceMetadataPath + strings.TrimSuffix(u.Path, "/")
+}
+
+// ProtectedResourceMetadataHandler 返回资源元数据，同时注册在元数据路径及其子路径上
+func (am *AuthMiddleware) ProtectedResourceMetadataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		oauth := &am.config.OAuth
+		scopes := oauth.ScopesSupported
+		if len(scopes) == 0 {
+			for scope := range am.config.JWT.ScopePermissions {
+				scopes = append(scopes, scope)
+			}
+			sort.Strings(scopes)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		json.NewEncoder(w).Encode(protectedResourceMetadata{
+			Resource:               am.resourceURL(r),
+			AuthorizationServers:   oauth.AuthorizationServers,
+			ScopesSupported:        scopes,
+			BearerMethodsSupported: []string{"header"},
+			ResourceDocumentation:  oauth.ResourceDocumentation,
+		})
+	}
+}
+
+// writeUnauthorized 返回 401；作为受保护资源时附带 RFC 6750 / RFC 9728 格式的 WWW-Authenticate 质询，
+// 令牌无效时带上 invalid_token 错误
+func (am *AuthMiddleware) writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if !am.oauth {
+		http.Error(w, "Unauthorized: Invalid API Key", http.StatusUnauthorized)
+		return
+	}
+
+	challenge := fmt.Sprintf(`Bearer resource_metadata="%s"`, am.ResourceMetadataURL(r))
+	if !errors.Is(err, ErrMissingKey) {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description="%s"`, challengeText(err.Error()))
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// challengeText 去掉不能出现在质询引号字符串中的字符
+func challengeText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// 权限动作
+const (
+	ActionConnect   = "connect"    // 建立会话
+	ActionListTools = "list_tools" // 在 tools/list 中看到工具
+	ActionCallTool  = "call_tool"  // 调用工具
+)
+
+// PermissionRule 一条授权规则，servers/tools 为 glob 模式（path.Match 语法），省略时匹配全部；
+// actions 省略时允许全部动作
+type PermissionRule struct {
+	Servers []string `json:"servers,omitempty"`
+	Tools   []string `json:"tools,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// Permissions user_keys.permissions 解析后的授权规则，满足任意一条规则即允许。
+// 格式为 JSON 数组，元素可以是规则对象，也可以是服务 ID 模式字符串（该服务的全部工具和动作），例如：
+//
+//	["weather", {"servers": ["db-*"], "tools": ["query_*"], "actions": ["connect", "call_tool"]}]
+//
+// nil 表示不限制（静态密钥、permissions 为空数组的数据库密钥）
+type Permissions struct {
+	rules []PermissionRule
+}
+
+// denyAll 不允许任何访问，permissions 无法解析时使用
+var denyAll = &Permissions{rules: []PermissionRule{}}
+
+// ParsePermissions 解析 permissions 字段；null 或空数组表示不限制，返回 nil
+func ParsePermissions(raw json.RawMessage) (*Permissions, error) {
+	rules, err := parseRules(raw)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	return &Permissions{rules: rules}, nil
+}
+
+// parseRules 解析权限规则数组，null 返回空列表
+func parseRules(raw json.RawMessage) ([]PermissionRule, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("permissions must be a JSON array: %w", err)
+	}
+
+	rules := make([]PermissionRule, 0, len(items))
+	for i, item := range items {
+		var rule PermissionRule
+		var server string
+		if err := json.Unmarshal(item, &server); err == nil {
+			rule.Servers = []string{server}
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(item))
+			decoder.DisallowUnknownFields()
+			if err = decoder.Decode(&rule); err != nil {
+				return nil, fmt.Errorf("permissions[%d]: %w", i, err)
+			}
+		}
+
+		patterns := append(append([]string{}, rule.Servers...), rule.Tools...)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("permissions[%d]: invalid pattern %q", i, pattern)
+			}
+		}
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionConnect, ActionListTools, ActionCallTool, "*":
+			default:
+				return nil, fmt.Errorf("permissions[%d]: unknown action %q", i, action)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Allows 判断是否允许对服务（及工具，connect 动作时为空）执行动作
+func (p *Permissions) Allows(serverID, toolName, action string) bool {
+	if p == nil {
+		return true
+	}
+	for _, rule := range p.rules {
+		if !matchAny(rule.Servers, serverID) || !containsAction(rule.Actions, action) {
+			continue
+		}
+		if action == ActionConnect || matchAny(rule.Tools, toolName) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny 模式列表为空时匹配全部
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAction(actions []string, action string) bool {
+	if len(actions) == 0 {
+		return true
+	}
+	for _, a := range actions {
+		if a == action || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CanConnect 是否允许建立到服务的会话；user 为 nil（认证未启用）时允许
+func (u *User) CanConnect(serverID string) bool {
+	return u == nil || u.access.Allows(serverID, "", ActionConnect)
+}
+
+// CanListTool 是否在 tools/list 结果中返回该工具
+func (u *User) CanListTool(serverID, toolName string) bool {
+	return u == nil || u.access.Allows(serverID, toolName, ActionListTools)
+}
+
+// CanCallTool 是否允许调用该工具
+func (u *User) CanCallTool(serverID, toolName string) bool {
+	return u == nil || u.access.Allows(serverID, toolName, ActionCallTool)
+}
+
+// Restricted 是否受 permissions 限制
+func (u *User) Restricted() bool {
+	return u != nil && u.access != nil
+}
+
+// IsAdmin 是否可访问管理接口：只有 auth.admin_keys 中的静态密钥和持有 admin_scopes/admin_groups 的
+// JWT/OAuth 用户（不论是否配置了权限规则）是管理员，受 permissions 限制的用户一律不是；数据库密钥不能访问管理接口
+func (u *User) IsAdmin() bool {
+	return u != nil && u.admin && !u.Restricted()
+}
@@ -0,0 +1,241 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+	"McpServer/internal/metrics"
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常放行
+	StateOpen     = "open"      // 熔断，直接拒绝
+	StateHalfOpen = "half_open" // 冷却结束，放行少量探测调用
+)
+
+// stateValues 状态 -> 指标值
+var stateValues = map[string]float64{
+	StateClosed:   0,
+	StateHalfOpen: 1,
+	StateOpen:     2,
+}
+
+// ErrOpen 熔断器处于熔断状态，调用未发往远程服务
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Status 一个远程服务的熔断器状态
+type Status struct {
+	ServerID            string     `json:"server_id"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // 熔断时进入半开状态的时间
+	Rejected            int64      `json:"rejected"`           // 累计拒绝次数
+}
+
+// circuit 一个远程服务的熔断器
+type circuit struct {
+	state      string
+	failures   int // 关闭状态下的连续失败次数
+	successes  int // 半开状态下的连续成功次数
+	inFlight   int // 半开状态下未完成的探测调用
+	lastError  string
+	openedAt   time.Time
+	rejected   int64
+	generation uint64 // 每次状态变化加一，忽略上一个状态期间开始的调用的结果
+}
+
+// Breakers 按服务 ID 管理的熔断器，状态只保存在本进程内
+type Breakers struct {
+	failureThreshold int
+	coolDown         time.Duration
+	halfOpenMaxCalls int
+	successThreshold int
+
+	mutex    sync.Mutex
+	circuits map[string]*circuit
+}
+
+// New 创建熔断器
+func New(cfg *config.BreakerConfig) *Breakers {
+	return &Breakers{
+		failureThreshold: cfg.FailureThreshold,
+		coolDown:         cfg.CoolDown,
+		halfOpenMaxCalls: cfg.HalfOpenMaxCalls,
+		successThreshold: cfg.SuccessThreshold,
+		circuits:         make(map[string]*circuit),
+	}
+}
+
+// Allow 检查是否可以向远程服务发起调用或连接。熔断时返回包装 ErrOpen 的错误；
+// 放行时返回的 done 必须在调用结束后以调用的错误调用一次，context.Canceled 不计入成功或失败
+func (b *Breakers) Allow(serverID string) (func(err error), error) {
+	now := time.Now()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c, ok := b.circuits[serverID]
+	if !ok {
+		c = &circuit{state: StateClosed}
+		b.circuits[serverID] = c
+		metrics.SetCircuitBreakerState(serverID, stateValues[StateClosed])
+	}
+
+	switch c.state {
+	case StateOpen:
+		retryAt := c.openedAt.Add(b.coolDown)
+		if now.Before(retryAt) {
+			return nil, b.reject(serverID, c, fmt.Errorf("%w for server %s after %d consecutive failures (last error: %s), retry after %s",
+				ErrOpen, serverID, c.failures, c.lastError, retryAt.Sub(now).Round(time.Millisecond)))
+		}
+		b.transition(serverID, c, StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if c.inFlight >= b.halfOpenMaxCalls {
+			return nil, b.reject(serverID, c, fmt.Errorf("%w for server %s, waiting for probe calls to finish", ErrOpen, serverID))
+		}
+		c.inFlight++
+	}
+
+	generation := c.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.done(serverID, c, generation, err)
+		})
+	}, nil
+}
+
+// Open 处于熔断或半开状态的服务 ID
+func (b *Breakers) Open() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	open := []string{}
+	for serverID, c := range b.circuits {
+		if c.state != StateClosed {
+			open = append(open, serverID)
+		}
+	}
+	sort.Strings(open)
+	return open
+}
+
+// Statuses 全部熔断器的状态，按服务 ID 排序
+func (b *Breakers) Statuses() []Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	result := make([]Status, 0, len(b.circuits))
+	for serverID, c := range b.circuits {
+		status := Status{
+			ServerID:            serverID,
+			State:               c.state,
+			ConsecutiveFailures: c.failures,
+			LastError:           c.lastError,
+			Rejected:            c.rejected,
+		}
+		if c.state != StateClosed {
+			openedAt, retryAt := c.openedAt, c.openedAt.Add(b.coolDown)
+			status.OpenedAt = &openedAt
+			if c.state == StateOpen {
+				status.RetryAt = &retryAt
+			}
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ServerID < result[j].ServerID })
+	return result
+}
+
+// Reset 将服务的熔断器恢复为关闭状态，用于服务配置变更后
+func (b *Breakers) Reset(serverID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c, ok := b.circuits[serverID]
+	if !ok {
+		return
+	}
+	if c.state != StateClosed {
+		logger.Info("Circuit breaker for server %s reset", serverID)
+	}
+	b.transition(serverID, c, StateClosed)
+}
+
+// done 记录一次调用的结果；调用开始后状态已变化的结果被忽略
+func (b *Breakers) done(serverID string, c *circuit, generation uint64, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if c.state == StateHalfOpen {
+		c.inFlight--
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if err == nil {
+		switch c.state {
+		case StateClosed:
+			c.failures = 0
+		case StateHalfOpen:
+			c.successes++
+			if c.successes >= b.successThreshold {
+				logger.Info("Circuit breaker for server %s closed after %d successful probe calls", serverID, c.successes)
+				b.transition(serverID, c, StateClosed)
+			}
+		}
+		return
+	}
+
+	c.lastError = err.Error()
+	switch c.state {
+	case StateClosed:
+		c.failures++
+		if c.failures >= b.failureThreshold {
+			logger.Warn("Circuit breaker for server %s opened after %d consecutive failures: %v", serverID, c.failures, err)
+			b.transition(serverID, c, StateOpen)
+		}
+	case StateHalfOpen:
+		c.failures++
+		logger.Warn("Circuit breaker for server %s reopened after failed probe call: %v", serverID, err)
+		b.transition(serverID, c, StateOpen)
+	}
+}
+
+// transition 切换状态；调用方需持有锁
+func (b *Breakers) transition(serverID string, c *circuit, state string) {
+	c.state = state
+	c.generation++
+	c.inFlight = 0
+	c.successes = 0
+	switch state {
+	case StateOpen:
+		c.openedAt = time.Now()
+	case StateClosed:
+		c.failures = 0
+		c.lastError = ""
+		c.openedAt = time.Time{}
+	}
+	metrics.SetCircuitBreakerState(serverID, stateValues[state])
+}
+
+// reject 记录一次拒绝；调用方需持有锁
+func (b *Breakers) reject(serverID string, c *circuit, err error) error {
+	c.rejected++
+	metrics.CircuitBreakerRejected(serverID)
+	return err
+}
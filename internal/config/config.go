@@ -10,18 +10,29 @@ import (
 
 // Config 主配置结构
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Logging  LoggingConfig  `yaml:"logging"`
-	Remote   RemoteConfig   `yaml:"remote"`
-	Tools    ToolsConfig    `yaml:"tools"`
-	Auth     AuthConfig     `yaml:"auth"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Remote    RemoteConfig    `yaml:"remote"`
+	Tools     ToolsConfig     `yaml:"tools"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Reload    ReloadConfig    `yaml:"reload"`
+	Secrets   SecretsConfig   `yaml:"secrets"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Metering  MeteringConfig  `yaml:"metering"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Redaction RedactionConfig `yaml:"redaction"`
+	Health    HealthConfig    `yaml:"health_check"`
+	Breaker   BreakerConfig   `yaml:"circuit_breaker"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // 收到退出信号后等待进行中的工具调用和 HTTP 请求完成的时间
 }
 
 // DatabaseConfig 数据库配置
@@ -39,17 +50,22 @@ type DatabaseConfig struct {
 
 // LoggingConfig 日志配置
 type LoggingConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
-	File   string `yaml:"file"`
+	Level      string `yaml:"level"`
+	Format     string `yaml:"format"`      // text 或 json
+	File       string `yaml:"file"`        // 为空时输出到标准输出
+	MaxSizeMB  int    `yaml:"max_size_mb"` // 日志文件超过该大小时轮转
+	MaxBackups int    `yaml:"max_backups"` // 保留的轮转文件数
 }
 
 // RemoteConfig 远程服务配置
 type RemoteConfig struct {
 	DefaultTimeout         time.Duration `yaml:"default_timeout"`
 	DefaultConnectTimeout  time.Duration `yaml:"default_connect_timeout"`
-	DefaultRetryAttempts   int           `yaml:"default_retry_attempts"`
-	DefaultRetryDelay      time.Duration `yaml:"default_retry_delay"`
+	DefaultRetryAttempts   int           `yaml:"default_retry_attempts"` // 首次失败后的重试次数，-1 表示不重试；远程 SSE 服务以 retry_attempts 为准
+	DefaultRetryDelay      time.Duration `yaml:"default_retry_delay"`    // 首次重试前的等待时间，之后每次翻倍
+	MaxRetryDelay          time.Duration `yaml:"max_retry_delay"`        // 重试等待时间的上限
+	RestartWindow          time.Duration `yaml:"restart_window"`         // 统计 stdio 进程 max_restarts 的时间窗口
+	RestartDelay           time.Duration `yaml:"restart_delay"`          // 崩溃的 stdio 进程首次重启前的等待时间，之后每次翻倍，上限为 max_retry_delay
 	SessionCleanupInterval time.Duration `yaml:"session_cleanup_interval"`
 	DefaultIdleTTL         time.Duration `yaml:"default_idle_ttl"`
 }
@@ -59,6 +75,9 @@ type ToolsConfig struct {
 	BuiltinEcho   bool `yaml:"builtin_echo"`
 	BuiltinGreet  bool `yaml:"builtin_greet"`
 	BuiltinStatus bool `yaml:"builtin_status"`
+
+	// ValidateProxiedArgs 是否在网关侧按上游 schema 校验代理工具（remote_stdio/remote_sse）的参数
+	ValidateProxiedArgs bool `yaml:"validate_proxied_args"`
 }
 
 // AuthConfig 认证配置
@@ -66,6 +85,181 @@ type AuthConfig struct {
 	Enabled    bool     `yaml:"enabled"`
 	APIKeys    []string `yaml:"api_keys"`
 	HeaderName string   `yaml:"header_name"`
+
+	// AdminKeys 可访问管理接口的静态密钥，同时可以像 api_keys 一样访问 MCP 端点
+	AdminKeys []string `yaml:"admin_keys"`
+
+	// DatabaseKeys 是否同时校验 user_keys 表中的密钥（api_keys 仍然有效）
+	DatabaseKeys       bool          `yaml:"database_keys"`
+	CacheTTL           time.Duration `yaml:"cache_ttl"`            // 密钥查询结果缓存时间，撤销最迟在此时间后生效
+	NegativeCacheTTL   time.Duration `yaml:"negative_cache_ttl"`   // 不存在的密钥缓存时间
+	UsageFlushInterval time.Duration `yaml:"usage_flush_interval"` // usage_count/last_used_at 批量写回间隔
+
+	JWT   JWTConfig   `yaml:"jwt"`
+	OAuth OAuthConfig `yaml:"oauth"`
+}
+
+// OAuthConfig 作为 OAuth 2.1 受保护资源（MCP 授权规范）的配置
+type OAuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// 受保护资源元数据（/.well-known/oauth-protected-resource）
+	Resource              string   `yaml:"resource"`              // 网关的资源标识，例如 https://mcp.example.com；留空时按请求的 Host 推断
+	AuthorizationServers  []string `yaml:"authorization_servers"` // 授权服务器的 issuer
+	ScopesSupported       []string `yaml:"scopes_supported"`      // 留空时使用 jwt.scope_permissions 中的 scope
+	ResourceDocumentation string   `yaml:"resource_documentation"`
+
+	// 不透明令牌通过内省（RFC 7662）校验，JWT 令牌使用 auth.jwt 校验
+	IntrospectionURL      string        `yaml:"introspection_url"`
+	ClientID              string        `yaml:"client_id"`
+	ClientSecret          string        `yaml:"client_secret"`
+	IntrospectionCacheTTL time.Duration `yaml:"introspection_cache_ttl"` // 内省结果缓存时间，不超过令牌有效期
+}
+
+// JWTConfig Authorization: Bearer <JWT> 认证配置
+type JWTConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Issuer     string   `yaml:"issuer"`     // 要求的 iss，留空不检查
+	Audience   []string `yaml:"audience"`   // aud 需包含其中之一，留空不检查
+	Algorithms []string `yaml:"algorithms"` // 允许的签名算法，留空时允许与密钥类型匹配的全部算法
+
+	// 验签密钥：JWKS（URL 或文件，定期刷新）、PEM 公钥文件、HMAC 共享密钥，可同时配置
+	JWKSURL             string        `yaml:"jwks_url"`
+	JWKSFile            string        `yaml:"jwks_file"`
+	JWKSRefreshInterval time.Duration `yaml:"jwks_refresh_interval"`
+	PublicKeyFiles      []string      `yaml:"public_key_files"`
+	HMACSecret          string        `yaml:"hmac_secret"`
+
+	ClockSkew time.Duration `yaml:"clock_skew"` // exp/nbf/iat 允许的时钟偏差
+
+	// 声明映射
+	UserClaim        string `yaml:"user_claim"`        // 用户 ID，默认 sub
+	UsernameClaim    string `yaml:"username_claim"`    // 用户名，默认 preferred_username
+	GroupsClaim      string `yaml:"groups_claim"`      // 用户组，默认 groups
+	ScopeClaim       string `yaml:"scope_claim"`       // 权限范围（空格分隔字符串或数组），默认 scope
+	PermissionsClaim string `yaml:"permissions_claim"` // 直接携带权限规则（格式同 user_keys.permissions）的声明，留空不使用
+
+	// 按 scope / 用户组授予的权限规则（格式同 user_keys.permissions）
+	ScopePermissions map[string][]interface{} `yaml:"scope_permissions"`
+	GroupPermissions map[string][]interface{} `yaml:"group_permissions"`
+
+	// 持有其中任一 scope 或属于其中任一用户组的用户可访问管理接口（受上面的权限规则限制的用户除外）
+	AdminScopes []string `yaml:"admin_scopes"`
+	AdminGroups []string `yaml:"admin_groups"`
+}
+
+// ReloadConfig 热重载配置
+type ReloadConfig struct {
+	// ListenNotify 是否通过 PostgreSQL LISTEN/NOTIFY 监听配置表变更并自动重载（需执行 config_change_notify.sql）
+	ListenNotify bool          `yaml:"listen_notify"`
+	Debounce     time.Duration `yaml:"debounce"` // 合并短时间内多次变更的等待时间
+}
+
+// SecretsConfig 加密密钥存储配置：适配器配置中的 secret://name 从 secrets 表解密得到。
+// 主密钥为 32 字节（base64 或 hex 编码），优先读取 key_env 环境变量，其次 key_file；都没有时不启用
+type SecretsConfig struct {
+	KeyEnv  string `yaml:"key_env"`  // 主密钥所在的环境变量，默认 MCP_SECRETS_KEY
+	KeyFile string `yaml:"key_file"` // 主密钥文件
+
+	// PreviousKeyFiles 轮换主密钥后仍用于解密旧数据的密钥文件，执行 /admin/secrets/rekey 后可移除
+	PreviousKeyFiles []string      `yaml:"previous_key_files"`
+	CacheTTL         time.Duration `yaml:"cache_ttl"` // 解密结果缓存时间，其他实例更新的密钥最迟在此时间后生效
+}
+
+// RateLimitConfig 令牌桶限流配置，请求需通过全部匹配的规则
+type RateLimitConfig struct {
+	Enabled bool            `yaml:"enabled"`
+	Rules   []RateLimitRule `yaml:"rules"`
+}
+
+// RateLimitRule 一条限流规则：每 period 补充 rate 个令牌，桶容量为 burst
+type RateLimitRule struct {
+	Name string `yaml:"name"` // 规则名称，出现在日志和被限流的响应中，默认 rule-<序号>
+
+	// Scope request 限制发往 MCP 端点的 HTTP 请求（建立连接和会话消息），tool_call 限制工具调用
+	Scope string `yaml:"scope"`
+	// Per 按哪些维度分别计数：caller（调用方密钥或用户）、server、tool；为空时所有匹配的请求共用一个令牌桶
+	Per []string `yaml:"per"`
+
+	Servers []string `yaml:"servers"` // 适用的服务，glob 模式（path.Match 语法），省略时匹配全部
+	Tools   []string `yaml:"tools"`   // 适用的工具（仅 tool_call），省略时匹配全部
+
+	Rate   int           `yaml:"rate"`   // 每个周期补充的令牌数
+	Period time.Duration `yaml:"period"` // 补充周期，默认 1s
+	Burst  int           `yaml:"burst"`  // 桶容量，默认等于 rate
+}
+
+// MeteringConfig 工具调用计量与配额配置（需执行 migrations/tool_usage.sql）
+type MeteringConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	FlushInterval time.Duration `yaml:"flush_interval"`  // 批量写入间隔
+	BatchSize     int           `yaml:"batch_size"`      // 缓冲达到该数量时立即写入
+	MaxBuffer     int           `yaml:"max_buffer"`      // 数据库不可用时最多缓冲的记录数，超出后丢弃最早的记录
+	QuotaCacheTTL time.Duration `yaml:"quota_cache_ttl"` // 配额和已持久化计数的缓存时间，多实例部署时计数最迟在此时间后同步
+}
+
+// AuditConfig 审计日志配置（需执行 migrations/audit_log.sql）
+type AuditConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Arguments     string        `yaml:"arguments"`      // 工具参数的记录方式：hash 只记录 SHA-256，redacted 同时记录遮蔽后的参数
+	RedactKeys    []string      `yaml:"redact_keys"`    // redacted 模式下遮蔽名称包含任一项的参数（不区分大小写，任意层级）
+	FlushInterval time.Duration `yaml:"flush_interval"` // 批量写入间隔
+	BatchSize     int           `yaml:"batch_size"`     // 缓冲达到该数量时立即写入
+	MaxBuffer     int           `yaml:"max_buffer"`     // 数据库不可用时最多缓冲的记录数，达到后拒绝新的工具调用和管理变更
+}
+
+// MetricsConfig Prometheus 指标端点配置
+type MetricsConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Path        string `yaml:"path"`         // 指标端点路径
+	RequireAuth bool   `yaml:"require_auth"` // 是否要求与其他接口相同的认证
+}
+
+// BreakerConfig 每个远程服务的熔断器配置：连续失败 failure_threshold 次后熔断，
+// cool_down 后放行少量探测调用，探测成功 success_threshold 次后恢复
+type BreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold"`   // 连续失败多少次后熔断
+	CoolDown         time.Duration `yaml:"cool_down"`           // 熔断后多久进入半开状态
+	HalfOpenMaxCalls int           `yaml:"half_open_max_calls"` // 半开状态下同时放行的调用数
+	SuccessThreshold int           `yaml:"success_threshold"`   // 半开状态下连续成功多少次后恢复
+}
+
+// HealthConfig 远程 SSE 服务的主动健康检查配置，只检查 health_check_enabled 的服务
+type HealthConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	RefreshInterval    time.Duration `yaml:"refresh_interval"`    // 重新读取需要检查的服务列表的间隔
+	DefaultInterval    time.Duration `yaml:"default_interval"`    // 服务未配置 health_check_interval_ms 时的检查间隔
+	Timeout            time.Duration `yaml:"timeout"`             // 单次探测的超时
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // 连续失败多少次标记为不健康
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // 不健康的服务连续成功多少次后恢复
+	HistorySize        int           `yaml:"history_size"`        // 每个服务保留的最近探测记录数
+}
+
+// RedactionConfig 日志和审计记录中敏感数据的遮蔽规则
+type RedactionConfig struct {
+	Headers   []string           `yaml:"headers"`    // 值需要遮蔽的请求/响应头，不区分大小写，支持 * 通配
+	JSONPaths []string           `yaml:"json_paths"` // 需要遮蔽的 JSON 字段，如 $.password、$.items[*].card、$..token
+	Patterns  []RedactionPattern `yaml:"patterns"`   // 在所有字符串中遮蔽的正则
+}
+
+// RedactionPattern 正则遮蔽规则
+type RedactionPattern struct {
+	Name        string `yaml:"name"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"` // 默认 [REDACTED]
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Exporter    string            `yaml:"exporter"`     // otlp、stdout 或 file
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP 接收端地址（host:port）
+	Insecure    bool              `yaml:"insecure"`     // OTLP 使用 HTTP 而非 HTTPS
+	Headers     map[string]string `yaml:"headers"`      // OTLP 请求头，如认证令牌
+	File        string            `yaml:"file"`         // file 导出器写入的文件
+	ServiceName string            `yaml:"service_name"` // 上报的 service.name
+	SampleRatio float64           `yaml:"sample_ratio"` // 没有上游采样决定时的采样比例，0~1
 }
 
 // GetDSN 获取数据库连接字符串
@@ -128,6 +322,9 @@ func setDefaults(config *Config) {
 	if config.Server.Port == 0 {
 		config.Server.Port = 9001
 	}
+	if config.Server.ShutdownTimeout == 0 {
+		config.Server.ShutdownTimeout = 30 * time.Second
+	}
 
 	// 数据库默认值
 	if config.Database.Host == "" {
@@ -156,6 +353,12 @@ func setDefaults(config *Config) {
 	if config.Logging.Format == "" {
 		config.Logging.Format = "text"
 	}
+	if config.Logging.MaxSizeMB == 0 {
+		config.Logging.MaxSizeMB = 100
+	}
+	if config.Logging.MaxBackups == 0 {
+		config.Logging.MaxBackups = 5
+	}
 
 	// 远程服务默认值
 	if config.Remote.DefaultTimeout == 0 {
@@ -170,12 +373,176 @@ func setDefaults(config *Config) {
 	if config.Remote.DefaultRetryDelay == 0 {
 		config.Remote.DefaultRetryDelay = 3 * time.Second
 	}
+	if config.Remote.MaxRetryDelay == 0 {
+		config.Remote.MaxRetryDelay = 30 * time.Second
+	}
+	if config.Remote.RestartWindow == 0 {
+		config.Remote.RestartWindow = 10 * time.Minute
+	}
+	if config.Remote.RestartDelay == 0 {
+		config.Remote.RestartDelay = time.Second
+	}
 	if config.Remote.SessionCleanupInterval == 0 {
 		config.Remote.SessionCleanupInterval = 30 * time.Second
 	}
 	if config.Remote.DefaultIdleTTL == 0 {
 		config.Remote.DefaultIdleTTL = 5 * time.Minute
 	}
+
+	// 认证默认值
+	if config.Auth.CacheTTL == 0 {
+		config.Auth.CacheTTL = 30 * time.Second
+	}
+	if config.Auth.NegativeCacheTTL == 0 {
+		config.Auth.NegativeCacheTTL = 5 * time.Second
+	}
+	if config.Auth.UsageFlushInterval == 0 {
+		config.Auth.UsageFlushInterval = 10 * time.Second
+	}
+	if config.Auth.OAuth.IntrospectionCacheTTL == 0 {
+		config.Auth.OAuth.IntrospectionCacheTTL = time.Minute
+	}
+	// 作为受保护资源时，JWT 必须是为本资源签发的
+	if config.Auth.OAuth.Enabled && config.Auth.OAuth.Resource != "" && len(config.Auth.JWT.Audience) == 0 {
+		config.Auth.JWT.Audience = []string{config.Auth.OAuth.Resource}
+	}
+	if config.Auth.JWT.JWKSRefreshInterval == 0 {
+		config.Auth.JWT.JWKSRefreshInterval = time.Hour
+	}
+	if config.Auth.JWT.ClockSkew == 0 {
+		config.Auth.JWT.ClockSkew = time.Minute
+	}
+	if config.Auth.JWT.UserClaim == "" {
+		config.Auth.JWT.UserClaim = "sub"
+	}
+	if config.Auth.JWT.UsernameClaim == "" {
+		config.Auth.JWT.UsernameClaim = "preferred_username"
+	}
+	if config.Auth.JWT.GroupsClaim == "" {
+		config.Auth.JWT.GroupsClaim = "groups"
+	}
+	if config.Auth.JWT.ScopeClaim == "" {
+		config.Auth.JWT.ScopeClaim = "scope"
+	}
+
+	// 热重载默认值
+	if config.Reload.Debounce == 0 {
+		config.Reload.Debounce = 500 * time.Millisecond
+	}
+
+	// 密钥存储默认值
+	if config.Secrets.KeyEnv == "" {
+		config.Secrets.KeyEnv = "MCP_SECRETS_KEY"
+	}
+	if config.Secrets.CacheTTL == 0 {
+		config.Secrets.CacheTTL = time.Minute
+	}
+
+	// 计量默认值
+	if config.Metering.FlushInterval == 0 {
+		config.Metering.FlushInterval = 10 * time.Second
+	}
+	if config.Metering.BatchSize == 0 {
+		config.Metering.BatchSize = 500
+	}
+	if config.Metering.MaxBuffer == 0 {
+		config.Metering.MaxBuffer = 100000
+	}
+	if config.Metering.QuotaCacheTTL == 0 {
+		config.Metering.QuotaCacheTTL = 30 * time.Second
+	}
+
+	// 审计默认值
+	if config.Audit.Arguments == "" {
+		config.Audit.Arguments = "hash"
+	}
+	if len(config.Audit.RedactKeys) == 0 {
+		config.Audit.RedactKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "credential", "private_key"}
+	}
+	if config.Audit.FlushInterval == 0 {
+		config.Audit.FlushInterval = time.Second
+	}
+	if config.Audit.BatchSize == 0 {
+		config.Audit.BatchSize = 200
+	}
+	if config.Audit.MaxBuffer == 0 {
+		config.Audit.MaxBuffer = 100000
+	}
+
+	// 指标默认值
+	if config.Metrics.Path == "" {
+		config.Metrics.Path = "/metrics"
+	}
+
+	// 熔断器默认值
+	if config.Breaker.FailureThreshold == 0 {
+		config.Breaker.FailureThreshold = 5
+	}
+	if config.Breaker.CoolDown == 0 {
+		config.Breaker.CoolDown = 30 * time.Second
+	}
+	if config.Breaker.HalfOpenMaxCalls == 0 {
+		config.Breaker.HalfOpenMaxCalls = 1
+	}
+	if config.Breaker.SuccessThreshold == 0 {
+		config.Breaker.SuccessThreshold = 1
+	}
+
+	// 健康检查默认值
+	if config.Health.RefreshInterval == 0 {
+		config.Health.RefreshInterval = 30 * time.Second
+	}
+	if config.Health.DefaultInterval == 0 {
+		config.Health.DefaultInterval = 30 * time.Second
+	}
+	if config.Health.Timeout == 0 {
+		config.Health.Timeout = 5 * time.Second
+	}
+	if config.Health.UnhealthyThreshold == 0 {
+		config.Health.UnhealthyThreshold = 3
+	}
+	if config.Health.HealthyThreshold == 0 {
+		config.Health.HealthyThreshold = 1
+	}
+	if config.Health.HistorySize == 0 {
+		config.Health.HistorySize = 20
+	}
+
+	// 遮蔽默认值：认证相关的头
+	if len(config.Redaction.Headers) == 0 {
+		config.Redaction.Headers = []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "*token*", "*secret*", "*api-key*", "*apikey*"}
+		if config.Auth.HeaderName != "" {
+			config.Redaction.Headers = append(config.Redaction.Headers, config.Auth.HeaderName)
+		}
+	}
+
+	// 链路追踪默认值
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = "otlp"
+	}
+	if config.Tracing.Endpoint == "" {
+		config.Tracing.Endpoint = "localhost:4318"
+	}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "mcp-gateway"
+	}
+	if config.Tracing.SampleRatio == 0 {
+		config.Tracing.SampleRatio = 1
+	}
+
+	// 限流默认值
+	for i := range config.RateLimit.Rules {
+		rule := &config.RateLimit.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Period == 0 {
+			rule.Period = time.Second
+		}
+		if rule.Burst == 0 {
+			rule.Burst = rule.Rate
+		}
+	}
 }
 
 // LoadConfigFromEnv 从环境变量加载配置（优先级高于配置文件）
@@ -209,4 +576,10 @@ func LoadConfigFromEnv(config *Config) {
 	if level := os.Getenv("LOG_LEVEL"); level != "" {
 		config.Logging.Level = level
 	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.Logging.Format = format
+	}
+	if file := os.Getenv("LOG_FILE"); file != "" {
+		config.Logging.File = file
+	}
 }
@@ -0,0 +1,491 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// 以下方法供管理接口使用：读取时包含已禁用的记录，记录不存在时返回 (nil, nil) 或 false
+
+const serviceColumns = `server_id, display_name, implementation_name, protocol_version,
+		       enabled, metadata, created_at, updated_at, adapter, start_mode`
+
+const toolColumns = `id, server_id, name, description, args_schema, output_schema, enabled,
+		       created_at, updated_at, handler_type, handler_config`
+
+// scanService 扫描一行 mcp_service 记录
+func scanService(row interface{ Scan(...interface{}) error }) (*models.MCPService, error) {
+	var service models.MCPService
+	err := row.Scan(
+		&service.ServerID,
+		&service.DisplayName,
+		&service.ImplementationName,
+		&service.ProtocolVersion,
+		&service.Enabled,
+		&service.Metadata,
+		&service.CreatedAt,
+		&service.UpdatedAt,
+		&service.Adapter,
+		&service.StartMode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// scanTool 扫描一行 mcp_tool 记录
+func scanTool(row interface{ Scan(...interface{}) error }) (*models.MCPTool, error) {
+	var tool models.MCPTool
+	err := row.Scan(
+		&tool.ID,
+		&tool.ServerID,
+		&tool.Name,
+		&tool.Description,
+		&tool.ArgsSchema,
+		&tool.OutputSchema,
+		&tool.Enabled,
+		&tool.CreatedAt,
+		&tool.UpdatedAt,
+		&tool.HandlerType,
+		&tool.HandlerConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &tool, nil
+}
+
+// ListServiceRecords 获取所有服务（包括已禁用的服务和远程服务）
+func (ds *DatabaseService) ListServiceRecords() ([]models.MCPService, error) {
+	query := `SELECT ` + serviceColumns + ` FROM mcp_service ORDER BY server_id`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query services: %w", err)
+	}
+	logger.Debug("%s", query)
+	defer rows.Close()
+
+	services := make([]models.MCPService, 0)
+	for rows.Next() {
+		service, err1 := scanService(rows)
+		if err1 != nil {
+			return nil, fmt.Errorf("failed to scan service: %w", err1)
+		}
+		services = append(services, *service)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating service rows: %w", err)
+	}
+
+	return services, nil
+}
+
+// GetServiceRecord 根据 server_id 获取服务（包括已禁用的服务），不存在时返回 nil
+func (ds *DatabaseService) GetServiceRecord(serverID string) (*models.MCPService, error) {
+	query := `SELECT ` + serviceColumns + ` FROM mcp_service WHERE server_id = $1`
+
+	service, err := scanService(ds.db.QueryRow(query, serverID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	logger.Debug("%s", query)
+	return service, nil
+}
+
+// CreateService 创建服务
+func (ds *DatabaseService) CreateService(service *models.MCPService) error {
+	query := `
+		INSERT INTO mcp_service (server_id, display_name, implementation_name, protocol_version,
+		                         enabled, metadata, adapter, start_mode)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at, updated_at
+	`
+
+	err := ds.db.QueryRow(query,
+		service.ServerID,
+		service.DisplayName,
+		service.ImplementationName,
+		service.ProtocolVersion,
+		service.Enabled,
+		service.Metadata,
+		service.Adapter,
+		service.StartMode,
+	).Scan(&service.CreatedAt, &service.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	logger.Debug("%s", query)
+	return nil
+}
+
+// adapterConfigTables 远程适配器及其配置表
+var adapterConfigTables = map[string]string{
+	"remote_stdio": "mcp_service_stdio",
+	"remote_sse":   "mcp_service_sse",
+}
+
+// UpdateService 更新服务（不修改 server_id），服务不存在时返回 false。
+// 适配器变更时在同一事务中删除原适配器的配置，避免遗留的 stdio/SSE 配置在改回时被重新启用
+func (ds *DatabaseService) UpdateService(service *models.MCPService) (bool, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previousAdapter string
+	err = tx.QueryRow(`SELECT adapter FROM mcp_service WHERE server_id = $1 FOR UPDATE`, service.ServerID).Scan(&previousAdapter)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update service: %w", err)
+	}
+
+	query := `
+		UPDATE mcp_service
+		SET display_name = $2, implementation_name = $3, protocol_version = $4,
+		    enabled = $5, metadata = $6, adapter = $7, start_mode = $8, updated_at = now()
+		WHERE server_id = $1
+		RETURNING created_at, updated_at
+	`
+
+	err = tx.QueryRow(query,
+		service.ServerID,
+		service.DisplayName,
+		service.ImplementationName,
+		service.ProtocolVersion,
+		service.Enabled,
+		service.Metadata,
+		service.Adapter,
+		service.StartMode,
+	).Scan(&service.CreatedAt, &service.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to update service: %w", err)
+	}
+	logger.Debug("%s", query)
+
+	if table, ok := adapterConfigTables[previousAdapter]; ok && previousAdapter != service.Adapter {
+		if _, err = tx.Exec(`DELETE FROM `+table+` WHERE server_id = $1`, service.ServerID); err != nil {
+			return false, fmt.Errorf("failed to delete %s config of service %s: %w", previousAdapter, service.ServerID, err)
+		}
+		logger.Info("Deleted %s config of service %s after its adapter changed to %s", previousAdapter, service.ServerID, service.Adapter)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// SetServiceEnabled 启用或禁用服务，服务不存在时返回 false
+func (ds *DatabaseService) SetServiceEnabled(serverID string, enabled bool) (bool, error) {
+	query := `UPDATE mcp_service SET enabled = $2, updated_at = now() WHERE server_id = $1`
+	return ds.execAffected(query, "failed to set service enabled", serverID, enabled)
+}
+
+// DeleteService 删除服务（stdio/SSE 配置通过外键级联删除），服务不存在时返回 false
+func (ds *DatabaseService) DeleteService(serverID string) (bool, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// mcp_tool 的外键未声明级联删除，先删除工具
+	if _, err = tx.Exec(`DELETE FROM mcp_tool WHERE server_id = $1`, serverID); err != nil {
+		return false, fmt.Errorf("failed to delete service tools: %w", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM mcp_service WHERE server_id = $1`, serverID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete service: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListToolRecords 获取服务的所有工具（包括已禁用的工具）
+func (ds *DatabaseService) ListToolRecords(serverID string) ([]models.MCPTool, error) {
+	query := `SELECT ` + toolColumns + ` FROM mcp_tool WHERE server_id = $1 ORDER BY name`
+
+	rows, err := ds.db.Query(query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tools: %w", err)
+	}
+	logger.Debug("%s", query)
+	defer rows.Close()
+
+	tools := make([]models.MCPTool, 0)
+	for rows.Next() {
+		tool, err1 := scanTool(rows)
+		if err1 != nil {
+			return nil, fmt.Errorf("failed to scan tool: %w", err1)
+		}
+		tools = append(tools, *tool)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tool rows: %w", err)
+	}
+
+	return tools, nil
+}
+
+// GetToolRecord 获取服务下指定 ID 的工具（包括已禁用的工具），不存在时返回 nil
+func (ds *DatabaseService) GetToolRecord(serverID string, toolID int64) (*models.MCPTool, error) {
+	query := `SELECT ` + toolColumns + ` FROM mcp_tool WHERE server_id = $1 AND id = $2`
+
+	tool, err := scanTool(ds.db.QueryRow(query, serverID, toolID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tool: %w", err)
+	}
+	logger.Debug("%s", query)
+	return tool, nil
+}
+
+// CreateTool 创建工具，成功后回填 ID 和时间戳
+func (ds *DatabaseService) CreateTool(tool *models.MCPTool) error {
+	query := `
+		INSERT INTO mcp_tool (server_id, name, description, args_schema, output_schema,
+		                      enabled, handler_type, handler_config)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := ds.db.QueryRow(query,
+		tool.ServerID,
+		tool.Name,
+		tool.Description,
+		tool.ArgsSchema,
+		tool.OutputSchema,
+		tool.Enabled,
+		tool.HandlerType,
+		tool.HandlerConfig,
+	).Scan(&tool.ID, &tool.CreatedAt, &tool.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create tool: %w", err)
+	}
+	logger.Debug("%s", query)
+	return nil
+}
+
+// UpdateTool 更新工具，工具不存在时返回 false
+func (ds *DatabaseService) UpdateTool(tool *models.MCPTool) (bool, error) {
+	query := `
+		UPDATE mcp_tool
+		SET name = $3, description = $4, args_schema = $5, output_schema = $6,
+		    enabled = $7, handler_type = $8, handler_config = $9, updated_at = now()
+		WHERE server_id = $1 AND id = $2
+		RETURNING created_at, updated_at
+	`
+
+	err := ds.db.QueryRow(query,
+		tool.ServerID,
+		tool.ID,
+		tool.Name,
+		tool.Description,
+		tool.ArgsSchema,
+		tool.OutputSchema,
+		tool.Enabled,
+		tool.HandlerType,
+		tool.HandlerConfig,
+	).Scan(&tool.CreatedAt, &tool.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update tool: %w", err)
+	}
+	logger.Debug("%s", query)
+	return true, nil
+}
+
+// SetToolEnabled 启用或禁用工具，工具不存在时返回 false
+func (ds *DatabaseService) SetToolEnabled(serverID string, toolID int64, enabled bool) (bool, error) {
+	query := `UPDATE mcp_tool SET enabled = $3, updated_at = now() WHERE server_id = $1 AND id = $2`
+	return ds.execAffected(query, "failed to set tool enabled", serverID, toolID, enabled)
+}
+
+// DeleteTool 删除工具，工具不存在时返回 false
+func (ds *DatabaseService) DeleteTool(serverID string, toolID int64) (bool, error) {
+	query := `DELETE FROM mcp_tool WHERE server_id = $1 AND id = $2`
+	return ds.execAffected(query, "failed to delete tool", serverID, toolID)
+}
+
+// GetStdioServiceRecord 获取 stdio 配置，不存在时返回 nil
+func (ds *DatabaseService) GetStdioServiceRecord(serverID string) (*models.MCPServiceStdio, error) {
+	config, err := ds.queryStdioServiceConfig(serverID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get stdio config: %w", err)
+	}
+	return config, nil
+}
+
+// UpsertStdioServiceConfig 创建或替换 stdio 配置
+func (ds *DatabaseService) UpsertStdioServiceConfig(config *models.MCPServiceStdio) error {
+	query := `
+		INSERT INTO mcp_service_stdio (server_id, command, args, workdir, env, startup_timeout_ms,
+		                               shutdown_timeout_ms, reuse_strategy, max_concurrent, idle_ttl_ms,
+		                               max_restarts, init_params, credential_passthrough)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (server_id) DO UPDATE SET
+		    command = EXCLUDED.command,
+		    args = EXCLUDED.args,
+		    workdir = EXCLUDED.workdir,
+		    env = EXCLUDED.env,
+		    startup_timeout_ms = EXCLUDED.startup_timeout_ms,
+		    shutdown_timeout_ms = EXCLUDED.shutdown_timeout_ms,
+		    reuse_strategy = EXCLUDED.reuse_strategy,
+		    max_concurrent = EXCLUDED.max_concurrent,
+		    idle_ttl_ms = EXCLUDED.idle_ttl_ms,
+		    max_restarts = EXCLUDED.max_restarts,
+		    init_params = EXCLUDED.init_params,
+		    credential_passthrough = EXCLUDED.credential_passthrough,
+		    updated_at = now()
+	`
+
+	_, err := ds.db.Exec(query,
+		config.ServerID,
+		config.Command,
+		pq.Array(config.Args),
+		config.Workdir,
+		config.Env,
+		config.StartupTimeoutMs,
+		config.ShutdownTimeoutMs,
+		config.ReuseStrategy,
+		config.MaxConcurrent,
+		config.IdleTtlMs,
+		config.MaxRestarts,
+		config.InitParams,
+		config.CredentialPassthrough,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save stdio config: %w", err)
+	}
+	logger.Debug("%s", query)
+	return nil
+}
+
+// DeleteStdioServiceConfig 删除 stdio 配置，配置不存在时返回 false
+func (ds *DatabaseService) DeleteStdioServiceConfig(serverID string) (bool, error) {
+	query := `DELETE FROM mcp_service_stdio WHERE server_id = $1`
+	return ds.execAffected(query, "failed to delete stdio config", serverID)
+}
+
+// GetSSEServiceRecord 获取 SSE 配置，不存在时返回 nil
+func (ds *DatabaseService) GetSSEServiceRecord(serverID string) (*models.MCPServiceSSE, error) {
+	config, err := ds.querySSEServiceConfig(serverID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get sse config: %w", err)
+	}
+	return config, nil
+}
+
+// UpsertSSEServiceConfig 创建或替换 SSE 配置，成功后回填时间戳
+func (ds *DatabaseService) UpsertSSEServiceConfig(config *models.MCPServiceSSE) error {
+	query := `
+		INSERT INTO mcp_service_sse (server_id, base_url, sse_path, auth_type, auth_config,
+		                             timeout_ms, connect_timeout_ms, retry_attempts, retry_delay_ms,
+		                             health_check_enabled, health_check_path, health_check_interval_ms,
+		                             headers, query_params, connection_pool_size, keep_alive,
+		                             follow_redirects, max_redirects, user_agent, credential_passthrough)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		ON CONFLICT (server_id) DO UPDATE SET
+		    base_url = EXCLUDED.base_url,
+		    sse_path = EXCLUDED.sse_path,
+		    auth_type = EXCLUDED.auth_type,
+		    auth_config = EXCLUDED.auth_config,
+		    timeout_ms = EXCLUDED.timeout_ms,
+		    connect_timeout_ms = EXCLUDED.connect_timeout_ms,
+		    retry_attempts = EXCLUDED.retry_attempts,
+		    retry_delay_ms = EXCLUDED.retry_delay_ms,
+		    health_check_enabled = EXCLUDED.health_check_enabled,
+		    health_check_path = EXCLUDED.health_check_path,
+		    health_check_interval_ms = EXCLUDED.health_check_interval_ms,
+		    headers = EXCLUDED.headers,
+		    query_params = EXCLUDED.query_params,
+		    connection_pool_size = EXCLUDED.connection_pool_size,
+		    keep_alive = EXCLUDED.keep_alive,
+		    follow_redirects = EXCLUDED.follow_redirects,
+		    max_redirects = EXCLUDED.max_redirects,
+		    user_agent = EXCLUDED.user_agent,
+		    credential_passthrough = EXCLUDED.credential_passthrough,
+		    updated_at = now()
+		RETURNING created_at, updated_at
+	`
+
+	err := ds.db.QueryRow(query,
+		config.ServerID,
+		config.BaseURL,
+		config.SSEPath,
+		config.AuthType,
+		config.AuthConfig,
+		config.TimeoutMs,
+		config.ConnectTimeoutMs,
+		config.RetryAttempts,
+		config.RetryDelayMs,
+		config.HealthCheckEnabled,
+		config.HealthCheckPath,
+		config.HealthCheckIntervalMs,
+		config.Headers,
+		config.QueryParams,
+		config.ConnectionPoolSize,
+		config.KeepAlive,
+		config.FollowRedirects,
+		config.MaxRedirects,
+		config.UserAgent,
+		config.CredentialPassthrough,
+	).Scan(&config.CreatedAt, &config.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save sse config: %w", err)
+	}
+	logger.Debug("%s", query)
+	return nil
+}
+
+// DeleteSSEServiceConfig 删除 SSE 配置，配置不存在时返回 false
+func (ds *DatabaseService) DeleteSSEServiceConfig(serverID string) (bool, error) {
+	query := `DELETE FROM mcp_service_sse WHERE server_id = $1`
+	return ds.execAffected(query, "failed to delete sse config", serverID)
+}
+
+// execAffected 执行语句并返回是否有记录受影响
+func (ds *DatabaseService) execAffected(query, errPrefix string, args ...interface{}) (bool, error) {
+	result, err := ds.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	logger.Debug("%s", query)
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// auditChainLock 追加审计记录时持有的事务级咨询锁，多个实例串行写入同一条哈希链
+const auditChainLock = 0x6d6370617564 // "mcpaud"
+
+// maxAuditQueryRows 审计记录查询的最大行数
+const maxAuditQueryRows = 1000
+
+const auditColumns = `id, occurred_at, event_type, actor, user_id, key_id, action, server_id, tool_name,
+	target, arguments_hash, arguments, status, details, prev_hash, hash`
+
+// AppendAuditEntries 在一个事务中追加一批审计记录：持有咨询锁读取最后一条记录的 hash，
+// 依次设置每条记录的 PrevHash 并以 hash 计算 Hash 后写入
+func (ds *DatabaseService) AppendAuditEntries(entries []models.AuditEntry, hash func(entry *models.AuditEntry) string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+
+	var prevHash string
+	err = tx.QueryRow("SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query last audit entry: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO audit_log (occurred_at, event_type, actor, user_id, key_id, action, server_id, tool_name,
+		                       target, arguments_hash, arguments, status, details, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare audit insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i := range entries {
+		entry := &entries[i]
+		entry.PrevHash = prevHash
+		entry.Hash = hash(entry)
+		if _, err = stmt.Exec(
+			entry.OccurredAt,
+			entry.EventType,
+			entry.Actor,
+			nullString(entry.UserID),
+			nullString(entry.KeyID),
+			entry.Action,
+			nullString(entry.ServerID),
+			nullString(entry.ToolName),
+			nullString(entry.Target),
+			nullString(entry.ArgumentsHash),
+			entry.Arguments,
+			entry.Status,
+			entry.Details,
+			entry.PrevHash,
+			entry.Hash,
+		); err != nil {
+			return fmt.Errorf("failed to insert audit entry: %w", err)
+		}
+		prevHash = entry.Hash
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit audit entries: %w", err)
+	}
+	logger.Debug("Appended %d audit entries", len(entries))
+	return nil
+}
+
+// ListAuditEntries 按条件查询审计记录，按 id 倒序，最多返回 maxAuditQueryRows 行
+func (ds *DatabaseService) ListAuditEntries(q models.AuditQuery) ([]models.AuditEntry, error) {
+	var args []interface{}
+	var conditions []string
+	condition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	filter := func(column, value string) {
+		if value != "" {
+			condition(column+" = $%d", value)
+		}
+	}
+	if !q.From.IsZero() {
+		condition("occurred_at >= $%d", q.From)
+	}
+	if !q.To.IsZero() {
+		condition("occurred_at < $%d", q.To)
+	}
+	if q.BeforeID > 0 {
+		condition("id < $%d", q.BeforeID)
+	}
+	filter("event_type", q.EventType)
+	filter("actor", q.Actor)
+	filter("user_id", q.UserID)
+	filter("key_id", q.KeyID)
+	filter("server_id", q.ServerID)
+	filter("tool_name", q.ToolName)
+	filter("action", q.Action)
+	filter("status", q.Status)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > maxAuditQueryRows {
+		limit = maxAuditQueryRows
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM audit_log %s ORDER BY id DESC LIMIT %d", auditColumns, where, limit)
+	return ds.queryAuditEntries(query, args...)
+}
+
+// ListAuditEntriesAfter 按 id 顺序返回 id 大于 afterID 的审计记录，用于校验哈希链
+func (ds *DatabaseService) ListAuditEntriesAfter(afterID int64, limit int) ([]models.AuditEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2", auditColumns)
+	return ds.queryAuditEntries(query, afterID, limit)
+}
+
+func (ds *DatabaseService) queryAuditEntries(query string, args ...interface{}) ([]models.AuditEntry, error) {
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var userID, keyID, serverID, toolName, target, argumentsHash sql.NullString
+		if err = rows.Scan(
+			&entry.ID,
+			&entry.OccurredAt,
+			&entry.EventType,
+			&entry.Actor,
+			&userID,
+			&keyID,
+			&entry.Action,
+			&serverID,
+			&toolName,
+			&target,
+			&argumentsHash,
+			&entry.Arguments,
+			&entry.Status,
+			&entry.Details,
+			&entry.PrevHash,
+			&entry.Hash,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.OccurredAt = entry.OccurredAt.UTC()
+		entry.UserID = userID.String
+		entry.KeyID = keyID.String
+		entry.ServerID = serverID.String
+		entry.ToolName = toolName.String
+		entry.Target = target.String
+		entry.ArgumentsHash = argumentsHash.String
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"McpServer/internal/logger"
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -15,7 +16,7 @@ import (
 
 // DatabaseService 数据库服务
 type DatabaseService struct {
-	db *sql.DB
+	db *instrumentedDB
 }
 
 // DatabaseConfig 数据库配置接口
@@ -48,7 +49,15 @@ func NewDatabaseService(config DatabaseConfig) (*DatabaseService, error) {
 	}
 
 	logger.Info("Successfully connected to database")
-	return &DatabaseService{db: db}, nil
+	return &DatabaseService{db: &instrumentedDB{db}}, nil
+}
+
+// Ping 检查数据库连接是否可用
+func (ds *DatabaseService) Ping(ctx context.Context) error {
+	if err := ds.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
 }
 
 // Close 关闭数据库连接
@@ -133,7 +142,7 @@ func (ds *DatabaseService) GetServiceByID(serverID string) (*models.MCPService,
 // GetToolsByServerID 根据 server_id 获取该服务的所有工具
 func (ds *DatabaseService) GetToolsByServerID(serverID string) ([]models.MCPTool, error) {
 	query := `
-		SELECT id, server_id, name, description, args_schema, enabled, 
+		SELECT id, server_id, name, description, args_schema, output_schema, enabled, 
 		       created_at, updated_at, handler_type, handler_config
 		FROM mcp_tool 
 		WHERE server_id = $1 AND enabled = true
@@ -156,6 +165,7 @@ func (ds *DatabaseService) GetToolsByServerID(serverID string) ([]models.MCPTool
 			&tool.Name,
 			&tool.Description,
 			&tool.ArgsSchema,
+			&tool.OutputSchema,
 			&tool.Enabled,
 			&tool.CreatedAt,
 			&tool.UpdatedAt,
@@ -191,9 +201,22 @@ func (ds *DatabaseService) GetServiceWithTools(serverID string) (*models.Service
 
 // GetStdioServiceConfig 获取远程 stdio 服务配置
 func (ds *DatabaseService) GetStdioServiceConfig(serverID string) (*models.MCPServiceStdio, error) {
+	config, err := ds.queryStdioServiceConfig(serverID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("stdio config for server %s not found", serverID)
+		}
+		return nil, fmt.Errorf("failed to get stdio config: %w", err)
+	}
+	return config, nil
+}
+
+// queryStdioServiceConfig 查询 stdio 配置，记录不存在时返回 sql.ErrNoRows
+func (ds *DatabaseService) queryStdioServiceConfig(serverID string) (*models.MCPServiceStdio, error) {
 	query := `
 		SELECT server_id, command, args, workdir, env, startup_timeout_ms, 
-		       shutdown_timeout_ms, reuse_strategy, idle_ttl_ms, max_restarts, init_params
+		       shutdown_timeout_ms, reuse_strategy, max_concurrent, idle_ttl_ms, max_restarts, init_params,
+		       credential_passthrough
 		FROM mcp_service_stdio 
 		WHERE server_id = $1
 	`
@@ -209,16 +232,15 @@ func (ds *DatabaseService) GetStdioServiceConfig(serverID string) (*models.MCPSe
 		&config.StartupTimeoutMs,
 		&config.ShutdownTimeoutMs,
 		&config.ReuseStrategy,
+		&config.MaxConcurrent,
 		&config.IdleTtlMs,
 		&config.MaxRestarts,
 		&config.InitParams,
+		&config.CredentialPassthrough,
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("stdio config for server %s not found", serverID)
-		}
-		return nil, fmt.Errorf("failed to get stdio config: %w", err)
+		return nil, err
 	}
 	logger.Debug("%s", query)
 	config.Args = args
@@ -227,18 +249,33 @@ func (ds *DatabaseService) GetStdioServiceConfig(serverID string) (*models.MCPSe
 
 // GetSSEServiceConfig 获取远程 SSE 服务配置
 func (ds *DatabaseService) GetSSEServiceConfig(serverID string) (*models.MCPServiceSSE, error) {
-	query := `
-		SELECT server_id, base_url, sse_path, auth_type, auth_config, 
-		       timeout_ms, connect_timeout_ms, retry_attempts, retry_delay_ms,
-		       health_check_enabled, health_check_path, health_check_interval_ms,
-		       headers, query_params, connection_pool_size, keep_alive,
-		       follow_redirects, max_redirects, user_agent, created_at, updated_at
-		FROM mcp_service_sse 
-		WHERE server_id = $1
-	`
+	config, err := ds.querySSEServiceConfig(serverID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("sse config for server %s not found", serverID)
+		}
+		return nil, fmt.Errorf("failed to get sse config: %w", err)
+	}
+	return config, nil
+}
 
+// sseServiceColumns mcp_service_sse 的列，顺序与 scanSSEServiceConfig 一致
+const sseServiceColumns = `s.server_id, s.base_url, s.sse_path, s.auth_type, s.auth_config,
+		       s.timeout_ms, s.connect_timeout_ms, s.retry_attempts, s.retry_delay_ms,
+		       s.health_check_enabled, s.health_check_path, s.health_check_interval_ms,
+		       s.headers, s.query_params, s.connection_pool_size, s.keep_alive,
+		       s.follow_redirects, s.max_redirects, s.user_agent, s.credential_passthrough,
+		       s.created_at, s.updated_at`
+
+// rowScanner *sql.Row 和 *sql.Rows 共有的 Scan
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSSEServiceConfig 读取按 sseServiceColumns 查询的一行
+func scanSSEServiceConfig(row rowScanner) (*models.MCPServiceSSE, error) {
 	var config models.MCPServiceSSE
-	err := ds.db.QueryRow(query, serverID).Scan(
+	err := row.Scan(
 		&config.ServerID,
 		&config.BaseURL,
 		&config.SSEPath,
@@ -258,18 +295,60 @@ func (ds *DatabaseService) GetSSEServiceConfig(serverID string) (*models.MCPServ
 		&config.FollowRedirects,
 		&config.MaxRedirects,
 		&config.UserAgent,
+		&config.CredentialPassthrough,
 		&config.CreatedAt,
 		&config.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
 
+// querySSEServiceConfig 查询 SSE 配置，记录不存在时返回 sql.ErrNoRows
+func (ds *DatabaseService) querySSEServiceConfig(serverID string) (*models.MCPServiceSSE, error) {
+	query := `
+		SELECT ` + sseServiceColumns + `
+		FROM mcp_service_sse s
+		WHERE s.server_id = $1
+	`
+
+	config, err := scanSSEServiceConfig(ds.db.QueryRow(query, serverID))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("sse config for server %s not found", serverID)
-		}
-		return nil, fmt.Errorf("failed to get sse config: %w", err)
+		return nil, err
 	}
 	logger.Debug("%s", query)
-	return &config, nil
+	return config, nil
+}
+
+// ListHealthCheckedSSEServices 获取启用且开启了健康检查的远程 SSE 服务配置
+func (ds *DatabaseService) ListHealthCheckedSSEServices() ([]models.MCPServiceSSE, error) {
+	query := `
+		SELECT ` + sseServiceColumns + `
+		FROM mcp_service_sse s
+		JOIN mcp_service m ON m.server_id = s.server_id
+		WHERE m.enabled = true AND m.adapter = 'remote_sse' AND s.health_check_enabled = true
+		ORDER BY s.server_id
+	`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health checked sse services: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []models.MCPServiceSSE
+	for rows.Next() {
+		config, err1 := scanSSEServiceConfig(rows)
+		if err1 != nil {
+			return nil, fmt.Errorf("failed to scan sse config: %w", err1)
+		}
+		configs = append(configs, *config)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sse configs: %w", err)
+	}
+	return configs, nil
 }
 
 // IsRemoteStdioService 检查服务是否为远程 stdio 服务
@@ -309,7 +388,7 @@ func (ds *DatabaseService) IsRemoteSSEService(serverID string) (bool, error) {
 }
 
 // GetEmployeeByName 根据姓名查询员工信息
-func (ds *DatabaseService) GetEmployeeByName(name string) (*models.Employee, error) {
+func (ds *DatabaseService) GetEmployeeByName(ctx context.Context, name string) (*models.Employee, error) {
 	query := `
 		SELECT id, name, address, phone, enabled
 		FROM employees 
@@ -317,7 +396,7 @@ func (ds *DatabaseService) GetEmployeeByName(name string) (*models.Employee, err
 	`
 
 	var employee models.Employee
-	err := ds.db.QueryRow(query, name).Scan(
+	err := ds.db.QueryRowContext(ctx, query, name).Scan(
 		&employee.ID,
 		&employee.Name,
 		&employee.Address,
@@ -336,7 +415,7 @@ func (ds *DatabaseService) GetEmployeeByName(name string) (*models.Employee, err
 }
 
 // GetAllEmployees 获取所有启用的员工列表
-func (ds *DatabaseService) GetAllEmployees() ([]models.Employee, error) {
+func (ds *DatabaseService) GetAllEmployees(ctx context.Context) ([]models.Employee, error) {
 	query := `
 		SELECT id, name, address, phone, enabled
 		FROM employees 
@@ -344,7 +423,7 @@ func (ds *DatabaseService) GetAllEmployees() ([]models.Employee, error) {
 		ORDER BY name
 	`
 
-	rows, err := ds.db.Query(query)
+	rows, err := ds.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query employees: %v", err)
 	}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/metrics"
+	"McpServer/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queryTablePattern 取语句中第一个 FROM、INTO、UPDATE 或 JOIN 之后的表名
+var queryTablePattern = regexp.MustCompile(`(?i)\b(?:from|into|update|join)\s+(?:"?public"?\.)?"?(\w+)`)
+
+// queryLabels 语句 -> 指标标签（语句类型和表名），语句文本是有限的常量
+var queryLabels sync.Map
+
+// instrumentedDB 包装 *sql.DB，记录每次查询的耗时
+type instrumentedDB struct {
+	*sql.DB
+}
+
+func (db *instrumentedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow 查询在调用时执行，Scan 只读取结果
+func (db *instrumentedDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db *instrumentedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return db.DB.Exec(query, args...)
+}
+
+// QueryContext 与 Query 相同，ctx 中有 span 时为查询创建子 span
+func (db *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer observeQuery(query, time.Now())
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	endQuerySpan(span, err)
+	return rows, err
+}
+
+// QueryRowContext 与 QueryRow 相同，ctx 中有 span 时为查询创建子 span
+func (db *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	defer observeQuery(query, time.Now())
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	endQuerySpan(span, row.Err())
+	return row
+}
+
+func (db *instrumentedDB) Begin() (*instrumentedTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{tx}, nil
+}
+
+// instrumentedTx 包装 *sql.Tx，记录事务内每次查询的耗时（预编译语句除外）
+type instrumentedTx struct {
+	*sql.Tx
+}
+
+func (tx *instrumentedTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.QueryRow(query, args...)
+}
+
+func (tx *instrumentedTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.Exec(query, args...)
+}
+
+func observeQuery(query string, start time.Time) {
+	l := labelsOf(query)
+	metrics.ObserveDBQuery(l[0], l[1], time.Since(start))
+}
+
+// startQuerySpan 只在 ctx 中已有 span（属于某个请求）时创建查询的 span，后台任务的查询不单独成为 trace
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil
+	}
+	l := labelsOf(query)
+	return tracing.Start(ctx, strings.TrimSpace("db "+l[0]+" "+l[1]), trace.SpanKindClient,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", l[0]),
+		attribute.String("db.sql.table", l[1]),
+	)
+}
+
+func endQuerySpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+// labelsOf 返回缓存的语句标签
+func labelsOf(query string) [2]string {
+	labels, ok := queryLabels.Load(query)
+	if !ok {
+		labels, _ = queryLabels.LoadOrStore(query, parseQueryLabels(query))
+	}
+	return labels.([2]string)
+}
+
+// parseQueryLabels 返回语句类型（select、insert 等，小写）和表名，无法识别表名时为空
+func parseQueryLabels(query string) [2]string {
+	var labels [2]string
+	if fields := strings.Fields(query); len(fields) > 0 {
+		labels[0] = strings.ToLower(fields[0])
+	}
+	if match := queryTablePattern.FindStringSubmatch(query); match != nil {
+		labels[1] = strings.ToLower(match[1])
+	}
+	return labels
+}
@@ -0,0 +1,59 @@
+-- 为 mcp_tool 表添加 output_schema 字段，用于声明工具结构化输出的 JSON Schema
+
+-- 添加 output_schema 字段（如果不存在）
+DO $$ 
+BEGIN 
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns 
+        WHERE table_name = 'mcp_tool' AND column_name = 'output_schema'
+    ) THEN
+        ALTER TABLE "public"."mcp_tool" 
+        ADD COLUMN "output_schema" jsonb;
+    END IF;
+END $$;
+
+-- 添加字段注释
+COMMENT ON COLUMN "public"."mcp_tool"."output_schema" IS '工具结构化输出的 JSON Schema（可选，根类型须为 object），为空表示只返回文本内容';
+
+-- 为员工查询工具设置输出 schema
+UPDATE "public"."mcp_tool" 
+SET "output_schema" = '{
+  "type": "object",
+  "properties": {
+    "found": {"type": "boolean", "description": "是否找到员工"},
+    "name": {"type": "string", "description": "员工姓名"},
+    "address": {"type": "string", "description": "员工地址"},
+    "phone": {"type": "string", "description": "员工电话"}
+  },
+  "required": ["found", "name"]
+}'
+WHERE "handler_type" = 'builtin_employee_query';
+
+UPDATE "public"."mcp_tool" 
+SET "output_schema" = '{
+  "type": "object",
+  "properties": {
+    "found": {"type": "boolean", "description": "是否找到员工"},
+    "name": {"type": "string", "description": "员工姓名"},
+    "address": {"type": "string", "description": "员工地址"}
+  },
+  "required": ["found", "name"]
+}'
+WHERE "handler_type" = 'builtin_employee_address';
+
+UPDATE "public"."mcp_tool" 
+SET "output_schema" = '{
+  "type": "object",
+  "properties": {
+    "found": {"type": "boolean", "description": "是否找到员工"},
+    "name": {"type": "string", "description": "员工姓名"},
+    "phone": {"type": "string", "description": "员工电话"}
+  },
+  "required": ["found", "name"]
+}'
+WHERE "handler_type" = 'builtin_employee_phone';
+
+-- 验证结果
+SELECT "server_id", "name", "handler_type", "output_schema" IS NOT NULL AS "has_output_schema"
+FROM "public"."mcp_tool"
+ORDER BY "server_id", "name";
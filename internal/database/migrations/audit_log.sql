@@ -0,0 +1,52 @@
+-- 审计日志：网关将每次工具调用和管理接口的变更操作追加到 audit_log，相邻记录以 SHA-256 哈希链接，
+-- 执行 mcp-server -verify-audit 或调用 GET /admin/audit/verify 校验整条链
+
+CREATE TABLE IF NOT EXISTS "public"."audit_log" (
+    "id" bigserial PRIMARY KEY,
+    "occurred_at" timestamptz NOT NULL,
+    "event_type" text NOT NULL CHECK (event_type IN ('tool_call', 'admin')),
+    "actor" text NOT NULL,                                     -- 调用方标识：key:<key_id>、user:<sub>、static:<指纹> 或 anonymous
+    "user_id" text,
+    "key_id" text,
+    "action" text NOT NULL,                                    -- tools/call 或管理接口路由
+    "server_id" text,
+    "tool_name" text,
+    "target" text,                                             -- 管理接口的请求路径
+    "arguments_hash" text,                                     -- 工具参数或管理请求体的 SHA-256
+    "arguments" jsonb,                                         -- 遮蔽后的工具参数（audit.arguments 为 redacted 时）
+    "status" text NOT NULL,                                    -- success、error、permission_denied、rate_limited、quota_exceeded，管理操作为 HTTP 状态码
+    "details" jsonb,
+    "prev_hash" text NOT NULL,                                 -- 上一条记录的 hash，第一条为空字符串
+    "hash" text NOT NULL                                       -- SHA-256(prev_hash + 本条全部字段)
+);
+
+-- 设置表所有者
+ALTER TABLE "public"."audit_log" OWNER TO "wcs";
+
+CREATE INDEX IF NOT EXISTS "idx_audit_log_occurred_at" ON "public"."audit_log" ("occurred_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_log_actor" ON "public"."audit_log" ("actor", "id");
+CREATE INDEX IF NOT EXISTS "idx_audit_log_server_tool" ON "public"."audit_log" ("server_id", "tool_name", "id");
+
+-- 只允许追加：拒绝修改和删除（表所有者仍可禁用触发器，篡改由哈希链发现）
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON "public"."audit_log";
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON "public"."audit_log"
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON "public"."audit_log";
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON "public"."audit_log"
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- 字段注释
+COMMENT ON TABLE "public"."audit_log" IS '只追加的审计日志，相邻记录以 SHA-256 哈希链接';
+COMMENT ON COLUMN "public"."audit_log"."status" IS '工具调用：success、error、permission_denied、rate_limited、quota_exceeded；管理操作：HTTP 状态码';
+COMMENT ON COLUMN "public"."audit_log"."prev_hash" IS '上一条记录（按 id）的 hash，第一条为空字符串';
+COMMENT ON COLUMN "public"."audit_log"."hash" IS 'SHA-256(prev_hash 与本条全部字段的规范 JSON)，十六进制';
@@ -0,0 +1,38 @@
+-- 配置表变更时通过 NOTIFY 通知网关热重载，负载为受影响的 server_id
+-- 网关配置 reload.listen_notify: true 时监听 mcp_config_changed 频道
+
+CREATE OR REPLACE FUNCTION "public"."notify_mcp_config_changed"()
+RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('mcp_config_changed', OLD.server_id);
+    ELSE
+        PERFORM pg_notify('mcp_config_changed', NEW.server_id);
+        -- server_id 被修改时同时通知旧的服务
+        IF TG_OP = 'UPDATE' AND OLD.server_id IS DISTINCT FROM NEW.server_id THEN
+            PERFORM pg_notify('mcp_config_changed', OLD.server_id);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS "trg_mcp_service_notify" ON "public"."mcp_service";
+CREATE TRIGGER "trg_mcp_service_notify"
+    AFTER INSERT OR UPDATE OR DELETE ON "public"."mcp_service"
+    FOR EACH ROW EXECUTE FUNCTION "public"."notify_mcp_config_changed"();
+
+DROP TRIGGER IF EXISTS "trg_mcp_tool_notify" ON "public"."mcp_tool";
+CREATE TRIGGER "trg_mcp_tool_notify"
+    AFTER INSERT OR UPDATE OR DELETE ON "public"."mcp_tool"
+    FOR EACH ROW EXECUTE FUNCTION "public"."notify_mcp_config_changed"();
+
+DROP TRIGGER IF EXISTS "trg_mcp_service_stdio_notify" ON "public"."mcp_service_stdio";
+CREATE TRIGGER "trg_mcp_service_stdio_notify"
+    AFTER INSERT OR UPDATE OR DELETE ON "public"."mcp_service_stdio"
+    FOR EACH ROW EXECUTE FUNCTION "public"."notify_mcp_config_changed"();
+
+DROP TRIGGER IF EXISTS "trg_mcp_service_sse_notify" ON "public"."mcp_service_sse";
+CREATE TRIGGER "trg_mcp_service_sse_notify"
+    AFTER INSERT OR UPDATE OR DELETE ON "public"."mcp_service_sse"
+    FOR EACH ROW EXECUTE FUNCTION "public"."notify_mcp_config_changed"();
@@ -23,7 +23,7 @@ CREATE TABLE "public"."mcp_service_sse" (
   "updated_at" timestamptz(6) NOT NULL DEFAULT now(),
   CONSTRAINT "mcp_service_sse_pkey" PRIMARY KEY ("server_id"),
   CONSTRAINT "mcp_service_sse_server_id_fkey" FOREIGN KEY ("server_id") REFERENCES "public"."mcp_service" ("server_id") ON DELETE CASCADE ON UPDATE NO ACTION,
-  CONSTRAINT "mcp_service_sse_auth_type_check" CHECK (auth_type IN ('none', 'bearer_token', 'api_key', 'basic_auth', 'custom_header'))
+  CONSTRAINT "mcp_service_sse_auth_type_check" CHECK (auth_type IN ('none', 'bearer_token', 'api_key', 'basic_auth', 'custom_header', 'oauth2_client_credentials'))
 );
 
 -- 设置表所有者
@@ -48,13 +48,14 @@ COMMENT ON COLUMN "public"."mcp_service_sse"."base_url" IS '远程SSE服务的
 
 COMMENT ON COLUMN "public"."mcp_service_sse"."sse_path" IS 'SSE端点路径，通常为/sse或/mcp-server/sse';
 
-COMMENT ON COLUMN "public"."mcp_service_sse"."auth_type" IS '认证类型：none-无认证, bearer_token-Bearer令牌, api_key-API密钥, basic_auth-基础认证, custom_header-自定义头部';
+COMMENT ON COLUMN "public"."mcp_service_sse"."auth_type" IS '认证类型：none-无认证, bearer_token-Bearer令牌, api_key-API密钥, basic_auth-基础认证, custom_header-自定义头部, oauth2_client_credentials-OAuth2客户端凭证';
 
 COMMENT ON COLUMN "public"."mcp_service_sse"."auth_config" IS '认证配置JSON，根据auth_type包含不同字段：
 - bearer_token: {"token": "xxx"}
 - api_key: {"key": "xxx", "header": "X-API-Key"}
 - basic_auth: {"username": "xxx", "password": "xxx"}
-- custom_header: {"header_name": "value"}';
+- custom_header: {"header_name": "value"}
+- oauth2_client_credentials: {"token_url": "https://auth/token", "client_id": "xxx", "client_secret": "xxx", "scope": "a b", "audience": "可选", "client_auth_method": "client_secret_basic|client_secret_post"}';
 
 COMMENT ON COLUMN "public"."mcp_service_sse"."timeout_ms" IS '请求超时时间（毫秒）';
 
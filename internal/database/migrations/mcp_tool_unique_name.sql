@@ -0,0 +1,23 @@
+-- 同一服务下的工具名唯一，管理接口依赖该约束拒绝重名工具（返回 409）
+
+-- 已有重名工具时中止，需先手动处理
+DO $$
+DECLARE
+    duplicates text;
+BEGIN
+    SELECT string_agg(format('%s/%s', "server_id", "name"), ', ')
+    INTO duplicates
+    FROM (
+        SELECT "server_id", "name"
+        FROM "public"."mcp_tool"
+        GROUP BY "server_id", "name"
+        HAVING count(*) > 1
+    ) t;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'mcp_tool has duplicate tool names, rename or delete them first: %', duplicates;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "uq_mcp_tool_server_name"
+    ON "public"."mcp_tool" ("server_id", "name");
@@ -0,0 +1,28 @@
+-- 加密密钥存储：适配器配置（mcp_service_stdio.env、mcp_service_sse.auth_config/headers）中的
+-- secret://name 在连接时从本表解密。值以 AES-256-GCM 加密，主密钥不入库
+
+CREATE TABLE IF NOT EXISTS "public"."secrets" (
+    "name" text NOT NULL,
+    "description" text DEFAULT '',
+    "ciphertext" bytea NOT NULL,                               -- 密文（含 GCM 认证标签）
+    "nonce" bytea NOT NULL,                                    -- GCM 随机数
+    "key_id" text NOT NULL,                                    -- 主密钥指纹
+    "version" int4 NOT NULL DEFAULT 1,                         -- 每次设置或轮换加一
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT "secrets_pkey" PRIMARY KEY ("name"),
+    CONSTRAINT "secrets_name_check" CHECK (name ~ '^[A-Za-z0-9_.-]{1,128}$')
+);
+
+-- 设置表所有者
+ALTER TABLE "public"."secrets" OWNER TO "wcs";
+
+CREATE INDEX IF NOT EXISTS "idx_secrets_key_id" ON "public"."secrets" ("key_id");
+
+-- 字段注释
+COMMENT ON TABLE "public"."secrets" IS '加密存储的上游凭证，通过 secret://name 引用';
+COMMENT ON COLUMN "public"."secrets"."name" IS '密钥名称，配置中以 secret://name 引用';
+COMMENT ON COLUMN "public"."secrets"."ciphertext" IS 'AES-256-GCM 密文，附加数据为密钥名称';
+COMMENT ON COLUMN "public"."secrets"."nonce" IS 'GCM 随机数';
+COMMENT ON COLUMN "public"."secrets"."key_id" IS '加密所用主密钥的指纹（SHA-256 前 8 字节），轮换主密钥后用于选择解密密钥';
+COMMENT ON COLUMN "public"."secrets"."version" IS '版本号，每次设置或轮换加一';
@@ -0,0 +1,17 @@
+-- 允许 mcp_service_sse 使用 OAuth2 客户端凭证认证（oauth2_client_credentials）
+
+ALTER TABLE "public"."mcp_service_sse"
+  DROP CONSTRAINT IF EXISTS "mcp_service_sse_auth_type_check";
+
+ALTER TABLE "public"."mcp_service_sse"
+  ADD CONSTRAINT "mcp_service_sse_auth_type_check"
+  CHECK (auth_type IN ('none', 'bearer_token', 'api_key', 'basic_auth', 'custom_header', 'oauth2_client_credentials'));
+
+COMMENT ON COLUMN "public"."mcp_service_sse"."auth_type" IS '认证类型：none-无认证, bearer_token-Bearer令牌, api_key-API密钥, basic_auth-基础认证, custom_header-自定义头部, oauth2_client_credentials-OAuth2客户端凭证';
+
+COMMENT ON COLUMN "public"."mcp_service_sse"."auth_config" IS '认证配置JSON，根据auth_type包含不同字段：
+- bearer_token: {"token": "xxx"}
+- api_key: {"key": "xxx", "header": "X-API-Key"}
+- basic_auth: {"username": "xxx", "password": "xxx"}
+- custom_header: {"header_name": "value"}
+- oauth2_client_credentials: {"token_url": "https://auth/token", "client_id": "xxx", "client_secret": "xxx", "scope": "a b", "audience": "可选", "client_auth_method": "client_secret_basic|client_secret_post"}';
@@ -0,0 +1,71 @@
+-- 工具调用计量与配额：网关批量写入每次工具调用的明细（tool_usage）并累加按天/按月的计数（usage_counters），
+-- 调用前按 usage_quotas 检查密钥或用户的配额
+
+-- 工具调用明细
+CREATE TABLE IF NOT EXISTS "public"."tool_usage" (
+    "id" bigserial PRIMARY KEY,
+    "called_at" timestamptz NOT NULL,                          -- 调用开始时间
+    "caller" text NOT NULL,                                    -- 调用方标识：key:<key_id>、user:<sub>、static:<指纹> 或 anonymous
+    "user_id" text,                                            -- 用户ID：users.user_id 或 JWT 的 sub
+    "key_id" text,                                             -- 数据库密钥ID
+    "server_id" text NOT NULL,                                 -- 服务ID
+    "tool_name" text NOT NULL,                                 -- 工具名称
+    "duration_ms" int8 NOT NULL,                               -- 耗时（毫秒）
+    "success" bool NOT NULL,                                   -- 是否成功（未返回错误且 isError 不为 true）
+    "bytes_in" int8 NOT NULL DEFAULT 0,                        -- 参数大小（字节）
+    "bytes_out" int8 NOT NULL DEFAULT 0                        -- 结果大小（字节）
+);
+
+-- 设置表所有者
+ALTER TABLE "public"."tool_usage" OWNER TO "wcs";
+
+CREATE INDEX IF NOT EXISTS "idx_tool_usage_called_at" ON "public"."tool_usage" ("called_at");
+CREATE INDEX IF NOT EXISTS "idx_tool_usage_key_id" ON "public"."tool_usage" ("key_id", "called_at");
+CREATE INDEX IF NOT EXISTS "idx_tool_usage_user_id" ON "public"."tool_usage" ("user_id", "called_at");
+CREATE INDEX IF NOT EXISTS "idx_tool_usage_server_tool" ON "public"."tool_usage" ("server_id", "tool_name", "called_at");
+
+COMMENT ON TABLE "public"."tool_usage" IS '工具调用计量明细，由网关批量写入';
+COMMENT ON COLUMN "public"."tool_usage"."caller" IS '调用方标识，与限流的 caller 维度一致';
+COMMENT ON COLUMN "public"."tool_usage"."user_id" IS '用户ID，数据库密钥为 users.user_id，JWT/OAuth 为 sub 声明，因此不设外键';
+
+-- 按天/按月的调用计数（UTC），用于配额检查
+CREATE TABLE IF NOT EXISTS "public"."usage_counters" (
+    "subject_type" text NOT NULL CHECK (subject_type IN ('key', 'user')),
+    "subject_id" text NOT NULL,
+    "period" text NOT NULL CHECK (period IN ('day', 'month')),
+    "period_start" date NOT NULL,                              -- 当天或当月第一天（UTC）
+    "calls" int8 NOT NULL DEFAULT 0,
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT "usage_counters_pkey" PRIMARY KEY ("subject_type", "subject_id", "period", "period_start")
+);
+
+ALTER TABLE "public"."usage_counters" OWNER TO "wcs";
+
+COMMENT ON TABLE "public"."usage_counters" IS '密钥和用户按天、按月的工具调用次数（UTC），与 tool_usage 在同一事务中更新';
+
+-- 配额，未配置的密钥或用户不限制；同时配置了密钥和用户配额时两者都要满足
+CREATE TABLE IF NOT EXISTS "public"."usage_quotas" (
+    "subject_type" text NOT NULL CHECK (subject_type IN ('key', 'user')),
+    "subject_id" text NOT NULL,                                -- key_id 或用户ID
+    "daily_limit" int8 CHECK (daily_limit >= 0),               -- 每天（UTC）最多调用次数，NULL 表示不限制
+    "monthly_limit" int8 CHECK (monthly_limit >= 0),           -- 每月（UTC）最多调用次数，NULL 表示不限制
+    "description" text DEFAULT '',
+    "created_at" timestamptz DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" timestamptz DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "usage_quotas_pkey" PRIMARY KEY ("subject_type", "subject_id")
+);
+
+ALTER TABLE "public"."usage_quotas" OWNER TO "wcs";
+
+-- 创建更新时间触发器（update_updated_at_column 见 users.sql）
+DROP TRIGGER IF EXISTS update_usage_quotas_updated_at ON "public"."usage_quotas";
+CREATE TRIGGER update_usage_quotas_updated_at
+    BEFORE UPDATE ON "public"."usage_quotas"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE "public"."usage_quotas" IS '密钥或用户的工具调用配额，修改后最迟在 metering.quota_cache_ttl 后生效';
+COMMENT ON COLUMN "public"."usage_quotas"."subject_type" IS 'key: subject_id 为 user_keys.key_id；user: subject_id 为用户ID';
+
+-- 示例：限制某个密钥每天 1000 次、每月 20000 次
+-- INSERT INTO usage_quotas (subject_type, subject_id, daily_limit, monthly_limit)
+-- VALUES ('key', '00000000-0000-0000-0000-000000000000', 1000, 20000);
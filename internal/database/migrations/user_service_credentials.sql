@@ -0,0 +1,59 @@
+-- 按用户的上游凭证：部分上游 MCP 服务需要最终用户自己的令牌，而不是 auth_config 中的共享凭证
+
+-- 创建用户服务凭证表
+CREATE TABLE IF NOT EXISTS "public"."user_service_credentials" (
+    "credential_id" uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    "user_id" text NOT NULL,                                   -- 用户ID：users.user_id 或 JWT 的 sub
+    "server_id" text NOT NULL,                                 -- 关联服务ID
+    "credential" text NOT NULL,                                -- 凭证值
+    "expires_at" timestamptz,                                  -- 过期时间（可选）
+    "created_at" timestamptz DEFAULT CURRENT_TIMESTAMP,        -- 创建时间
+    "updated_at" timestamptz DEFAULT CURRENT_TIMESTAMP,        -- 更新时间
+
+    CONSTRAINT "uq_user_service_credentials" UNIQUE ("user_id", "server_id"),
+    CONSTRAINT "fk_user_service_credentials_server_id" FOREIGN KEY ("server_id") REFERENCES "public"."mcp_service" ("server_id") ON DELETE CASCADE
+);
+
+-- 设置表所有者
+ALTER TABLE "public"."user_service_credentials" OWNER TO "wcs";
+
+-- 创建更新时间触发器（update_updated_at_column 见 users.sql）
+DROP TRIGGER IF EXISTS update_user_service_credentials_updated_at ON "public"."user_service_credentials";
+CREATE TRIGGER update_user_service_credentials_updated_at
+    BEFORE UPDATE ON "public"."user_service_credentials"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 字段注释
+COMMENT ON TABLE "public"."user_service_credentials" IS '用户访问上游服务的凭证';
+COMMENT ON COLUMN "public"."user_service_credentials"."user_id" IS '用户ID，数据库密钥为 users.user_id，JWT/OAuth 为 sub 声明，因此不设外键';
+COMMENT ON COLUMN "public"."user_service_credentials"."server_id" IS '服务ID，关联mcp_service表';
+COMMENT ON COLUMN "public"."user_service_credentials"."credential" IS '凭证值，按服务的 credential_passthrough.user_credential 注入请求头或环境变量';
+COMMENT ON COLUMN "public"."user_service_credentials"."expires_at" IS '凭证过期时间，过期后视为不存在';
+
+-- 为适配器配置添加 credential_passthrough 字段（如果不存在）
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'mcp_service_sse' AND column_name = 'credential_passthrough'
+    ) THEN
+        ALTER TABLE "public"."mcp_service_sse"
+        ADD COLUMN "credential_passthrough" jsonb NOT NULL DEFAULT '{}'::jsonb;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'mcp_service_stdio' AND column_name = 'credential_passthrough'
+    ) THEN
+        ALTER TABLE "public"."mcp_service_stdio"
+        ADD COLUMN "credential_passthrough" jsonb NOT NULL DEFAULT '{}'::jsonb;
+    END IF;
+END $$;
+
+COMMENT ON COLUMN "public"."mcp_service_sse"."credential_passthrough" IS '转发调用方凭证：
+- forward_headers: {"X-Upstream-Token": "Authorization"} 调用方请求头 -> 上游请求头
+- forward_claims: {"email": "X-User-Email"} 调用方声明 -> 上游请求头
+- user_credential: {"header": "Authorization", "prefix": "Bearer ", "required": true} 注入 user_service_credentials 中的凭证';
+
+COMMENT ON COLUMN "public"."mcp_service_stdio"."credential_passthrough" IS '转发调用方凭证（仅 per_user）：
+- user_credential: {"env": "GITHUB_TOKEN", "required": true} 启动进程时将 user_service_credentials 中的凭证注入环境变量';
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"McpServer/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+// ConfigChangeChannel 配置表触发器发送通知的频道，负载为变更记录的 server_id（见 migrations/config_change_notify.sql）
+const ConfigChangeChannel = "mcp_config_changed"
+
+// ConfigChangeListener 通过 PostgreSQL LISTEN/NOTIFY 监听服务、工具及适配器配置的变更
+type ConfigChangeListener struct {
+	listener *pq.Listener
+	debounce time.Duration
+	stopChan chan struct{}
+}
+
+// NewConfigChangeListener 创建配置变更监听器，debounce 时间内的多次变更合并为一次回调
+func NewConfigChangeListener(config DatabaseConfig, debounce time.Duration) (*ConfigChangeListener, error) {
+	listener := pq.NewListener(config.GetDSN(), 5*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Config change listener event %d: %v", event, err)
+		}
+	})
+
+	if err := listener.Listen(ConfigChangeChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", ConfigChangeChannel, err)
+	}
+
+	logger.Info("Listening for config changes on channel %s (debounce: %v)", ConfigChangeChannel, debounce)
+	return &ConfigChangeListener{
+		listener: listener,
+		debounce: debounce,
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Run 处理通知直到 Close 被调用：onChange 接收合并后的 server_id 列表；
+// 连接断开重连后可能丢失通知，此时调用 onReconnect 以全量重载
+func (l *ConfigChangeListener) Run(onChange func(serverIDs []string), onReconnect func()) {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(l.debounce)
+	timer.Stop()
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		serverIDs := make([]string, 0, len(pending))
+		for serverID := range pending {
+			serverIDs = append(serverIDs, serverID)
+		}
+		sort.Strings(serverIDs)
+		pending = make(map[string]bool)
+		onChange(serverIDs)
+	}
+
+	for {
+		select {
+		case notification := <-l.listener.Notify:
+			// pq 在重连后发送 nil 通知
+			if notification == nil {
+				logger.Info("Config change listener reconnected, reloading all services")
+				pending = make(map[string]bool)
+				onReconnect()
+				continue
+			}
+			if notification.Extra == "" {
+				continue
+			}
+			logger.Debug("Config change notification for server: %s", notification.Extra)
+			if len(pending) == 0 {
+				timer.Reset(l.debounce)
+			}
+			pending[notification.Extra] = true
+		case <-timer.C:
+			flush()
+		case <-time.After(90 * time.Second):
+			// 定期检查连接是否存活
+			go l.listener.Ping()
+		case <-l.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Close 停止监听并关闭连接
+func (l *ConfigChangeListener) Close() error {
+	close(l.stopChan)
+	return l.listener.Close()
+}
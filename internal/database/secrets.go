@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// GetSecret 查询密钥，不存在时返回 nil, nil
+func (ds *DatabaseService) GetSecret(name string) (*models.Secret, error) {
+	query := `
+		SELECT name, COALESCE(description, ''), ciphertext, nonce, key_id, version, created_at, updated_at
+		FROM secrets
+		WHERE name = $1
+	`
+
+	var secret models.Secret
+	err := ds.db.QueryRow(query, name).Scan(
+		&secret.Name,
+		&secret.Description,
+		&secret.Ciphertext,
+		&secret.Nonce,
+		&secret.KeyID,
+		&secret.Version,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secret %s: %w", name, err)
+	}
+	return &secret, nil
+}
+
+// ListSecrets 列出全部密钥（含密文，供重新加密使用）
+func (ds *DatabaseService) ListSecrets() ([]models.Secret, error) {
+	query := `
+		SELECT name, COALESCE(description, ''), ciphertext, nonce, key_id, version, created_at, updated_at
+		FROM secrets
+		ORDER BY name
+	`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := []models.Secret{}
+	for rows.Next() {
+		var secret models.Secret
+		if err = rows.Scan(
+			&secret.Name,
+			&secret.Description,
+			&secret.Ciphertext,
+			&secret.Nonce,
+			&secret.KeyID,
+			&secret.Version,
+			&secret.CreatedAt,
+			&secret.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// UpsertSecret 创建或替换密钥，已存在时版本号加一；成功后回填版本和时间戳
+func (ds *DatabaseService) UpsertSecret(secret *models.Secret) error {
+	query := `
+		INSERT INTO secrets (name, description, ciphertext, nonce, key_id, version)
+		VALUES ($1, $2, $3, $4, $5, 1)
+		ON CONFLICT (name) DO UPDATE SET
+		    description = EXCLUDED.description,
+		    ciphertext = EXCLUDED.ciphertext,
+		    nonce = EXCLUDED.nonce,
+		    key_id = EXCLUDED.key_id,
+		    version = secrets.version + 1,
+		    updated_at = now()
+		RETURNING version, created_at, updated_at
+	`
+
+	err := ds.db.QueryRow(query,
+		secret.Name,
+		secret.Description,
+		secret.Ciphertext,
+		secret.Nonce,
+		secret.KeyID,
+	).Scan(&secret.Version, &secret.CreatedAt, &secret.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save secret %s: %w", secret.Name, err)
+	}
+	logger.Debug("Saved secret %s (version %d)", secret.Name, secret.Version)
+	return nil
+}
+
+// ReencryptSecret 用新的主密钥替换密文，值和版本不变；version 已变化（并发更新）时返回 false
+func (ds *DatabaseService) ReencryptSecret(secret *models.Secret) (bool, error) {
+	query := `
+		UPDATE secrets
+		SET ciphertext = $2, nonce = $3, key_id = $4
+		WHERE name = $1 AND version = $5
+	`
+	return ds.execAffected(query, "failed to re-encrypt secret", secret.Name, secret.Ciphertext, secret.Nonce, secret.KeyID, secret.Version)
+}
+
+// DeleteSecret 删除密钥，不存在时返回 false
+func (ds *DatabaseService) DeleteSecret(name string) (bool, error) {
+	query := `DELETE FROM secrets WHERE name = $1`
+	return ds.execAffected(query, "failed to delete secret", name)
+}
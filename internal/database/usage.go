@@ -0,0 +1,218 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// maxUsageReportRows 用量报表的最大行数
+const maxUsageReportRows = 10000
+
+// usageGroupColumns 用量报表可分组的维度 -> 列
+var usageGroupColumns = map[string]string{
+	"key":    "COALESCE(key_id, '')",
+	"user":   "COALESCE(user_id, '')",
+	"caller": "caller",
+	"server": "server_id",
+	"tool":   "tool_name",
+}
+
+// RecordToolUsage 在一个事务中写入一批工具调用明细并累加计数
+func (ds *DatabaseService) RecordToolUsage(usages []models.ToolUsage, counters []models.UsageCounter) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn("tool_usage",
+		"called_at", "caller", "user_id", "key_id", "server_id", "tool_name",
+		"duration_ms", "success", "bytes_in", "bytes_out"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare tool usage copy: %w", err)
+	}
+	for _, usage := range usages {
+		if _, err = stmt.Exec(
+			usage.CalledAt,
+			usage.Caller,
+			nullString(usage.UserID),
+			nullString(usage.KeyID),
+			usage.ServerID,
+			usage.ToolName,
+			usage.DurationMs,
+			usage.Success,
+			usage.BytesIn,
+			usage.BytesOut,
+		); err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy tool usage: %w", err)
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to copy tool usage: %w", err)
+	}
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("failed to copy tool usage: %w", err)
+	}
+
+	query := `
+		INSERT INTO usage_counters (subject_type, subject_id, period, period_start, calls)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (subject_type, subject_id, period, period_start) DO UPDATE SET
+		    calls = usage_counters.calls + EXCLUDED.calls,
+		    updated_at = now()
+	`
+	for _, counter := range counters {
+		if _, err = tx.Exec(query,
+			counter.SubjectType,
+			counter.SubjectID,
+			counter.Period,
+			counter.PeriodStart,
+			counter.Calls,
+		); err != nil {
+			return fmt.Errorf("failed to update usage counter: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tool usage: %w", err)
+	}
+	logger.Debug("Recorded %d tool calls and %d usage counters", len(usages), len(counters))
+	return nil
+}
+
+// GetUsageQuota 查询密钥或用户的配额，未配置时返回 nil, nil
+func (ds *DatabaseService) GetUsageQuota(subjectType, subjectID string) (*models.UsageQuota, error) {
+	query := `
+		SELECT subject_type, subject_id, daily_limit, monthly_limit
+		FROM usage_quotas
+		WHERE subject_type = $1 AND subject_id = $2
+	`
+
+	var quota models.UsageQuota
+	var daily, monthly sql.NullInt64
+	err := ds.db.QueryRow(query, subjectType, subjectID).Scan(
+		&quota.SubjectType,
+		&quota.SubjectID,
+		&daily,
+		&monthly,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage quota of %s %s: %w", subjectType, subjectID, err)
+	}
+	if daily.Valid {
+		quota.DailyLimit = &daily.Int64
+	}
+	if monthly.Valid {
+		quota.MonthlyLimit = &monthly.Int64
+	}
+	return &quota, nil
+}
+
+// GetUsageCount 查询密钥或用户在一个周期内已持久化的调用次数
+func (ds *DatabaseService) GetUsageCount(subjectType, subjectID, period string, periodStart time.Time) (int64, error) {
+	query := `
+		SELECT COALESCE(SUM(calls), 0)
+		FROM usage_counters
+		WHERE subject_type = $1 AND subject_id = $2 AND period = $3 AND period_start = $4
+	`
+
+	var calls int64
+	if err := ds.db.QueryRow(query, subjectType, subjectID, period, periodStart).Scan(&calls); err != nil {
+		return 0, fmt.Errorf("failed to query usage count of %s %s: %w", subjectType, subjectID, err)
+	}
+	return calls, nil
+}
+
+// UsageReport 按时间桶（UTC）和指定维度汇总工具调用，最多返回 maxUsageReportRows 行
+func (ds *DatabaseService) UsageReport(q models.UsageReportQuery) ([]models.UsageReportRow, error) {
+	args := []interface{}{q.Bucket, q.From, q.To}
+	conditions := []string{"called_at >= $2", "called_at < $3"}
+	filter := func(column, value string) {
+		if value != "" {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+	}
+	filter("server_id", q.ServerID)
+	filter("tool_name", q.ToolName)
+	filter("key_id", q.KeyID)
+	filter("user_id", q.UserID)
+
+	groupColumns := []string{"bucket"}
+	for _, group := range q.GroupBy {
+		column, ok := usageGroupColumns[group]
+		if !ok {
+			return nil, fmt.Errorf("unknown usage group %q", group)
+		}
+		groupColumns = append(groupColumns, column)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s,
+		       count(*),
+		       count(*) FILTER (WHERE NOT success),
+		       COALESCE(SUM(duration_ms), 0),
+		       COALESCE(AVG(duration_ms), 0),
+		       COALESCE(SUM(bytes_in), 0),
+		       COALESCE(SUM(bytes_out), 0)
+		FROM (SELECT *, date_trunc($1, called_at AT TIME ZONE 'UTC') AS bucket FROM tool_usage) usage
+		WHERE %s
+		GROUP BY %s
+		ORDER BY %s
+		LIMIT %d
+	`, strings.Join(groupColumns, ", "), strings.Join(conditions, " AND "),
+		strings.Join(groupColumns, ", "), strings.Join(groupColumns, ", "), maxUsageReportRows)
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage report: %w", err)
+	}
+	defer rows.Close()
+
+	report := []models.UsageReportRow{}
+	for rows.Next() {
+		var row models.UsageReportRow
+		dest := []interface{}{&row.Bucket}
+		for _, group := range q.GroupBy {
+			switch group {
+			case "key":
+				dest = append(dest, &row.KeyID)
+			case "user":
+				dest = append(dest, &row.UserID)
+			case "caller":
+				dest = append(dest, &row.Caller)
+			case "server":
+				dest = append(dest, &row.ServerID)
+			case "tool":
+				dest = append(dest, &row.ToolName)
+			}
+		}
+		dest = append(dest, &row.Calls, &row.Errors, &row.TotalDurationMs, &row.AvgDurationMs, &row.BytesIn, &row.BytesOut)
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan usage report: %w", err)
+		}
+		row.Bucket = row.Bucket.UTC()
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// nullString 空字符串写入为 NULL
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"McpServer/internal/models"
+)
+
+// GetUserServiceCredential 查询用户在指定服务上的凭证，未找到时返回 nil, nil
+func (ds *DatabaseService) GetUserServiceCredential(userID, serverID string) (*models.UserServiceCredential, error) {
+	query := `
+		SELECT user_id, server_id, credential, expires_at
+		FROM user_service_credentials
+		WHERE user_id = $1 AND server_id = $2
+	`
+
+	var credential models.UserServiceCredential
+	var expiresAt sql.NullTime
+	err := ds.db.QueryRow(query, userID, serverID).Scan(
+		&credential.UserID,
+		&credential.ServerID,
+		&credential.Credential,
+		&expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credential of user %s for server %s: %w", userID, serverID, err)
+	}
+
+	if expiresAt.Valid {
+		credential.ExpiresAt = &expiresAt.Time
+	}
+	return &credential, nil
+}
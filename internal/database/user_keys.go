@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// GetUserKeyByValue 根据密钥值查询 user_keys 记录及所属用户，未找到时返回 nil, nil
+func (ds *DatabaseService) GetUserKeyByValue(keyValue string) (*models.UserKey, error) {
+	query := `
+		SELECT uk.key_id, uk.user_id, u.username, u.name, COALESCE(u.status, 'active'),
+		       uk.key_name, COALESCE(uk.key_type, 'api'), COALESCE(uk.status, 'active'),
+		       COALESCE(uk.permissions, '[]'::jsonb), uk.expires_at
+		FROM user_keys uk
+		JOIN users u ON uk.user_id = u.user_id
+		WHERE uk.key_value = $1
+	`
+
+	var key models.UserKey
+	var permissions []byte
+	var expiresAt sql.NullTime
+	err := ds.db.QueryRow(query, keyValue).Scan(
+		&key.KeyID,
+		&key.UserID,
+		&key.Username,
+		&key.UserName,
+		&key.UserStatus,
+		&key.KeyName,
+		&key.KeyType,
+		&key.Status,
+		&permissions,
+		&expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user key: %w", err)
+	}
+
+	key.Permissions = permissions
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	return &key, nil
+}
+
+// RecordKeyUsage 累加密钥使用次数并更新最后使用时间
+func (ds *DatabaseService) RecordKeyUsage(keyID string, count int, lastUsedAt time.Time) error {
+	query := `
+		UPDATE user_keys
+		SET usage_count = COALESCE(usage_count, 0) + $2,
+		    last_used_at = GREATEST(COALESCE(last_used_at, $3), $3)
+		WHERE key_id = $1
+	`
+
+	if _, err := ds.db.Exec(query, keyID, count, lastUsedAt); err != nil {
+		return fmt.Errorf("failed to record usage for key %s: %w", keyID, err)
+	}
+	logger.Debug("Recorded %d uses for key %s", count, keyID)
+	return nil
+}
@@ -1,26 +1,30 @@
 package handlers
 
-import "McpServer/internal/models"
+import (
+	"context"
+
+	"McpServer/internal/models"
+)
 
 // DatabaseAdapter 数据库适配器，将 models.Employee 转换为 handlers.Employee
 type DatabaseAdapter struct {
 	db interface {
-		GetEmployeeByName(name string) (*models.Employee, error)
-		GetAllEmployees() ([]models.Employee, error)
+		GetEmployeeByName(ctx context.Context, name string) (*models.Employee, error)
+		GetAllEmployees(ctx context.Context) ([]models.Employee, error)
 	}
 }
 
 // NewDatabaseAdapter 创建数据库适配器
 func NewDatabaseAdapter(db interface {
-	GetEmployeeByName(name string) (*models.Employee, error)
-	GetAllEmployees() ([]models.Employee, error)
+	GetEmployeeByName(ctx context.Context, name string) (*models.Employee, error)
+	GetAllEmployees(ctx context.Context) ([]models.Employee, error)
 }) *DatabaseAdapter {
 	return &DatabaseAdapter{db: db}
 }
 
 // GetEmployeeByName 查询员工信息
-func (da *DatabaseAdapter) GetEmployeeByName(name string) (*Employee, error) {
-	employee, err := da.db.GetEmployeeByName(name)
+func (da *DatabaseAdapter) GetEmployeeByName(ctx context.Context, name string) (*Employee, error) {
+	employee, err := da.db.GetEmployeeByName(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -39,8 +43,8 @@ func (da *DatabaseAdapter) GetEmployeeByName(name string) (*Employee, error) {
 }
 
 // GetAllEmployees 获取所有员工
-func (da *DatabaseAdapter) GetAllEmployees() ([]Employee, error) {
-	employees, err := da.db.GetAllEmployees()
+func (da *DatabaseAdapter) GetAllEmployees(ctx context.Context) ([]Employee, error) {
+	employees, err := da.db.GetAllEmployees(ctx)
 	if err != nil {
 		return nil, err
 	}
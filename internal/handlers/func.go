@@ -12,8 +12,8 @@ type ToolHandler func(ctx context.Context, session *mcp.ServerSession, params *m
 
 // DatabaseService 数据库服务接口（避免循环依赖）
 type DatabaseService interface {
-	GetEmployeeByName(name string) (*Employee, error)
-	GetAllEmployees() ([]Employee, error)
+	GetEmployeeByName(ctx context.Context, name string) (*Employee, error)
+	GetAllEmployees(ctx context.Context) ([]Employee, error)
 }
 
 // Employee 员工模型（避免循环依赖）
@@ -68,6 +68,12 @@ func (r *ToolHandlerRegistry) GetHandler(handlerType string) (ToolHandler, bool)
 	return handler, exists
 }
 
+// HasHandler 检查处理器类型是否已注册
+func (r *ToolHandlerRegistry) HasHandler(handlerType string) bool {
+	_, exists := r.handlers[handlerType]
+	return exists
+}
+
 // RegisterBuiltinHandlers 注册内置处理器
 func (r *ToolHandlerRegistry) RegisterBuiltinHandlers() {
 	// Echo 处理器 - 回显输入的文本
@@ -75,23 +81,13 @@ func (r *ToolHandlerRegistry) RegisterBuiltinHandlers() {
 		// 类型断言获取参数
 		args, ok := params.Arguments.(map[string]interface{})
 		if !ok {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: No arguments provided"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("No arguments provided"), nil
 		}
 
 		// 获取要回显的文本
 		text, exists := args["text"].(string)
 		if !exists || text == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: 'text' parameter is required"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("'text' parameter is required"), nil
 		}
 
 		// 可选的前缀参数
@@ -173,62 +169,42 @@ func (r *ToolHandlerRegistry) RegisterBuiltinHandlers() {
 		// 类型断言获取参数
 		args, ok := params.Arguments.(map[string]interface{})
 		if !ok {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: No arguments provided"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("No arguments provided"), nil
 		}
 
 		// 获取员工姓名参数
 		name, exists := args["name"].(string)
 		if !exists || name == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: 'name' parameter is required"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("'name' parameter is required"), nil
 		}
 
 		// 查询员工信息
 		if r.db == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: Database service not available"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Database service not available"), nil
 		}
 
-		employee, err := r.db.GetEmployeeByName(name)
+		employee, err := r.db.GetEmployeeByName(ctx, name)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error querying employee: %v", err)},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Failed to query employee: %v", err), nil
 		}
 
 		if employee == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Employee '%s' not found", name)},
-				},
-			}, nil
+			return structuredResult(fmt.Sprintf("Employee '%s' not found", name), map[string]interface{}{
+				"found": false,
+				"name":  name,
+			}), nil
 		}
 
 		// 格式化员工信息
 		message := fmt.Sprintf("员工信息:\n姓名: %s\n地址: %s\n电话: %s",
 			employee.Name, employee.Address, employee.Phone)
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: message},
-			},
-		}, nil
+		return structuredResult(message, map[string]interface{}{
+			"found":   true,
+			"name":    employee.Name,
+			"address": employee.Address,
+			"phone":   employee.Phone,
+		}), nil
 	})
 
 	// 员工地址查询处理器
@@ -236,61 +212,40 @@ func (r *ToolHandlerRegistry) RegisterBuiltinHandlers() {
 		// 类型断言获取参数
 		args, ok := params.Arguments.(map[string]interface{})
 		if !ok {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: No arguments provided"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("No arguments provided"), nil
 		}
 
 		// 获取员工姓名参数
 		name, exists := args["name"].(string)
 		if !exists || name == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: 'name' parameter is required"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("'name' parameter is required"), nil
 		}
 
 		// 查询员工信息
 		if r.db == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: Database service not available"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Database service not available"), nil
 		}
 
-		employee, err := r.db.GetEmployeeByName(name)
+		employee, err := r.db.GetEmployeeByName(ctx, name)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error querying employee: %v", err)},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Failed to query employee: %v", err), nil
 		}
 
 		if employee == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Employee '%s' not found", name)},
-				},
-			}, nil
+			return structuredResult(fmt.Sprintf("Employee '%s' not found", name), map[string]interface{}{
+				"found": false,
+				"name":  name,
+			}), nil
 		}
 
 		// 只返回地址信息
 		message := fmt.Sprintf("%s 的地址: %s", employee.Name, employee.Address)
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: message},
-			},
-		}, nil
+		return structuredResult(message, map[string]interface{}{
+			"found":   true,
+			"name":    employee.Name,
+			"address": employee.Address,
+		}), nil
 	})
 
 	// 员工电话查询处理器
@@ -298,61 +253,40 @@ func (r *ToolHandlerRegistry) RegisterBuiltinHandlers() {
 		// 类型断言获取参数
 		args, ok := params.Arguments.(map[string]interface{})
 		if !ok {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: No arguments provided"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("No arguments provided"), nil
 		}
 
 		// 获取员工姓名参数
 		name, exists := args["name"].(string)
 		if !exists || name == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: 'name' parameter is required"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("'name' parameter is required"), nil
 		}
 
 		// 查询员工信息
 		if r.db == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: Database service not available"},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Database service not available"), nil
 		}
 
-		employee, err := r.db.GetEmployeeByName(name)
+		employee, err := r.db.GetEmployeeByName(ctx, name)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error querying employee: %v", err)},
-				},
-				IsError: true,
-			}, nil
+			return errorResult("Failed to query employee: %v", err), nil
 		}
 
 		if employee == nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Employee '%s' not found", name)},
-				},
-			}, nil
+			return structuredResult(fmt.Sprintf("Employee '%s' not found", name), map[string]interface{}{
+				"found": false,
+				"name":  name,
+			}), nil
 		}
 
 		// 只返回电话信息
 		message := fmt.Sprintf("%s 的电话: %s", employee.Name, employee.Phone)
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: message},
-			},
-		}, nil
+		return structuredResult(message, map[string]interface{}{
+			"found": true,
+			"name":  employee.Name,
+			"phone": employee.Phone,
+		}), nil
 	})
 
 	// 保留原有的处理器以兼容现有数据
@@ -383,3 +317,23 @@ func (r *ToolHandlerRegistry) createLegacyHandler(prefix string) ToolHandler {
 		}, nil
 	}
 }
+
+// errorResult 构造统一格式的错误结果（"Error: " 前缀，IsError 为 true）
+func errorResult(format string, args ...interface{}) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: "Error: " + fmt.Sprintf(format, args...)},
+		},
+		IsError: true,
+	}
+}
+
+// structuredResult 构造带结构化内容的结果，text 作为不支持 structuredContent 的旧客户端的文本回退
+func structuredResult(text string, structured map[string]interface{}) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		StructuredContent: structured,
+	}
+}
@@ -0,0 +1,360 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+	"McpServer/internal/metrics"
+	"McpServer/internal/models"
+)
+
+// 服务的健康状态
+const (
+	StatusUnknown   = "unknown"   // 尚未完成足够的探测
+	StatusHealthy   = "healthy"   // 最近的探测成功
+	StatusUnhealthy = "unhealthy" // 连续失败达到 unhealthy_threshold
+)
+
+// minInterval 检查间隔的下限，避免配置错误时压垮上游
+const minInterval = time.Second
+
+// ErrUnhealthy 服务被健康检查标记为不健康
+var ErrUnhealthy = errors.New("service is unhealthy")
+
+// Store 读取需要检查的服务
+type Store interface {
+	// ListHealthCheckedSSEServices 返回启用且开启了健康检查的远程 SSE 服务
+	ListHealthCheckedSSEServices() ([]models.MCPServiceSSE, error)
+}
+
+// Prober 探测一个服务，返回使用的方式（http 或 ping）
+type Prober interface {
+	ProbeSSEService(ctx context.Context, config *models.MCPServiceSSE) (string, error)
+}
+
+// Probe 一次探测的结果
+type Probe struct {
+	CheckedAt time.Time `json:"checked_at"`
+	OK        bool      `json:"ok"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ServiceHealth 服务的健康状态和最近的探测记录（由新到旧）
+type ServiceHealth struct {
+	ServerID             string     `json:"server_id"`
+	Status               string     `json:"status"`
+	Method               string     `json:"method,omitempty"`
+	IntervalMs           int64      `json:"interval_ms"`
+	LastCheckedAt        *time.Time `json:"last_checked_at,omitempty"`
+	LastSuccessAt        *time.Time `json:"last_success_at,omitempty"`
+	LastError            string     `json:"last_error,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutive_failures"`
+	ConsecutiveSuccesses int        `json:"consecutive_successes"`
+	StatusChangedAt      *time.Time `json:"status_changed_at,omitempty"`
+	History              []Probe    `json:"history"`
+}
+
+// target 一个被检查的服务及其后台任务
+type target struct {
+	config   models.MCPServiceSSE
+	stopChan chan struct{}
+	health   ServiceHealth // 受 Checker.mutex 保护
+}
+
+// Checker 按各服务的 health_check_interval_ms 在后台探测远程 SSE 服务，记录状态和探测历史。
+// 服务列表按 refresh_interval 从数据库重新读取，配置变化的服务重新开始检查
+type Checker struct {
+	store              Store
+	prober             Prober
+	refreshInterval    time.Duration
+	defaultInterval    time.Duration
+	timeout            time.Duration
+	unhealthyThreshold int
+	healthyThreshold   int
+	historySize        int
+
+	mutex   sync.RWMutex
+	targets map[string]*target
+
+	refreshSignal chan struct{}
+	stopChan      chan struct{}
+	done          chan struct{}
+	wg            sync.WaitGroup
+	stopOnce      sync.Once
+}
+
+// NewChecker 创建健康检查器并启动后台检查
+func NewChecker(cfg *config.HealthConfig, store Store, prober Prober) *Checker {
+	c := &Checker{
+		store:              store,
+		prober:             prober,
+		refreshInterval:    cfg.RefreshInterval,
+		defaultInterval:    cfg.DefaultInterval,
+		timeout:            cfg.Timeout,
+		unhealthyThreshold: cfg.UnhealthyThreshold,
+		healthyThreshold:   cfg.HealthyThreshold,
+		historySize:        cfg.HistorySize,
+		targets:            make(map[string]*target),
+		refreshSignal:      make(chan struct{}, 1),
+		stopChan:           make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Check 服务被标记为不健康时返回包装 ErrUnhealthy 的错误；未检查或状态未知的服务视为可用
+func (c *Checker) Check(serverID string) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	t, ok := c.targets[serverID]
+	if !ok || t.health.Status != StatusUnhealthy {
+		return nil
+	}
+	return fmt.Errorf("remote service %s failed %d consecutive health checks (last error: %s): %w",
+		serverID, t.health.ConsecutiveFailures, t.health.LastError, ErrUnhealthy)
+}
+
+// Services 全部被检查的服务的状态，按服务 ID 排序
+func (c *Checker) Services() []ServiceHealth {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	result := make([]ServiceHealth, 0, len(c.targets))
+	for _, t := range c.targets {
+		health := t.health
+		health.History = append([]Probe(nil), t.health.History...)
+		result = append(result, health)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ServerID < result[j].ServerID })
+	return result
+}
+
+// Unhealthy 被标记为不健康的服务 ID 和被检查的服务总数
+func (c *Checker) Unhealthy() ([]string, int) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	unhealthy := []string{}
+	for serverID, t := range c.targets {
+		if t.health.Status == StatusUnhealthy {
+			unhealthy = append(unhealthy, serverID)
+		}
+	}
+	sort.Strings(unhealthy)
+	return unhealthy, len(c.targets)
+}
+
+// Refresh 立即重新读取服务列表，用于服务配置变更后
+func (c *Checker) Refresh() {
+	select {
+	case c.refreshSignal <- struct{}{}:
+	default:
+	}
+}
+
+// Close 停止全部后台检查
+func (c *Checker) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
+	<-c.done
+}
+
+func (c *Checker) run() {
+	defer close(c.done)
+
+	c.refresh()
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.refresh()
+		case <-c.refreshSignal:
+			c.refresh()
+		case <-c.stopChan:
+			c.mutex.Lock()
+			for serverID, t := range c.targets {
+				close(t.stopChan)
+				delete(c.targets, serverID)
+				metrics.RemoveUpstreamHealth(serverID)
+			}
+			c.mutex.Unlock()
+			c.wg.Wait()
+			return
+		}
+	}
+}
+
+// refresh 按数据库中的服务列表启动、重启或停止检查；读取失败时保持当前列表
+func (c *Checker) refresh() {
+	services, err := c.store.ListHealthCheckedSSEServices()
+	if err != nil {
+		logger.Warn("Failed to list services for health checks: %v", err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	current := make(map[string]bool, len(services))
+	for _, service := range services {
+		current[service.ServerID] = true
+		if t, ok := c.targets[service.ServerID]; ok {
+			if sameConfig(&t.config, &service) {
+				continue
+			}
+			// 配置变化后重新开始检查，旧的状态不再适用
+			close(t.stopChan)
+			logger.Info("Restarting health checks for server %s after config change", service.ServerID)
+		} else {
+			logger.Info("Starting health checks for server %s", service.ServerID)
+		}
+		t := &target{
+			config:   service,
+			stopChan: make(chan struct{}),
+			health: ServiceHealth{
+				ServerID:   service.ServerID,
+				Status:     StatusUnknown,
+				IntervalMs: c.interval(&service).Milliseconds(),
+				History:    []Probe{},
+			},
+		}
+		c.targets[service.ServerID] = t
+		c.wg.Add(1)
+		go c.check(t)
+	}
+	for serverID, t := range c.targets {
+		if !current[serverID] {
+			close(t.stopChan)
+			delete(c.targets, serverID)
+			metrics.RemoveUpstreamHealth(serverID)
+			logger.Info("Stopped health checks for server %s", serverID)
+		}
+	}
+}
+
+// interval 服务的检查间隔
+func (c *Checker) interval(service *models.MCPServiceSSE) time.Duration {
+	interval := c.defaultInterval
+	if service.HealthCheckIntervalMs > 0 {
+		interval = time.Duration(service.HealthCheckIntervalMs) * time.Millisecond
+	}
+	if interval < minInterval {
+		interval = minInterval
+	}
+	return interval
+}
+
+// check 定期探测一个服务，直到服务被移除或配置变化
+func (c *Checker) check(t *target) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval(&t.config))
+	defer ticker.Stop()
+
+	for {
+		c.probe(t)
+		select {
+		case <-ticker.C:
+		case <-t.stopChan:
+			return
+		}
+	}
+}
+
+// probe 执行一次探测并更新状态
+func (c *Checker) probe(t *target) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	start := time.Now()
+	method, err := c.prober.ProbeSSEService(ctx, &t.config)
+	cancel()
+
+	probe := Probe{CheckedAt: start.UTC(), OK: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		probe.Error = err.Error()
+	}
+
+	c.mutex.Lock()
+	select {
+	case <-t.stopChan:
+		// 探测期间服务已被移除或替换
+		c.mutex.Unlock()
+		return
+	default:
+	}
+	previous := t.health.Status
+	c.record(&t.health, method, probe)
+	health := t.health
+	c.mutex.Unlock()
+
+	if health.Status != StatusUnknown {
+		metrics.SetUpstreamHealthy(health.ServerID, health.Status == StatusHealthy)
+	}
+	if health.Status == previous || (previous != StatusUnhealthy && health.Status != StatusUnhealthy) {
+		return
+	}
+	if health.Status == StatusUnhealthy {
+		logger.Warn("Remote service %s marked unhealthy after %d failed health checks: %s",
+			health.ServerID, health.ConsecutiveFailures, health.LastError)
+	} else {
+		logger.Info("Remote service %s is healthy again", health.ServerID)
+	}
+}
+
+// record 记录探测结果并按阈值更新状态；调用方需持有锁
+func (c *Checker) record(health *ServiceHealth, method string, probe Probe) {
+	health.Method = method
+	checkedAt := probe.CheckedAt
+	health.LastCheckedAt = &checkedAt
+
+	health.History = append([]Probe{probe}, health.History...)
+	if len(health.History) > c.historySize {
+		health.History = health.History[:c.historySize]
+	}
+
+	status := health.Status
+	if probe.OK {
+		health.LastSuccessAt = &checkedAt
+		health.LastError = ""
+		health.ConsecutiveFailures = 0
+		health.ConsecutiveSuccesses++
+		if status != StatusUnhealthy || health.ConsecutiveSuccesses >= c.healthyThreshold {
+			status = StatusHealthy
+		}
+	} else {
+		health.LastError = probe.Error
+		health.ConsecutiveSuccesses = 0
+		health.ConsecutiveFailures++
+		if health.ConsecutiveFailures >= c.unhealthyThreshold {
+			status = StatusUnhealthy
+		}
+	}
+	if status != health.Status {
+		health.Status = status
+		health.StatusChangedAt = &checkedAt
+	}
+}
+
+// sameConfig 比较影响探测的配置
+func sameConfig(a, b *models.MCPServiceSSE) bool {
+	return a.BaseURL == b.BaseURL && a.SSEPath == b.SSEPath && a.HealthCheckIntervalMs == b.HealthCheckIntervalMs &&
+		stringValue(a.HealthCheckPath) == stringValue(b.HealthCheckPath) && a.UpdatedAt.Equal(b.UpdatedAt)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader 请求 ID 头，调用方提供时沿用，否则由网关生成；响应中回传
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 调用方提供的请求 ID 的最大长度，超出或含不可见字符时重新生成
+const maxRequestIDLength = 128
+
+// fields 随 context 传递、附加到每条日志的字段
+type fields struct {
+	requestID string
+	sessionID string
+	serverID  string
+	user      string
+}
+
+type fieldsContextKey struct{}
+
+func fieldsFromContext(ctx context.Context) fields {
+	f, _ := ctx.Value(fieldsContextKey{}).(fields)
+	return f
+}
+
+func withFields(ctx context.Context, update func(*fields)) context.Context {
+	f := fieldsFromContext(ctx)
+	update(&f)
+	return context.WithValue(ctx, fieldsContextKey{}, f)
+}
+
+// WithRequestID 返回携带请求 ID 的 context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return withFields(ctx, func(f *fields) { f.requestID = requestID })
+}
+
+// WithSessionID 返回携带 MCP 会话 ID 的 context
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return withFields(ctx, func(f *fields) { f.sessionID = sessionID })
+}
+
+// WithServerID 返回携带服务 ID 的 context
+func WithServerID(ctx context.Context, serverID string) context.Context {
+	return withFields(ctx, func(f *fields) { f.serverID = serverID })
+}
+
+// WithUser 返回携带调用方标识的 context
+func WithUser(ctx context.Context, user string) context.Context {
+	return withFields(ctx, func(f *fields) { f.user = user })
+}
+
+// RequestID 返回 context 中的请求 ID
+func RequestID(ctx context.Context) string {
+	return fieldsFromContext(ctx).requestID
+}
+
+// Middleware 为每个请求分配请求 ID，写入 context 和响应头
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), requestID)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHandler 遮蔽消息中的敏感数据（包括标准库 log 的输出），并将 context 中的字段和 trace ID 附加到每条记录
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.Message = redactMessage(record.Message)
+	f := fieldsFromContext(ctx)
+	add := func(key, value string) {
+		if value != "" {
+			record.AddAttrs(slog.String(key, value))
+		}
+	}
+	add("request_id", f.requestID)
+	add("session_id", f.sessionID)
+	add("server_id", f.serverID)
+	add("user", f.user)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		add("trace_id", spanContext.TraceID().String())
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -1,10 +1,18 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"McpServer/internal/config"
 )
 
 // LogLevel 日志级别
@@ -18,32 +26,108 @@ const (
 	FATAL
 )
 
-var levelNames = map[LogLevel]string{
-	DEBUG: "DEBUG",
-	INFO:  "INFO",
-	WARN:  "WARN",
-	ERROR: "ERROR",
-	FATAL: "FATAL",
-}
+// levelFatal slog 没有 FATAL 级别，取高于 ERROR 的值并在输出时命名为 FATAL
+const levelFatal = slog.LevelError + 4
 
-// Logger 日志记录器
-type Logger struct {
-	level LogLevel
+var slogLevels = map[LogLevel]slog.Level{
+	DEBUG: slog.LevelDebug,
+	INFO:  slog.LevelInfo,
+	WARN:  slog.LevelWarn,
+	ERROR: slog.LevelError,
+	FATAL: levelFatal,
 }
 
-var defaultLogger *Logger
+// 日志格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	level   = new(slog.LevelVar)
+	current atomic.Pointer[slog.Logger]
+
+	outputMutex sync.Mutex
+	output      io.Closer // 当前日志文件，输出到控制台时为 nil
+)
 
 func init() {
-	defaultLogger = &Logger{level: INFO}
-	
-	// 配置标准log包
-	log.SetOutput(os.Stdout)
-	log.SetFlags(0) // 不添加时间戳
+	handler, _ := newHandler(os.Stdout, FormatText)
+	setHandler(handler)
+}
+
+// Configure 按配置设置日志级别、格式和输出：file 为空时输出到标准输出，
+// 否则写入文件并按 max_size_mb 轮转。标准库 log 的输出也经过同一个 handler
+func Configure(cfg *config.LoggingConfig) error {
+	SetLevelFromString(cfg.Level)
+
+	var writer io.Writer = os.Stdout
+	var file *rotatingFile
+	if cfg.File != "" {
+		var err error
+		file, err = openRotatingFile(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		writer = file
+	}
+
+	handler, err := newHandler(writer, cfg.Format)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}
+	setHandler(handler)
+
+	outputMutex.Lock()
+	previous := output
+	output = nil
+	if file != nil {
+		output = file
+	}
+	outputMutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// newHandler 创建指定格式的 handler，并附加 context 中的字段
+func newHandler(w io.Writer, format string) (slog.Handler, error) {
+	options := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.LevelKey {
+				if l, ok := attr.Value.Any().(slog.Level); ok && l >= levelFatal {
+					attr.Value = slog.StringValue("FATAL")
+				}
+			}
+			return attr
+		},
+	}
+
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return &contextHandler{slog.NewTextHandler(w, options)}, nil
+	case FormatJSON:
+		return &contextHandler{slog.NewJSONHandler(w, options)}, nil
+	default:
+		return nil, fmt.Errorf("logging.format must be %s or %s", FormatText, FormatJSON)
+	}
+}
+
+func setHandler(handler slog.Handler) {
+	l := slog.New(handler)
+	current.Store(l)
+	// 第三方库和标准库 log 的输出以 INFO 级别写入同一个 handler
+	slog.SetDefault(l)
 }
 
 // SetLevel 设置日志级别
-func SetLevel(level LogLevel) {
-	defaultLogger.level = level
+func SetLevel(l LogLevel) {
+	level.Set(slogLevels[l])
 }
 
 // SetLevelFromString 从字符串设置日志级别
@@ -64,58 +148,143 @@ func SetLevelFromString(levelStr string) {
 	}
 }
 
-// 内部日志记录方法
-func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
-	if level < l.level {
+// logf 格式化消息并写入一条记录，ctx 中的请求字段由 contextHandler 附加
+func logf(ctx context.Context, l slog.Level, format string, args ...interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logger := current.Load()
+	if !logger.Enabled(ctx, l) {
 		return
 	}
-	
-	levelName := levelNames[level]
-	message := fmt.Sprintf(format, args...)
-	log.Printf("[%s] %s", levelName, message)
+	if r := currentRedactor(); r != nil {
+		args = redactArgs(r, args)
+	}
+	record := slog.NewRecord(time.Now(), l, fmt.Sprintf(format, args...), 0)
+	_ = logger.Handler().Handle(ctx, record)
+}
+
+// minSecretLength 短于该长度的值不登记，避免遮蔽普通文本
+const minSecretLength = 6
+
+// maxSecrets 登记的敏感值上限
+const maxSecrets = 10000
+
+var (
+	secretMutex    sync.RWMutex
+	secretValues   = make(map[string]bool)
+	secretReplacer *strings.Replacer
+)
+
+// RegisterSecret 登记敏感值（如解密后的密钥），之后日志中出现该值时替换为 [REDACTED]
+func RegisterSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secretMutex.Lock()
+	defer secretMutex.Unlock()
+	if secretValues[value] || len(secretValues) >= maxSecrets {
+		return
+	}
+	secretValues[value] = true
+
+	// 较长的值优先匹配，避免只遮蔽其中一部分
+	values := make([]string, 0, len(secretValues))
+	for v := range secretValues {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, "[REDACTED]")
+	}
+	secretReplacer = strings.NewReplacer(pairs...)
+}
+
+// redact 遮蔽消息中已登记的敏感值
+func redact(message string) string {
+	secretMutex.RLock()
+	replacer := secretReplacer
+	secretMutex.RUnlock()
+	if replacer == nil {
+		return message
+	}
+	return replacer.Replace(message)
 }
 
 // 公共方法
 func Debug(format string, args ...interface{}) {
-	defaultLogger.logf(DEBUG, format, args...)
+	logf(nil, slog.LevelDebug, format, args...)
 }
 
 func Info(format string, args ...interface{}) {
-	defaultLogger.logf(INFO, format, args...)
+	logf(nil, slog.LevelInfo, format, args...)
 }
 
 func Warn(format string, args ...interface{}) {
-	defaultLogger.logf(WARN, format, args...)
+	logf(nil, slog.LevelWarn, format, args...)
 }
 
 func Error(format string, args ...interface{}) {
-	defaultLogger.logf(ERROR, format, args...)
+	logf(nil, slog.LevelError, format, args...)
 }
 
 func Fatal(format string, args ...interface{}) {
-	defaultLogger.logf(FATAL, format, args...)
+	logf(nil, levelFatal, format, args...)
 	os.Exit(1)
 }
 
+// 带 context 的方法，附加 context 中的请求 ID、会话 ID、服务 ID、用户和 trace ID
+func DebugContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelDebug, format, args...)
+}
+
+func InfoContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelInfo, format, args...)
+}
+
+func WarnContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelWarn, format, args...)
+}
+
+func ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelError, format, args...)
+}
+
 // 结构化日志方法
 func InfoWithFields(message string, fields map[string]interface{}) {
-	fieldStr := formatFields(fields)
-	Info("%s %s", message, fieldStr)
+	logWithFields(slog.LevelInfo, message, fields)
 }
 
 func ErrorWithFields(message string, fields map[string]interface{}) {
-	fieldStr := formatFields(fields)
-	Error("%s %s", message, fieldStr)
+	logWithFields(slog.LevelError, message, fields)
 }
 
-func formatFields(fields map[string]interface{}) string {
-	if len(fields) == 0 {
-		return ""
+// logWithFields 字段作为独立的属性输出，按键排序
+func logWithFields(l slog.Level, message string, fields map[string]interface{}) {
+	logger := current.Load()
+	ctx := context.Background()
+	if !logger.Enabled(ctx, l) {
+		return
 	}
-	
-	var parts []string
-	for key, value := range fields {
-		parts = append(parts, fmt.Sprintf("%s=%v", key, value))
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = fields[key]
+	}
+	if r := currentRedactor(); r != nil {
+		values = redactArgs(r, values)
+	}
+
+	record := slog.NewRecord(time.Now(), l, message, 0)
+	for i, key := range keys {
+		record.AddAttrs(slog.String(key, redactMessage(fmt.Sprint(values[i]))))
 	}
-	return fmt.Sprintf("| %s", strings.Join(parts, " "))
+	_ = logger.Handler().Handle(ctx, record)
 }
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// Redactor 按规则遮蔽敏感数据（由 redact.Redactor 实现）
+type Redactor interface {
+	Headers(header http.Header) http.Header
+	Value(value interface{}) interface{}
+	JSON(data []byte) []byte
+	String(s string) string
+}
+
+// redactorHolder atomic.Value 要求每次存入相同的具体类型
+type redactorHolder struct {
+	Redactor
+}
+
+var redactor atomic.Value
+
+// SetRedactor 设置遮蔽规则：请求头、查询参数、JSON 值（map、切片、json.RawMessage）类型的参数在格式化前遮蔽，
+// 格式化后的消息再按正则遮蔽
+func SetRedactor(r Redactor) {
+	redactor.Store(redactorHolder{r})
+}
+
+func currentRedactor() Redactor {
+	holder, _ := redactor.Load().(redactorHolder)
+	return holder.Redactor
+}
+
+// redactArgs 返回遮蔽后的参数副本
+func redactArgs(r Redactor, args []interface{}) []interface{} {
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case http.Header:
+			result[i] = r.Headers(v)
+		case url.Values:
+			// 查询参数与请求头按相同的名称规则遮蔽
+			result[i] = url.Values(r.Headers(http.Header(v)))
+		case map[string]interface{}, []interface{}:
+			result[i] = r.Value(v)
+		case json.RawMessage:
+			result[i] = json.RawMessage(r.JSON(v))
+		default:
+			result[i] = arg
+		}
+	}
+	return result
+}
+
+// redactMessage 遮蔽已登记的敏感值，再按正则规则遮蔽
+func redactMessage(message string) string {
+	message = redact(message)
+	if r := currentRedactor(); r != nil {
+		message = r.String(message)
+	}
+	return message
+}
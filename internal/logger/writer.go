@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// maxLineLength 单行超过该长度时直接输出，避免没有换行的输出无限缓冲
+const maxLineLength = 64 * 1024
+
+// lineWriter 按行将输出写为日志记录，用于子进程的标准错误等非结构化输出
+type lineWriter struct {
+	ctx   context.Context
+	level LogLevel
+
+	mutex  sync.Mutex
+	buffer []byte
+}
+
+// NewLineWriter 返回按行写入日志的 Writer，每行一条记录并附加 ctx 中的字段
+func NewLineWriter(ctx context.Context, level LogLevel) io.Writer {
+	return &lineWriter{ctx: ctx, level: level}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			if len(w.buffer) >= maxLineLength {
+				w.emit(w.buffer)
+				w.buffer = w.buffer[:0]
+			}
+			return len(p), nil
+		}
+		w.emit(w.buffer[:i])
+		w.buffer = w.buffer[i+1:]
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > 0 {
+		logf(w.ctx, slogLevels[w.level], "%s", line)
+	}
+}
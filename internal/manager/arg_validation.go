@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/schema"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// validatorSet 以工具名为键的参数校验器集合，热重载时可整体替换
+type validatorSet struct {
+	mutex      sync.RWMutex
+	validators map[string]*schema.Validator
+}
+
+// newValidatorSet 创建校验器集合
+func newValidatorSet(validators map[string]*schema.Validator) *validatorSet {
+	return &validatorSet{validators: validators}
+}
+
+// get 获取工具的校验器，没有时返回 nil
+func (vs *validatorSet) get(toolName string) *schema.Validator {
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	return vs.validators[toolName]
+}
+
+// replace 整体替换校验器
+func (vs *validatorSet) replace(validators map[string]*schema.Validator) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.validators = validators
+}
+
+// argumentValidationMiddleware 在调用工具处理器之前，按工具的参数 schema 校验 tools/call 请求：
+// 填充 schema 默认值，校验失败时直接返回列出全部违规项的 IsError 结果，不调用处理器。
+// 没有校验器的工具不做处理。
+func argumentValidationMiddleware(serverID string, validators *validatorSet) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+			if !ok {
+				return next(ctx, session, method, params)
+			}
+			validator := validators.get(callParams.Name)
+			if validator == nil {
+				return next(ctx, session, method, params)
+			}
+
+			// 解析参数，缺省时视为空对象
+			var args interface{}
+			if len(callParams.Arguments) > 0 && string(callParams.Arguments) != "null" {
+				if err := json.Unmarshal(callParams.Arguments, &args); err != nil {
+					return invalidArgumentsResult(callParams.Name, []schema.Violation{{
+						Keyword: "json",
+						Message: fmt.Sprintf("arguments are not valid JSON: %v", err),
+					}}), nil
+				}
+			} else {
+				args = map[string]interface{}{}
+			}
+
+			if argsMap, isMap := args.(map[string]interface{}); isMap {
+				validator.ApplyDefaults(argsMap)
+			}
+
+			if violations := validator.Validate(args); len(violations) > 0 {
+				logger.InfoContext(ctx, "Rejected call to tool %s on server %s: %d argument violation(s)", callParams.Name, serverID, len(violations))
+				return invalidArgumentsResult(callParams.Name, violations), nil
+			}
+
+			// 将填充默认值后的参数传给处理器
+			data, err := json.Marshal(args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode arguments for tool %s: %w", callParams.Name, err)
+			}
+			callParams.Arguments = data
+
+			return next(ctx, session, method, params)
+		}
+	}
+}
+
+// invalidArgumentsResult 构造参数校验失败的工具结果，文本和结构化内容都列出全部违规项
+func invalidArgumentsResult(toolName string, violations []schema.Violation) *mcp.CallToolResult {
+	lines := make([]string, 0, len(violations)+1)
+	lines = append(lines, fmt.Sprintf("Error: invalid arguments for tool '%s':", toolName))
+	for _, violation := range violations {
+		lines = append(lines, "- "+violation.String())
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: strings.Join(lines, "\n")},
+		},
+		StructuredContent: map[string]interface{}{
+			"error":      "invalid_arguments",
+			"tool":       toolName,
+			"violations": violations,
+		},
+		IsError: true,
+	}
+}
+
+// validatorFromSchema 根据 SDK 的 schema 创建校验器
+func validatorFromSchema(s *jsonschema.Schema) (*schema.Validator, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return schema.NewValidator(raw), nil
+}
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+	"McpServer/internal/metrics"
+	"McpServer/internal/models"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SetAuditRecorder 启用透传给远程 SSE 服务的工具调用的审计
+func (sm *SessionManager) SetAuditRecorder(recorder AuditRecorder) {
+	sm.audit = recorder
+}
+
+// auditMiddleware 记录每次工具调用的调用方、参数摘要和结果。位于最外层，
+// 被权限检查、限流、配额或参数校验拒绝的调用也会以对应的状态记录；审计日志无法写入时拒绝调用
+func auditMiddleware(serverID string, recorder AuditRecorder) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+			if !ok {
+				return next(ctx, session, method, params)
+			}
+
+			if err := recorder.Ready(); err != nil {
+				logger.WarnContext(ctx, "Rejecting call to tool %s on server %s: %v", callParams.Name, serverID, err)
+				return auditUnavailableResult(callParams.Name), nil
+			}
+
+			user, _ := auth.UserFromContext(ctx)
+			usage := newToolUsage(user, serverID, callParams.Name)
+
+			result, err := next(ctx, session, method, params)
+
+			usage.DurationMs = time.Since(usage.CalledAt).Milliseconds()
+			entry := toolCallAuditEntry(usage, toolCallOutcome(result, err))
+			if err != nil {
+				entry.Details["error"] = err.Error()
+			}
+			recorder.Record(entry, callParams.Arguments)
+			return result, err
+		}
+	}
+}
+
+// auditUnavailableResult 构造因审计日志无法写入而拒绝工具调用的结果
+func auditUnavailableResult(toolName string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Error: tool '%s' is unavailable because the audit log cannot be written, try again later", toolName)},
+		},
+		StructuredContent: map[string]interface{}{
+			"error": outcomeAuditUnavailable,
+			"tool":  toolName,
+		},
+		IsError: true,
+	}
+}
+
+// allowAuditedToolCalls 审计日志无法写入时拒绝透传给远程 SSE 服务的工具调用，写入 503 并返回 false
+func (sm *SessionManager) allowAuditedToolCalls(w http.ResponseWriter, r *http.Request, serverID string, body []byte) bool {
+	calls := parseToolCalls(body)
+	if sm.audit == nil || len(calls) == 0 {
+		return true
+	}
+	err := sm.audit.Ready()
+	if err == nil {
+		return true
+	}
+	logger.WarnContext(r.Context(), "Rejecting tool call to server %s: %v", serverID, err)
+	for _, call := range calls {
+		metrics.ObserveToolCall(serverID, call.Params.Name, outcomeAuditUnavailable, 0)
+	}
+	http.Error(w, "Service Unavailable: audit log cannot be written", http.StatusServiceUnavailable)
+	return false
+}
+
+// toolCallAuditEntry 由工具调用的计量记录构造审计记录
+func toolCallAuditEntry(usage models.ToolUsage, status string) models.AuditEntry {
+	return models.AuditEntry{
+		OccurredAt: usage.CalledAt,
+		EventType:  models.AuditEventToolCall,
+		Actor:      usage.Caller,
+		UserID:     usage.UserID,
+		KeyID:      usage.KeyID,
+		Action:     "tools/call",
+		ServerID:   usage.ServerID,
+		ToolName:   usage.ToolName,
+		Status:     status,
+		Details:    models.JSONB{"duration_ms": usage.DurationMs},
+	}
+}
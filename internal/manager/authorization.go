@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// authorizationMiddleware 按调用方密钥的 permissions 过滤 tools/list 结果并拒绝无权调用的 tools/call。
+// 调用方来自建立 SSE 连接时认证中间件放入上下文的用户，认证未启用时不做限制
+func authorizationMiddleware(serverID string) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			user, _ := auth.UserFromContext(ctx)
+			if !user.Restricted() {
+				return next(ctx, session, method, params)
+			}
+
+			switch method {
+			case "tools/call":
+				callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+				if ok && !user.CanCallTool(serverID, callParams.Name) {
+					logger.InfoContext(ctx, "Denied call to tool %s on server %s for user %s (key: %s)", callParams.Name, serverID, user.Username, user.KeyName)
+					return permissionDeniedResult(callParams.Name), nil
+				}
+			case "tools/list":
+				result, err := next(ctx, session, method, params)
+				if err != nil {
+					return result, err
+				}
+				if listResult, ok := result.(*mcp.ListToolsResult); ok {
+					allowed := make([]*mcp.Tool, 0, len(listResult.Tools))
+					for _, tool := range listResult.Tools {
+						if user.CanListTool(serverID, tool.Name) {
+							allowed = append(allowed, tool)
+						}
+					}
+					listResult.Tools = allowed
+				}
+				return result, nil
+			}
+
+			return next(ctx, session, method, params)
+		}
+	}
+}
+
+// permissionDeniedResult 构造无权调用工具的结果
+func permissionDeniedResult(toolName string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Error: permission denied for tool '%s'", toolName)},
+		},
+		StructuredContent: map[string]interface{}{
+			"error": "permission_denied",
+			"tool":  toolName,
+		},
+		IsError: true,
+	}
+}
+
+// deniedToolCall 检查透传给远程 SSE 服务的 JSON-RPC 消息（单条或批量），返回第一个无权调用的工具名
+func deniedToolCall(user *auth.User, serverID string, body []byte) (string, bool) {
+	for _, toolName := range toolCallNames(body) {
+		if !user.CanCallTool(serverID, toolName) {
+			return toolName, true
+		}
+	}
+	return "", false
+}
+
+// toolCallNames 返回 JSON-RPC 消息（单条或批量）中 tools/call 请求的工具名
+func toolCallNames(body []byte) []string {
+	var names []string
+	for _, call := range parseToolCalls(body) {
+		names = append(names, call.Params.Name)
+	}
+	return names
+}
+
+// toolCallRequest JSON-RPC tools/call 请求
+type toolCallRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"params"`
+}
+
+// parseToolCalls 返回 JSON-RPC 消息（单条或批量）中的 tools/call 请求
+func parseToolCalls(body []byte) []toolCallRequest {
+	var messages []json.RawMessage
+	if err := json.Unmarshal(body, &messages); err != nil {
+		messages = []json.RawMessage{body}
+	}
+
+	var calls []toolCallRequest
+	for _, message := range messages {
+		var request toolCallRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			continue
+		}
+		if request.Method == "tools/call" {
+			calls = append(calls, request)
+		}
+	}
+	return calls
+}
+
+// filterToolsListEvent 从远程 SSE 流的 data 行中移除调用方无权看到的工具；
+// 不是 tools/list 结果的行原样返回
+func filterToolsListEvent(user *auth.User, serverID string, line []byte) []byte {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return line
+	}
+	trimmed := bytes.TrimSpace(payload)
+	suffix := payload[len(bytes.TrimRight(payload, "\r\n")):]
+
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &message); err != nil || message["result"] == nil {
+		return line
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(message["result"], &result); err != nil || result["tools"] == nil {
+		return line
+	}
+	var tools []json.RawMessage
+	if err := json.Unmarshal(result["tools"], &tools); err != nil {
+		return line
+	}
+
+	allowed := make([]json.RawMessage, 0, len(tools))
+	for _, tool := range tools {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(tool, &named); err == nil && user.CanListTool(serverID, named.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+	if len(allowed) == len(tools) {
+		return line
+	}
+
+	var err error
+	if result["tools"], err = json.Marshal(allowed); err != nil {
+		return line
+	}
+	if message["result"], err = json.Marshal(result); err != nil {
+		return line
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return line
+	}
+
+	filtered := append([]byte("data: "), data...)
+	return append(filtered, suffix...)
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+
+	"McpServer/internal/logger"
+)
+
+// SetCircuitBreaker 启用远程服务的熔断，服务重新加载时恢复其熔断器：连接远程 SSE 服务、启动 stdio 进程和代理工具调用经过熔断器
+func (m *MCPServerManager) SetCircuitBreaker(breaker CircuitBreaker) {
+	m.breaker = breaker
+	m.remoteManager.breaker = breaker
+	m.sseManager.breaker = breaker
+}
+
+// SetCircuitBreaker 启用远程 SSE 服务透传请求的熔断：熔断时新连接和消息直接返回 503
+func (sm *SessionManager) SetCircuitBreaker(breaker CircuitBreaker) {
+	sm.breaker = breaker
+}
+
+// guardUpstream 经过熔断器执行一次对远程服务的调用；未启用熔断时直接执行
+func guardUpstream(breaker CircuitBreaker, serverID string, fn func() error) error {
+	if breaker == nil {
+		return fn()
+	}
+	done, err := breaker.Allow(serverID)
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+// allowUpstreamRequest 透传请求前检查熔断器，熔断时写入 503 并返回 false；
+// 放行时返回的 done 以 upstreamResponseError 的结果调用
+func allowUpstreamRequest(w http.ResponseWriter, r *http.Request, breaker CircuitBreaker, serverID string) (func(error), bool) {
+	if breaker == nil {
+		return func(error) {}, true
+	}
+	done, err := breaker.Allow(serverID)
+	if err != nil {
+		logger.InfoContext(r.Context(), "Rejected request %s %s to server %s: %v", r.Method, r.URL.Path, serverID, err)
+		http.Error(w, fmt.Sprintf("Service Unavailable: circuit breaker for server '%s' is open", serverID), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return done, true
+}
+
+// upstreamResponseError 透传请求的结果是否计为远程服务的失败：请求失败或 5xx
+func upstreamResponseError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("remote service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
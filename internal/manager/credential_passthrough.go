@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// errCredentialRequired 服务要求调用方的凭证，但 user_service_credentials 中没有可用记录
+var errCredentialRequired = errors.New("no credential configured for this user")
+
+// credentialPassthrough 解析后的 credential_passthrough 配置
+type credentialPassthrough struct {
+	serverID string
+	*models.CredentialPassthrough
+}
+
+// parseCredentialPassthrough 解析服务的 credential_passthrough，未配置时返回 nil
+func parseCredentialPassthrough(serverID string, raw models.JSONB) (*credentialPassthrough, error) {
+	passthrough, err := models.ParseCredentialPassthrough(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential_passthrough for server %s: %w", serverID, err)
+	}
+	if passthrough == nil {
+		return nil, nil
+	}
+	return &credentialPassthrough{serverID: serverID, CredentialPassthrough: passthrough}, nil
+}
+
+// resolveCredential 查找调用方在该服务上的凭证；未配置 user_credential 时返回空串，
+// 找不到（或已过期）且配置为 required 时返回 errCredentialRequired
+func (p *credentialPassthrough) resolveCredential(db DatabaseServiceInterface, userID string) (string, error) {
+	if p == nil || p.UserCredential == nil {
+		return "", nil
+	}
+
+	var credential *models.UserServiceCredential
+	if userID != "" {
+		var err error
+		if credential, err = db.GetUserServiceCredential(userID, p.serverID); err != nil {
+			return "", err
+		}
+	}
+	if credential == nil || credential.IsExpired(time.Now()) {
+		if p.UserCredential.Required {
+			return "", errCredentialRequired
+		}
+		logger.Debug("No credential for user %q on server %s, not injecting one", userID, p.serverID)
+		return "", nil
+	}
+	logger.RegisterSecret(credential.Credential)
+	return credential.Credential, nil
+}
+
+// SetGatewayCredentialHeaders 设置网关自身的凭证头（Authorization 和 auth.header_name），
+// 透传给远程 SSE 服务的请求不包括这些头
+func (sm *SessionManager) SetGatewayCredentialHeaders(names ...string) {
+	sm.gatewayCredentialHeaders = names
+}
+
+// copyRequestHeaders 复制调用方的请求头，Host、Connection 和网关自身的凭证头除外。
+// 调用方的凭证只按 credential_passthrough 的 forward_headers、forward_claims 显式转发
+func (sm *SessionManager) copyRequestHeaders(req *http.Request, caller *http.Request) {
+	for name, values := range caller.Header {
+		if name == "Host" || name == "Connection" || sm.isGatewayCredentialHeader(name) {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
+
+func (sm *SessionManager) isGatewayCredentialHeader(name string) bool {
+	for _, header := range sm.gatewayCredentialHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaders 在共享认证之后设置调用方的请求头、声明和凭证，覆盖同名的共享凭证
+func (p *credentialPassthrough) applyHeaders(req *http.Request, caller *http.Request, user *auth.User, credential string) {
+	if p == nil {
+		return
+	}
+	for from, to := range p.ForwardHeaders {
+		if value := caller.Header.Get(from); value != "" {
+			req.Header.Set(to, value)
+		}
+	}
+	for claim, header := range p.ForwardClaims {
+		if value, ok := user.Claim(claim); ok {
+			req.Header.Set(header, value)
+		}
+	}
+	if credential != "" && p.UserCredential != nil && p.UserCredential.Header != "" {
+		req.Header.Set(p.UserCredential.Header, p.UserCredential.Prefix+credential)
+	}
+}
+
+// credentialEnv 返回启动 per_user 进程时注入的环境变量，未配置时返回 nil
+func (p *credentialPassthrough) credentialEnv(db DatabaseServiceInterface, userID string) (map[string]string, error) {
+	if p == nil || p.UserCredential == nil || p.UserCredential.Env == "" {
+		return nil, nil
+	}
+	credential, err := p.resolveCredential(db, userID)
+	if err != nil || credential == "" {
+		return nil, err
+	}
+	return map[string]string{p.UserCredential.Env: credential}, nil
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+	"McpServer/internal/tracing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 健康探测方式
+const (
+	probeHTTP = "http" // GET base_url + health_check_path
+	probePing = "ping" // MCP ping
+)
+
+// SetHealthStatus 启用远程 SSE 服务的健康状态检查：被标记为不健康的服务直接返回错误，不再尝试连接
+func (m *MCPServerManager) SetHealthStatus(status HealthStatus) {
+	m.sseManager.health = status
+}
+
+// SetHealthStatus 启用远程 SSE 服务的健康状态检查：被标记为不健康的服务拒绝新连接（503）
+func (sm *SessionManager) SetHealthStatus(status HealthStatus) {
+	sm.health = status
+}
+
+// ProbeSSEService 探测远程 SSE 服务：配置了 health_check_path 时 GET 该路径，2xx 视为健康；
+// 否则通过已有会话（没有时临时建立一个）发送 MCP ping
+func (m *MCPServerManager) ProbeSSEService(ctx context.Context, config *models.MCPServiceSSE) (string, error) {
+	if config.HealthCheckPath != nil && *config.HealthCheckPath != "" {
+		return probeHTTP, probeHealthPath(ctx, config, *config.HealthCheckPath)
+	}
+	return probePing, m.sseManager.ping(ctx, config)
+}
+
+// probeHealthPath GET 健康检查路径，带上默认头部和上游认证信息
+func probeHealthPath(ctx context.Context, config *models.MCPServiceSSE, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("invalid health check url: %w", err)
+	}
+	// 超时由探测的 ctx 控制；重定向视为不健康
+	client := &http.Client{
+		Transport: tracing.Transport(&upstreamAuthRoundTripper{base: http.DefaultTransport, config: config}),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ping 通过缓存的会话发送 MCP ping；没有会话时临时连接，探测后关闭
+func (rsm *RemoteSSEManager) ping(ctx context.Context, config *models.MCPServiceSSE) error {
+	rsm.mutex.RLock()
+	sessionInfo, exists := rsm.sessions[config.ServerID]
+	rsm.mutex.RUnlock()
+	if exists && sameSSEConfig(sessionInfo.config, config) {
+		if err := sessionInfo.session.Ping(ctx, &mcp.PingParams{}); err != nil {
+			return fmt.Errorf("ping failed: %w", err)
+		}
+		return nil
+	}
+
+	session, _, err := rsm.connectToRemoteSSEService(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err = session.Ping(ctx, &mcp.PingParams{}); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// checkHealth 服务被健康检查标记为不健康时返回错误
+func (rsm *RemoteSSEManager) checkHealth(serverID string) error {
+	if rsm.health == nil {
+		return nil
+	}
+	if err := rsm.health.Check(serverID); err != nil {
+		logger.Info("Rejecting connection to server %s: %v", serverID, err)
+		return err
+	}
+	return nil
+}
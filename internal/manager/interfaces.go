@@ -1,8 +1,14 @@
 package manager
 
 import (
+	"context"
+	"encoding/json"
+
+	"McpServer/internal/auth"
 	"McpServer/internal/handlers"
+	"McpServer/internal/metering"
 	"McpServer/internal/models"
+	"McpServer/internal/ratelimit"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -11,14 +17,53 @@ import (
 type DatabaseServiceInterface interface {
 	GetEnabledServices() ([]models.MCPService, error)
 	GetServiceByID(serverID string) (*models.MCPService, error)
+	GetServiceRecord(serverID string) (*models.MCPService, error)
+	ListServiceRecords() ([]models.MCPService, error)
 	GetToolsByServerID(serverID string) ([]models.MCPTool, error)
 	GetServiceWithTools(serverID string) (*models.ServiceWithTools, error)
 	GetStdioServiceConfig(serverID string) (*models.MCPServiceStdio, error)
 	GetSSEServiceConfig(serverID string) (*models.MCPServiceSSE, error)
 	IsRemoteStdioService(serverID string) (bool, error)
 	IsRemoteSSEService(serverID string) (bool, error)
-	GetEmployeeByName(name string) (*models.Employee, error)
-	GetAllEmployees() ([]models.Employee, error)
+	GetEmployeeByName(ctx context.Context, name string) (*models.Employee, error)
+	GetAllEmployees(ctx context.Context) ([]models.Employee, error)
+	GetUserServiceCredential(userID, serverID string) (*models.UserServiceCredential, error)
+}
+
+// SecretResolver 将配置中的 secret://name 引用解析为密钥明文
+type SecretResolver interface {
+	Resolve(values models.JSONB) (models.JSONB, error)
+}
+
+// RateLimiter 按调用方、服务和工具限流
+type RateLimiter interface {
+	Allow(scope string, key ratelimit.Key) ratelimit.Decision
+	HasScope(scope string) bool
+}
+
+// UsageMeter 工具调用计量和配额检查
+type UsageMeter interface {
+	CheckQuota(keyID, userID string) metering.QuotaDecision
+	Record(usage models.ToolUsage)
+}
+
+// AuditRecorder 审计日志记录，arguments 为工具参数的原始 JSON。Ready 返回错误时记录无法写入，
+// 工具调用被拒绝
+type AuditRecorder interface {
+	Ready() error
+	Record(entry models.AuditEntry, arguments json.RawMessage)
+}
+
+// HealthStatus 远程服务的健康检查状态，服务被标记为不健康时 Check 返回错误
+type HealthStatus interface {
+	Check(serverID string) error
+}
+
+// CircuitBreaker 按远程服务熔断。Allow 熔断时返回错误；放行时返回的 done 在调用结束后以调用的错误调用。
+// Reset 在服务重新加载后恢复为关闭状态
+type CircuitBreaker interface {
+	Allow(serverID string) (done func(err error), err error)
+	Reset(serverID string)
 }
 
 // HandlerRegistryInterface 处理器注册表接口
@@ -29,5 +74,9 @@ type HandlerRegistryInterface interface {
 // MCPServerManagerInterface MCP服务器管理器接口
 type MCPServerManagerInterface interface {
 	GetServer(serverID string) (*mcp.Server, error)
+	GetServerWithContext(serverID string, user *auth.User, sessionID string) (*mcp.Server, func(), error)
 	GetDB() DatabaseServiceInterface
+	ReloadService(serverID string) ReloadResult
+	ReloadCandidates() ([]string, error)
+	InFlightToolCalls() int64
 }
@@ -1,21 +1,50 @@
 package manager
 
 import (
+	"McpServer/internal/auth"
 	"McpServer/internal/logger"
 	"McpServer/internal/models"
+	"McpServer/internal/schema"
+	"McpServer/internal/tracing"
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MCPServerManager 管理所有 MCP 服务器实例
 type MCPServerManager struct {
 	db              DatabaseServiceInterface
 	handlerRegistry HandlerRegistryInterface
-	servers         map[string]*mcp.Server
+	servers         map[string]*builtinServer
+	mutex           sync.RWMutex
+	reloadMutex     sync.Mutex // 串行化热重载
 	remoteManager   *RemoteStdioManager
 	sseManager      *RemoteSSEManager
+	report          *ToolRegistrationReport
+	limiter         RateLimiter    // nil 表示不限流
+	meter           UsageMeter     // nil 表示不计量
+	audit           AuditRecorder  // nil 表示不审计
+	breaker         CircuitBreaker // nil 表示不熔断
+}
+
+// builtinServer 内置服务器实例及其已注册工具，热重载时原地更新以便向已连接的客户端发送 tools/list_changed
+type builtinServer struct {
+	server     *mcp.Server
+	validators *validatorSet
+	tools      map[string]string // 工具名 -> 工具配置指纹
+}
+
+// builtinTool 待注册的内置工具
+type builtinTool struct {
+	def         *mcp.Tool
+	handler     mcp.ToolHandlerFor[map[string]any, any]
+	validator   *schema.Validator
+	fingerprint string
 }
 
 // NewMCPServerManager 创建新的服务器管理器
@@ -23,9 +52,10 @@ func NewMCPServerManager(db DatabaseServiceInterface, handlerRegistry HandlerReg
 	return &MCPServerManager{
 		db:              db,
 		handlerRegistry: handlerRegistry,
-		servers:         make(map[string]*mcp.Server),
+		servers:         make(map[string]*builtinServer),
 		remoteManager:   NewRemoteStdioManager(db),
 		sseManager:      NewRemoteSSEManager(db),
+		report:          NewToolRegistrationReport(),
 	}
 }
 
@@ -41,13 +71,15 @@ func (m *MCPServerManager) LoadServersFromDatabase() error {
 	for _, service := range services {
 		logger.Info("Loading builtin service: %s", service.ServerID)
 
-		server, err1 := m.createServerFromConfig(service)
+		entry, err1 := m.createServerFromConfig(service)
 		if err1 != nil {
 			logger.Info("Failed to create server for builtin service %s: %v", service.ServerID, err1)
 			continue
 		}
 
-		m.servers[service.ServerID] = server
+		m.mutex.Lock()
+		m.servers[service.ServerID] = entry
+		m.mutex.Unlock()
 		logger.Info("Successfully loaded builtin service: %s", service.ServerID)
 	}
 
@@ -55,67 +87,215 @@ func (m *MCPServerManager) LoadServersFromDatabase() error {
 }
 
 // createServerFromConfig 根据配置创建服务器
-func (m *MCPServerManager) createServerFromConfig(service models.MCPService) (*mcp.Server, error) {
+func (m *MCPServerManager) createServerFromConfig(service models.MCPService) (*builtinServer, error) {
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "mcp-builtin-server",
 		Version: "1.0.0",
 	}, nil)
 
+	entry := &builtinServer{
+		server:     server,
+		validators: newValidatorSet(map[string]*schema.Validator{}),
+		tools:      make(map[string]string),
+	}
+
+	// 在处理器之前按 args_schema 校验参数并填充默认值
+	server.AddReceivingMiddleware(argumentValidationMiddleware(service.ServerID, entry.validators))
+	if m.meter != nil {
+		server.AddReceivingMiddleware(meteringMiddleware(service.ServerID, m.meter))
+	}
+	if m.limiter != nil {
+		server.AddReceivingMiddleware(rateLimitMiddleware(service.ServerID, m.limiter))
+	}
+	// 最外层：按调用方权限过滤工具列表、拒绝无权调用
+	server.AddReceivingMiddleware(authorizationMiddleware(service.ServerID))
+	// 指标和审计位于最外层，被拒绝的调用也会记录
+	server.AddReceivingMiddleware(metricsMiddleware(service.ServerID))
+	if m.audit != nil {
+		server.AddReceivingMiddleware(auditMiddleware(service.ServerID, m.audit))
+	}
+	server.AddReceivingMiddleware(tracingMiddleware(service.ServerID))
+	server.AddReceivingMiddleware(inFlightMiddleware())
+
+	if _, err := m.syncServerTools(service, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// syncServerTools 按数据库中的工具配置更新服务器：新增或变更的工具重新注册，已删除或禁用的工具移除。
+// SDK 在工具增删时向已连接的会话发送 tools/list_changed。返回工具列表是否发生变化
+func (m *MCPServerManager) syncServerTools(service models.MCPService, entry *builtinServer) (bool, error) {
 	// 获取工具配置
 	tools, err := m.db.GetToolsByServerID(service.ServerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tools for service %s: %w", service.ServerID, err)
+		return false, fmt.Errorf("failed to get tools for service %s: %w", service.ServerID, err)
 	}
 
 	// 添加工具
+	var skipped []SkippedTool
+	changed := false
+	validators := make(map[string]*schema.Validator)
+	registered := make(map[string]string)
 	for _, tool := range tools {
-		logger.Info("Adding tool: %s to server: %s", tool.Name, service.ServerID)
-
-		// 获取处理器
-		handler, exists := m.handlerRegistry.GetHandler(tool.HandlerType)
-		if !exists {
-			logger.Warn("No handler found for type: %s", tool.HandlerType)
+		built, reason := m.buildTool(service.ServerID, tool)
+		if built == nil {
+			if reason != "" {
+				skipped = append(skipped, SkippedTool{Name: tool.Name, Reason: reason})
+			}
 			continue
 		}
 
-		// 创建工具定义
-		toolDef := mcp.Tool{
-			Name:        tool.Name,
-			Description: tool.Description,
+		// 配置未变化的工具不重新注册，避免无意义的 list_changed 通知
+		if entry.tools[tool.Name] != built.fingerprint {
+			logger.Info("Adding tool: %s to server: %s", tool.Name, service.ServerID)
+			if err = addToolSafely(entry.server, built.def, built.handler); err != nil {
+				logger.Warn("Skipping tool %s on server %s: %v", tool.Name, service.ServerID, err)
+				skipped = append(skipped, SkippedTool{Name: tool.Name, Reason: err.Error()})
+				continue
+			}
+			changed = true
 		}
 
-		// 转换 JSONB 到 JSON Schema
-		if tool.ArgsSchema != nil {
-			schema, err1 := tool.ArgsSchema.ToJSONSchema()
-			if err1 != nil {
-				logger.Warn("Failed to convert args schema for tool %s: %v", tool.Name, err1)
-			} else if schema != nil {
-				toolDef.InputSchema = schema
-			}
+		registered[tool.Name] = built.fingerprint
+		if built.validator != nil {
+			validators[tool.Name] = built.validator
 		}
+	}
 
-		// 创建符合 ToolHandlerFor 类型的处理器
-		toolHandler := func(ctx context.Context, session *mcp.ServerSession, params *mcp.CallToolParamsFor[map[string]any]) (*mcp.CallToolResultFor[any], error) {
-			// 转换参数类型
-			callParams := &mcp.CallToolParams{
-				Name:      params.Name,
-				Arguments: params.Arguments,
-			}
-			result, err1 := handler(ctx, session, callParams)
-			if err1 != nil {
-				return nil, err1
-			}
-			// 转换返回类型
-			return &mcp.CallToolResultFor[any]{
-				Content: result.Content,
-				IsError: result.IsError,
-			}, nil
+	// 移除已删除、禁用或本次注册失败的工具
+	var stale []string
+	for name := range entry.tools {
+		if _, exists := registered[name]; !exists {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		logger.Info("Removing tools %v from server: %s", stale, service.ServerID)
+		entry.server.RemoveTools(stale...)
+		changed = true
+	}
+
+	entry.tools = registered
+	entry.validators.replace(validators)
+	m.report.Record(service.ServerID, skipped)
+
+	return changed, nil
+}
+
+// buildTool 根据工具配置构建工具定义和处理器；无法注册时返回 nil 和跳过原因（没有处理器时原因为空）
+func (m *MCPServerManager) buildTool(serverID string, tool models.MCPTool) (*builtinTool, string) {
+	// 获取处理器
+	handler, exists := m.handlerRegistry.GetHandler(tool.HandlerType)
+	if !exists {
+		logger.Warn("No handler found for type: %s", tool.HandlerType)
+		return nil, ""
+	}
+
+	// 创建工具定义
+	toolDef := &mcp.Tool{
+		Name:        tool.Name,
+		Description: tool.Description,
+	}
+	built := &builtinTool{def: toolDef, fingerprint: toolFingerprint(tool)}
+
+	// 转换 JSONB 到 JSON Schema
+	if tool.ArgsSchema != nil {
+		inputSchema, err := tool.ArgsSchema.ToJSONSchema()
+		if err != nil {
+			logger.Warn("Failed to convert args schema for tool %s: %v", tool.Name, err)
+			return nil, err.Error()
+		} else if inputSchema != nil {
+			toolDef.InputSchema = inputSchema
+		}
+		built.validator = schema.NewValidator(tool.ArgsSchema)
+	}
+
+	// 输出 schema（可选），MCP 要求其根类型为 object
+	var outputValidator *schema.Validator
+	if tool.OutputSchema != nil {
+		if schemaType, _ := tool.OutputSchema["type"].(string); schemaType != "object" {
+			reason := fmt.Sprintf("output schema must have type \"object\", got %q", schemaType)
+			logger.Warn("Skipping tool %s on server %s: %s", tool.Name, serverID, reason)
+			return nil, reason
+		}
+		outputSchema, err := tool.OutputSchema.ToJSONSchema()
+		if err != nil {
+			logger.Warn("Failed to convert output schema for tool %s: %v", tool.Name, err)
+			return nil, err.Error()
 		}
+		toolDef.OutputSchema = outputSchema
+		outputValidator = schema.NewValidator(tool.OutputSchema)
+	}
 
-		mcp.AddTool(server, &toolDef, toolHandler)
+	// 创建符合 ToolHandlerFor 类型的处理器
+	built.handler = func(ctx context.Context, session *mcp.ServerSession, params *mcp.CallToolParamsFor[map[string]any]) (*mcp.CallToolResultFor[any], error) {
+		// 转换参数类型
+		callParams := &mcp.CallToolParams{
+			Name:      params.Name,
+			Arguments: params.Arguments,
+		}
+		ctx, span := tracing.Start(ctx, "handler "+tool.HandlerType, trace.SpanKindInternal,
+			attribute.String("mcp.server_id", serverID),
+			attribute.String("mcp.tool", tool.Name),
+			attribute.String("mcp.handler_type", tool.HandlerType),
+		)
+		result, err := handler(ctx, session, callParams)
+		tracing.End(span, err)
+		if err != nil {
+			return nil, err
+		}
+		// 校验结构化输出并转换返回类型
+		return finalizeToolResult(serverID, tool.Name, result, outputValidator), nil
 	}
 
-	return server, nil
+	return built, ""
+}
+
+// toolFingerprint 计算工具配置指纹，用于热重载时判断工具是否变化
+func toolFingerprint(tool models.MCPTool) string {
+	data, _ := json.Marshal([]interface{}{
+		tool.Description, tool.ArgsSchema, tool.OutputSchema, tool.HandlerType, tool.HandlerConfig,
+	})
+	return string(data)
+}
+
+// SetValidateProxiedArgs 设置是否按上游 schema 在网关侧校验代理工具的参数
+func (m *MCPServerManager) SetValidateProxiedArgs(enabled bool) {
+	m.remoteManager.validateArgs = enabled
+	m.sseManager.validateArgs = enabled
+}
+
+// SetSecretResolver 启用密钥存储：stdio 的 env 以及 SSE 的 auth_config、headers 中的 secret://name 在连接时解析
+func (m *MCPServerManager) SetSecretResolver(resolver SecretResolver) {
+	m.remoteManager.secrets = resolver
+	upstreamAuths.setResolver(resolver)
+}
+
+// SetProtectedEnv 设置不传给远程 stdio 进程的环境变量，例如密钥存储的主密钥
+func (m *MCPServerManager) SetProtectedEnv(names ...string) {
+	m.remoteManager.protectedEnv = names
+}
+
+// SetRateLimiter 启用工具调用限流，需在加载服务之前调用
+func (m *MCPServerManager) SetRateLimiter(limiter RateLimiter) {
+	m.limiter = limiter
+	m.remoteManager.limiter = limiter
+	m.sseManager.limiter = limiter
+}
+
+// SetUsageMeter 启用工具调用计量和配额检查，需在加载服务之前调用
+func (m *MCPServerManager) SetUsageMeter(meter UsageMeter) {
+	m.meter = meter
+	m.remoteManager.meter = meter
+	m.sseManager.meter = meter
+}
+
+// SetAuditRecorder 启用工具调用审计，需在加载服务之前调用
+func (m *MCPServerManager) SetAuditRecorder(recorder AuditRecorder) {
+	m.audit = recorder
+	m.remoteManager.audit = recorder
+	m.sseManager.audit = recorder
 }
 
 // GetServer 根据 server_id 获取对应的 MCP 服务器
@@ -141,15 +321,47 @@ func (m *MCPServerManager) GetServer(serverID string) (*mcp.Server, error) {
 	}
 
 	// 本地服务
-	if server, exists := m.servers[serverID]; exists {
+	m.mutex.RLock()
+	entry, exists := m.servers[serverID]
+	m.mutex.RUnlock()
+	if exists {
 		logger.Info("Using builtin MCP server for: %s", serverID)
-		return server, nil
+		return entry.server, nil
 	}
 
 	return nil, fmt.Errorf("server not found: %s", serverID)
 }
 
+// GetServerWithContext 为一个下游连接获取 MCP 服务器：远程 stdio 服务按复用策略使用调用方
+// （per_user）或 MCP 会话 ID（per_session）选择进程。release 在连接结束时调用
+func (m *MCPServerManager) GetServerWithContext(serverID string, user *auth.User, sessionID string) (*mcp.Server, func(), error) {
+	isRemoteStdio, err := m.db.IsRemoteStdioService(serverID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check if service is remote stdio: %w", err)
+	}
+	if isRemoteStdio {
+		logger.Info("Getting remote stdio server for: %s (caller: %s, session: %s)", serverID, user.Identity(), sessionID)
+		return m.remoteManager.AcquireRemoteServer(serverID, user, sessionID)
+	}
+
+	server, err := m.GetServer(serverID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return server, func() {}, nil
+}
+
+// GetStdioSessionStats 远程 stdio 进程的统计，按复用策略汇总
+func (m *MCPServerManager) GetStdioSessionStats() map[string]interface{} {
+	return m.remoteManager.GetSessionStats()
+}
+
 // GetDB 获取数据库服务接口
 func (m *MCPServerManager) GetDB() DatabaseServiceInterface {
 	return m.db
 }
+
+// GetSkippedTools 获取所有服务器（内置、远程 stdio、远程 SSE）中未能注册的工具及原因
+func (m *MCPServerManager) GetSkippedTools() map[string][]SkippedTool {
+	return mergeReports(m.report.Snapshot(), m.remoteManager.GetSkippedTools(), m.sseManager.GetSkippedTools())
+}
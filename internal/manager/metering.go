@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+	"McpServer/internal/metering"
+	"McpServer/internal/models"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxPendingProxiedCalls 每个 SSE 透传会话最多跟踪的未完成工具调用，超出后不再计量和审计新调用的结果
+const maxPendingProxiedCalls = 1000
+
+// SetUsageMeter 启用透传给远程 SSE 服务的工具调用的计量和配额检查
+func (sm *SessionManager) SetUsageMeter(meter UsageMeter) {
+	sm.meter = meter
+}
+
+// meteringMiddleware 调用工具前检查调用方配额，超出时返回 IsError 结果而不调用工具；
+// 调用完成后记录耗时、是否成功和参数、结果的大小
+func meteringMiddleware(serverID string, meter UsageMeter) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+			if !ok {
+				return next(ctx, session, method, params)
+			}
+
+			user, _ := auth.UserFromContext(ctx)
+			usage := newToolUsage(user, serverID, callParams.Name)
+			if user != nil {
+				if decision := meter.CheckQuota(user.KeyID, user.UserID); !decision.Allowed {
+					logger.InfoContext(ctx, "Denied call to tool %s on server %s for %s: %s quota of %s exceeded (%d/%d)",
+						callParams.Name, serverID, usage.Caller, decision.Period, decision.Subject, decision.Used, decision.Limit)
+					return quotaExceededResult(callParams.Name, decision), nil
+				}
+			}
+
+			result, err := next(ctx, session, method, params)
+
+			usage.DurationMs = time.Since(usage.CalledAt).Milliseconds()
+			usage.BytesIn = int64(len(callParams.Arguments))
+			if callResult, ok1 := result.(*mcp.CallToolResult); ok1 && callResult != nil {
+				usage.Success = err == nil && !callResult.IsError
+				if data, err1 := json.Marshal(callResult); err1 == nil {
+					usage.BytesOut = int64(len(data))
+				}
+			}
+			meter.Record(usage)
+			return result, err
+		}
+	}
+}
+
+// newToolUsage 创建一次工具调用的计量记录，开始时间为当前时间
+func newToolUsage(user *auth.User, serverID, toolName string) models.ToolUsage {
+	usage := models.ToolUsage{
+		CalledAt: time.Now().UTC(),
+		Caller:   user.Identity(),
+		ServerID: serverID,
+		ToolName: toolName,
+	}
+	if user != nil {
+		usage.UserID = user.UserID
+		usage.KeyID = user.KeyID
+	}
+	return usage
+}
+
+// quotaExceededResult 构造超出配额的工具调用结果
+func quotaExceededResult(toolName string, decision metering.QuotaDecision) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Error: %s quota exceeded for tool '%s' (%d/%d), resets at %s",
+				quotaPeriodName(decision.Period), toolName, decision.Used, decision.Limit, decision.ResetAt.Format(time.RFC3339))},
+		},
+		StructuredContent: map[string]interface{}{
+			"error":          "quota_exceeded",
+			"tool":           toolName,
+			"period":         decision.Period,
+			"limit":          decision.Limit,
+			"used":           decision.Used,
+			"reset_at":       decision.ResetAt.Format(time.RFC3339),
+			"retry_after_ms": time.Until(decision.ResetAt).Milliseconds(),
+		},
+		IsError: true,
+	}
+}
+
+// quotaPeriodName 周期的形容词形式，用于错误信息
+func quotaPeriodName(period string) string {
+	if period == models.UsagePeriodMonth {
+		return "monthly"
+	}
+	return "daily"
+}
+
+// checkProxiedQuota 检查透传给远程 SSE 服务的工具调用的配额，超出时写入 429 并返回 false
+func (sm *SessionManager) checkProxiedQuota(w http.ResponseWriter, user *auth.User, serverID string, body []byte) bool {
+	if user == nil {
+		return true
+	}
+	toolNames := toolCallNames(body)
+	if len(toolNames) == 0 {
+		return true
+	}
+	if decision := sm.meter.CheckQuota(user.KeyID, user.UserID); !decision.Allowed {
+		logger.Info("Denied call to tool %s on server %s for %s: %s quota of %s exceeded (%d/%d)",
+			toolNames[0], serverID, user.Identity(), decision.Period, decision.Subject, decision.Used, decision.Limit)
+		writeRateLimited(w, time.Until(decision.ResetAt), fmt.Sprintf("Too Many Requests: %s quota exceeded (%d/%d), resets at %s",
+			quotaPeriodName(decision.Period), decision.Used, decision.Limit, decision.ResetAt.Format(time.RFC3339)))
+		return false
+	}
+	return true
+}
+
+// proxiedToolCall 一次透传给远程 SSE 服务的工具调用
+type proxiedToolCall struct {
+	usage     models.ToolUsage
+	arguments json.RawMessage
+}
+
+// outcome 调用结果
+func (c *proxiedToolCall) outcome() string {
+	if c.usage.Success {
+		return outcomeSuccess
+	}
+	return outcomeError
+}
+
+// proxiedToolCalls 透传给远程 SSE 服务、尚未收到结果的工具调用，结果从事件流中按 JSON-RPC id 匹配
+type proxiedToolCalls struct {
+	mutex sync.Mutex
+	calls map[string]proxiedToolCall // JSON-RPC id -> 调用
+}
+
+func newProxiedToolCalls() *proxiedToolCalls {
+	return &proxiedToolCalls{calls: make(map[string]proxiedToolCall)}
+}
+
+// add 登记请求体中的工具调用；没有 id（通知）或未完成的调用过多时不跟踪
+func (p *proxiedToolCalls) add(user *auth.User, serverID string, body []byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, call := range parseToolCalls(body) {
+		if len(call.ID) == 0 {
+			continue
+		}
+		if len(p.calls) >= maxPendingProxiedCalls {
+			logger.Warn("Too many pending tool calls on server %s, not tracking call to %s", serverID, call.Params.Name)
+			continue
+		}
+		usage := newToolUsage(user, serverID, call.Params.Name)
+		usage.BytesIn = int64(len(call.Params.Arguments))
+		p.calls[string(bytes.TrimSpace(call.ID))] = proxiedToolCall{usage: usage, arguments: call.Params.Arguments}
+	}
+}
+
+// pending 尚未收到结果的调用数
+func (p *proxiedToolCalls) pending() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.calls)
+}
+
+// complete 检查远程 SSE 流的 data 行，是已登记调用的响应时返回补全耗时、结果和大小的调用
+func (p *proxiedToolCalls) complete(line []byte) (proxiedToolCall, bool) {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return proxiedToolCall{}, false
+	}
+	payload = bytes.TrimSpace(payload)
+
+	var response struct {
+		ID     json.RawMessage `json:"id"`
+		Result *struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil || len(response.ID) == 0 {
+		return proxiedToolCall{}, false
+	}
+
+	p.mutex.Lock()
+	id := string(bytes.TrimSpace(response.ID))
+	call, ok := p.calls[id]
+	delete(p.calls, id)
+	p.mutex.Unlock()
+	if !ok {
+		return proxiedToolCall{}, false
+	}
+
+	call.usage.DurationMs = time.Since(call.usage.CalledAt).Milliseconds()
+	call.usage.Success = response.Error == nil && response.Result != nil && !response.Result.IsError
+	call.usage.BytesOut = int64(len(payload))
+	return call, true
+}
@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/metrics"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 工具调用的结果，用于指标的 outcome 标签和审计记录的 status
+const (
+	outcomeSuccess          = "success"
+	outcomeError            = "error"
+	outcomePermissionDenied = "permission_denied"
+	outcomeRateLimited      = "rate_limited"
+	outcomeQuotaExceeded    = "quota_exceeded"
+	outcomeInvalidArguments = "invalid_arguments"
+	outcomeAuditUnavailable = "audit_unavailable"
+)
+
+// metricsMiddleware 统计工具调用的次数和耗时。位于权限检查之外，被拒绝的调用以对应的结果计入
+func metricsMiddleware(serverID string) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+			if !ok {
+				return next(ctx, session, method, params)
+			}
+
+			start := time.Now()
+			result, err := next(ctx, session, method, params)
+			metrics.ObserveToolCall(serverID, callParams.Name, toolCallOutcome(result, err), time.Since(start))
+			return result, err
+		}
+	}
+}
+
+// toolCallOutcome 从工具调用结果判断调用结果：网关拒绝的调用取 structuredContent 中的错误类型
+func toolCallOutcome(result mcp.Result, err error) string {
+	if err != nil {
+		return outcomeError
+	}
+	callResult, ok := result.(*mcp.CallToolResult)
+	if !ok || callResult == nil {
+		return outcomeError
+	}
+	if !callResult.IsError {
+		return outcomeSuccess
+	}
+	if structured, ok1 := callResult.StructuredContent.(map[string]interface{}); ok1 {
+		switch status, _ := structured["error"].(string); status {
+		case outcomePermissionDenied, outcomeRateLimited, outcomeQuotaExceeded, outcomeInvalidArguments, outcomeAuditUnavailable:
+			return status
+		}
+	}
+	return outcomeError
+}
+
+// recordDeniedToolCalls 统计并审计被网关拒绝、未转发给远程 SSE 服务的工具调用
+func (sm *SessionManager) recordDeniedToolCalls(user *auth.User, serverID string, body []byte, outcome string) {
+	for _, call := range parseToolCalls(body) {
+		metrics.ObserveToolCall(serverID, call.Params.Name, outcome, 0)
+		if sm.audit != nil {
+			usage := newToolUsage(user, serverID, call.Params.Name)
+			sm.audit.Record(toolCallAuditEntry(usage, outcome), call.Params.Arguments)
+		}
+	}
+}
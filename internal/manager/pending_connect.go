@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"fmt"
+)
+
+// pendingConnect 正在管理器锁外进行的连接（含重试）。同一服务（会话键）的其他调用方等待其结果，不重复连接；
+// 连接期间服务被热重载或管理器被关闭时标记为作废，连接成功后也不再发布
+type pendingConnect struct {
+	serverID  string
+	done      chan struct{}
+	err       error
+	abandoned bool // 需持有管理器的锁读写
+}
+
+func newPendingConnect(serverID string) *pendingConnect {
+	return &pendingConnect{serverID: serverID, done: make(chan struct{})}
+}
+
+// finish 记录连接结果并唤醒等待者
+func (p *pendingConnect) finish(err error) {
+	p.err = err
+	close(p.done)
+}
+
+// wait 等待连接结束，返回连接的错误
+func (p *pendingConnect) wait() error {
+	<-p.done
+	return p.err
+}
+
+// abandonedError 连接期间服务被热重载或管理器被关闭
+func (p *pendingConnect) abandonedError() error {
+	return fmt.Errorf("remote service %s was reloaded or closed while connecting, retry the connection", p.serverID)
+}
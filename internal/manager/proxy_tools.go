@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"McpServer/internal/schema"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SkippedTool 记录未能注册的工具及原因
+type SkippedTool struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ToolRegistrationReport 按服务器记录未能注册的工具
+type ToolRegistrationReport struct {
+	skipped map[string][]SkippedTool // serverID -> skipped tools
+	mutex   sync.RWMutex
+}
+
+// NewToolRegistrationReport 创建新的工具注册报告
+func NewToolRegistrationReport() *ToolRegistrationReport {
+	return &ToolRegistrationReport{
+		skipped: make(map[string][]SkippedTool),
+	}
+}
+
+// Record 记录某个服务器最近一次注册中被跳过的工具（覆盖之前的记录）
+func (r *ToolRegistrationReport) Record(serverID string, skipped []SkippedTool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(skipped) == 0 {
+		delete(r.skipped, serverID)
+		return
+	}
+	r.skipped[serverID] = skipped
+}
+
+// Snapshot 获取报告副本
+func (r *ToolRegistrationReport) Snapshot() map[string][]SkippedTool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string][]SkippedTool, len(r.skipped))
+	for serverID, skipped := range r.skipped {
+		result[serverID] = append([]SkippedTool(nil), skipped...)
+	}
+	return result
+}
+
+// mergeReports 合并多个报告快照
+func mergeReports(reports ...map[string][]SkippedTool) map[string][]SkippedTool {
+	result := make(map[string][]SkippedTool)
+	for _, report := range reports {
+		for serverID, skipped := range report {
+			result[serverID] = append(result[serverID], skipped...)
+		}
+	}
+	for serverID := range result {
+		sort.Slice(result[serverID], func(i, j int) bool {
+			return result[serverID][i].Name < result[serverID][j].Name
+		})
+	}
+	return result
+}
+
+// compatibleProxyTool 返回远程工具的副本，输入输出 schema 转换为 draft 2020-12，其余字段原样保留
+func compatibleProxyTool(tool mcp.Tool) (*mcp.Tool, error) {
+	compatible := tool
+
+	inputSchema, err := schema.Translate(tool.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+	compatible.InputSchema = inputSchema
+
+	outputSchema, err := schema.Translate(tool.OutputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+	compatible.OutputSchema = outputSchema
+
+	return &compatible, nil
+}
+
+// addToolSafely 注册工具，将 mcp.AddTool 因 schema 无法解析而产生的 panic 转为错误
+func addToolSafely(server *mcp.Server, tool *mcp.Tool, handler mcp.ToolHandlerFor[map[string]any, any]) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	mcp.AddTool(server, tool, handler)
+	return nil
+}
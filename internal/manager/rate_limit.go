@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"McpServer/internal/auth"
+	"McpServer/internal/logger"
+	"McpServer/internal/ratelimit"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SetRateLimiter 启用 HTTP 请求限流，以及透传给远程 SSE 服务的工具调用的限流
+func (sm *SessionManager) SetRateLimiter(limiter RateLimiter) {
+	sm.limiter = limiter
+}
+
+// rateLimitMiddleware 按 tool_call 规则限流工具调用，超限时返回带重试时间的 IsError 结果而不调用工具。
+// 位于权限检查之内，无权调用的请求不消耗配额
+func rateLimitMiddleware(serverID string, limiter RateLimiter) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+			if !ok {
+				return next(ctx, session, method, params)
+			}
+
+			user, _ := auth.UserFromContext(ctx)
+			decision := limiter.Allow(ratelimit.ScopeToolCall, ratelimit.Key{
+				Caller:   user.Identity(),
+				ServerID: serverID,
+				Tool:     callParams.Name,
+			})
+			if !decision.Allowed {
+				logger.InfoContext(ctx, "Rate limited call to tool %s on server %s for %s (rule: %s, retry after %s)",
+					callParams.Name, serverID, user.Identity(), decision.Rule, decision.RetryAfter)
+				return rateLimitedResult(callParams.Name, decision), nil
+			}
+			return next(ctx, session, method, params)
+		}
+	}
+}
+
+// rateLimitedResult 构造工具调用被限流的结果
+func rateLimitedResult(toolName string, decision ratelimit.Decision) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Error: rate limit exceeded for tool '%s', retry after %ds", toolName, retryAfterSeconds(decision.RetryAfter))},
+		},
+		StructuredContent: map[string]interface{}{
+			"error":          "rate_limited",
+			"tool":           toolName,
+			"rule":           decision.Rule,
+			"retry_after_ms": decision.RetryAfter.Milliseconds(),
+		},
+		IsError: true,
+	}
+}
+
+// allowRequest 按 request 规则限流发往 MCP 端点的 HTTP 请求，超限时写入 429 并返回 false
+func (sm *SessionManager) allowRequest(w http.ResponseWriter, r *http.Request, serverID string) bool {
+	if sm.limiter == nil {
+		return true
+	}
+	user, _ := auth.UserFromContext(r.Context())
+	decision := sm.limiter.Allow(ratelimit.ScopeRequest, ratelimit.Key{Caller: user.Identity(), ServerID: serverID})
+	if decision.Allowed {
+		return true
+	}
+	logger.InfoContext(r.Context(), "Rate limited request %s %s to server %s for %s (rule: %s, retry after %s)",
+		r.Method, r.URL.Path, serverID, user.Identity(), decision.Rule, decision.RetryAfter)
+	writeRateLimited(w, decision.RetryAfter, fmt.Sprintf("Too Many Requests: rate limit exceeded for server '%s'", serverID))
+	return false
+}
+
+// allowProxiedToolCalls 按 tool_call 规则限流透传给远程 SSE 服务的工具调用，超限时写入 429 并返回 false
+func (sm *SessionManager) allowProxiedToolCalls(w http.ResponseWriter, user *auth.User, serverID string, body []byte) bool {
+	for _, toolName := range toolCallNames(body) {
+		decision := sm.limiter.Allow(ratelimit.ScopeToolCall, ratelimit.Key{
+			Caller:   user.Identity(),
+			ServerID: serverID,
+			Tool:     toolName,
+		})
+		if !decision.Allowed {
+			logger.Info("Rate limited call to tool %s on server %s for %s (rule: %s, retry after %s)",
+				toolName, serverID, user.Identity(), decision.Rule, decision.RetryAfter)
+			writeRateLimited(w, decision.RetryAfter, fmt.Sprintf("Too Many Requests: rate limit exceeded for tool '%s'", toolName))
+			return false
+		}
+	}
+	return true
+}
+
+// writeRateLimited 写入带 Retry-After 头的 429 响应
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := retryAfterSeconds(retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("%s, retry after %ds", message, seconds), http.StatusTooManyRequests)
+}
+
+// retryAfterSeconds Retry-After 以整秒表示，向上取整且至少为 1
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
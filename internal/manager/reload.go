@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+	"sort"
+)
+
+// 热重载对单个服务执行的操作
+const (
+	ReloadCreated   = "created"   // 新建了内置服务器
+	ReloadUpdated   = "updated"   // 内置服务器的工具列表已原地更新并通知客户端
+	ReloadRemoved   = "removed"   // 服务已删除、禁用或不再是该适配器，相关服务器和会话已移除
+	ReloadRestarted = "restarted" // 远程服务配置变化，已关闭上游会话，下次连接时重新建立
+	ReloadUnchanged = "unchanged" // 无变化
+)
+
+// ReloadResult 单个服务的热重载结果
+type ReloadResult struct {
+	ServerID string `json:"server_id"`
+	Adapter  string `json:"adapter,omitempty"`
+	Active   bool   `json:"active"` // 服务是否存在且已启用
+	Action   string `json:"action"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReloadService 按数据库中的最新配置重新加载指定服务：
+// 内置服务原地同步工具（SDK 向已连接的客户端发送 tools/list_changed），
+// 远程服务在配置变化时关闭上游会话；服务被删除或禁用时移除对应的服务器和会话
+func (m *MCPServerManager) ReloadService(serverID string) ReloadResult {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	result := ReloadResult{ServerID: serverID, Action: ReloadUnchanged}
+
+	service, err := m.db.GetServiceRecord(serverID)
+	if err != nil {
+		logger.Error("Failed to reload service %s: %v", serverID, err)
+		result.Error = err.Error()
+		return result
+	}
+	if service != nil {
+		result.Adapter = service.Adapter
+		result.Active = service.Enabled
+	}
+
+	// 内置服务器
+	if result.Active && service.Adapter == "builtin" {
+		m.reloadBuiltin(*service, &result)
+	} else if m.removeBuiltin(serverID) {
+		result.Action = ReloadRemoved
+	}
+
+	// 远程 stdio 会话
+	var stdioConfig *models.MCPServiceStdio
+	if result.Active && service.Adapter == "remote_stdio" {
+		if stdioConfig, err = m.db.GetStdioServiceConfig(serverID); err != nil {
+			result.Error = err.Error()
+		}
+	}
+	if closed := m.remoteManager.RefreshService(serverID, stdioConfig); closed > 0 {
+		result.Action = remoteReloadAction(stdioConfig != nil)
+	}
+
+	// 远程 SSE 会话
+	var sseConfig *models.MCPServiceSSE
+	if result.Active && service.Adapter == "remote_sse" {
+		if sseConfig, err = m.db.GetSSEServiceConfig(serverID); err != nil {
+			result.Error = err.Error()
+		}
+	}
+	if m.sseManager.RefreshService(serverID, sseConfig) {
+		result.Action = remoteReloadAction(sseConfig != nil)
+	}
+
+	// 配置可能已修正，不再沿用之前的失败计数
+	if m.breaker != nil {
+		m.breaker.Reset(serverID)
+	}
+
+	// 服务不存在或已禁用时，由会话管理器清理其余的缓存和会话
+	if !result.Active {
+		result.Action = ReloadRemoved
+	}
+
+	logger.Info("Reloaded service %s: %s", serverID, result.Action)
+	return result
+}
+
+// ReloadCandidates 获取热重载全部服务时需要检查的服务 ID：数据库中的所有服务以及当前已加载的服务
+func (m *MCPServerManager) ReloadCandidates() ([]string, error) {
+	services, err := m.db.ListServiceRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, service := range services {
+		seen[service.ServerID] = true
+	}
+
+	m.mutex.RLock()
+	for serverID := range m.servers {
+		seen[serverID] = true
+	}
+	m.mutex.RUnlock()
+
+	for _, serverID := range m.remoteManager.ServerIDs() {
+		seen[serverID] = true
+	}
+	for _, serverID := range m.sseManager.ServerIDs() {
+		seen[serverID] = true
+	}
+
+	serverIDs := make([]string, 0, len(seen))
+	for serverID := range seen {
+		serverIDs = append(serverIDs, serverID)
+	}
+	sort.Strings(serverIDs)
+	return serverIDs, nil
+}
+
+// reloadBuiltin 新建内置服务器或原地同步其工具
+func (m *MCPServerManager) reloadBuiltin(service models.MCPService, result *ReloadResult) {
+	m.mutex.RLock()
+	entry, exists := m.servers[service.ServerID]
+	m.mutex.RUnlock()
+
+	if !exists {
+		created, err := m.createServerFromConfig(service)
+		if err != nil {
+			logger.Error("Failed to create server for builtin service %s: %v", service.ServerID, err)
+			result.Error = err.Error()
+			return
+		}
+		m.mutex.Lock()
+		m.servers[service.ServerID] = created
+		m.mutex.Unlock()
+		result.Action = ReloadCreated
+		return
+	}
+
+	changed, err := m.syncServerTools(service, entry)
+	if err != nil {
+		logger.Error("Failed to sync tools for builtin service %s: %v", service.ServerID, err)
+		result.Error = err.Error()
+		return
+	}
+	if changed {
+		result.Action = ReloadUpdated
+	}
+}
+
+// removeBuiltin 移除内置服务器，先移除全部工具以通知已连接的客户端。返回服务器是否存在
+func (m *MCPServerManager) removeBuiltin(serverID string) bool {
+	m.mutex.Lock()
+	entry, exists := m.servers[serverID]
+	delete(m.servers, serverID)
+	m.mutex.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	names := make([]string, 0, len(entry.tools))
+	for name := range entry.tools {
+		names = append(names, name)
+	}
+	entry.server.RemoveTools(names...)
+	m.report.Record(serverID, nil)
+	return true
+}
+
+// remoteReloadAction 远程会话被关闭时的操作：配置仍有效为重启，否则为移除
+func remoteReloadAction(active bool) string {
+	if active {
+		return ReloadRestarted
+	}
+	return ReloadRemoved
+}
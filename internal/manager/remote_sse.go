@@ -5,28 +5,19 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"McpServer/internal/metrics"
 	"McpServer/internal/models"
+	"McpServer/internal/schema"
+	"McpServer/internal/tracing"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// headerRoundTripper 实现 http.RoundTripper 接口，用于添加自定义头部
-type headerRoundTripper struct {
-	base    http.RoundTripper
-	headers map[string]string
-}
-
-func (hrt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	for key, value := range hrt.headers {
-		req.Header.Set(key, value)
-	}
-	return hrt.base.RoundTrip(req)
-}
-
 // SSESessionInfo SSE会话信息
 type SSESessionInfo struct {
 	session     *mcp.ClientSession
@@ -41,6 +32,18 @@ type RemoteSSEManager struct {
 	db       DatabaseServiceInterface
 	sessions map[string]*SSESessionInfo
 	mutex    sync.RWMutex
+	report   *ToolRegistrationReport
+
+	connecting map[string]*pendingConnect // 正在锁外连接的服务
+	closed     bool                       // CloseAll 之后不再发布新连接
+
+	validateArgs bool           // 是否按上游 schema 校验代理工具参数
+	limiter      RateLimiter    // nil 表示不限流
+	meter        UsageMeter     // nil 表示不计量
+	audit        AuditRecorder  // nil 表示不审计
+	health       HealthStatus   // nil 表示不检查健康状态
+	retry        retryPolicy    // 默认重试策略，按服务的 retry_attempts、retry_delay_ms 覆盖
+	breaker      CircuitBreaker // nil 表示不熔断
 }
 
 // NewRemoteSSEManager 创建新的远程 SSE 管理器
@@ -48,11 +51,18 @@ func NewRemoteSSEManager(db DatabaseServiceInterface) *RemoteSSEManager {
 	return &RemoteSSEManager{
 		db:       db,
 		sessions: make(map[string]*SSESessionInfo),
+		report:   NewToolRegistrationReport(),
+
+		connecting: make(map[string]*pendingConnect),
 	}
 }
 
 // GetOrCreateRemoteServer 获取或创建远程 SSE 服务器连接
 func (rsm *RemoteSSEManager) GetOrCreateRemoteServer(serverID string) (*mcp.Server, error) {
+	if err := rsm.checkHealth(serverID); err != nil {
+		return nil, err
+	}
+
 	rsm.mutex.RLock()
 	if sessionInfo, exists := rsm.sessions[serverID]; exists {
 		// 更新最后使用时间和连接数
@@ -65,74 +75,94 @@ func (rsm *RemoteSSEManager) GetOrCreateRemoteServer(serverID string) (*mcp.Serv
 	}
 	rsm.mutex.RUnlock()
 
-	// 创建新连接
+	// 创建新连接：同一服务只有一个调用方在锁外连接（包括重试），其余调用方等待其结果
+	var pending *pendingConnect
+	for pending == nil {
+		rsm.mutex.Lock()
+		if sessionInfo, exists := rsm.sessions[serverID]; exists {
+			sessionInfo.lastUsed = time.Now()
+			atomic.AddInt32(&sessionInfo.activeConns, 1)
+			rsm.mutex.Unlock()
+			return rsm.createProxyServer(serverID, sessionInfo), nil
+		}
+		if inFlight, connecting := rsm.connecting[serverID]; connecting {
+			rsm.mutex.Unlock()
+			if err := inFlight.wait(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pending = newPendingConnect(serverID)
+		rsm.connecting[serverID] = pending
+		rsm.mutex.Unlock()
+	}
+
+	sessionInfo, err := rsm.connect(serverID)
+
 	rsm.mutex.Lock()
-	defer rsm.mutex.Unlock()
+	delete(rsm.connecting, serverID)
+	if err == nil && (pending.abandoned || rsm.closed) {
+		sessionInfo.session.Close()
+		err = pending.abandonedError()
+	}
+	if err == nil {
+		rsm.sessions[serverID] = sessionInfo
+	}
+	rsm.mutex.Unlock()
+	pending.finish(err)
 
-	// 双重检查
-	if sessionInfo, exists := rsm.sessions[serverID]; exists {
-		sessionInfo.lastUsed = time.Now()
-		atomic.AddInt32(&sessionInfo.activeConns, 1)
-		return rsm.createProxyServer(serverID, sessionInfo), nil
+	if err != nil {
+		return nil, err
 	}
+	return rsm.createProxyServer(serverID, sessionInfo), nil
+}
 
-	// 获取配置
+// connect 读取配置并连接远程服务，失败时按服务的 retry_attempts、retry_delay_ms 重试。不持有管理器的锁
+func (rsm *RemoteSSEManager) connect(serverID string) (*SSESessionInfo, error) {
 	config, err := rsm.db.GetSSEServiceConfig(serverID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get SSE service config: %w", err)
 	}
 
-	// 连接到远程服务
-	session, client, err := rsm.connectToRemoteSSEService(config)
+	var session *mcp.ClientSession
+	var client *mcp.Client
+	err = rsm.retry.forSSEService(config).do(context.Background(), "connect to remote SSE service "+serverID, func() error {
+		return guardUpstream(rsm.breaker, serverID, func() error {
+			var err1 error
+			if session, client, err1 = rsm.connectToRemoteSSEService(context.Background(), config); err1 != nil {
+				metrics.UpstreamConnectFailed(serverID, "sse")
+			}
+			return err1
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to remote SSE service: %w", err)
+		return nil, err
 	}
 
 	logger.Info("Successfully connected to remote SSE service: %s", serverID)
-
-	// 存储会话信息
-	sessionInfo := &SSESessionInfo{
+	return &SSESessionInfo{
 		session:     session,
 		client:      client,
 		lastUsed:    time.Now(),
 		config:      config,
 		activeConns: 1,
-	}
-	rsm.sessions[serverID] = sessionInfo
-
-	return rsm.createProxyServer(serverID, sessionInfo), nil
+	}, nil
 }
 
-// connectToRemoteSSEService 连接到远程 SSE 服务
-func (rsm *RemoteSSEManager) connectToRemoteSSEService(config *models.MCPServiceSSE) (*mcp.ClientSession, *mcp.Client, error) {
+// connectToRemoteSSEService 连接到远程 SSE 服务，事件流在 ctx 取消后断开
+func (rsm *RemoteSSEManager) connectToRemoteSSEService(ctx context.Context, config *models.MCPServiceSSE) (*mcp.ClientSession, *mcp.Client, error) {
 	// 构建完整的 URL
 	fullURL := config.BaseURL + config.SSEPath
 	logger.Info("Connecting to remote SSE service: %s", fullURL)
 
-	// 创建HTTP客户端，添加自定义头部
-	var headers map[string]string
-	if config.Headers != nil {
-		headerMap := map[string]interface{}(config.Headers)
-		headers = make(map[string]string)
-		for k, v := range headerMap {
-			if str, ok := v.(string); ok {
-				headers[k] = str
-			}
-		}
-	}
-
-	// 创建传输选项 - 注意：URL 作为第一个参数传递给 NewSSEClientTransport
-	options := &mcp.SSEClientTransportOptions{}
-
-	// 如果有自定义头部，创建自定义的HTTP客户端
-	if len(headers) > 0 {
-		httpClient := &http.Client{
-			Transport: &headerRoundTripper{
-				base:    http.DefaultTransport,
-				headers: headers,
-			},
-		}
-		options.HTTPClient = httpClient
+	// 事件流和消息请求都经过认证传输，添加默认头部和认证信息
+	options := &mcp.SSEClientTransportOptions{
+		HTTPClient: &http.Client{
+			Transport: tracing.Transport(&upstreamAuthRoundTripper{
+				base:   http.DefaultTransport,
+				config: config,
+			}),
+		},
 	}
 
 	// 创建SSE传输
@@ -145,7 +175,6 @@ func (rsm *RemoteSSEManager) connectToRemoteSSEService(config *models.MCPService
 	}, nil)
 
 	// 启动客户端
-	ctx := context.Background()
 	session, err := client.Connect(ctx, transport)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to remote service: %w", err)
@@ -170,15 +199,46 @@ func (rsm *RemoteSSEManager) createProxyServer(serverID string, sessionInfo *SSE
 	}
 
 	// 为每个工具添加代理
+	var skipped []SkippedTool
+	validators := make(map[string]*schema.Validator)
 	for _, toolPtr := range toolsResult.Tools {
-		rsm.addProxyTool(server, sessionInfo, *toolPtr)
+		if err = rsm.addProxyTool(server, sessionInfo, *toolPtr); err != nil {
+			logger.Warn("Skipping proxy tool %s on SSE server %s: %v", toolPtr.Name, serverID, err)
+			skipped = append(skipped, SkippedTool{Name: toolPtr.Name, Reason: err.Error()})
+			continue
+		}
+		if rsm.validateArgs {
+			if validator, err1 := validatorFromSchema(toolPtr.InputSchema); err1 != nil {
+				logger.Warn("Failed to build argument validator for proxy tool %s: %v", toolPtr.Name, err1)
+			} else if validator != nil {
+				validators[toolPtr.Name] = validator
+			}
+		}
 	}
+	rsm.report.Record(serverID, skipped)
+
+	if rsm.validateArgs {
+		server.AddReceivingMiddleware(argumentValidationMiddleware(serverID, newValidatorSet(validators)))
+	}
+	if rsm.meter != nil {
+		server.AddReceivingMiddleware(meteringMiddleware(serverID, rsm.meter))
+	}
+	if rsm.limiter != nil {
+		server.AddReceivingMiddleware(rateLimitMiddleware(serverID, rsm.limiter))
+	}
+	server.AddReceivingMiddleware(authorizationMiddleware(serverID))
+	server.AddReceivingMiddleware(metricsMiddleware(serverID))
+	if rsm.audit != nil {
+		server.AddReceivingMiddleware(auditMiddleware(serverID, rsm.audit))
+	}
+	server.AddReceivingMiddleware(tracingMiddleware(serverID))
+	server.AddReceivingMiddleware(inFlightMiddleware())
 
 	return server
 }
 
-// addProxyTool 添加代理工具
-func (rsm *RemoteSSEManager) addProxyTool(server *mcp.Server, sessionInfo *SSESessionInfo, tool mcp.Tool) {
+// addProxyTool 添加代理工具，schema 无法转换或注册失败时返回错误
+func (rsm *RemoteSSEManager) addProxyTool(server *mcp.Server, sessionInfo *SSESessionInfo, tool mcp.Tool) error {
 	// 创建符合 ToolHandlerFor 类型的处理器
 	toolHandler := func(ctx context.Context, session *mcp.ServerSession, params *mcp.CallToolParamsFor[map[string]any]) (*mcp.CallToolResultFor[any], error) {
 		// 转换参数类型
@@ -187,20 +247,46 @@ func (rsm *RemoteSSEManager) addProxyTool(server *mcp.Server, sessionInfo *SSESe
 			Arguments: params.Arguments,
 		}
 
-		// 调用远程服务
-		result, err := sessionInfo.session.CallTool(ctx, callParams)
+		// 调用远程服务，幂等工具失败时重试
+		var policy retryPolicy
+		if idempotent(&tool) {
+			policy = rsm.retry.forSSEService(sessionInfo.config)
+		}
+		var result *mcp.CallToolResult
+		err := policy.do(ctx, fmt.Sprintf("call to tool %s on server %s", tool.Name, sessionInfo.config.ServerID), func() error {
+			return guardUpstream(rsm.breaker, sessionInfo.config.ServerID, func() error {
+				callCtx, span := startUpstreamCall(ctx, sessionInfo.config.ServerID, "sse", callParams)
+				var err1 error
+				result, err1 = sessionInfo.session.CallTool(callCtx, callParams)
+				endUpstreamCall(span, result, err1)
+				return err1
+			})
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to call remote tool %s: %w", tool.Name, err)
 		}
 
 		// 转换返回类型
 		return &mcp.CallToolResultFor[any]{
-			Content: result.Content,
-			IsError: result.IsError,
+			Meta:              result.Meta,
+			Content:           result.Content,
+			StructuredContent: result.StructuredContent,
+			IsError:           result.IsError,
 		}, nil
 	}
 
-	mcp.AddTool(server, &tool, toolHandler)
+	// 创建兼容的工具副本，转换Schema版本
+	compatibleTool, err := compatibleProxyTool(tool)
+	if err != nil {
+		return err
+	}
+
+	return addToolSafely(server, compatibleTool, toolHandler)
+}
+
+// GetSkippedTools 获取未能注册的代理工具报告
+func (rsm *RemoteSSEManager) GetSkippedTools() map[string][]SkippedTool {
+	return rsm.report.Snapshot()
 }
 
 // CleanupIdleSessions 清理空闲会话
@@ -223,3 +309,70 @@ func (rsm *RemoteSSEManager) CleanupIdleSessions(idleTimeout time.Duration) {
 		}
 	}
 }
+
+// CloseAll 关闭所有远程 SSE 会话
+func (rsm *RemoteSSEManager) CloseAll() {
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
+
+	rsm.closed = true
+	for _, pending := range rsm.connecting {
+		pending.abandoned = true
+	}
+	for serverID, sessionInfo := range rsm.sessions {
+		if sessionInfo.session != nil {
+			sessionInfo.session.Close()
+		}
+		logger.Info("Closed remote SSE session for server: %s", serverID)
+	}
+	rsm.sessions = make(map[string]*SSESessionInfo)
+}
+
+// RefreshService 在配置变更后刷新指定服务的远程会话：config 为 nil（服务已删除或禁用）
+// 或与会话创建时的配置不同（忽略时间戳）时关闭会话，下次连接时按新配置重新连接。返回是否关闭了会话
+func (rsm *RemoteSSEManager) RefreshService(serverID string, config *models.MCPServiceSSE) bool {
+	if config == nil {
+		upstreamAuths.remove(serverID)
+	}
+
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
+
+	// 正在按旧配置连接的不再发布
+	if pending, connecting := rsm.connecting[serverID]; connecting {
+		pending.abandoned = true
+	}
+	sessionInfo, exists := rsm.sessions[serverID]
+	if !exists {
+		return false
+	}
+	if config != nil && sameSSEConfig(sessionInfo.config, config) {
+		return false
+	}
+
+	if sessionInfo.session != nil {
+		sessionInfo.session.Close()
+	}
+	delete(rsm.sessions, serverID)
+	logger.Info("Closed remote SSE session for server %s after config change", serverID)
+	return true
+}
+
+// ServerIDs 获取当前存在远程会话的服务 ID
+func (rsm *RemoteSSEManager) ServerIDs() []string {
+	rsm.mutex.RLock()
+	defer rsm.mutex.RUnlock()
+
+	serverIDs := make([]string, 0, len(rsm.sessions))
+	for serverID := range rsm.sessions {
+		serverIDs = append(serverIDs, serverID)
+	}
+	return serverIDs
+}
+
+// sameSSEConfig 比较两份 SSE 配置是否相同，忽略创建和更新时间
+func sameSSEConfig(a, b *models.MCPServiceSSE) bool {
+	left, right := *a, *b
+	left.CreatedAt, left.UpdatedAt = right.CreatedAt, right.UpdatedAt
+	return reflect.DeepEqual(left, right)
+}
@@ -4,29 +4,45 @@ import (
 	"McpServer/internal/logger"
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"McpServer/internal/auth"
+	"McpServer/internal/metrics"
 	"McpServer/internal/models"
 
-	"github.com/modelcontextprotocol/go-sdk/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 // SessionInfo 会话信息
 type SessionInfo struct {
-	session         *mcp.ClientSession
+	key             string
+	session         *mcp.ClientSession // 受 processMutex 保护，进程重启后替换
 	client          *mcp.Client
 	lastUsed        time.Time
 	config          *models.MCPServiceStdio
-	activeConns     int32            // 活跃连接数
-	userSessions    map[string]int32 // 用户会话计数 (userID -> count)
-	sessionKeys     map[string]bool  // 会话键集合 (for per_session strategy)
-	keepAliveTicker *time.Ticker     // 保活定时器
+	extraEnv        map[string]string // 启动进程时附加的环境变量（按用户凭证），重启时沿用
+	activeConns     int32             // 活跃连接数
+	userSessions    map[string]int32  // 调用方的连接计数 (调用方 Identity -> count)
+	sessionKeys     map[string]bool   // 会话键集合 (for per_session strategy)
+	keepAliveTicker *time.Ticker      // 保活定时器
+
+	processMutex sync.RWMutex
+	proxies      map[*mcp.Server]*stdioProxy // 使用该进程的下游代理服务器，进程重启后按新的工具列表更新
+	state        string                      // 进程状态，见 StdioProcessRunning 等
+	ready        chan struct{}               // 重启完成（成功或放弃）时关闭
+	restarts     []time.Time                 // restart_window 内的重启时间
+	totalRestart int
+	lastCrashAt  time.Time
+	lastError    string
+	stopped      chan struct{} // 会话被主动关闭时关闭，停止保活、崩溃检测和重启
+	stopOnce     sync.Once
 }
 
 // RemoteStdioManager 管理远程 stdio MCP 服务
@@ -35,6 +51,23 @@ type RemoteStdioManager struct {
 	sessions map[string]*SessionInfo
 	mutex    sync.RWMutex
 	stopChan chan struct{}
+	report   *ToolRegistrationReport
+
+	validateArgs bool           // 是否按上游 schema 校验代理工具参数
+	secrets      SecretResolver // 解析 env 中的密钥引用，nil 表示未启用密钥存储
+	protectedEnv []string       // 不传给进程的网关环境变量
+	limiter      RateLimiter    // nil 表示不限流
+	meter        UsageMeter     // nil 表示不计量
+	audit        AuditRecorder  // nil 表示不审计
+	retry        retryPolicy    // 启动进程和调用幂等工具的重试策略
+	breaker      CircuitBreaker // nil 表示不熔断
+
+	starting map[string]*pendingConnect // 正在锁外启动的进程，按会话键
+	closed   bool                       // CloseAll 之后不再发布新进程
+
+	restartWindow  time.Duration  // 统计 max_restarts 的时间窗口
+	restartBackoff retryPolicy    // 崩溃进程的重启退避，只使用 delay 和 maxDelay
+	stopping       sync.WaitGroup // 在后台终止中的进程，CloseAll 等待其退出
 }
 
 // NewRemoteStdioManager 创建新的远程 stdio 管理器
@@ -43,6 +76,11 @@ func NewRemoteStdioManager(db DatabaseServiceInterface) *RemoteStdioManager {
 		db:       db,
 		sessions: make(map[string]*SessionInfo),
 		stopChan: make(chan struct{}),
+		report:   NewToolRegistrationReport(),
+		starting: make(map[string]*pendingConnect),
+
+		restartWindow:  10 * time.Minute,
+		restartBackoff: retryPolicy{delay: time.Second, maxDelay: 30 * time.Second},
 	}
 
 	// 启动清理协程
@@ -53,115 +91,212 @@ func NewRemoteStdioManager(db DatabaseServiceInterface) *RemoteStdioManager {
 
 // GetOrCreateRemoteServer 获取或创建远程服务器连接
 func (rsm *RemoteStdioManager) GetOrCreateRemoteServer(serverID string) (*mcp.Server, error) {
-	return rsm.GetOrCreateRemoteServerWithContext(serverID, "", "")
+	return rsm.GetOrCreateRemoteServerWithContext(serverID, nil, "")
+}
+
+// GetOrCreateRemoteServerWithContext 获取或创建远程服务器连接（带用户和会话上下文）。
+// 占用的连接不会释放，需要在连接结束时释放的调用方使用 AcquireRemoteServer
+func (rsm *RemoteStdioManager) GetOrCreateRemoteServerWithContext(serverID string, user *auth.User, sessionKey string) (*mcp.Server, error) {
+	server, _, err := rsm.AcquireRemoteServer(serverID, user, sessionKey)
+	return server, err
 }
 
-// GetOrCreateRemoteServerWithContext 获取或创建远程服务器连接（带用户和会话上下文）
-func (rsm *RemoteStdioManager) GetOrCreateRemoteServerWithContext(serverID, userID, sessionKey string) (*mcp.Server, error) {
+// AcquireRemoteServer 按复用策略获取或启动远程 stdio 进程，并为一个下游连接占用它：
+// per_user 按调用方 Identity、per_session 按 sessionKey 隔离进程。
+// 返回的 release 在下游连接结束时调用，per_session 的进程在最后一个连接释放后立即关闭
+func (rsm *RemoteStdioManager) AcquireRemoteServer(serverID string, user *auth.User, sessionKey string) (*mcp.Server, func(), error) {
 	// 获取配置以确定复用策略
 	config, err := rsm.db.GetStdioServiceConfig(serverID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stdio config: %w", err)
+		return nil, nil, fmt.Errorf("failed to get stdio config: %w", err)
 	}
 
 	// 根据复用策略生成实际的 session 键
-	actualSessionKey := rsm.generateSessionKey(serverID, userID, sessionKey, config.ReuseStrategy)
+	owner := user.Identity()
+	actualSessionKey := rsm.generateSessionKey(serverID, owner, sessionKey, config.ReuseStrategy)
 
-	rsm.mutex.RLock()
-	if sessionInfo, exists := rsm.sessions[actualSessionKey]; exists {
-		// 检查是否超过最大并发数
-		if config.MaxConcurrent > 0 && atomic.LoadInt32(&sessionInfo.activeConns) >= int32(config.MaxConcurrent) {
-			rsm.mutex.RUnlock()
-			return nil, fmt.Errorf("service %s reached maximum concurrent connections (%d)", serverID, config.MaxConcurrent)
-		}
+	sessionInfo, err := rsm.reserveProcess(actualSessionKey, config, user, sessionKey)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// 更新最后使用时间和连接数
-		sessionInfo.lastUsed = time.Now()
-		atomic.AddInt32(&sessionInfo.activeConns, 1)
+	// 代理服务器在锁外创建：列出工具需要与进程通信，进程重启中还要等待重启完成
+	server := rsm.createProxyServer(actualSessionKey, sessionInfo)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			sessionInfo.removeProxy(server)
+			rsm.releaseRemoteServer(actualSessionKey, sessionInfo, owner, sessionKey)
+		})
+	}
+	return server, release, nil
+}
 
-		// 更新用户会话计数
-		if userID != "" {
-			if sessionInfo.userSessions == nil {
-				sessionInfo.userSessions = make(map[string]int32)
+// reserveProcess 复用或启动会话键对应的进程，并记录占用它的调用方和会话
+func (rsm *RemoteStdioManager) reserveProcess(actualSessionKey string, config *models.MCPServiceStdio, user *auth.User, sessionKey string) (*SessionInfo, error) {
+	serverID := config.ServerID
+	owner := user.Identity()
+
+	// 同一会话键只有一个调用方在锁外启动进程（包括重试），其余调用方等待其结果
+	var pending *pendingConnect
+	for pending == nil {
+		rsm.mutex.Lock()
+		sessionInfo, exists := rsm.sessions[actualSessionKey]
+		if exists {
+			// 崩溃循环的进程在 restart_window 内拒绝新连接，之后重新启动
+			if crashLooping, lastCrashAt := sessionInfo.crashLooping(); crashLooping {
+				if retryAt := lastCrashAt.Add(rsm.restartWindow); time.Now().Before(retryAt) {
+					rsm.mutex.Unlock()
+					return nil, fmt.Errorf("remote stdio service %s is crash-looping (restarted %d times within %s), retry after %s",
+						serverID, config.MaxRestarts, rsm.restartWindow, time.Until(retryAt).Round(time.Second))
+				}
+				logger.Info("Restart window of crash-looping process %s has elapsed, starting a new process", actualSessionKey)
+				rsm.stopInBackground(sessionInfo)
+				delete(rsm.sessions, actualSessionKey)
+				exists = false
 			}
-			sessionInfo.userSessions[userID]++
 		}
+		if exists {
+			// 检查是否超过最大并发数
+			if config.MaxConcurrent > 0 && atomic.LoadInt32(&sessionInfo.activeConns) >= int32(config.MaxConcurrent) {
+				rsm.mutex.Unlock()
+				return nil, fmt.Errorf("service %s reached maximum concurrent connections (%d)", serverID, config.MaxConcurrent)
+			}
 
-		rsm.mutex.RUnlock()
-
-		log.Printf("Reusing existing session for %s (strategy: %s, active: %d/%d)",
-			serverID, config.ReuseStrategy, atomic.LoadInt32(&sessionInfo.activeConns), config.MaxConcurrent)
+			// 更新最后使用时间和连接数
+			sessionInfo.lastUsed = time.Now()
+			atomic.AddInt32(&sessionInfo.activeConns, 1)
+			sessionInfo.addOccupant(owner, sessionKey)
+			rsm.mutex.Unlock()
 
-		// 返回一个代理服务器，将请求转发到远程客户端
-		return rsm.createProxyServer(actualSessionKey, sessionInfo), nil
+			logger.Info("Reusing existing session for %s (strategy: %s, key: %s, active: %d/%d)",
+				serverID, config.ReuseStrategy, actualSessionKey, atomic.LoadInt32(&sessionInfo.activeConns), config.MaxConcurrent)
+			return sessionInfo, nil
+		}
+		if inFlight, starting := rsm.starting[actualSessionKey]; starting {
+			rsm.mutex.Unlock()
+			if err := inFlight.wait(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pending = newPendingConnect(serverID)
+		rsm.starting[actualSessionKey] = pending
+		rsm.mutex.Unlock()
 	}
-	rsm.mutex.RUnlock()
 
-	// 创建新连接
-	rsm.mutex.Lock()
-	defer rsm.mutex.Unlock()
+	sessionInfo, err := rsm.startProcess(actualSessionKey, config, user)
 
-	// 双重检查
-	if sessionInfo, exists := rsm.sessions[actualSessionKey]; exists {
-		if config.MaxConcurrent > 0 && atomic.LoadInt32(&sessionInfo.activeConns) >= int32(config.MaxConcurrent) {
-			return nil, fmt.Errorf("service %s reached maximum concurrent connections (%d)", serverID, config.MaxConcurrent)
-		}
+	rsm.mutex.Lock()
+	delete(rsm.starting, actualSessionKey)
+	discard := err == nil && (pending.abandoned || rsm.closed)
+	if discard {
+		err = pending.abandonedError()
+	} else if err == nil {
+		// 启动保活机制 - 每2分钟发送一次心跳
+		sessionInfo.keepAliveTicker = time.NewTicker(2 * time.Minute)
+		go rsm.startKeepAlive(actualSessionKey, sessionInfo)
+		// 进程退出时按 max_restarts 重启
+		go rsm.watch(sessionInfo, sessionInfo.session)
+
+		sessionInfo.addOccupant(owner, sessionKey)
+		rsm.sessions[actualSessionKey] = sessionInfo
+	}
+	rsm.mutex.Unlock()
+	pending.finish(err)
 
-		sessionInfo.lastUsed = time.Now()
-		atomic.AddInt32(&sessionInfo.activeConns, 1)
+	if discard {
+		sessionInfo.stop()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sessionInfo, nil
+}
 
-		if userID != "" {
-			if sessionInfo.userSessions == nil {
-				sessionInfo.userSessions = make(map[string]int32)
-			}
-			sessionInfo.userSessions[userID]++
+// startProcess 启动会话键对应的进程，启动失败时按默认重试策略重试。不持有管理器的锁
+func (rsm *RemoteStdioManager) startProcess(actualSessionKey string, config *models.MCPServiceStdio, user *auth.User) (*SessionInfo, error) {
+	serverID := config.ServerID
+	logger.Info("Creating new session for %s (strategy: %s, key: %s, max_concurrent: %d)",
+		serverID, config.ReuseStrategy, actualSessionKey, config.MaxConcurrent)
+
+	// per_user 进程在启动时注入该用户自己的凭证，按 UserID 查找
+	var credentialEnv map[string]string
+	if config.ReuseStrategy == "per_user" {
+		var userID string
+		if user != nil {
+			userID = user.UserID
+		}
+		passthrough, err := parseCredentialPassthrough(serverID, config.CredentialPassthrough)
+		if err != nil {
+			return nil, err
+		}
+		if credentialEnv, err = passthrough.credentialEnv(rsm.db, userID); err != nil {
+			return nil, fmt.Errorf("failed to resolve credential of user %q for %s: %w", userID, serverID, err)
 		}
-
-		return rsm.createProxyServer(actualSessionKey, sessionInfo), nil
 	}
 
-	log.Printf("Creating new session for %s (strategy: %s, max_concurrent: %d)",
-		serverID, config.ReuseStrategy, config.MaxConcurrent)
-
 	// 创建客户端连接
-	session, client, err := rsm.connectToRemoteService(config)
+	var session *mcp.ClientSession
+	var client *mcp.Client
+	err := rsm.retry.do(context.Background(), "start remote stdio service "+serverID, func() error {
+		return guardUpstream(rsm.breaker, serverID, func() error {
+			var err1 error
+			if session, client, err1 = rsm.connectToRemoteService(config, credentialEnv); err1 != nil {
+				metrics.UpstreamConnectFailed(serverID, "stdio")
+			}
+			return err1
+		})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to remote service: %w", err)
 	}
 
-	sessionInfo := &SessionInfo{
-		session:      session,
-		client:       client,
-		lastUsed:     time.Now(),
-		config:       config,
-		activeConns:  1,
-		userSessions: make(map[string]int32),
-		sessionKeys:  make(map[string]bool),
+	sessionInfo := newSessionInfo(actualSessionKey, config, credentialEnv, session, client)
+	sessionInfo.activeConns = 1
+	return sessionInfo, nil
+}
+
+// addOccupant 记录使用该进程的调用方和会话，需持有管理器的锁
+func (s *SessionInfo) addOccupant(owner, sessionKey string) {
+	if owner != "" {
+		s.userSessions[owner]++
 	}
+	if sessionKey != "" {
+		s.sessionKeys[sessionKey] = true
+	}
+}
 
-	// 启动保活机制 - 每2分钟发送一次心跳
-	sessionInfo.keepAliveTicker = time.NewTicker(2 * time.Minute)
-	go rsm.startKeepAlive(actualSessionKey, sessionInfo)
+// releaseRemoteServer 释放下游连接对进程的占用
+func (rsm *RemoteStdioManager) releaseRemoteServer(actualSessionKey string, sessionInfo *SessionInfo, owner, sessionKey string) {
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
 
-	// 初始化用户会话计数
-	if userID != "" {
-		sessionInfo.userSessions[userID] = 1
+	remaining := atomic.AddInt32(&sessionInfo.activeConns, -1)
+	sessionInfo.lastUsed = time.Now()
+	if owner != "" {
+		if sessionInfo.userSessions[owner]--; sessionInfo.userSessions[owner] <= 0 {
+			delete(sessionInfo.userSessions, owner)
+		}
+	}
+	if sessionKey != "" {
+		delete(sessionInfo.sessionKeys, sessionKey)
 	}
 
-	rsm.sessions[actualSessionKey] = sessionInfo
-
-	//log.Printf("Successfully connected to remote stdio service: %s (session_key: %s)", serverID, actualSessionKey)
-	return rsm.createProxyServer(actualSessionKey, sessionInfo), nil
+	// 会话已结束，per_session 的进程不会再被复用；进程已在重载时关闭的则不再处理
+	if sessionInfo.config.ReuseStrategy != "per_session" || remaining > 0 || rsm.sessions[actualSessionKey] != sessionInfo {
+		return
+	}
+	rsm.stopInBackground(sessionInfo)
+	delete(rsm.sessions, actualSessionKey)
+	logger.Info("Closing per-session process %s after its session ended", actualSessionKey)
 }
 
-// generateSessionKey 根据复用策略生成会话键
-func (rsm *RemoteStdioManager) generateSessionKey(serverID, userID, sessionKey, reuseStrategy string) string {
+// generateSessionKey 根据复用策略生成会话键，owner 为调用方的 Identity
+func (rsm *RemoteStdioManager) generateSessionKey(serverID, owner, sessionKey, reuseStrategy string) string {
 	switch reuseStrategy {
 	case "per_user":
-		if userID != "" {
-			return fmt.Sprintf("%s:user:%s", serverID, userID)
-		}
-		return fmt.Sprintf("%s:user:anonymous", serverID)
+		return fmt.Sprintf("%s:%s", serverID, owner)
 	case "per_session":
 		if sessionKey != "" {
 			return fmt.Sprintf("%s:session:%s", serverID, sessionKey)
@@ -174,8 +309,20 @@ func (rsm *RemoteStdioManager) generateSessionKey(serverID, userID, sessionKey,
 	}
 }
 
-// connectToRemoteService 连接到远程服务
-func (rsm *RemoteStdioManager) connectToRemoteService(config *models.MCPServiceStdio) (*mcp.ClientSession, *mcp.Client, error) {
+// processEnv 进程继承的网关环境变量，去掉受保护的变量
+func (rsm *RemoteStdioManager) processEnv() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if !slices.Contains(rsm.protectedEnv, name) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// connectToRemoteService 启动进程并连接，extraEnv 为附加的环境变量（按用户凭证）
+func (rsm *RemoteStdioManager) connectToRemoteService(config *models.MCPServiceStdio, extraEnv map[string]string) (*mcp.ClientSession, *mcp.Client, error) {
 	ctx := context.Background()
 
 	// 创建客户端
@@ -192,21 +339,30 @@ func (rsm *RemoteStdioManager) connectToRemoteService(config *models.MCPServiceS
 		cmd.Dir = *config.Workdir
 	}
 
-	// 设置环境变量
-	if config.Env != nil {
-		cmd.Env = os.Environ()
-		for key, value := range config.Env {
-			if valueStr, ok := value.(string); ok {
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, valueStr))
-			}
+	// 设置环境变量，secret:// 引用在启动时解密
+	env, err := resolveSecretRefs(rsm.secrets, config.Env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("env of server %s: %w", config.ServerID, err)
+	}
+	// 始终显式设置，受保护的变量不会被隐式继承
+	cmd.Env = rsm.processEnv()
+	for key, value := range env {
+		if valueStr, ok := value.(string); ok {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, valueStr))
 		}
 	}
+	for key, value := range extraEnv {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
 
-	// 设置错误输出
-	cmd.Stderr = log.Writer()
-
-	// 创建传输
-	transport := mcp.NewCommandTransport(cmd)
+	// 创建传输，关闭时按 shutdown_timeout_ms 终止进程组
+	shutdownTimeout := time.Duration(config.ShutdownTimeoutMs) * time.Millisecond
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	// 进程的标准错误逐行写入日志
+	stderr := logger.NewLineWriter(logger.WithServerID(context.Background(), config.ServerID), logger.INFO)
+	transport := newProcessTransport(cmd, stderr, config.ServerID, shutdownTimeout)
 
 	logger.Info("Connecting to remote stdio service with command: %s %v", config.Command, config.Args)
 
@@ -232,10 +388,26 @@ func (rsm *RemoteStdioManager) createProxyServer(serverID string, sessionInfo *S
 		Version: "1.0.0",
 	}, nil)
 
+	// 登记代理服务器，进程重启后按新的工具列表更新
+	proxy := &stdioProxy{
+		server:     server,
+		validators: newValidatorSet(nil),
+		tools:      make(map[string]string),
+	}
+	sessionInfo.processMutex.Lock()
+	sessionInfo.proxies[server] = proxy
+	sessionInfo.processMutex.Unlock()
+
 	// 获取远程服务的工具列表
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(sessionInfo.config.StartupTimeoutMs)*time.Millisecond)
+	defer cancel()
 	logger.Info("Attempting to list tools from remote service: %s", serverID)
-	toolsResult, err := sessionInfo.session.ListTools(ctx, &mcp.ListToolsParams{})
+	session, err := sessionInfo.acquireSession(ctx)
+	if err != nil {
+		logger.Error("Failed to list tools from remote service %s: %v", serverID, err)
+		return server
+	}
+	toolsResult, err := session.ListTools(ctx, &mcp.ListToolsParams{})
 	if err != nil {
 		logger.Error("Failed to list tools from remote service %s: %v", serverID, err)
 		return server
@@ -244,16 +416,30 @@ func (rsm *RemoteStdioManager) createProxyServer(serverID string, sessionInfo *S
 	logger.Info("Successfully got %d tools from remote service %s", len(toolsResult.Tools), serverID)
 
 	// 为每个远程工具创建代理工具
-	for _, tool := range toolsResult.Tools {
-		logger.Info("Adding tool: %s - %s", tool.Name, tool.Description)
-		rsm.addProxyTool(server, sessionInfo, *tool)
+	rsm.syncProxyTools(sessionInfo, proxy, toolsResult.Tools)
+
+	if rsm.validateArgs {
+		server.AddReceivingMiddleware(argumentValidationMiddleware(sessionInfo.config.ServerID, proxy.validators))
+	}
+	if rsm.meter != nil {
+		server.AddReceivingMiddleware(meteringMiddleware(sessionInfo.config.ServerID, rsm.meter))
 	}
+	if rsm.limiter != nil {
+		server.AddReceivingMiddleware(rateLimitMiddleware(sessionInfo.config.ServerID, rsm.limiter))
+	}
+	server.AddReceivingMiddleware(authorizationMiddleware(sessionInfo.config.ServerID))
+	server.AddReceivingMiddleware(metricsMiddleware(sessionInfo.config.ServerID))
+	if rsm.audit != nil {
+		server.AddReceivingMiddleware(auditMiddleware(sessionInfo.config.ServerID, rsm.audit))
+	}
+	server.AddReceivingMiddleware(tracingMiddleware(sessionInfo.config.ServerID))
+	server.AddReceivingMiddleware(inFlightMiddleware())
 
 	return server
 }
 
-// addProxyTool 添加代理工具
-func (rsm *RemoteStdioManager) addProxyTool(server *mcp.Server, sessionInfo *SessionInfo, tool mcp.Tool) {
+// addProxyTool 添加代理工具，schema 无法转换或注册失败时返回错误
+func (rsm *RemoteStdioManager) addProxyTool(server *mcp.Server, sessionInfo *SessionInfo, tool mcp.Tool) error {
 	// 创建符合 ToolHandlerFor 类型的处理器
 	toolHandler := func(ctx context.Context, session *mcp.ServerSession, params *mcp.CallToolParamsFor[map[string]any]) (*mcp.CallToolResultFor[any], error) {
 		// 增加活跃连接数
@@ -261,11 +447,11 @@ func (rsm *RemoteStdioManager) addProxyTool(server *mcp.Server, sessionInfo *Ses
 		sessionInfo.lastUsed = time.Now()
 
 		// 记录工具调用开始
-		logger.Debug("=== Tool Call Started ===")
-		logger.Debug("Tool: %s", params.Name)
-		logger.Debug("Arguments: %+v", params.Arguments)
-		logger.Debug("Server: %s", sessionInfo.config.ServerID)
-		logger.Debug("Active connections: %d", atomic.LoadInt32(&sessionInfo.activeConns))
+		logger.DebugContext(ctx, "=== Tool Call Started ===")
+		logger.DebugContext(ctx, "Tool: %s", params.Name)
+		logger.DebugContext(ctx, "Arguments: %+v", params.Arguments)
+		logger.DebugContext(ctx, "Server: %s", sessionInfo.config.ServerID)
+		logger.DebugContext(ctx, "Active connections: %d", atomic.LoadInt32(&sessionInfo.activeConns))
 
 		// 转换参数类型
 		callParams := &mcp.CallToolParams{
@@ -274,16 +460,34 @@ func (rsm *RemoteStdioManager) addProxyTool(server *mcp.Server, sessionInfo *Ses
 		}
 
 		// 记录调用远程服务
-		logger.Info("Calling remote tool: %s on server: %s", params.Name, sessionInfo.config.ServerID)
+		logger.InfoContext(ctx, "Calling remote tool: %s on server: %s", params.Name, sessionInfo.config.ServerID)
 
-		result, err := sessionInfo.session.CallTool(ctx, callParams)
+		// 幂等工具失败时重试
+		var policy retryPolicy
+		if idempotent(&tool) {
+			policy = rsm.retry
+		}
+		var result *mcp.CallToolResult
+		err := policy.do(ctx, fmt.Sprintf("call to tool %s on server %s", tool.Name, sessionInfo.config.ServerID), func() error {
+			return guardUpstream(rsm.breaker, sessionInfo.config.ServerID, func() error {
+				// 进程正在重启时等待重启完成
+				session, err1 := sessionInfo.acquireSession(ctx)
+				if err1 != nil {
+					return err1
+				}
+				callCtx, span := startUpstreamCall(ctx, sessionInfo.config.ServerID, "stdio", callParams)
+				result, err1 = session.CallTool(callCtx, callParams)
+				endUpstreamCall(span, result, err1)
+				return err1
+			})
+		})
 		if err != nil {
 			// 减少活跃连接数
 			atomic.AddInt32(&sessionInfo.activeConns, -1)
-			logger.Error("=== Tool Call Failed ===")
-			logger.Error("Tool: %s", params.Name)
-			logger.Error("Error: %v", err)
-			logger.Error("===========================")
+			logger.ErrorContext(ctx, "=== Tool Call Failed ===")
+			logger.ErrorContext(ctx, "Tool: %s", params.Name)
+			logger.ErrorContext(ctx, "Error: %v", err)
+			logger.ErrorContext(ctx, "===========================")
 			return nil, fmt.Errorf("remote call failed: %w", err)
 		}
 
@@ -291,40 +495,31 @@ func (rsm *RemoteStdioManager) addProxyTool(server *mcp.Server, sessionInfo *Ses
 		atomic.AddInt32(&sessionInfo.activeConns, -1)
 
 		// 记录工具调用成功
-		logger.Debug("=== Tool Call Success ===")
-		logger.Debug("Tool: %s", params.Name)
-		logger.Debug("Result content count: %d items", len(result.Content))
-		logger.Debug("Is error: %t", result.IsError)
-		logger.Debug("===========================")
+		logger.DebugContext(ctx, "=== Tool Call Success ===")
+		logger.DebugContext(ctx, "Tool: %s", params.Name)
+		logger.DebugContext(ctx, "Result content count: %d items", len(result.Content))
+		logger.DebugContext(ctx, "Is error: %t", result.IsError)
+		logger.DebugContext(ctx, "===========================")
 		// 转换返回类型
 		return &mcp.CallToolResultFor[any]{
-			Content: result.Content,
-			IsError: result.IsError,
+			Meta:              result.Meta,
+			Content:           result.Content,
+			StructuredContent: result.StructuredContent,
+			IsError:           result.IsError,
 		}, nil
 	}
 
 	// 创建兼容的工具副本，转换Schema版本
-	var convertedSchema *jsonschema.Schema
-	if tool.InputSchema != nil {
-		convertedSchema = rsm.convertSchemaToDraft2020(tool.InputSchema)
+	compatibleTool, err := compatibleProxyTool(tool)
+	if err != nil {
+		return err
 	}
 
-	compatibleTool := mcp.Tool{
-		Name:        tool.Name,
-		Description: tool.Description,
-		InputSchema: convertedSchema,
+	if err = addToolSafely(server, compatibleTool, toolHandler); err != nil {
+		return err
 	}
-
-	// 尝试添加工具，如果失败则记录错误但不中断程序
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Warn("Failed to add proxy tool %s due to schema compatibility issue: %v", tool.Name, r)
-			logger.Warn("This tool will be skipped, but the service will continue to work")
-		}
-	}()
-
-	mcp.AddTool(server, &compatibleTool, toolHandler)
 	logger.Info("Added proxy tool: %s", tool.Name)
+	return nil
 }
 
 // cleanupRoutine 清理协程，根据配置策略管理会话生命周期
@@ -363,6 +558,16 @@ func (rsm *RemoteStdioManager) cleanupIdleSessions() {
 					toDelete = append(toDelete, serverID)
 				}
 			}
+		case "per_user":
+			// 每个用户一个进程，该用户没有活跃连接且超过TTL时关闭，避免进程数随用户数增长
+			if atomic.LoadInt32(&sessionInfo.activeConns) == 0 {
+				idleDuration := now.Sub(sessionInfo.lastUsed)
+				ttl := time.Duration(sessionInfo.config.IdleTtlMs) * time.Millisecond
+				if idleDuration > ttl {
+					logger.Info("Closing idle per-user session %s (idle for %v)", serverID, idleDuration)
+					toDelete = append(toDelete, serverID)
+				}
+			}
 		case "shared":
 			// 共享模式，只有在超过TTL且没有活跃连接时才关闭
 			if atomic.LoadInt32(&sessionInfo.activeConns) == 0 {
@@ -388,11 +593,8 @@ func (rsm *RemoteStdioManager) cleanupIdleSessions() {
 	// 清理标记的会话
 	for _, serverID := range toDelete {
 		if sessionInfo, exists := rsm.sessions[serverID]; exists {
-			// 停止保活定时器
-			if sessionInfo.keepAliveTicker != nil {
-				sessionInfo.keepAliveTicker.Stop()
-			}
-			sessionInfo.session.Close()
+			// 停止保活、崩溃检测并在后台终止进程
+			rsm.stopInBackground(sessionInfo)
 			delete(rsm.sessions, serverID)
 		}
 	}
@@ -404,7 +606,7 @@ func (rsm *RemoteStdioManager) CloseRemoteSession(serverID string) {
 	defer rsm.mutex.Unlock()
 
 	if sessionInfo, exists := rsm.sessions[serverID]; exists {
-		sessionInfo.session.Close()
+		rsm.stopInBackground(sessionInfo)
 		delete(rsm.sessions, serverID)
 		logger.Info("Manually closed remote session: %s", serverID)
 	}
@@ -416,14 +618,38 @@ func (rsm *RemoteStdioManager) CloseAll() {
 	close(rsm.stopChan)
 
 	rsm.mutex.Lock()
-	defer rsm.mutex.Unlock()
-
-	for serverID, sessionInfo := range rsm.sessions {
-		sessionInfo.session.Close()
-		logger.Info("Closed remote session: %s", serverID)
+	rsm.closed = true
+	for _, pending := range rsm.starting {
+		pending.abandoned = true
 	}
-
+	sessions := rsm.sessions
 	rsm.sessions = make(map[string]*SessionInfo)
+	rsm.mutex.Unlock()
+
+	// 并行终止全部进程，等待它们以及之前在后台终止的进程退出
+	for serverID, sessionInfo := range sessions {
+		rsm.stopping.Add(1)
+		go func() {
+			defer rsm.stopping.Done()
+			sessionInfo.stop()
+			logger.Info("Closed remote session: %s", serverID)
+		}()
+	}
+	rsm.stopping.Wait()
+}
+
+// stopInBackground 在后台终止进程，进程按 shutdown_timeout_ms 逐步终止期间不占用管理器的锁
+func (rsm *RemoteStdioManager) stopInBackground(sessionInfo *SessionInfo) {
+	rsm.stopping.Add(1)
+	go func() {
+		defer rsm.stopping.Done()
+		sessionInfo.stop()
+	}()
+}
+
+// GetSkippedTools 获取未能注册的代理工具报告
+func (rsm *RemoteStdioManager) GetSkippedTools() map[string][]SkippedTool {
+	return rsm.report.Snapshot()
 }
 
 // GetSessionStats 获取会话统计信息
@@ -469,6 +695,7 @@ func (rsm *RemoteStdioManager) GetSessionStats() map[string]interface{} {
 		}
 
 		// 详细会话信息
+		sessionInfo.processMutex.RLock()
 		sessionDetail := map[string]interface{}{
 			"server_id":      sessionInfo.config.ServerID,
 			"strategy":       strategy,
@@ -476,7 +703,15 @@ func (rsm *RemoteStdioManager) GetSessionStats() map[string]interface{} {
 			"max_concurrent": sessionInfo.config.MaxConcurrent,
 			"last_used":      sessionInfo.lastUsed,
 			"user_sessions":  len(sessionInfo.userSessions),
+			"state":          sessionInfo.state,
+			"restarts":       len(recentRestarts(sessionInfo.restarts, rsm.restartWindow)),
+			"total_restarts": sessionInfo.totalRestart,
 		}
+		if !sessionInfo.lastCrashAt.IsZero() {
+			sessionDetail["last_crash_at"] = sessionInfo.lastCrashAt
+			sessionDetail["last_error"] = sessionInfo.lastError
+		}
+		sessionInfo.processMutex.RUnlock()
 		stats[sessionKey] = sessionDetail
 	}
 
@@ -490,56 +725,77 @@ func (rsm *RemoteStdioManager) GetSessionStats() map[string]interface{} {
 	return summary
 }
 
-// convertSchemaToDraft2020 将JSON Schema从draft-07转换为draft/2020-12
-func (rsm *RemoteStdioManager) convertSchemaToDraft2020(originalSchema *jsonschema.Schema) *jsonschema.Schema {
-	if originalSchema == nil {
-		return nil
-	}
-
-	// 创建新的Schema对象
-	newSchema := &jsonschema.Schema{
-		Type:        originalSchema.Type,
-		Title:       originalSchema.Title,
-		Description: originalSchema.Description,
-		Properties:  make(map[string]*jsonschema.Schema),
-		Required:    originalSchema.Required,
-		Items:       originalSchema.Items,
-		Enum:        originalSchema.Enum,
-		Default:     originalSchema.Default,
-		Examples:    originalSchema.Examples,
-	}
-
-	// 递归处理Properties
-	if originalSchema.Properties != nil {
-		for propName, propSchema := range originalSchema.Properties {
-			newSchema.Properties[propName] = rsm.convertSchemaToDraft2020(propSchema)
-		}
-	}
-
-	// 递归处理Items
-	if originalSchema.Items != nil {
-		newSchema.Items = rsm.convertSchemaToDraft2020(originalSchema.Items)
-	}
-
-	return newSchema
-}
-
-// startKeepAlive 启动保活机制
+// startKeepAlive 启动保活机制。进程无响应时关闭其会话，由崩溃检测按 max_restarts 重启
 func (rsm *RemoteStdioManager) startKeepAlive(sessionKey string, sessionInfo *SessionInfo) {
 	for {
 		select {
 		case <-sessionInfo.keepAliveTicker.C:
-			// 发送心跳请求（列出工具来保持连接活跃）
-			ctx := context.Background()
-			_, err := sessionInfo.session.ListTools(ctx, &mcp.ListToolsParams{})
+			sessionInfo.processMutex.RLock()
+			state, session := sessionInfo.state, sessionInfo.session
+			sessionInfo.processMutex.RUnlock()
+			if state != StdioProcessRunning {
+				continue
+			}
+
+			// 发送心跳请求
+			ctx, cancel := context.WithTimeout(context.Background(), keepAliveTimeout)
+			err := session.Ping(ctx, &mcp.PingParams{})
+			cancel()
 			if err != nil {
 				logger.Error("Keep-alive failed for session %s: %v", sessionKey, err)
+				metrics.KeepAliveFailed(sessionInfo.config.ServerID)
+				if !sessionInfo.isStopped() {
+					session.Close()
+				}
 			} else {
 				sessionInfo.lastUsed = time.Now()
 				logger.Info("Keep-alive successful for session %s", sessionKey)
 			}
+		case <-sessionInfo.stopped:
+			return
 		case <-rsm.stopChan:
 			return
 		}
 	}
 }
+
+// RefreshService 在配置变更后刷新指定服务的远程会话：config 为 nil（服务已删除或禁用）
+// 或与会话创建时的配置不同时，关闭该服务的所有会话，下次连接时按新配置重新启动。返回关闭的会话数
+func (rsm *RemoteStdioManager) RefreshService(serverID string, config *models.MCPServiceStdio) int {
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
+
+	// 正在按旧配置启动的进程不再发布
+	for _, pending := range rsm.starting {
+		if pending.serverID == serverID {
+			pending.abandoned = true
+		}
+	}
+	closed := 0
+	for sessionKey, sessionInfo := range rsm.sessions {
+		if sessionInfo.config.ServerID != serverID {
+			continue
+		}
+		if config != nil && reflect.DeepEqual(*sessionInfo.config, *config) {
+			continue
+		}
+
+		rsm.stopInBackground(sessionInfo)
+		delete(rsm.sessions, sessionKey)
+		closed++
+		logger.Info("Closed remote stdio session %s after config change", sessionKey)
+	}
+	return closed
+}
+
+// ServerIDs 获取当前存在远程会话的服务 ID
+func (rsm *RemoteStdioManager) ServerIDs() []string {
+	rsm.mutex.RLock()
+	defer rsm.mutex.RUnlock()
+
+	serverIDs := make([]string, 0, len(rsm.sessions))
+	for _, sessionInfo := range rsm.sessions {
+		serverIDs = append(serverIDs, sessionInfo.config.ServerID)
+	}
+	return serverIDs
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"McpServer/internal/breaker"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// retryPolicy 重试策略：首次失败后最多再尝试 attempts 次，第 n 次重试前等待 delay*2^(n-1)，
+// 不超过 maxDelay，并在后一半区间内随机抖动，避免大量调用同时重试
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+// SetRetryDefaults 设置连接远程服务和调用幂等工具的默认重试策略；远程 SSE 服务以自身的
+// retry_attempts、retry_delay_ms 为准，retry_delay_ms 为 0 时使用默认间隔
+func (m *MCPServerManager) SetRetryDefaults(attempts int, delay, maxDelay time.Duration) {
+	policy := retryPolicy{attempts: attempts, delay: delay, maxDelay: maxDelay}
+	m.remoteManager.retry = policy
+	m.sseManager.retry = policy
+}
+
+// forSSEService 远程 SSE 服务的重试策略
+func (p retryPolicy) forSSEService(config *models.MCPServiceSSE) retryPolicy {
+	policy := p
+	policy.attempts = config.RetryAttempts
+	if config.RetryDelayMs > 0 {
+		policy.delay = time.Duration(config.RetryDelayMs) * time.Millisecond
+	}
+	return policy
+}
+
+// backoff 第 retry 次（从 1 开始）重试前的等待时间
+func (p retryPolicy) backoff(retry int) time.Duration {
+	delay := p.delay
+	for i := 1; i < retry && (p.maxDelay <= 0 || delay < p.maxDelay); i++ {
+		delay *= 2
+	}
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// do 执行 fn，失败时按策略重试；ctx 取消或错误不可重试时立即返回。
+// 重试后仍失败时返回的错误包含尝试次数和最后一次的错误
+func (p retryPolicy) do(ctx context.Context, operation string, fn func() error) error {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt > p.attempts || !retryable(ctx, err) {
+			break
+		}
+		wait := p.backoff(attempt)
+		logger.WarnContext(ctx, "%s failed (attempt %d/%d), retrying in %s: %v", operation, attempt, p.attempts+1, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s canceled after %d attempts: %w", operation, attempt, err)
+		}
+	}
+	if attempt == 1 {
+		return err
+	}
+	logger.ErrorContext(ctx, "%s failed after %d attempts: %v", operation, attempt, err)
+	return fmt.Errorf("%s failed after %d attempts: %w", operation, attempt, err)
+}
+
+// retryable 调用方已取消、会话已关闭（同一会话上重试不会成功）或已熔断时不重试
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return !errors.Is(err, mcp.ErrConnectionClosed) && !errors.Is(err, breaker.ErrOpen)
+}
+
+// idempotent 上游是否将工具标注为幂等（annotations.idempotentHint），只有幂等工具的调用失败后重试
+func idempotent(tool *mcp.Tool) bool {
+	return tool.Annotations != nil && tool.Annotations.IdempotentHint
+}
@@ -1,47 +1,75 @@
 package manager
 
 import (
+	"McpServer/internal/auth"
+	"McpServer/internal/breaker"
+	"McpServer/internal/health"
 	"McpServer/internal/logger"
+	"McpServer/internal/metrics"
+	"McpServer/internal/tracing"
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"McpServer/internal/models"
+	"McpServer/internal/ratelimit"
 
-	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HTTPSessionInfo 存储 HTTP 会话信息
 type HTTPSessionInfo struct {
 	ServerID     string
 	SessionID    string
-	Config       *models.MCPServiceSSE
+	Config       *models.MCPServiceSSE `json:"-"` // 含上游认证配置和请求头，不出现在 /admin/sessions 的响应中
+	BaseURL      string                // 远程 SSE 服务的地址，STDIO 和内置服务为空
 	LastUsed     time.Time
 	CreatedAt    time.Time
 	IsActive     bool
 	ConnectionID string // 用于跟踪连接
+	UserID       string // 建立会话的认证用户
+	Owner        string // 建立会话的调用方标识（auth.User.Identity），后续消息必须来自同一调用方；认证未启用时为空
+
+	credential string            // 建立 SSE 会话时解析的调用方上游凭证（credential_passthrough）
+	toolCalls  *proxiedToolCalls // 等待结果的透传工具调用
 }
 
 // SessionManager 管理 MCP 会话
 type SessionManager struct {
 	manager      MCPServerManagerInterface
 	db           DatabaseServiceInterface
-	mcpHandlers  map[string]http.Handler     // serverID -> MCP Handler
-	sessions     map[string]*HTTPSessionInfo // sessionID -> HTTPSessionInfo
+	mcpHandlers  map[string]*connectionHandler // serverID -> MCP Handler
+	sessions     map[string]*HTTPSessionInfo   // sessionID -> HTTPSessionInfo
 	handlerMutex sync.RWMutex
 
 	// 会话清理配置
 	sessionTimeout time.Duration // 会话超时时间
 	cleanupTicker  *time.Ticker  // 清理定时器
 	shutdownChan   chan bool     // 关闭信号
+
+	limiter RateLimiter    // HTTP 请求和透传工具调用的限流，nil 表示不限流
+	meter   UsageMeter     // 透传工具调用的计量和配额，nil 表示不计量
+	audit   AuditRecorder  // 透传工具调用的审计，nil 表示不审计
+	health  HealthStatus   // 远程 SSE 服务的健康状态，nil 表示不检查
+	breaker CircuitBreaker // 远程 SSE 服务透传请求的熔断，nil 表示不熔断
+
+	// 网关自身的凭证头（Authorization 和 API 密钥头），不转发给远程 SSE 服务
+	gatewayCredentialHeaders []string
+
+	draining     atomic.Bool     // 正在关闭，拒绝新的连接和透传工具调用
+	streams      context.Context // 关闭时取消，结束透传的远程 SSE 请求
+	closeStreams context.CancelFunc
 }
 
 // NewSessionManager 创建新的会话管理器
@@ -49,11 +77,14 @@ func NewSessionManager(manager MCPServerManagerInterface, db DatabaseServiceInte
 	sm := &SessionManager{
 		manager:        manager,
 		db:             db,
-		mcpHandlers:    make(map[string]http.Handler),
+		mcpHandlers:    make(map[string]*connectionHandler),
 		sessions:       make(map[string]*HTTPSessionInfo),
 		sessionTimeout: 30 * time.Minute, // 30分钟超时
 		shutdownChan:   make(chan bool),
+
+		gatewayCredentialHeaders: []string{"Authorization", "X-API-Key"},
 	}
+	sm.streams, sm.closeStreams = context.WithCancel(context.Background())
 
 	// 启动会话清理协程
 	sm.startSessionCleanup()
@@ -122,10 +153,10 @@ func (sm *SessionManager) cleanupUnusedHandlers(potentialServers map[string]bool
 		activeServers[sessionInfo.ServerID]++
 	}
 
-	// 清理没有活跃会话的处理器
+	// 清理没有活跃会话和连接的处理器
 	for serverID := range potentialServers {
 		if activeServers[serverID] == 0 {
-			if _, exists := sm.mcpHandlers[serverID]; exists {
+			if handler, exists := sm.mcpHandlers[serverID]; exists && handler.activeCount() == 0 {
 				delete(sm.mcpHandlers, serverID)
 				logger.Info("Cleaned up handler for inactive server: %s", serverID)
 			}
@@ -170,57 +201,114 @@ func (sm *SessionManager) GetActiveSessionCount() int {
 	return count
 }
 
+// ActiveSessionsByServer 各服务的活跃会话数
+func (sm *SessionManager) ActiveSessionsByServer() map[string]int {
+	sm.handlerMutex.RLock()
+	defer sm.handlerMutex.RUnlock()
+
+	counts := make(map[string]int)
+	for _, session := range sm.sessions {
+		if session.IsActive {
+			counts[session.ServerID]++
+		}
+	}
+	return counts
+}
+
 // HandleInitialConnection 处理初始连接请求（GET 请求 + server_id）
 func (sm *SessionManager) HandleInitialConnection(w http.ResponseWriter, r *http.Request, serverID string) {
-	logger.Info("Handling initial connection for server: %s", serverID)
+	r = r.WithContext(logger.WithServerID(r.Context(), serverID))
+	logger.InfoContext(r.Context(), "Handling initial connection for server: %s", serverID)
+	if sm.rejectIfDraining(w, r) {
+		return
+	}
 
-	// 检查是否已有缓存的处理器
-	sm.handlerMutex.RLock()
-	if handler, exists := sm.mcpHandlers[serverID]; exists {
-		sm.handlerMutex.RUnlock()
-		logger.Info("Using cached MCP handler for server: %s", serverID)
-		handler.ServeHTTP(w, r)
+	// 检查调用方密钥是否有权访问该服务
+	if user, _ := auth.UserFromContext(r.Context()); !user.CanConnect(serverID) {
+		logger.InfoContext(r.Context(), "Denied connection to server %s for user %s (key: %s)", serverID, user.Username, user.KeyName)
+		http.Error(w, fmt.Sprintf("Forbidden: no permission for server '%s'", serverID), http.StatusForbidden)
+		return
+	}
+	if !sm.allowRequest(w, r, serverID) {
 		return
 	}
-	sm.handlerMutex.RUnlock()
 
 	// 首先检查是否为远程 SSE 服务
 	isSSE, err := sm.manager.GetDB().IsRemoteSSEService(serverID)
 	if err != nil {
-		logger.Info("Error checking SSE service: %v", err)
+		logger.InfoContext(r.Context(), "Error checking SSE service: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	if isSSE {
 		// 对于远程 SSE 服务，直接透传
-		logger.Info("Handling remote SSE service: %s", serverID)
+		logger.InfoContext(r.Context(), "Handling remote SSE service: %s", serverID)
 		sm.handleRemoteSSEProxy(w, r, serverID)
 		return
 	}
 
-	// 获取本地服务器实例
-	server, err := sm.manager.GetServer(serverID)
+	// 为本次连接生成 MCP 会话 ID，并按调用方获取服务器实例（per_user/per_session 的 stdio 服务各自独立）
+	sessionID := sm.generateSessionID()
+	r = r.WithContext(logger.WithSessionID(r.Context(), sessionID))
+	var userID, owner string
+	user, ok := auth.UserFromContext(r.Context())
+	if ok {
+		userID, owner = user.UserID, user.Identity()
+	}
+
+	server, release, err := sm.manager.GetServerWithContext(serverID, user, sessionID)
+	if errors.Is(err, errCredentialRequired) {
+		logger.InfoContext(r.Context(), "Denied connection to server %s for user %q: %v", serverID, userID, err)
+		http.Error(w, fmt.Sprintf("Forbidden: no credential configured for server '%s'", serverID), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, health.ErrUnhealthy) {
+		logger.InfoContext(r.Context(), "Rejecting connection to server %s: %v", serverID, err)
+		http.Error(w, fmt.Sprintf("Service Unavailable: server '%s' is failing health checks", serverID), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, breaker.ErrOpen) {
+		logger.InfoContext(r.Context(), "Rejecting connection to server %s: %v", serverID, err)
+		http.Error(w, fmt.Sprintf("Service Unavailable: circuit breaker for server '%s' is open", serverID), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		log.Printf("Error: Server with ID '%s' not found: %v", serverID, err)
+		logger.InfoContext(r.Context(), "Error: Server with ID '%s' not found: %v", serverID, err)
 		http.Error(w, fmt.Sprintf("Server '%s' not found", serverID), http.StatusNotFound)
 		return
 	}
+	defer release()
 
-	// 创建新的 MCP SSE 处理器
-	logger.Info("Creating new MCP SSE handler for server: %s", serverID)
-	mcpHandler := mcp.NewSSEHandler(func(request *http.Request) *mcp.Server {
-		logger.Info("MCP SSE Handler called for server %s, method: %s, URL: %s", serverID, request.Method, request.URL.String())
-		return server
-	})
-
-	// 缓存处理器
+	// 获取或创建服务的连接处理器
 	sm.handlerMutex.Lock()
-	sm.mcpHandlers[serverID] = mcpHandler
+	handler, exists := sm.mcpHandlers[serverID]
+	if !exists {
+		logger.InfoContext(r.Context(), "Creating new MCP SSE handler for server: %s", serverID)
+		handler = newConnectionHandler(serverID)
+		sm.mcpHandlers[serverID] = handler
+	}
+
+	// 记录会话，后续消息按 sessionId 路由到该服务
+	now := time.Now()
+	sm.sessions[sessionID] = &HTTPSessionInfo{
+		ServerID:     serverID,
+		SessionID:    sessionID,
+		LastUsed:     now,
+		CreatedAt:    now,
+		IsActive:     true,
+		ConnectionID: generateConnectionID(),
+		UserID:       userID,
+		Owner:        owner,
+	}
 	sm.handlerMutex.Unlock()
 
-	logger.Info("Successfully created and cached MCP handler for server: %s", serverID)
-	mcpHandler.ServeHTTP(w, r)
+	logger.InfoContext(r.Context(), "Serving SSE connection for server %s (session: %s, user: %s)", serverID, sessionID, userID)
+	handler.serveConnection(w, r, sessionID, server)
+
+	sm.handlerMutex.Lock()
+	delete(sm.sessions, sessionID)
+	sm.handlerMutex.Unlock()
 }
 
 // generateSessionID 生成一个新的会话 ID
@@ -297,34 +385,34 @@ func (sm *SessionManager) createStdioSession(serverID string, r *http.Request) {
 
 // HandleSessionRequest 处理会话请求（POST 请求或无 server_id 的请求）
 func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Handling session request: %s %s", r.Method, r.URL.String())
+	logger.InfoContext(r.Context(), "Handling session request: %s %s", r.Method, r.URL.String())
 
 	// 检查是否是 POST 到 /message 或 /messages 端点，或者其他带 sessionId/session_id/sessionid 的请求
 	sessionID := r.URL.Query().Get("sessionId")
-	logger.Info("Checking sessionId (camelCase): '%s'", sessionID)
+	logger.InfoContext(r.Context(), "Checking sessionId (camelCase): '%s'", sessionID)
 	if sessionID == "" {
 		sessionID = r.URL.Query().Get("session_id")
-		logger.Info("Checking session_id (underscore): '%s'", sessionID)
+		logger.InfoContext(r.Context(), "Checking session_id (underscore): '%s'", sessionID)
 	}
 	if sessionID == "" {
 		sessionID = r.URL.Query().Get("sessionid") // 支持小写的 sessionid
-		logger.Info("Checking sessionid (lowercase): '%s'", sessionID)
+		logger.InfoContext(r.Context(), "Checking sessionid (lowercase): '%s'", sessionID)
 	}
 
 	// 调试：显示所有查询参数
-	//log.Printf("All query parameters: %v", r.URL.Query())
-	logger.Debug("All query parameters: %v", r.URL.Query())
+	//logger.InfoContext(r.Context(), "All query parameters: %v", r.URL.Query())
+	logger.DebugContext(r.Context(), "All query parameters: %v", r.URL.Query())
 
 	if sessionID != "" {
-		logger.Debug("Detected request to %s with sessionId: %s", r.URL.Path, sessionID)
-		logger.Debug("Routing to handleSessionMessage for sessionId: %s", sessionID)
+		logger.DebugContext(r.Context(), "Detected request to %s with sessionId: %s", r.URL.Path, sessionID)
+		logger.DebugContext(r.Context(), "Routing to handleSessionMessage for sessionId: %s", sessionID)
 		sm.handleSessionMessage(w, r, sessionID)
 		return
 	}
 
 	// 检查是否是 POST 到 /message 或 /messages 端点（无 sessionId 参数的情况）
 	if r.Method == "POST" && (strings.HasPrefix(r.URL.Path, "/message") || strings.HasPrefix(r.URL.Path, "/messages")) {
-		logger.Debug("POST request to %s without sessionId, checking request body", r.URL.Path)
+		logger.DebugContext(r.Context(), "POST request to %s without sessionId, checking request body", r.URL.Path)
 		// 可能需要从请求体中提取 sessionId，但这里先使用现有逻辑
 	}
 
@@ -339,7 +427,7 @@ func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Re
 	sm.handlerMutex.RUnlock()
 
 	if len(handlers) == 0 {
-		logger.Error("No cached handlers available for session request")
+		logger.ErrorContext(r.Context(), "No cached handlers available for session request")
 		http.Error(w, "No active sessions", http.StatusNotFound)
 		return
 	}
@@ -356,12 +444,15 @@ func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Re
 
 		if sessionID != "" {
 			// 有sessionID的请求需要路由到正确的session
-			logger.Info("Single handler with sessionID %s, routing through session management", sessionID)
+			logger.InfoContext(r.Context(), "Single handler with sessionID %s, routing through session management", sessionID)
 			sm.handleSessionMessage(w, r, sessionID)
 			return
 		} else {
 			// 没有sessionID的请求直接转发（例如初始连接后的第一个请求）
-			logger.Info("Single handler without sessionID, direct forwarding to: %s", serverIDs[0])
+			logger.InfoContext(r.Context(), "Single handler without sessionID, direct forwarding to: %s", serverIDs[0])
+			if !sm.allowRequest(w, r, serverIDs[0]) {
+				return
+			}
 			handlers[0].ServeHTTP(w, r)
 			return
 		}
@@ -377,7 +468,7 @@ func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Re
 		if strings.Contains(r.URL.String(), serverID) {
 			targetHandler = handlers[i]
 			targetServerID = serverID
-			logger.Info("Inferred target server from URL: %s", serverID)
+			logger.InfoContext(r.Context(), "Inferred target server from URL: %s", serverID)
 			break
 		}
 	}
@@ -390,7 +481,7 @@ func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Re
 				if strings.Contains(referer, serverID) {
 					targetHandler = handlers[i]
 					targetServerID = serverID
-					logger.Info("Inferred target server from Referer: %s", serverID)
+					logger.InfoContext(r.Context(), "Inferred target server from Referer: %s", serverID)
 					break
 				}
 			}
@@ -412,40 +503,45 @@ func (sm *SessionManager) HandleSessionRequest(w http.ResponseWriter, r *http.Re
 		if len(nonEmployeeHandlers) == 1 {
 			targetHandler = nonEmployeeHandlers[0]
 			targetServerID = nonEmployeeServerIDs[0]
-			log.Printf("Using the only non-employee server: %s", targetServerID)
+			logger.InfoContext(r.Context(), "Using the only non-employee server: %s", targetServerID)
 		}
 	}
 
 	// 如果无法推断，记录警告并拒绝请求
 	if targetHandler == nil {
-		logger.Error("Multiple handlers available (%d): %v, but cannot determine target server", len(handlers), serverIDs)
-		logger.Error("Request URL: %s", r.URL.String())
-		logger.Error("Please specify sessionId parameter to route to the correct server")
+		logger.ErrorContext(r.Context(), "Multiple handlers available (%d): %v, but cannot determine target server", len(handlers), serverIDs)
+		logger.ErrorContext(r.Context(), "Request URL: %s", r.URL.String())
+		logger.ErrorContext(r.Context(), "Please specify sessionId parameter to route to the correct server")
 		http.Error(w, "Cannot determine target server. Multiple active sessions found. Please use sessionId parameter.",
 			http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Using inferred handler for server: %s", targetServerID)
+	logger.InfoContext(r.Context(), "Using inferred handler for server: %s", targetServerID)
+	if !sm.allowRequest(w, r, targetServerID) {
+		return
+	}
 	targetHandler.ServeHTTP(w, r)
 }
 
 // handleSessionMessage 处理基于 sessionId 的消息请求
 func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Request, sessionID string) {
+	r = r.WithContext(logger.WithSessionID(r.Context(), sessionID))
 	// 验证sessionID格式
 	if !sm.isValidSessionID(sessionID) {
-		logger.Error("Invalid sessionID format: %s", sessionID)
+		logger.ErrorContext(r.Context(), "Invalid sessionID format: %s", sessionID)
 		http.Error(w, "Invalid session ID format", http.StatusBadRequest)
 		return
 	}
 
 	// 查找会话信息
+	_, lookupSpan := tracing.Start(r.Context(), "session.lookup", trace.SpanKindInternal, attribute.String("mcp.session_id", sessionID))
 	sm.handlerMutex.RLock()
 	sessionInfo, exists := sm.sessions[sessionID]
 
 	// 如果会话存在，检查是否已过期
 	if exists && sm.isSessionExpired(sessionInfo) {
-		logger.Info("Session %s has expired, removing it", sessionID)
+		logger.InfoContext(r.Context(), "Session %s has expired, removing it", sessionID)
 		sm.handlerMutex.RUnlock()
 
 		// 删除过期会话
@@ -459,11 +555,11 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 	}
 
 	// 添加调试信息
-	logger.Debug("Looking up sessionId: %s", sessionID)
+	logger.DebugContext(r.Context(), "Looking up sessionId: %s", sessionID)
 
 	if !exists {
 		// 对于内置服务，允许按需创建session，但要严格验证
-		logger.Info("Session not found: %s, checking if can create for builtin service", sessionID)
+		logger.InfoContext(r.Context(), "Session not found: %s, checking if can create for builtin service", sessionID)
 
 		sm.handlerMutex.RLock()
 		activeHandlers := make(map[string]bool)
@@ -479,7 +575,7 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 			isSSE, sseErr := sm.manager.GetDB().IsRemoteSSEService(serverID)
 
 			if stdioErr == nil && sseErr == nil && !isStdio && !isSSE {
-				logger.Info("Creating virtual session for builtin service: %s, sessionID: %s", serverID, sessionID)
+				logger.InfoContext(r.Context(), "Creating virtual session for builtin service: %s, sessionID: %s", serverID, sessionID)
 
 				// 创建虚拟会话
 				now := time.Now()
@@ -495,7 +591,7 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 				}
 				sm.handlerMutex.Unlock()
 
-				logger.Info("Successfully created virtual session for builtin service: %s (sessionID: %s)", serverID, sessionID)
+				logger.InfoContext(r.Context(), "Successfully created virtual session for builtin service: %s (sessionID: %s)", serverID, sessionID)
 				exists = true
 				break
 			}
@@ -503,7 +599,9 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 
 		if !exists {
 			// 对于远程服务或其他情况，拒绝创建session
-			logger.Error("Session not found and cannot create: %s (not a builtin service or multiple handlers)", sessionID)
+			logger.ErrorContext(r.Context(), "Session not found and cannot create: %s (not a builtin service or multiple handlers)", sessionID)
+			tracing.Fail(lookupSpan, "session not found")
+			lookupSpan.End()
 			http.Error(w, "Session not found. Please establish connection first.", http.StatusNotFound)
 			return
 		}
@@ -513,28 +611,53 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 	sm.handlerMutex.RLock()
 	sessionInfo, exists = sm.sessions[sessionID]
 	sm.handlerMutex.RUnlock()
+	if exists {
+		lookupSpan.SetAttributes(attribute.String("mcp.server_id", sessionInfo.ServerID))
+	} else {
+		tracing.Fail(lookupSpan, "session disappeared")
+	}
+	lookupSpan.End()
 
 	if !exists {
-		logger.Error("Session disappeared during processing: %s", sessionID)
+		logger.ErrorContext(r.Context(), "Session disappeared during processing: %s", sessionID)
 		http.Error(w, "Session not available", http.StatusNotFound)
 		return
 	}
 
-	logger.Info("Found session for sessionId %s, forwarding to server: %s", sessionID, sessionInfo.ServerID)
+	r = r.WithContext(logger.WithServerID(r.Context(), sessionInfo.ServerID))
+	logger.InfoContext(r.Context(), "Found session for sessionId %s, forwarding to server: %s", sessionID, sessionInfo.ServerID)
 
-	// 更新最后使用时间
+	user, _ := auth.UserFromContext(r.Context())
+	if sessionInfo.Owner != "" && user.Identity() != sessionInfo.Owner {
+		logger.InfoContext(r.Context(), "Denied message to session %s: session belongs to another user", sessionID)
+		http.Error(w, "Forbidden: session belongs to another user", http.StatusForbidden)
+		return
+	}
+	if !user.CanConnect(sessionInfo.ServerID) {
+		logger.InfoContext(r.Context(), "Denied message to server %s for user %s (key: %s)", sessionInfo.ServerID, user.Username, user.KeyName)
+		http.Error(w, fmt.Sprintf("Forbidden: no permission for server '%s'", sessionInfo.ServerID), http.StatusForbidden)
+		return
+	}
+	if !sm.allowRequest(w, r, sessionInfo.ServerID) {
+		return
+	}
+
+	// 更新最后使用时间，并取得会话当前的 SSE 配置（热重载在同一把锁下替换它）
+	sm.handlerMutex.Lock()
 	sessionInfo.LastUsed = time.Now()
+	config := sessionInfo.Config
+	sm.handlerMutex.Unlock()
 
 	// 如果是 STDIO 服务（Config 为 nil），直接路由到对应的缓存处理器
-	if sessionInfo.Config == nil {
-		logger.Info("Routing STDIO session %s to server: %s", sessionID, sessionInfo.ServerID)
+	if config == nil {
+		logger.InfoContext(r.Context(), "Routing STDIO session %s to server: %s", sessionID, sessionInfo.ServerID)
 
 		sm.handlerMutex.RLock()
 		handler, exists1 := sm.mcpHandlers[sessionInfo.ServerID]
 		sm.handlerMutex.RUnlock()
 
 		if !exists1 {
-			logger.Error("Handler not found for STDIO server: %s", sessionInfo.ServerID)
+			logger.ErrorContext(r.Context(), "Handler not found for STDIO server: %s", sessionInfo.ServerID)
 			http.Error(w, "Server handler not available", http.StatusInternalServerError)
 			return
 		}
@@ -545,69 +668,100 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 	}
 
 	// 对于 SSE 服务，构建远程 URL - 使用正确的端点格式
-	remoteURL := sessionInfo.Config.BaseURL + "/messages/?session_id=" + sessionID
+	remoteURL := config.BaseURL + "/messages/?session_id=" + sessionID
 
-	logger.Info("Forwarding message to: %s", remoteURL)
+	logger.InfoContext(r.Context(), "Forwarding message to: %s", remoteURL)
 
-	// 创建到远程服务的请求
-	ctx := context.Background()
-	req, err := http.NewRequestWithContext(ctx, r.Method, remoteURL, r.Body)
+	// 远程 SSE 服务的工具调用在网关侧按调用方权限检查、限流、计量、审计并统计指标
+	var body io.Reader = r.Body
+	limitToolCalls := sm.limiter != nil && sm.limiter.HasScope(ratelimit.ScopeToolCall)
+	if r.Method == http.MethodPost {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if sm.draining.Load() && len(parseToolCalls(data)) > 0 {
+			logger.InfoContext(r.Context(), "Rejecting tool call to server %s while shutting down", sessionInfo.ServerID)
+			http.Error(w, "Service Unavailable: server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if !sm.allowAuditedToolCalls(w, r, sessionInfo.ServerID, data) {
+			return
+		}
+		if toolName, denied := deniedToolCall(user, sessionInfo.ServerID, data); denied {
+			logger.InfoContext(r.Context(), "Denied call to tool %s on server %s for user %s (key: %s)", toolName, sessionInfo.ServerID, user.Username, user.KeyName)
+			http.Error(w, fmt.Sprintf("Forbidden: permission denied for tool '%s'", toolName), http.StatusForbidden)
+			sm.recordDeniedToolCalls(user, sessionInfo.ServerID, data, outcomePermissionDenied)
+			return
+		}
+		if limitToolCalls && !sm.allowProxiedToolCalls(w, user, sessionInfo.ServerID, data) {
+			sm.recordDeniedToolCalls(user, sessionInfo.ServerID, data, outcomeRateLimited)
+			return
+		}
+		if sm.meter != nil && !sm.checkProxiedQuota(w, user, sessionInfo.ServerID, data) {
+			sm.recordDeniedToolCalls(user, sessionInfo.ServerID, data, outcomeQuotaExceeded)
+			return
+		}
+		sessionInfo.toolCalls.add(user, sessionInfo.ServerID, data)
+		body = bytes.NewReader(data)
+	}
+
+	// 创建到远程服务的请求，不随入站请求取消，但属于同一 trace；网关关闭时取消
+	ctx, cancel := context.WithCancel(tracing.Detach(r.Context()))
+	defer cancel()
+	defer context.AfterFunc(sm.streams, cancel)()
+	req, err := http.NewRequestWithContext(ctx, r.Method, remoteURL, body)
 	if err != nil {
-		logger.Error("Failed to create remote request: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to create remote request: %v", err)
 		http.Error(w, "Failed to create remote request", http.StatusInternalServerError)
 		return
 	}
 
-	// 复制请求头
-	for name, values := range r.Header {
-		if name == "Host" || name == "Connection" {
-			continue
-		}
-		for _, value := range values {
-			req.Header.Add(name, value)
-		}
-	}
+	// 复制请求头，不包括网关自身的凭证
+	sm.copyRequestHeaders(req, r)
 
-	// 添加认证头部（如果需要）
-	config := sessionInfo.Config
-	if config.AuthType != "none" && config.AuthConfig != nil {
-		switch config.AuthType {
-		case "bearer_token":
-			if token, ok := config.AuthConfig["token"].(string); ok {
-				req.Header.Set("Authorization", "Bearer "+token)
-			}
-		case "api_key":
-			if key, ok := config.AuthConfig["key"].(string); ok {
-				headerName := "X-API-Key"
-				if h, ok1 := config.AuthConfig["header"].(string); ok1 {
-					headerName = h
-				}
-				req.Header.Set(headerName, key)
-			}
-		case "custom_header":
-			for key, value := range config.AuthConfig {
-				if valueStr, ok := value.(string); ok {
-					req.Header.Set(key, valueStr)
-				}
-			}
-		}
+	// 添加默认头部和认证头部
+	upstream, err := upstreamAuths.get(config)
+	if err == nil {
+		err = upstream.apply(req)
 	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to authenticate to remote SSE service %s: %v", sessionInfo.ServerID, err)
+		http.Error(w, "Failed to authenticate to remote service", http.StatusBadGateway)
+		return
+	}
+	passthrough, err := parseCredentialPassthrough(sessionInfo.ServerID, config.CredentialPassthrough)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "%v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	passthrough.applyHeaders(req, r, user, sessionInfo.credential)
 
 	// 创建 HTTP 客户端
 	client := &http.Client{
-		Timeout: time.Duration(config.TimeoutMs) * time.Millisecond,
+		Timeout:   time.Duration(config.TimeoutMs) * time.Millisecond,
+		Transport: tracing.Transport(http.DefaultTransport),
 	}
 
 	// 发送请求
+	done, ok := allowUpstreamRequest(w, r, sm.breaker, sessionInfo.ServerID)
+	if !ok {
+		return
+	}
 	resp, err := client.Do(req)
+	done(upstreamResponseError(resp, err))
 	if err != nil {
-		logger.Error("Failed to send message to remote service: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to send message to remote service: %v", err)
 		http.Error(w, "Failed to send message", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	logger.Info("Remote service responded with status: %d", resp.StatusCode)
+	upstream.checkResponse(resp)
+
+	logger.InfoContext(r.Context(), "Remote service responded with status: %d", resp.StatusCode)
 	// 复制响应头
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -621,7 +775,7 @@ func (sm *SessionManager) handleSessionMessage(w http.ResponseWriter, r *http.Re
 	// 复制响应体
 	_, err = io.Copy(w, resp.Body)
 	if err != nil {
-		logger.Error("Error copying response body: %v", err)
+		logger.ErrorContext(r.Context(), "Error copying response body: %v", err)
 	}
 
 	// 更新最后使用时间
@@ -643,10 +797,18 @@ func (sm *SessionManager) CleanupHandler(serverID string) {
 
 // handleRemoteSSEProxy 直接透传远程 SSE 服务
 func (sm *SessionManager) handleRemoteSSEProxy(w http.ResponseWriter, r *http.Request, serverID string) {
+	r = r.WithContext(logger.WithServerID(r.Context(), serverID))
+	if sm.health != nil {
+		if err := sm.health.Check(serverID); err != nil {
+			logger.InfoContext(r.Context(), "Rejecting connection to server %s: %v", serverID, err)
+			http.Error(w, fmt.Sprintf("Service Unavailable: server '%s' is failing health checks", serverID), http.StatusServiceUnavailable)
+			return
+		}
+	}
 	// 获取远程 SSE 服务配置
 	config, err := sm.manager.GetDB().GetSSEServiceConfig(serverID)
 	if err != nil {
-		logger.Error("Failed to get SSE config for %s: %v", serverID, err)
+		logger.ErrorContext(r.Context(), "Failed to get SSE config for %s: %v", serverID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -654,26 +816,29 @@ func (sm *SessionManager) handleRemoteSSEProxy(w http.ResponseWriter, r *http.Re
 	// 构建远程 URL
 	remoteURL := config.BaseURL + config.SSEPath
 
-	// 移除 server_id 参数，保留其他查询参数
+	// 移除 server_id 参数和以查询参数传递的网关 API 密钥，保留其他查询参数
 	query := r.URL.Query()
 	query.Del("server_id")
+	query.Del("api_key")
 	if len(query) > 0 {
 		remoteURL += "?" + query.Encode()
 	}
 
-	logger.Debug("Proxying SSE request to: %s", remoteURL)
-	logger.Debug("Original request method: %s, URL: %s", r.Method, r.URL.String())
-	logger.Debug("Request headers: %v", r.Header)
+	logger.DebugContext(r.Context(), "Proxying SSE request to: %s", remoteURL)
+	logger.DebugContext(r.Context(), "Original request method: %s, URL: %s", r.Method, r.URL.String())
+	logger.DebugContext(r.Context(), "Request headers: %v", r.Header)
 
-	// 创建到远程服务的请求
-	ctx := context.Background()
+	// 创建到远程服务的请求，不随入站请求取消，但属于同一 trace；网关关闭时取消以结束事件流
+	ctx, cancel := context.WithCancel(tracing.Detach(r.Context()))
+	defer cancel()
+	defer context.AfterFunc(sm.streams, cancel)()
 
 	// 对于 SSE 连接，通常初始请求应该是 GET
 	method := r.Method
 	acceptHeader := r.Header.Get("Accept")
 	if strings.Contains(acceptHeader, "text/event-stream") || r.Method == "GET" {
 		method = "GET"
-		logger.Debug("Using GET method for SSE connection (Accept: %s)", acceptHeader)
+		logger.DebugContext(r.Context(), "Using GET method for SSE connection (Accept: %s)", acceptHeader)
 	}
 
 	// 对于 GET 请求，不应该发送 body
@@ -684,76 +849,82 @@ func (sm *SessionManager) handleRemoteSSEProxy(w http.ResponseWriter, r *http.Re
 
 	req, err := http.NewRequestWithContext(ctx, method, remoteURL, body)
 	if err != nil {
-		logger.Error("Failed to create remote request: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to create remote request: %v", err)
 		http.Error(w, "Failed to create remote request", http.StatusInternalServerError)
 		return
 	}
 
-	// 复制请求头，但排除一些不需要的头
-	for name, values := range r.Header {
-		if name == "Host" || name == "Connection" {
-			continue
-		}
-		for _, value := range values {
-			req.Header.Add(name, value)
-		}
-	}
+	// 复制请求头，不包括网关自身的凭证
+	sm.copyRequestHeaders(req, r)
 
-	// 添加认证头部
-	if config.AuthType != "none" && config.AuthConfig != nil {
-		switch config.AuthType {
-		case "bearer_token":
-			if token, ok := config.AuthConfig["token"].(string); ok {
-				req.Header.Set("Authorization", "Bearer "+token)
-			}
-		case "api_key":
-			if key, ok := config.AuthConfig["key"].(string); ok {
-				headerName := "X-API-Key"
-				if h, ok1 := config.AuthConfig["header"].(string); ok1 {
-					headerName = h
-				}
-				req.Header.Set(headerName, key)
-			}
-		case "custom_header":
-			for key, value := range config.AuthConfig {
-				if valueStr, ok := value.(string); ok {
-					req.Header.Set(key, valueStr)
-				}
-			}
-		}
+	// 添加默认头部和认证头部
+	upstream, err := upstreamAuths.get(config)
+	if err == nil {
+		err = upstream.apply(req)
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to authenticate to remote SSE service %s: %v", serverID, err)
+		http.Error(w, "Failed to authenticate to remote service", http.StatusBadGateway)
+		return
 	}
 
-	// 添加配置中的默认头部
-	if config.Headers != nil {
-		for key, value := range config.Headers {
-			if valueStr, ok := value.(string); ok {
-				req.Header.Set(key, valueStr)
-			}
-		}
+	// 按配置转发调用方自己的凭证，后续消息沿用连接时解析的凭证
+	user, _ := auth.UserFromContext(r.Context())
+	var userID, owner string
+	if user != nil {
+		userID, owner = user.UserID, user.Identity()
 	}
+	passthrough, err := parseCredentialPassthrough(serverID, config.CredentialPassthrough)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "%v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	credential, err := passthrough.resolveCredential(sm.manager.GetDB(), userID)
+	if errors.Is(err, errCredentialRequired) {
+		logger.InfoContext(r.Context(), "Denied connection to server %s for user %q: %v", serverID, userID, err)
+		http.Error(w, fmt.Sprintf("Forbidden: no credential configured for server '%s'", serverID), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to resolve credential of user %q for %s: %v", userID, serverID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	passthrough.applyHeaders(req, r, user, credential)
 
 	// 创建 HTTP 客户端
 	client := &http.Client{
-		Timeout: time.Duration(config.TimeoutMs) * time.Millisecond,
+		Timeout:   time.Duration(config.TimeoutMs) * time.Millisecond,
+		Transport: tracing.Transport(http.DefaultTransport),
 	}
 
-	logger.Debug("Sending request to remote: Method=%s, URL=%s", req.Method, req.URL.String())
-	logger.Debug("Remote request headers: %v", req.Header)
+	logger.DebugContext(r.Context(), "Sending request to remote: Method=%s, URL=%s", req.Method, req.URL.String())
+	logger.DebugContext(r.Context(), "Remote request headers: %v", req.Header)
 
 	// 发送请求
+	done, ok := allowUpstreamRequest(w, r, sm.breaker, serverID)
+	if !ok {
+		return
+	}
 	resp, err := client.Do(req)
+	done(upstreamResponseError(resp, err))
 	if err != nil {
-		logger.Error("Failed to connect to remote SSE service %s: %v", serverID, err)
+		logger.ErrorContext(r.Context(), "Failed to connect to remote SSE service %s: %v", serverID, err)
+		metrics.UpstreamConnectFailed(serverID, "sse")
 		http.Error(w, "Failed to connect to remote service", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	logger.Debug("Successfully connected to remote SSE service %s, status: %d", serverID, resp.StatusCode)
+	upstream.checkResponse(resp)
+
+	logger.DebugContext(r.Context(), "Successfully connected to remote SSE service %s, status: %d", serverID, resp.StatusCode)
 
 	// 如果不是成功状态，返回错误
 	if resp.StatusCode != http.StatusOK {
-		logger.Error("Remote SSE service returned status: %d", resp.StatusCode)
+		logger.ErrorContext(r.Context(), "Remote SSE service returned status: %d", resp.StatusCode)
+		metrics.UpstreamConnectFailed(serverID, "sse")
 		w.WriteHeader(resp.StatusCode)
 		io.Copy(w, resp.Body)
 		return
@@ -772,30 +943,31 @@ func (sm *SessionManager) handleRemoteSSEProxy(w http.ResponseWriter, r *http.Re
 	// 检查客户端是否支持 SSE
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		logger.Error("Client does not support SSE")
+		logger.ErrorContext(r.Context(), "Client does not support SSE")
 		http.Error(w, "SSE not supported", http.StatusInternalServerError)
 		return
 	}
 
 	// 开始流式传输
+	var session *HTTPSessionInfo
 	reader := bufio.NewReader(resp.Body)
 	for {
 		line, err1 := reader.ReadBytes('\n')
 		if err1 != nil {
 			if err1 == io.EOF {
-				logger.Error("Remote SSE stream ended for: %s", serverID)
+				logger.ErrorContext(r.Context(), "Remote SSE stream ended for: %s", serverID)
 			} else {
-				logger.Error("Error reading from remote service %s: %v", serverID, err1)
+				logger.ErrorContext(r.Context(), "Error reading from remote service %s: %v", serverID, err1)
 			}
 			return
 		}
 
 		// 检查是否包含 sessionId 信息
 		lineStr := string(line)
-		logger.Info("SSE line: %s", strings.TrimSpace(lineStr))
+		logger.InfoContext(r.Context(), "SSE line: %s", strings.TrimSpace(lineStr))
 
 		if strings.HasPrefix(lineStr, "event: endpoint") {
-			logger.Info("Detected endpoint event for %s", serverID)
+			logger.InfoContext(r.Context(), "Detected endpoint event for %s", serverID)
 		}
 
 		// 检查多种可能的 sessionId 格式
@@ -836,28 +1008,52 @@ func (sm *SessionManager) handleRemoteSSEProxy(w http.ResponseWriter, r *http.Re
 			}
 
 			if sessionID != "" {
-				logger.Info("Extracted sessionId: %s for server: %s (endpoint: %s)", sessionID, serverID, endpointPath)
+				logger.InfoContext(r.Context(), "Extracted sessionId: %s for server: %s (endpoint: %s)", sessionID, serverID, endpointPath)
 
 				// 存储会话信息
 				now := time.Now()
-				sm.handlerMutex.Lock()
-				sm.sessions[sessionID] = &HTTPSessionInfo{
+				session = &HTTPSessionInfo{
 					ServerID:     serverID,
 					SessionID:    sessionID,
 					Config:       config,
+					BaseURL:      config.BaseURL,
 					LastUsed:     now,
 					CreatedAt:    now,
 					IsActive:     true,
 					ConnectionID: generateConnectionID(),
+					UserID:       userID,
+					Owner:        owner,
+					credential:   credential,
+					toolCalls:    newProxiedToolCalls(),
 				}
+				sm.handlerMutex.Lock()
+				sm.sessions[sessionID] = session
 				sm.handlerMutex.Unlock()
 			}
 		}
 
+		// 记录透传工具调用的结果
+		if session != nil {
+			if call, completed := session.toolCalls.complete(line); completed {
+				metrics.ObserveToolCall(call.usage.ServerID, call.usage.ToolName, call.outcome(), time.Duration(call.usage.DurationMs)*time.Millisecond)
+				if sm.meter != nil {
+					sm.meter.Record(call.usage)
+				}
+				if sm.audit != nil {
+					sm.audit.Record(toolCallAuditEntry(call.usage, call.outcome()), call.arguments)
+				}
+			}
+		}
+
+		// 受限的调用方只能在 tools/list 结果中看到有权使用的工具
+		if user.Restricted() {
+			line = filterToolsListEvent(user, serverID, line)
+		}
+
 		// 写入客户端
 		_, writeErr := w.Write(line)
 		if writeErr != nil {
-			logger.Error("Error writing to client for %s: %v", serverID, writeErr)
+			logger.ErrorContext(r.Context(), "Error writing to client for %s: %v", serverID, writeErr)
 			return
 		}
 
@@ -872,6 +1068,6 @@ func (sm *SessionManager) CleanupAll() {
 	defer sm.handlerMutex.Unlock()
 
 	count := len(sm.mcpHandlers)
-	sm.mcpHandlers = make(map[string]http.Handler)
+	sm.mcpHandlers = make(map[string]*connectionHandler)
 	logger.Info("Cleaned up all %d MCP handlers", count)
 }
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"McpServer/internal/logger"
+	"fmt"
+	"sort"
+)
+
+// ReloadService 重新加载指定服务，并清理会话管理器中已失效的处理器和会话：
+// 服务被移除或远程上游被重启时，丢弃缓存的处理器并关闭已连接的下游会话，客户端重连后使用新配置；
+// 透传的远程 SSE 会话使用最新的 SSE 配置转发后续消息
+func (sm *SessionManager) ReloadService(serverID string) ReloadResult {
+	result := sm.manager.ReloadService(serverID)
+	if result.Error != "" && result.Action == ReloadUnchanged {
+		return result
+	}
+
+	if result.Action == ReloadRemoved || result.Action == ReloadRestarted {
+		sm.dropServer(serverID)
+	}
+
+	// 刷新透传 SSE 会话的配置
+	if result.Active && result.Adapter == "remote_sse" {
+		config, err := sm.db.GetSSEServiceConfig(serverID)
+		if err != nil {
+			logger.Error("Failed to refresh SSE config for %s: %v", serverID, err)
+			result.Error = err.Error()
+			return result
+		}
+
+		sm.handlerMutex.Lock()
+		for _, sessionInfo := range sm.sessions {
+			if sessionInfo.ServerID == serverID && sessionInfo.Config != nil && !sameSSEConfig(sessionInfo.Config, config) {
+				sessionInfo.Config = config
+				logger.Info("Updated SSE config for session %s (server %s)", sessionInfo.SessionID, serverID)
+			}
+		}
+		sm.handlerMutex.Unlock()
+	}
+
+	return result
+}
+
+// ReloadAll 重新加载数据库中的所有服务以及当前已缓存的服务
+func (sm *SessionManager) ReloadAll() ([]ReloadResult, error) {
+	serverIDs, err := sm.manager.ReloadCandidates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services for reload: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, serverID := range serverIDs {
+		seen[serverID] = true
+	}
+	sm.handlerMutex.RLock()
+	for serverID := range sm.mcpHandlers {
+		seen[serverID] = true
+	}
+	for _, sessionInfo := range sm.sessions {
+		seen[sessionInfo.ServerID] = true
+	}
+	sm.handlerMutex.RUnlock()
+
+	serverIDs = serverIDs[:0]
+	for serverID := range seen {
+		serverIDs = append(serverIDs, serverID)
+	}
+	sort.Strings(serverIDs)
+
+	results := make([]ReloadResult, 0, len(serverIDs))
+	for _, serverID := range serverIDs {
+		results = append(results, sm.ReloadService(serverID))
+	}
+	return results, nil
+}
+
+// dropServer 丢弃服务的缓存处理器和会话记录，并关闭已连接到旧服务器实例的下游会话
+func (sm *SessionManager) dropServer(serverID string) {
+	sm.handlerMutex.Lock()
+	handler := sm.mcpHandlers[serverID]
+	delete(sm.mcpHandlers, serverID)
+
+	dropped := 0
+	for sessionID, sessionInfo := range sm.sessions {
+		if sessionInfo.ServerID == serverID {
+			delete(sm.sessions, sessionID)
+			dropped++
+		}
+	}
+	sm.handlerMutex.Unlock()
+
+	closed := 0
+	if handler != nil {
+		closed = handler.closeAll()
+	}
+
+	logger.Info("Dropped handler for server %s (%d session records, %d connected sessions closed)", serverID, dropped, closed)
+}
@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"McpServer/internal/logger"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// drainPollInterval 关闭时检查进行中工具调用的间隔
+const drainPollInterval = 100 * time.Millisecond
+
+// errShuttingDown 网关正在关闭，不再接受新的工具调用
+var errShuttingDown = errors.New("server is shutting down")
+
+// toolCallTracker 统计正在处理的工具调用，关闭时等待其完成
+type toolCallTracker struct {
+	active   atomic.Int64
+	draining atomic.Bool
+}
+
+// inFlightCalls 全部 MCP 服务器（内置、远程 stdio 代理、远程 SSE 代理）正在处理的工具调用
+var inFlightCalls = &toolCallTracker{}
+
+// inFlightMiddleware 统计正在处理的工具调用；关闭开始后拒绝新的调用。位于最外层
+func inFlightMiddleware() mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if method != "tools/call" {
+				return next(ctx, session, method, params)
+			}
+			if inFlightCalls.draining.Load() {
+				return nil, errShuttingDown
+			}
+			inFlightCalls.active.Add(1)
+			defer inFlightCalls.active.Add(-1)
+			return next(ctx, session, method, params)
+		}
+	}
+}
+
+// InFlightToolCalls 正在处理的工具调用数
+func (m *MCPServerManager) InFlightToolCalls() int64 {
+	return inFlightCalls.active.Load()
+}
+
+// Close 关闭全部远程 stdio 进程和远程 SSE 会话，等待 stdio 进程按 shutdown_timeout_ms 退出
+func (m *MCPServerManager) Close() {
+	m.sseManager.CloseAll()
+	m.remoteManager.CloseAll()
+}
+
+// StopAccepting 开始关闭：拒绝新的 SSE 连接和新的工具调用，已建立的连接不受影响
+func (sm *SessionManager) StopAccepting() {
+	sm.draining.Store(true)
+	inFlightCalls.draining.Store(true)
+	logger.Info("Stopped accepting new connections and tool calls")
+}
+
+// rejectIfDraining 关闭开始后以 503 拒绝新的连接
+func (sm *SessionManager) rejectIfDraining(w http.ResponseWriter, r *http.Request) bool {
+	if !sm.draining.Load() {
+		return false
+	}
+	logger.InfoContext(r.Context(), "Rejecting connection while shutting down")
+	w.Header().Set("Connection", "close")
+	http.Error(w, "Service Unavailable: server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+// Drain 等待进行中的工具调用完成，包括透传给远程 SSE 服务、尚未收到结果的调用。
+// ctx 结束时返回仍未完成的调用数
+func (sm *SessionManager) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		active, proxied := sm.manager.InFlightToolCalls(), sm.pendingProxiedCalls()
+		if active == 0 && proxied == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d tool calls and %d proxied tool calls still in flight: %w", active, proxied, ctx.Err())
+		}
+	}
+}
+
+// CloseConnections 关闭全部下游 SSE 连接和透传的远程 SSE 流，返回关闭的下游会话数
+func (sm *SessionManager) CloseConnections() int {
+	sm.closeStreams()
+
+	sm.handlerMutex.RLock()
+	handlers := make([]*connectionHandler, 0, len(sm.mcpHandlers))
+	for _, handler := range sm.mcpHandlers {
+		handlers = append(handlers, handler)
+	}
+	sm.handlerMutex.RUnlock()
+
+	closed := 0
+	for _, handler := range handlers {
+		closed += handler.closeAll()
+	}
+	logger.Info("Closed %d downstream SSE sessions", closed)
+	return closed
+}
+
+// pendingProxiedCalls 透传给远程 SSE 服务、尚未收到结果的工具调用数
+func (sm *SessionManager) pendingProxiedCalls() int {
+	sm.handlerMutex.RLock()
+	defer sm.handlerMutex.RUnlock()
+
+	pending := 0
+	for _, session := range sm.sessions {
+		if session.toolCalls != nil {
+			pending += session.toolCalls.pending()
+		}
+	}
+	return pending
+}
@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/tracing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// sseConnection 一个下游 SSE 连接
+type sseConnection struct {
+	transport *mcp.SSEServerTransport
+	session   *mcp.ServerSession
+}
+
+// connectionHandler 为同一服务的下游 SSE 连接提供服务。与 mcp.SSEHandler 不同，
+// 每个连接使用建立时为调用方解析的 MCP 服务器（per_user/per_session 的 stdio 进程各不相同），
+// 会话 ID 由会话管理器生成；后续 POST 消息按 sessionid 路由到对应连接
+type connectionHandler struct {
+	serverID    string
+	mutex       sync.Mutex
+	connections map[string]*sseConnection // sessionID -> 连接
+}
+
+// newConnectionHandler 创建连接处理器
+func newConnectionHandler(serverID string) *connectionHandler {
+	return &connectionHandler{
+		serverID:    serverID,
+		connections: make(map[string]*sseConnection),
+	}
+}
+
+// ServeHTTP 处理发往已建立连接的 POST 消息
+func (h *connectionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := req.URL.Query().Get("sessionid")
+	if sessionID == "" {
+		http.Error(w, "sessionid must be provided", http.StatusBadRequest)
+		return
+	}
+
+	h.mutex.Lock()
+	conn := h.connections[sessionID]
+	h.mutex.Unlock()
+	if conn == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	// 消息在连接的会话中处理，通过 _meta 将其关联到本次 HTTP 请求的 trace
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(tracing.InjectMessage(req.Context(), body)))
+
+	conn.transport.ServeHTTP(w, req)
+}
+
+// serveConnection 将 GET 请求作为 SSE 连接接入 server，阻塞直到客户端断开或会话被关闭
+func (h *connectionHandler) serveConnection(w http.ResponseWriter, req *http.Request, sessionID string, server *mcp.Server) {
+	endpoint, err := req.URL.Parse("?sessionid=" + sessionID)
+	if err != nil {
+		http.Error(w, "internal error: failed to create endpoint", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	conn := &sseConnection{transport: mcp.NewSSEServerTransport(endpoint.RequestURI(), w)}
+	h.mutex.Lock()
+	h.connections[sessionID] = conn
+	h.mutex.Unlock()
+	defer func() {
+		h.mutex.Lock()
+		delete(h.connections, sessionID)
+		h.mutex.Unlock()
+	}()
+
+	session, err := server.Connect(tracing.WithoutSpan(req.Context()), conn.transport)
+	if err != nil {
+		logger.Error("Failed to connect session %s to server %s: %v", sessionID, h.serverID, err)
+		http.Error(w, "connection failed", http.StatusInternalServerError)
+		return
+	}
+	h.mutex.Lock()
+	conn.session = session
+	h.mutex.Unlock()
+	defer session.Close()
+
+	done := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-req.Context().Done():
+	case <-done:
+	}
+	logger.Info("SSE connection %s to server %s closed", sessionID, h.serverID)
+}
+
+// activeCount 当前连接数
+func (h *connectionHandler) activeCount() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.connections)
+}
+
+// closeAll 关闭全部已连接的会话，返回关闭的数量
+func (h *connectionHandler) closeAll() int {
+	h.mutex.Lock()
+	sessions := make([]*mcp.ServerSession, 0, len(h.connections))
+	for _, conn := range h.connections {
+		if conn.session != nil {
+			sessions = append(sessions, conn.session)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, session := range sessions {
+		if err := session.Close(); err != nil {
+			logger.Warn("Failed to close session on server %s: %v", h.serverID, err)
+		}
+	}
+	return len(sessions)
+}
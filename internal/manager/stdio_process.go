@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"McpServer/internal/logger"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultShutdownTimeout 未配置 shutdown_timeout_ms 时每一步等待进程退出的时间
+const defaultShutdownTimeout = 5 * time.Second
+
+// groupPollInterval 等待进程组中残留进程退出时的检查间隔
+const groupPollInterval = 100 * time.Millisecond
+
+// processTransport 启动远程 stdio 进程的传输。进程在独立的进程组中启动，stdin/stdout 管道由网关持有，
+// 关闭连接时按 shutdown_timeout_ms 依次关闭 stdin、发送 SIGTERM、SIGKILL 整个进程组，避免遗留子进程
+type processTransport struct {
+	cmd      *exec.Cmd
+	stderr   io.Writer
+	serverID string
+	timeout  time.Duration
+}
+
+// newProcessTransport 创建进程传输，进程的标准错误写入 stderr，timeout 为每一步等待进程退出的时间
+func newProcessTransport(cmd *exec.Cmd, stderr io.Writer, serverID string, timeout time.Duration) *processTransport {
+	setProcessGroup(cmd)
+	return &processTransport{cmd: cmd, stderr: stderr, serverID: serverID, timeout: timeout}
+}
+
+// Connect 启动进程并通过 stdin/stdout 连接。标准错误使用单独的管道转发，
+// 不由 exec.Cmd 复制，避免仍持有它的子进程让主进程退出后的 Wait 一直阻塞
+func (t *processTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	t.cmd.Stderr = stderrWriter
+
+	err = t.cmd.Start()
+	// 写端已由子进程继承
+	stderrWriter.Close()
+	if err != nil {
+		stderrReader.Close()
+		return nil, err
+	}
+	go func() {
+		defer stderrReader.Close()
+		io.Copy(t.stderr, stderrReader)
+	}()
+
+	conn := &processConn{
+		cmd:      t.cmd,
+		serverID: t.serverID,
+		timeout:  t.timeout,
+		exited:   make(chan struct{}),
+	}
+	go func() {
+		conn.waitErr = t.cmd.Wait()
+		close(conn.exited)
+	}()
+
+	transport, err := newStreamTransport(&processPipes{stdout: stdout, stdin: stdin})
+	if err == nil {
+		conn.Connection, err = transport.Connect(ctx)
+	}
+	if err != nil {
+		killGroup(t.cmd)
+		<-conn.exited
+		return nil, err
+	}
+	return conn, nil
+}
+
+// processPipes 进程的 stdin/stdout。关闭时只关闭 stdin，通知进程退出；stdout 在进程退出后由 Wait 关闭
+type processPipes struct {
+	stdout io.ReadCloser
+	stdin  io.WriteCloser
+}
+
+func (p *processPipes) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+func (p *processPipes) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *processPipes) Close() error {
+	return p.stdin.Close()
+}
+
+// newStreamTransport 以 go-sdk 的换行分隔 JSON 编解码在 stream 上通信。
+// go-sdk v0.2.0 没有导出基于任意流的传输（只有绑定 os.Stdin/os.Stdout 的 StdioTransport 和
+// 自行终止进程的 CommandTransport），因此为 StdioTransport 内部的流赋值；其结构变化时返回错误
+func newStreamTransport(stream io.ReadWriteCloser) (mcp.Transport, error) {
+	transport := &mcp.StdioTransport{}
+	value := reflect.ValueOf(transport).Elem()
+	if value.NumField() != 1 || value.Field(0).Kind() != reflect.Struct || value.Field(0).NumField() != 1 {
+		return nil, errors.New("unsupported go-sdk StdioTransport layout")
+	}
+	field := value.Field(0).Field(0)
+	if field.Type() != reflect.TypeOf((*io.ReadWriteCloser)(nil)).Elem() {
+		return nil, errors.New("unsupported go-sdk StdioTransport layout")
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(stream))
+	return transport, nil
+}
+
+// processConn 远程 stdio 进程的连接，Close 时终止进程组
+type processConn struct {
+	mcp.Connection
+	cmd      *exec.Cmd
+	serverID string
+	timeout  time.Duration
+
+	exited  chan struct{} // 主进程退出（Wait 返回）后关闭
+	waitErr error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Close 终止进程：关闭 stdin 后等待 timeout，未退出时向进程组发送 SIGTERM，再等待 timeout 后 SIGKILL；
+// 主进程退出后，进程组中残留的子进程同样先 SIGTERM 再 SIGKILL
+func (c *processConn) Close() error {
+	c.closeOnce.Do(func() {
+		pid := c.cmd.Process.Pid
+		// 关闭 stdin，通知进程退出
+		if err := c.Connection.Close(); err != nil {
+			logger.Warn("Failed to close stdin of stdio process %d (server %s): %v", pid, c.serverID, err)
+		}
+
+		select {
+		case <-c.exited:
+		case <-time.After(c.timeout):
+			logger.Warn("Stdio process %d of server %s did not exit %s after stdin was closed, sending SIGTERM", pid, c.serverID, c.timeout)
+			terminateGroup(c.cmd)
+			select {
+			case <-c.exited:
+			case <-time.After(c.timeout):
+				logger.Warn("Stdio process %d of server %s did not exit %s after SIGTERM, killing its process group", pid, c.serverID, c.timeout)
+				killGroup(c.cmd)
+				<-c.exited
+			}
+		}
+		c.closeErr = c.waitErr
+		c.reapGroup(pid)
+	})
+	return c.closeErr
+}
+
+// reapGroup 终止主进程退出后进程组中残留的子进程
+func (c *processConn) reapGroup(pid int) {
+	if !groupAlive(c.cmd) {
+		return
+	}
+	logger.Info("Terminating leftover child processes of stdio process %d (server %s)", pid, c.serverID)
+	terminateGroup(c.cmd)
+	deadline := time.Now().Add(c.timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(groupPollInterval)
+		if !groupAlive(c.cmd) {
+			return
+		}
+	}
+	logger.Warn("Child processes of stdio process %d (server %s) did not exit %s after SIGTERM, killing them", pid, c.serverID, c.timeout)
+	killGroup(c.cmd)
+}
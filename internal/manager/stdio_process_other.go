@@ -0,0 +1,25 @@
+//go:build !unix
+
+package manager
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup 不支持进程组的平台上不做处理
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateGroup 不支持信号的平台上直接结束主进程
+func terminateGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// killGroup 结束主进程
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// groupAlive 无法检查子进程，视为已全部退出
+func groupAlive(cmd *exec.Cmd) bool {
+	return false
+}
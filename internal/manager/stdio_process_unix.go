@@ -0,0 +1,28 @@
+//go:build unix
+
+package manager
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让进程成为新进程组的组长，其子进程随之归入该组
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateGroup 向进程组发送 SIGTERM
+func terminateGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killGroup 向进程组发送 SIGKILL
+func killGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// groupAlive 进程组中是否还有进程
+func groupAlive(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) == nil
+}
@@ -0,0 +1,387 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/metrics"
+	"McpServer/internal/models"
+	"McpServer/internal/schema"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 远程 stdio 进程的状态
+const (
+	StdioProcessRunning      = "running"       // 正常运行
+	StdioProcessRestarting   = "restarting"    // 进程崩溃，正在等待或执行重启
+	StdioProcessCrashLooping = "crash_looping" // restart_window 内重启次数达到 max_restarts，已放弃重启
+	StdioProcessStopped      = "stopped"       // 会话已关闭，不再重启
+)
+
+// keepAliveTimeout 保活 ping 的超时，超时视为进程无响应
+const keepAliveTimeout = 10 * time.Second
+
+// stdioProxy 一个下游连接的代理服务器及其已注册的工具
+type stdioProxy struct {
+	server     *mcp.Server
+	validators *validatorSet
+
+	mutex sync.Mutex        // 串行化工具列表的更新
+	tools map[string]string // 工具名 -> 工具定义指纹
+}
+
+// StdioProcessStatus 远程 stdio 进程的运行和重启状态
+type StdioProcessStatus struct {
+	SessionKey     string     `json:"session_key"`
+	ServerID       string     `json:"server_id"`
+	Strategy       string     `json:"strategy"`
+	State          string     `json:"state"`
+	ActiveConns    int32      `json:"active_conns"`
+	RecentRestarts int        `json:"recent_restarts"` // restart_window 内的重启次数
+	MaxRestarts    int        `json:"max_restarts"`
+	TotalRestarts  int        `json:"total_restarts"`
+	LastCrashAt    *time.Time `json:"last_crash_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// SetRestartPolicy 设置崩溃的远程 stdio 进程的重启策略：window 内最多重启 max_restarts 次，
+// 第 n 次重启前等待 delay*2^(n-1)，不超过 maxDelay
+func (m *MCPServerManager) SetRestartPolicy(window, delay, maxDelay time.Duration) {
+	m.remoteManager.restartWindow = window
+	m.remoteManager.restartBackoff = retryPolicy{delay: delay, maxDelay: maxDelay}
+}
+
+// StdioProcesses 全部远程 stdio 进程的状态
+func (m *MCPServerManager) StdioProcesses() []StdioProcessStatus {
+	return m.remoteManager.Processes()
+}
+
+// Processes 全部远程 stdio 进程的状态，按会话键排序
+func (rsm *RemoteStdioManager) Processes() []StdioProcessStatus {
+	rsm.mutex.RLock()
+	defer rsm.mutex.RUnlock()
+
+	result := make([]StdioProcessStatus, 0, len(rsm.sessions))
+	for sessionKey, sessionInfo := range rsm.sessions {
+		sessionInfo.processMutex.RLock()
+		status := StdioProcessStatus{
+			SessionKey:     sessionKey,
+			ServerID:       sessionInfo.config.ServerID,
+			Strategy:       sessionInfo.config.ReuseStrategy,
+			State:          sessionInfo.state,
+			ActiveConns:    atomic.LoadInt32(&sessionInfo.activeConns),
+			RecentRestarts: len(recentRestarts(sessionInfo.restarts, rsm.restartWindow)),
+			MaxRestarts:    sessionInfo.config.MaxRestarts,
+			TotalRestarts:  sessionInfo.totalRestart,
+			LastError:      sessionInfo.lastError,
+		}
+		if !sessionInfo.lastCrashAt.IsZero() {
+			lastCrashAt := sessionInfo.lastCrashAt
+			status.LastCrashAt = &lastCrashAt
+		}
+		sessionInfo.processMutex.RUnlock()
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SessionKey < result[j].SessionKey })
+	return result
+}
+
+// newSessionInfo 创建运行中进程的会话信息
+func newSessionInfo(key string, config *models.MCPServiceStdio, extraEnv map[string]string, session *mcp.ClientSession, client *mcp.Client) *SessionInfo {
+	return &SessionInfo{
+		key:          key,
+		session:      session,
+		client:       client,
+		lastUsed:     time.Now(),
+		config:       config,
+		extraEnv:     extraEnv,
+		userSessions: make(map[string]int32),
+		sessionKeys:  make(map[string]bool),
+		proxies:      make(map[*mcp.Server]*stdioProxy),
+		state:        StdioProcessRunning,
+		stopped:      make(chan struct{}),
+	}
+}
+
+// current 当前进程的会话
+func (s *SessionInfo) current() *mcp.ClientSession {
+	s.processMutex.RLock()
+	defer s.processMutex.RUnlock()
+	return s.session
+}
+
+// acquireSession 返回可用的会话：进程正在重启时等待重启完成，已放弃重启或被关闭时返回错误
+func (s *SessionInfo) acquireSession(ctx context.Context) (*mcp.ClientSession, error) {
+	for {
+		s.processMutex.RLock()
+		state, session, ready, lastError := s.state, s.session, s.ready, s.lastError
+		s.processMutex.RUnlock()
+
+		switch state {
+		case StdioProcessRunning:
+			return session, nil
+		case StdioProcessRestarting:
+			select {
+			case <-ready:
+			case <-s.stopped:
+				return nil, fmt.Errorf("remote stdio process %s was closed", s.key)
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for remote stdio process %s to restart: %w", s.key, ctx.Err())
+			}
+		default:
+			return nil, fmt.Errorf("remote stdio process %s is %s, last error: %s", s.key, state, lastError)
+		}
+	}
+}
+
+// crashLooping 是否已放弃重启，返回最后一次崩溃的时间
+func (s *SessionInfo) crashLooping() (bool, time.Time) {
+	s.processMutex.RLock()
+	defer s.processMutex.RUnlock()
+	return s.state == StdioProcessCrashLooping, s.lastCrashAt
+}
+
+// stop 主动关闭会话：停止保活、崩溃检测和重启，并关闭当前进程
+func (s *SessionInfo) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+		if s.keepAliveTicker != nil {
+			s.keepAliveTicker.Stop()
+		}
+	})
+	s.current().Close()
+}
+
+// isStopped 会话是否已被主动关闭
+func (s *SessionInfo) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeProxy 下游连接结束后不再更新其代理服务器
+func (s *SessionInfo) removeProxy(server *mcp.Server) {
+	s.processMutex.Lock()
+	delete(s.proxies, server)
+	s.processMutex.Unlock()
+}
+
+// watch 等待进程的会话结束；不是主动关闭或重启替换的，视为进程崩溃
+func (rsm *RemoteStdioManager) watch(sessionInfo *SessionInfo, session *mcp.ClientSession) {
+	err := session.Wait()
+	if sessionInfo.isStopped() || sessionInfo.current() != session {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("process exited")
+	}
+	rsm.handleCrash(sessionInfo, session, err)
+}
+
+// handleCrash 处理进程崩溃：max_restarts 为 0 时移除会话，下次连接时重新启动；
+// 否则在 restart_window 内按退避重启，超过次数后标记为 crash_looping
+func (rsm *RemoteStdioManager) handleCrash(sessionInfo *SessionInfo, crashed *mcp.ClientSession, reason error) {
+	serverID := sessionInfo.config.ServerID
+	logger.Warn("Remote stdio process %s exited unexpectedly: %v", sessionInfo.key, reason)
+	metrics.StdioProcessCrashed(serverID)
+	// 回收进程
+	crashed.Close()
+
+	sessionInfo.processMutex.Lock()
+	sessionInfo.lastCrashAt = time.Now()
+	sessionInfo.lastError = reason.Error()
+	sessionInfo.state = StdioProcessRestarting
+	sessionInfo.ready = make(chan struct{})
+	sessionInfo.processMutex.Unlock()
+
+	if sessionInfo.config.MaxRestarts == 0 {
+		rsm.giveUp(sessionInfo, false)
+		sessionInfo.stop()
+		rsm.mutex.Lock()
+		if rsm.sessions[sessionInfo.key] == sessionInfo {
+			delete(rsm.sessions, sessionInfo.key)
+		}
+		rsm.mutex.Unlock()
+		logger.Info("Removed crashed remote stdio process %s (max_restarts is 0)", sessionInfo.key)
+		return
+	}
+
+	for {
+		sessionInfo.processMutex.Lock()
+		sessionInfo.restarts = recentRestarts(sessionInfo.restarts, rsm.restartWindow)
+		attempt := len(sessionInfo.restarts) + 1
+		if attempt > sessionInfo.config.MaxRestarts {
+			sessionInfo.processMutex.Unlock()
+			logger.Error("Remote stdio process %s is crash-looping: %d restarts within %s, giving up (last error: %s)",
+				sessionInfo.key, attempt-1, rsm.restartWindow, sessionInfo.lastError)
+			rsm.giveUp(sessionInfo, true)
+			return
+		}
+		sessionInfo.restarts = append(sessionInfo.restarts, time.Now())
+		sessionInfo.totalRestart++
+		sessionInfo.processMutex.Unlock()
+
+		wait := rsm.restartBackoff.backoff(attempt)
+		logger.Info("Restarting remote stdio process %s in %s (restart %d/%d within %s)",
+			sessionInfo.key, wait, attempt, sessionInfo.config.MaxRestarts, rsm.restartWindow)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-sessionInfo.stopped:
+			timer.Stop()
+			rsm.giveUp(sessionInfo, false)
+			return
+		}
+
+		if err := rsm.restart(sessionInfo); err != nil {
+			logger.Warn("Failed to restart remote stdio process %s: %v", sessionInfo.key, err)
+			sessionInfo.processMutex.Lock()
+			sessionInfo.lastCrashAt = time.Now()
+			sessionInfo.lastError = err.Error()
+			sessionInfo.processMutex.Unlock()
+			continue
+		}
+		return
+	}
+}
+
+// restart 启动新进程，替换会话并按新的工具列表更新代理服务器
+func (rsm *RemoteStdioManager) restart(sessionInfo *SessionInfo) error {
+	serverID := sessionInfo.config.ServerID
+
+	var session *mcp.ClientSession
+	var client *mcp.Client
+	err := guardUpstream(rsm.breaker, serverID, func() error {
+		var err1 error
+		if session, client, err1 = rsm.connectToRemoteService(sessionInfo.config, sessionInfo.extraEnv); err1 != nil {
+			metrics.UpstreamConnectFailed(serverID, "stdio")
+		}
+		return err1
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(sessionInfo.config.StartupTimeoutMs)*time.Millisecond)
+	toolsResult, err := session.ListTools(ctx, &mcp.ListToolsParams{})
+	cancel()
+	if err != nil {
+		session.Close()
+		return fmt.Errorf("failed to list tools: %w", err)
+	}
+
+	sessionInfo.processMutex.Lock()
+	if sessionInfo.isStopped() {
+		sessionInfo.processMutex.Unlock()
+		session.Close()
+		return nil
+	}
+	sessionInfo.session = session
+	sessionInfo.client = client
+	sessionInfo.state = StdioProcessRunning
+	close(sessionInfo.ready)
+	proxies := make([]*stdioProxy, 0, len(sessionInfo.proxies))
+	for _, proxy := range sessionInfo.proxies {
+		proxies = append(proxies, proxy)
+	}
+	sessionInfo.processMutex.Unlock()
+
+	go rsm.watch(sessionInfo, session)
+	for _, proxy := range proxies {
+		rsm.syncProxyTools(sessionInfo, proxy, toolsResult.Tools)
+	}
+	metrics.StdioProcessRestarted(serverID)
+	logger.Info("Restarted remote stdio process %s with %d tools", sessionInfo.key, len(toolsResult.Tools))
+	return nil
+}
+
+// giveUp 放弃重启，等待重启的调用返回错误
+func (rsm *RemoteStdioManager) giveUp(sessionInfo *SessionInfo, crashLooping bool) {
+	sessionInfo.processMutex.Lock()
+	defer sessionInfo.processMutex.Unlock()
+
+	if crashLooping {
+		sessionInfo.state = StdioProcessCrashLooping
+	} else {
+		sessionInfo.state = StdioProcessStopped
+	}
+	if sessionInfo.ready != nil {
+		select {
+		case <-sessionInfo.ready:
+		default:
+			close(sessionInfo.ready)
+		}
+	}
+}
+
+// syncProxyTools 按工具列表更新代理服务器：新增或定义变化的工具重新注册，不再存在的工具移除。
+// SDK 在工具增删时向已连接的会话发送 tools/list_changed
+func (rsm *RemoteStdioManager) syncProxyTools(sessionInfo *SessionInfo, proxy *stdioProxy, tools []*mcp.Tool) {
+	serverID := sessionInfo.config.ServerID
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	var skipped []SkippedTool
+	validators := make(map[string]*schema.Validator)
+	registered := make(map[string]string)
+	for _, tool := range tools {
+		data, _ := json.Marshal(tool)
+		fingerprint := string(data)
+		if proxy.tools[tool.Name] != fingerprint {
+			logger.Info("Adding tool: %s - %s", tool.Name, tool.Description)
+			if err := rsm.addProxyTool(proxy.server, sessionInfo, *tool); err != nil {
+				logger.Warn("Skipping proxy tool %s on server %s: %v", tool.Name, serverID, err)
+				skipped = append(skipped, SkippedTool{Name: tool.Name, Reason: err.Error()})
+				continue
+			}
+		}
+		registered[tool.Name] = fingerprint
+
+		if rsm.validateArgs {
+			if validator, err := validatorFromSchema(tool.InputSchema); err != nil {
+				logger.Warn("Failed to build argument validator for proxy tool %s: %v", tool.Name, err)
+			} else if validator != nil {
+				validators[tool.Name] = validator
+			}
+		}
+	}
+
+	var stale []string
+	for name := range proxy.tools {
+		if _, exists := registered[name]; !exists {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		logger.Info("Removing tools %v from server: %s", stale, serverID)
+		proxy.server.RemoveTools(stale...)
+	}
+
+	proxy.tools = registered
+	proxy.validators.replace(validators)
+	rsm.report.Record(serverID, skipped)
+}
+
+// recentRestarts 返回 window 内的重启时间。结果为新分配的切片，不修改 restarts，
+// 只持有读锁的调用方（如 Processes）也可以使用
+func recentRestarts(restarts []time.Time, window time.Duration) []time.Time {
+	cutoff := time.Now().Add(-window)
+	kept := make([]time.Time, 0, len(restarts))
+	for _, t := range restarts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
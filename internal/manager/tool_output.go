@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/schema"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// finalizeToolResult 处理内置工具的返回结果：
+//   - 声明了 output_schema 的工具必须返回符合 schema 的结构化内容，否则返回 IsError 结果
+//   - 只有结构化内容而没有文本内容时，追加序列化后的 JSON 文本，兼容旧客户端
+//
+// 错误结果原样返回，不做校验。
+func finalizeToolResult(serverID, toolName string, result *mcp.CallToolResult, outputValidator *schema.Validator) *mcp.CallToolResultFor[any] {
+	if result == nil {
+		result = &mcp.CallToolResult{Content: []mcp.Content{}}
+	}
+
+	if !result.IsError && outputValidator != nil {
+		if result.StructuredContent == nil {
+			logger.Error("Tool %s on server %s declares an output schema but returned no structured content", toolName, serverID)
+			return outputErrorResult(toolName, []string{"no structured content was returned"})
+		}
+		if violations := outputValidator.Validate(result.StructuredContent); len(violations) > 0 {
+			messages := make([]string, len(violations))
+			for i, violation := range violations {
+				messages[i] = violation.String()
+			}
+			logger.Error("Tool %s on server %s returned structured content that violates its output schema: %v", toolName, serverID, messages)
+			return outputErrorResult(toolName, messages)
+		}
+	}
+
+	content := result.Content
+	if len(content) == 0 && result.StructuredContent != nil {
+		if data, err := json.Marshal(result.StructuredContent); err == nil {
+			content = []mcp.Content{&mcp.TextContent{Text: string(data)}}
+		}
+	}
+
+	return &mcp.CallToolResultFor[any]{
+		Meta:              result.Meta,
+		Content:           content,
+		StructuredContent: result.StructuredContent,
+		IsError:           result.IsError,
+	}
+}
+
+// outputErrorResult 构造输出不符合 output_schema 时的错误结果
+func outputErrorResult(toolName string, problems []string) *mcp.CallToolResultFor[any] {
+	lines := make([]string, 0, len(problems)+1)
+	lines = append(lines, fmt.Sprintf("Error: tool '%s' produced output that does not match its output schema:", toolName))
+	for _, problem := range problems {
+		lines = append(lines, "- "+problem)
+	}
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: strings.Join(lines, "\n")},
+		},
+		IsError: true,
+	}
+}
@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+
+	"McpServer/internal/tracing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingMiddleware 为每个 MCP 请求创建 span，位于最外层以覆盖权限检查、限流和配额。
+// 客户端在 params._meta 中携带 traceparent 时以其为父 span，否则沿用 HTTP 请求的 span
+func tracingMiddleware(serverID string) mcp.Middleware[*mcp.ServerSession] {
+	return func(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+		return func(ctx context.Context, session *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+			if params != nil {
+				ctx = tracing.ExtractMeta(ctx, params.GetMeta())
+			}
+
+			name := "mcp " + method
+			attrs := []attribute.KeyValue{
+				attribute.String("mcp.server_id", serverID),
+				attribute.String("mcp.method", method),
+			}
+			if callParams, ok := params.(*mcp.CallToolParamsFor[json.RawMessage]); ok {
+				name += " " + callParams.Name
+				attrs = append(attrs, attribute.String("mcp.tool", callParams.Name))
+			}
+			ctx, span := tracing.Start(ctx, name, trace.SpanKindServer, attrs...)
+
+			result, err := next(ctx, session, method, params)
+			if method == "tools/call" && err == nil {
+				outcome := toolCallOutcome(result, err)
+				span.SetAttributes(attribute.String("mcp.outcome", outcome))
+				if outcome != outcomeSuccess {
+					tracing.Fail(span, outcome)
+				}
+			}
+			tracing.End(span, err)
+			return result, err
+		}
+	}
+}
+
+// startUpstreamCall 为转发给上游的工具调用创建 client span，并将 trace 上下文写入请求的 _meta
+func startUpstreamCall(ctx context.Context, serverID, transport string, params *mcp.CallToolParams) (context.Context, trace.Span) {
+	ctx, span := tracing.Start(ctx, "upstream tools/call "+params.Name, trace.SpanKindClient,
+		attribute.String("mcp.server_id", serverID),
+		attribute.String("mcp.transport", transport),
+		attribute.String("mcp.tool", params.Name),
+	)
+	params.Meta = tracing.InjectMeta(ctx, params.Meta)
+	return ctx, span
+}
+
+// endUpstreamCall 结束上游调用的 span，上游返回 IsError 时标记为失败
+func endUpstreamCall(span trace.Span, result *mcp.CallToolResult, err error) {
+	if err == nil && result != nil && result.IsError {
+		tracing.Fail(span, "tool returned an error")
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,301 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+	"McpServer/internal/secrets"
+)
+
+// oauth2TokenRefreshMargin 令牌到期前提前刷新的时间
+const oauth2TokenRefreshMargin = 30 * time.Second
+
+// upstreamAuths 远程 SSE 服务的认证状态，按服务共享，OAuth2 令牌在所有访问路径之间复用
+var upstreamAuths = newUpstreamAuthRegistry()
+
+// upstreamAuth 为发往远程 SSE 服务的请求添加配置的默认头部和认证信息，
+// 支持 none、bearer_token、api_key、basic_auth、custom_header 和 oauth2_client_credentials
+type upstreamAuth struct {
+	serverID   string
+	authType   string
+	authConfig models.JSONB
+	headers    models.JSONB
+
+	client    *http.Client
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// apply 设置默认头部和认证头部，获取 OAuth2 令牌失败时返回错误
+func (a *upstreamAuth) apply(req *http.Request) error {
+	for key, value := range a.headers {
+		if valueStr, ok := value.(string); ok {
+			req.Header.Set(key, valueStr)
+		}
+	}
+
+	switch a.authType {
+	case "", "none":
+	case "bearer_token":
+		if token, ok := a.authConfig["token"].(string); ok {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	case "api_key":
+		if key, ok := a.authConfig["key"].(string); ok {
+			headerName := "X-API-Key"
+			if h, ok1 := a.authConfig["header"].(string); ok1 && h != "" {
+				headerName = h
+			}
+			req.Header.Set(headerName, key)
+		}
+	case "basic_auth":
+		username, _ := a.authConfig["username"].(string)
+		password, _ := a.authConfig["password"].(string)
+		req.SetBasicAuth(username, password)
+	case "custom_header":
+		for key, value := range a.authConfig {
+			if valueStr, ok := value.(string); ok {
+				req.Header.Set(key, valueStr)
+			}
+		}
+	case "oauth2_client_credentials":
+		token, err := a.accessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return fmt.Errorf("unsupported auth_type %q for server %s", a.authType, a.serverID)
+	}
+	return nil
+}
+
+// checkResponse 上游返回 401 时丢弃缓存的 OAuth2 令牌，下次请求重新获取
+func (a *upstreamAuth) checkResponse(resp *http.Response) {
+	if resp.StatusCode != http.StatusUnauthorized || a.authType != "oauth2_client_credentials" {
+		return
+	}
+	a.mutex.Lock()
+	a.token = ""
+	a.mutex.Unlock()
+	logger.Warn("Remote SSE service %s rejected the OAuth2 access token, it will be refreshed", a.serverID)
+}
+
+// accessToken 返回缓存的 OAuth2 令牌，即将过期时重新获取
+func (a *upstreamAuth) accessToken() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token != "" && time.Now().Add(oauth2TokenRefreshMargin).Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	token, expiresIn, err := a.fetchToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain OAuth2 token for server %s: %w", a.serverID, err)
+	}
+	a.token = token
+	a.expiresAt = time.Now().Add(expiresIn)
+	logger.Info("Obtained OAuth2 access token for remote SSE service %s (expires in %s)", a.serverID, expiresIn)
+	return token, nil
+}
+
+// fetchToken 以 client_credentials 授权向 token_url 请求令牌；客户端认证默认使用 HTTP Basic，
+// client_auth_method 为 client_secret_post 时放在表单中
+func (a *upstreamAuth) fetchToken() (string, time.Duration, error) {
+	tokenURL, _ := a.authConfig["token_url"].(string)
+	clientID, _ := a.authConfig["client_id"].(string)
+	clientSecret, _ := a.authConfig["client_secret"].(string)
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if scope := oauth2Scope(a.authConfig["scope"]); scope != "" {
+		form.Set("scope", scope)
+	}
+	if audience, ok := a.authConfig["audience"].(string); ok && audience != "" {
+		form.Set("audience", audience)
+	}
+	basic := true
+	if method, _ := a.authConfig["client_auth_method"].(string); method == "client_secret_post" {
+		basic = false
+		form.Set("client_id", clientID)
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		AccessToken string  `json:"access_token"`
+		TokenType   string  `json:"token_type"`
+		ExpiresIn   float64 `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", 0, fmt.Errorf("invalid token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response contains no access_token")
+	}
+	if result.TokenType != "" && !strings.EqualFold(result.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token_type %q", result.TokenType)
+	}
+
+	// 未返回 expires_in 时按一小时缓存，被上游拒绝时会提前刷新
+	expiresIn := time.Hour
+	if result.ExpiresIn > 0 {
+		expiresIn = time.Duration(result.ExpiresIn) * time.Second
+	}
+	return result.AccessToken, expiresIn, nil
+}
+
+// oauth2Scope 读取 scope 配置，兼容空格分隔的字符串和字符串数组
+func oauth2Scope(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		scopes := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return strings.Join(scopes, " ")
+	}
+	return ""
+}
+
+// upstreamAuthRegistry 按服务缓存 upstreamAuth，认证配置或默认头部（解析密钥引用后）变化时重新创建
+type upstreamAuthRegistry struct {
+	mutex    sync.Mutex
+	auths    map[string]*upstreamAuth
+	resolver SecretResolver
+}
+
+func newUpstreamAuthRegistry() *upstreamAuthRegistry {
+	return &upstreamAuthRegistry{auths: make(map[string]*upstreamAuth)}
+}
+
+// setResolver 设置解析 auth_config 和 headers 中密钥引用的解析器
+func (r *upstreamAuthRegistry) setResolver(resolver SecretResolver) {
+	r.mutex.Lock()
+	r.resolver = resolver
+	r.mutex.Unlock()
+}
+
+// get 返回服务当前配置对应的 upstreamAuth；每次都重新解析密钥引用，密钥轮换后自动换用新值
+func (r *upstreamAuthRegistry) get(config *models.MCPServiceSSE) (*upstreamAuth, error) {
+	r.mutex.Lock()
+	resolver := r.resolver
+	r.mutex.Unlock()
+
+	authConfig, err := resolveSecretRefs(resolver, config.AuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("auth_config of server %s: %w", config.ServerID, err)
+	}
+	headers, err := resolveSecretRefs(resolver, config.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("headers of server %s: %w", config.ServerID, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if auth, exists := r.auths[config.ServerID]; exists &&
+		auth.authType == config.AuthType &&
+		reflect.DeepEqual(auth.authConfig, authConfig) &&
+		reflect.DeepEqual(auth.headers, headers) {
+		return auth, nil
+	}
+
+	timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	auth := &upstreamAuth{
+		serverID:   config.ServerID,
+		authType:   config.AuthType,
+		authConfig: authConfig,
+		headers:    headers,
+		client:     &http.Client{Timeout: timeout},
+	}
+	r.auths[config.ServerID] = auth
+	return auth, nil
+}
+
+// remove 服务删除或禁用后丢弃其认证状态
+func (r *upstreamAuthRegistry) remove(serverID string) {
+	r.mutex.Lock()
+	delete(r.auths, serverID)
+	r.mutex.Unlock()
+}
+
+// upstreamAuthRoundTripper 为 SSE 客户端传输的每个请求（事件流 GET 和消息 POST）添加认证信息
+type upstreamAuthRoundTripper struct {
+	base   http.RoundTripper
+	config *models.MCPServiceSSE
+}
+
+func (rt *upstreamAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth, err := upstreamAuths.get(rt.config)
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTripper 不应修改原请求
+	req = req.Clone(req.Context())
+	if err = auth.apply(req); err != nil {
+		return nil, err
+	}
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	auth.checkResponse(resp)
+	return resp, nil
+}
+
+// resolveSecretRefs 解析 values 中的密钥引用；未启用密钥存储时存在引用则返回错误
+func resolveSecretRefs(resolver SecretResolver, values models.JSONB) (models.JSONB, error) {
+	if resolver != nil {
+		return resolver.Resolve(values)
+	}
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			if name, isRef := secrets.ParseRef(str); isRef {
+				return nil, fmt.Errorf("%s references secret %s but no secrets key is configured", key, name)
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,350 @@
+package metering
+
+import (
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// Store 计量和配额所需的数据库操作，读取方法在记录不存在时返回 nil
+type Store interface {
+	RecordToolUsage(usages []models.ToolUsage, counters []models.UsageCounter) error
+	GetUsageQuota(subjectType, subjectID string) (*models.UsageQuota, error)
+	GetUsageCount(subjectType, subjectID, period string, periodStart time.Time) (int64, error)
+}
+
+// QuotaDecision 配额检查结果，超出配额时给出超出的主体、周期和重置时间
+type QuotaDecision struct {
+	Allowed bool
+	Subject string // key:<key_id> 或 user:<user_id>
+	Period  string // day 或 month
+	Limit   int64
+	Used    int64
+	ResetAt time.Time
+}
+
+// counterKey 一个主体在一个周期内的计数
+type counterKey struct {
+	subjectType string
+	subjectID   string
+	period      string
+	start       time.Time
+}
+
+// usageCount 调用次数：base 为上次从数据库读取的已持久化次数，pending 为本实例记录但尚未写入的次数
+type usageCount struct {
+	base      int64
+	pending   int64
+	fetchedAt time.Time // 零值表示需要重新读取
+}
+
+// quotaEntry 缓存的配额，quota 为 nil 表示未配置
+type quotaEntry struct {
+	quota     *models.UsageQuota
+	expiresAt time.Time
+}
+
+// Meter 记录工具调用并检查配额：调用明细在内存中缓冲，按批写入 tool_usage 并累加 usage_counters；
+// 配额按已持久化的计数加上本实例尚未写入的次数检查，计数和配额按 quota_cache_ttl 缓存
+type Meter struct {
+	store         Store
+	flushInterval time.Duration
+	batchSize     int
+	maxBuffer     int
+	cacheTTL      time.Duration
+
+	mutex  sync.Mutex
+	buffer []models.ToolUsage
+	counts map[counterKey]*usageCount
+	quotas map[string]quotaEntry // subject_type:subject_id -> 配额
+
+	flushSignal chan struct{}
+	stopChan    chan struct{}
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewMeter 创建计量器并启动后台写入
+func NewMeter(cfg *config.MeteringConfig, store Store) *Meter {
+	m := &Meter{
+		store:         store,
+		flushInterval: cfg.FlushInterval,
+		batchSize:     cfg.BatchSize,
+		maxBuffer:     cfg.MaxBuffer,
+		cacheTTL:      cfg.QuotaCacheTTL,
+		counts:        make(map[counterKey]*usageCount),
+		quotas:        make(map[string]quotaEntry),
+		flushSignal:   make(chan struct{}, 1),
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Record 记录一次工具调用，缓冲达到 batch_size 时立即写入
+func (m *Meter) Record(usage models.ToolUsage) {
+	m.mutex.Lock()
+	m.buffer = append(m.buffer, usage)
+	for _, key := range counterKeys(usage) {
+		count, ok := m.counts[key]
+		if !ok {
+			count = &usageCount{}
+			m.counts[key] = count
+		}
+		count.pending++
+	}
+	m.trimBuffer()
+	full := len(m.buffer) >= m.batchSize
+	m.mutex.Unlock()
+
+	if full {
+		select {
+		case m.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// CheckQuota 检查密钥和用户的配额，两者都配置时都要满足；查询数据库失败时放行
+func (m *Meter) CheckQuota(keyID, userID string) QuotaDecision {
+	now := time.Now().UTC()
+	for _, subject := range subjects(keyID, userID) {
+		quota, err := m.quota(subject[0], subject[1], now)
+		if err != nil {
+			logger.Warn("Failed to check usage quota, allowing call: %v", err)
+			continue
+		}
+		if quota == nil {
+			continue
+		}
+
+		limits := []struct {
+			period string
+			limit  *int64
+		}{
+			{models.UsagePeriodDay, quota.DailyLimit},
+			{models.UsagePeriodMonth, quota.MonthlyLimit},
+		}
+		for _, l := range limits {
+			if l.limit == nil {
+				continue
+			}
+			start, reset := periodBounds(l.period, now)
+			used, err1 := m.count(counterKey{subject[0], subject[1], l.period, start}, now)
+			if err1 != nil {
+				logger.Warn("Failed to check usage quota, allowing call: %v", err1)
+				continue
+			}
+			if used >= *l.limit {
+				return QuotaDecision{
+					Subject: subject[0] + ":" + subject[1],
+					Period:  l.period,
+					Limit:   *l.limit,
+					Used:    used,
+					ResetAt: reset,
+				}
+			}
+		}
+	}
+	return QuotaDecision{Allowed: true}
+}
+
+// Close 停止后台任务并写入缓冲中剩余的记录
+func (m *Meter) Close() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
+	<-m.done
+}
+
+// quota 返回缓存的配额，过期时重新查询
+func (m *Meter) quota(subjectType, subjectID string, now time.Time) (*models.UsageQuota, error) {
+	cacheKey := subjectType + ":" + subjectID
+	m.mutex.Lock()
+	entry, ok := m.quotas[cacheKey]
+	m.mutex.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.quota, nil
+	}
+
+	quota, err := m.store.GetUsageQuota(subjectType, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	m.quotas[cacheKey] = quotaEntry{quota: quota, expiresAt: now.Add(m.cacheTTL)}
+	m.mutex.Unlock()
+	return quota, nil
+}
+
+// count 返回周期内的调用次数，已持久化的部分按 quota_cache_ttl 重新读取，以包含其他实例写入的次数
+func (m *Meter) count(key counterKey, now time.Time) (int64, error) {
+	m.mutex.Lock()
+	count, ok := m.counts[key]
+	if ok && !count.fetchedAt.IsZero() && now.Sub(count.fetchedAt) < m.cacheTTL {
+		total := count.base + count.pending
+		m.mutex.Unlock()
+		return total, nil
+	}
+	m.mutex.Unlock()
+
+	base, err := m.store.GetUsageCount(key.subjectType, key.subjectID, key.period, key.start)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	count, ok = m.counts[key]
+	if !ok {
+		count = &usageCount{}
+		m.counts[key] = count
+	}
+	count.base = base
+	count.fetchedAt = now
+	return count.base + count.pending, nil
+}
+
+func (m *Meter) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.flush()
+		case <-m.flushSignal:
+			m.flush()
+		case <-m.stopChan:
+			m.flush()
+			return
+		}
+	}
+}
+
+// flush 写入缓冲中的记录；失败时放回缓冲，下次重试
+func (m *Meter) flush() {
+	m.mutex.Lock()
+	batch := m.buffer
+	m.buffer = nil
+	m.mutex.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	counters := aggregate(batch)
+	if err := m.store.RecordToolUsage(batch, counters); err != nil {
+		logger.Warn("Failed to write %d tool usage records, will retry: %v", len(batch), err)
+		m.mutex.Lock()
+		m.buffer = append(batch, m.buffer...)
+		m.trimBuffer()
+		m.mutex.Unlock()
+		return
+	}
+
+	now := time.Now().UTC()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, counter := range counters {
+		key := counterKey{counter.SubjectType, counter.SubjectID, counter.Period, counter.PeriodStart}
+		if count, ok := m.counts[key]; ok {
+			// 已写入的次数计入数据库中的计数，下次检查时重新读取
+			count.pending -= counter.Calls
+			count.fetchedAt = time.Time{}
+		}
+	}
+	for key, count := range m.counts {
+		if start, _ := periodBounds(key.period, now); key.start.Before(start) && count.pending <= 0 {
+			delete(m.counts, key)
+		}
+	}
+	for cacheKey, entry := range m.quotas {
+		if now.After(entry.expiresAt) {
+			delete(m.quotas, cacheKey)
+		}
+	}
+}
+
+// trimBuffer 缓冲超过 max_buffer 时丢弃最早的记录（数据库长时间不可用）；调用方需持有锁
+func (m *Meter) trimBuffer() {
+	excess := len(m.buffer) - m.maxBuffer
+	if excess <= 0 {
+		return
+	}
+	for _, usage := range m.buffer[:excess] {
+		for _, key := range counterKeys(usage) {
+			if count, ok := m.counts[key]; ok {
+				count.pending--
+			}
+		}
+	}
+	m.buffer = append([]models.ToolUsage(nil), m.buffer[excess:]...)
+	logger.Warn("Tool usage buffer full, dropped %d oldest records", excess)
+}
+
+// aggregate 将一批调用合并为各主体、各周期的计数增量
+func aggregate(batch []models.ToolUsage) []models.UsageCounter {
+	calls := make(map[counterKey]int64)
+	var order []counterKey
+	for _, usage := range batch {
+		for _, key := range counterKeys(usage) {
+			if _, ok := calls[key]; !ok {
+				order = append(order, key)
+			}
+			calls[key]++
+		}
+	}
+
+	counters := make([]models.UsageCounter, 0, len(order))
+	for _, key := range order {
+		counters = append(counters, models.UsageCounter{
+			SubjectType: key.subjectType,
+			SubjectID:   key.subjectID,
+			Period:      key.period,
+			PeriodStart: key.start,
+			Calls:       calls[key],
+		})
+	}
+	return counters
+}
+
+// counterKeys 一次调用计入的计数：密钥和用户各自的当天、当月
+func counterKeys(usage models.ToolUsage) []counterKey {
+	var keys []counterKey
+	for _, subject := range subjects(usage.KeyID, usage.UserID) {
+		for _, period := range []string{models.UsagePeriodDay, models.UsagePeriodMonth} {
+			start, _ := periodBounds(period, usage.CalledAt)
+			keys = append(keys, counterKey{subject[0], subject[1], period, start})
+		}
+	}
+	return keys
+}
+
+// subjects 调用方对应的计数主体（类型, ID）
+func subjects(keyID, userID string) [][2]string {
+	var result [][2]string
+	if keyID != "" {
+		result = append(result, [2]string{models.UsageSubjectKey, keyID})
+	}
+	if userID != "" {
+		result = append(result, [2]string{models.UsageSubjectUser, userID})
+	}
+	return result
+}
+
+// periodBounds 返回 t 所在周期（UTC）的开始时间和下一个周期的开始时间
+func periodBounds(period string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if period == models.UsagePeriodMonth {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
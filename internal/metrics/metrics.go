@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mcp"
+
+// maxToolsPerServer 每个服务最多单独统计的工具名，超出的调用计入 otherTool。
+// 透传给远程 SSE 服务的工具名来自客户端请求，限制标签数量避免序列无限增长
+const maxToolsPerServer = 500
+
+// otherTool 超出 maxToolsPerServer 后的工具标签
+const otherTool = "_other"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Tool calls by server, tool and outcome.",
+	}, []string{"server_id", "tool", "outcome"})
+
+	toolCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Tool call latency by server, tool and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"server_id", "tool", "outcome"})
+
+	upstreamConnectFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_connect_failures_total",
+		Help:      "Failed connections to remote SSE services and stdio processes.",
+	}, []string{"server_id", "transport"})
+
+	keepAliveFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "keepalive_failures_total",
+		Help:      "Failed keep-alive requests to remote stdio processes.",
+	}, []string{"server_id"})
+
+	stdioCrashes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stdio_process_crashes_total",
+		Help:      "Unexpected exits and unresponsive keep-alives of remote stdio processes.",
+	}, []string{"server_id"})
+
+	stdioRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stdio_process_restarts_total",
+		Help:      "Successful automatic restarts of crashed remote stdio processes.",
+	}, []string{"server_id"})
+
+	upstreamHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_healthy",
+		Help:      "Health check status of remote SSE services (1 healthy, 0 unhealthy).",
+	}, []string{"server_id"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state of remote services (0 closed, 1 half-open, 2 open).",
+	}, []string{"server_id"})
+
+	breakerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_rejections_total",
+		Help:      "Calls and connections to remote services rejected by an open circuit breaker.",
+	}, []string{"server_id"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by statement type and table.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "table"})
+
+	toolsMutex sync.Mutex
+	toolNames  = make(map[string]map[string]bool) // server_id -> 已单独统计的工具名
+)
+
+func init() {
+	registry.MustRegister(
+		toolCalls,
+		toolCallDuration,
+		upstreamConnectFailures,
+		keepAliveFailures,
+		stdioCrashes,
+		stdioRestarts,
+		upstreamHealthy,
+		breakerState,
+		breakerRejections,
+		dbQueryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveToolCall 记录一次工具调用的结果和耗时
+func ObserveToolCall(serverID, toolName, outcome string, duration time.Duration) {
+	toolName = toolLabel(serverID, toolName)
+	toolCalls.WithLabelValues(serverID, toolName, outcome).Inc()
+	toolCallDuration.WithLabelValues(serverID, toolName, outcome).Observe(duration.Seconds())
+}
+
+// UpstreamConnectFailed 记录一次连接远程服务失败，transport 为 sse 或 stdio
+func UpstreamConnectFailed(serverID, transport string) {
+	upstreamConnectFailures.WithLabelValues(serverID, transport).Inc()
+}
+
+// KeepAliveFailed 记录一次远程 stdio 进程保活失败
+func KeepAliveFailed(serverID string) {
+	keepAliveFailures.WithLabelValues(serverID).Inc()
+}
+
+// StdioProcessCrashed 记录一次远程 stdio 进程崩溃
+func StdioProcessCrashed(serverID string) {
+	stdioCrashes.WithLabelValues(serverID).Inc()
+}
+
+// StdioProcessRestarted 记录一次远程 stdio 进程自动重启成功
+func StdioProcessRestarted(serverID string) {
+	stdioRestarts.WithLabelValues(serverID).Inc()
+}
+
+// SetUpstreamHealthy 记录远程服务的健康检查状态
+func SetUpstreamHealthy(serverID string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	upstreamHealthy.WithLabelValues(serverID).Set(value)
+}
+
+// RemoveUpstreamHealth 服务不再被检查时移除其健康状态
+func RemoveUpstreamHealth(serverID string) {
+	upstreamHealthy.DeleteLabelValues(serverID)
+}
+
+// SetCircuitBreakerState 记录远程服务熔断器的状态：0 关闭，1 半开，2 熔断
+func SetCircuitBreakerState(serverID string, state float64) {
+	breakerState.WithLabelValues(serverID).Set(state)
+}
+
+// CircuitBreakerRejected 记录一次被熔断器拒绝的调用或连接
+func CircuitBreakerRejected(serverID string) {
+	breakerRejections.WithLabelValues(serverID).Inc()
+}
+
+// ObserveDBQuery 记录一次数据库查询的耗时
+func ObserveDBQuery(operation, table string, duration time.Duration) {
+	dbQueryDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
+}
+
+// toolLabel 返回工具的标签值，服务的工具名超过 maxToolsPerServer 后新的工具名统一为 otherTool
+func toolLabel(serverID, toolName string) string {
+	toolsMutex.Lock()
+	defer toolsMutex.Unlock()
+
+	names, ok := toolNames[serverID]
+	if !ok {
+		names = make(map[string]bool)
+		toolNames[serverID] = names
+	}
+	if names[toolName] {
+		return toolName
+	}
+	if len(names) >= maxToolsPerServer {
+		return otherTool
+	}
+	names[toolName] = true
+	return toolName
+}
+
+// Handler 返回 Prometheus 文本格式的指标端点，会话和进程数在抓取时从 sessions、processes 读取
+func Handler(sessions SessionSource, processes ProcessSource) http.Handler {
+	scrapeRegistry := prometheus.NewRegistry()
+	scrapeRegistry.MustRegister(&sessionCollector{sessions: sessions, processes: processes})
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, scrapeRegistry}, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SessionSource 提供各服务的活跃 SSE 会话数
+type SessionSource interface {
+	ActiveSessionsByServer() map[string]int
+}
+
+// ProcessSource 提供远程 stdio 进程的统计，格式同 RemoteStdioManager.GetSessionStats
+type ProcessSource interface {
+	GetStdioSessionStats() map[string]interface{}
+}
+
+var (
+	sseSessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "sse_sessions_active"),
+		"Active downstream SSE sessions by server.",
+		[]string{"server_id"}, nil)
+
+	stdioProcessesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "stdio_processes"),
+		"Running remote stdio processes by reuse strategy.",
+		[]string{"strategy"}, nil)
+
+	stdioConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "stdio_connections"),
+		"Downstream connections using remote stdio processes by reuse strategy.",
+		[]string{"strategy"}, nil)
+)
+
+// sessionCollector 在抓取时读取会话和进程数
+type sessionCollector struct {
+	sessions  SessionSource
+	processes ProcessSource
+}
+
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sseSessionsDesc
+	ch <- stdioProcessesDesc
+	ch <- stdioConnectionsDesc
+}
+
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	for serverID, count := range c.sessions.ActiveSessionsByServer() {
+		ch <- prometheus.MustNewConstMetric(sseSessionsDesc, prometheus.GaugeValue, float64(count), serverID)
+	}
+
+	byStrategy, _ := c.processes.GetStdioSessionStats()["by_strategy"].(map[string]map[string]interface{})
+	for strategy, stats := range byStrategy {
+		if processes, ok := stats["sessions"].(int); ok {
+			ch <- prometheus.MustNewConstMetric(stdioProcessesDesc, prometheus.GaugeValue, float64(processes), strategy)
+		}
+		if connections, ok := stats["connections"].(int32); ok {
+			ch <- prometheus.MustNewConstMetric(stdioConnectionsDesc, prometheus.GaugeValue, float64(connections), strategy)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// 审计事件类型
+const (
+	AuditEventToolCall = "tool_call" // 工具调用
+	AuditEventAdmin    = "admin"     // 管理接口的变更操作
+)
+
+// AuditEntry 表示 audit_log 表中的一条审计记录。每条记录的 hash 覆盖上一条记录的 hash 和本条的全部字段，
+// 修改或删除中间的记录都会使链校验失败
+type AuditEntry struct {
+	ID            int64     `json:"id" db:"id"`
+	OccurredAt    time.Time `json:"occurred_at" db:"occurred_at"`
+	EventType     string    `json:"event_type" db:"event_type"`
+	Actor         string    `json:"actor" db:"actor"` // 调用方标识，与限流、计量的 caller 一致
+	UserID        string    `json:"user_id,omitempty" db:"user_id"`
+	KeyID         string    `json:"key_id,omitempty" db:"key_id"`
+	Action        string    `json:"action" db:"action"` // tools/call 或管理接口的路由，如 PUT /admin/services/{id}
+	ServerID      string    `json:"server_id,omitempty" db:"server_id"`
+	ToolName      string    `json:"tool_name,omitempty" db:"tool_name"`
+	Target        string    `json:"target,omitempty" db:"target"`                 // 管理接口的请求路径
+	ArgumentsHash string    `json:"arguments_hash,omitempty" db:"arguments_hash"` // 工具参数或管理请求体的 SHA-256
+	Arguments     JSONB     `json:"arguments,omitempty" db:"arguments"`           // 遮蔽后的工具参数，audit.arguments 为 redacted 时记录
+	Status        string    `json:"status" db:"status"`
+	Details       JSONB     `json:"details,omitempty" db:"details"`
+	PrevHash      string    `json:"prev_hash" db:"prev_hash"`
+	Hash          string    `json:"hash" db:"hash"`
+}
+
+// AuditQuery 审计记录查询，按 id 倒序返回；空字符串和零值表示不过滤
+type AuditQuery struct {
+	From      time.Time
+	To        time.Time
+	EventType string
+	Actor     string
+	UserID    string
+	KeyID     string
+	ServerID  string
+	ToolName  string
+	Action    string
+	Status    string
+	BeforeID  int64 // 翻页：只返回 id 小于该值的记录
+	Limit     int
+}
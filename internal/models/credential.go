@@ -0,0 +1,57 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// UserServiceCredential 表示 user_service_credentials 表中用户访问某个上游服务的凭证
+type UserServiceCredential struct {
+	UserID     string     `json:"user_id" db:"user_id"`
+	ServerID   string     `json:"server_id" db:"server_id"`
+	Credential string     `json:"-" db:"credential"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// IsExpired 判断凭证在给定时间是否已过期
+func (c *UserServiceCredential) IsExpired(now time.Time) bool {
+	return c.ExpiresAt != nil && !c.ExpiresAt.After(now)
+}
+
+// CredentialPassthrough mcp_service_sse / mcp_service_stdio 的 credential_passthrough 字段：
+// 将调用方自己的凭证而不是 auth_config 中的共享凭证转发给上游
+type CredentialPassthrough struct {
+	// ForwardHeaders 调用方请求头 -> 上游请求头（仅 SSE）
+	ForwardHeaders map[string]string `json:"forward_headers,omitempty"`
+	// ForwardClaims 调用方身份声明（JWT 声明，或 sub/username/name）-> 上游请求头（仅 SSE）
+	ForwardClaims map[string]string `json:"forward_claims,omitempty"`
+	// UserCredential 从 user_service_credentials 表查找调用方在该服务上的凭证并注入
+	UserCredential *UserCredentialInjection `json:"user_credential,omitempty"`
+}
+
+// UserCredentialInjection 按用户凭证的注入方式
+type UserCredentialInjection struct {
+	Header   string `json:"header,omitempty"`   // SSE：注入的请求头
+	Prefix   string `json:"prefix,omitempty"`   // 请求头取值前缀，如 "Bearer "
+	Env      string `json:"env,omitempty"`      // stdio：启动 per_user 进程时注入的环境变量
+	Required bool   `json:"required,omitempty"` // 找不到凭证时拒绝连接，否则不注入
+}
+
+// ParseCredentialPassthrough 解析 credential_passthrough 字段，未配置时返回 nil；不认识的字段视为错误
+func ParseCredentialPassthrough(raw JSONB) (*CredentialPassthrough, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var passthrough CredentialPassthrough
+	if err = decoder.Decode(&passthrough); err != nil {
+		return nil, err
+	}
+	return &passthrough, nil
+}
@@ -23,6 +23,7 @@ type MCPServiceSSE struct {
 	FollowRedirects       bool      `json:"follow_redirects" db:"follow_redirects"`
 	MaxRedirects          int       `json:"max_redirects" db:"max_redirects"`
 	UserAgent             string    `json:"user_agent" db:"user_agent"`
+	CredentialPassthrough JSONB     `json:"credential_passthrough" db:"credential_passthrough"`
 	CreatedAt             time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -9,6 +9,7 @@ type MCPTool struct {
 	Name          string    `json:"name" db:"name"`
 	Description   string    `json:"description" db:"description"`
 	ArgsSchema    JSONB     `json:"args_schema" db:"args_schema"`
+	OutputSchema  JSONB     `json:"output_schema" db:"output_schema"`
 	Enabled       bool      `json:"enabled" db:"enabled"`
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
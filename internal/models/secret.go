@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Secret 表示 secrets 表中的加密密钥，密文和随机数不会出现在任何响应中
+type Secret struct {
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Ciphertext  []byte    `json:"-" db:"ciphertext"`
+	Nonce       []byte    `json:"-" db:"nonce"`
+	KeyID       string    `json:"key_id" db:"key_id"` // 加密所用主密钥的指纹
+	Version     int       `json:"version" db:"version"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
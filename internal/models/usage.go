@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// 配额和计数的主体类型
+const (
+	UsageSubjectKey  = "key"  // user_keys.key_id
+	UsageSubjectUser = "user" // 用户ID
+)
+
+// 计数周期（UTC）
+const (
+	UsagePeriodDay   = "day"
+	UsagePeriodMonth = "month"
+)
+
+// ToolUsage 表示 tool_usage 表中的一次工具调用
+type ToolUsage struct {
+	CalledAt   time.Time `json:"called_at" db:"called_at"`
+	Caller     string    `json:"caller" db:"caller"`
+	UserID     string    `json:"user_id,omitempty" db:"user_id"`
+	KeyID      string    `json:"key_id,omitempty" db:"key_id"`
+	ServerID   string    `json:"server_id" db:"server_id"`
+	ToolName   string    `json:"tool_name" db:"tool_name"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+	Success    bool      `json:"success" db:"success"`
+	BytesIn    int64     `json:"bytes_in" db:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out" db:"bytes_out"`
+}
+
+// UsageCounter usage_counters 表中某个主体在一个周期内的调用次数，写入时为增量
+type UsageCounter struct {
+	SubjectType string    `json:"subject_type" db:"subject_type"`
+	SubjectID   string    `json:"subject_id" db:"subject_id"`
+	Period      string    `json:"period" db:"period"`
+	PeriodStart time.Time `json:"period_start" db:"period_start"`
+	Calls       int64     `json:"calls" db:"calls"`
+}
+
+// UsageQuota 表示 usage_quotas 表中密钥或用户的配额，nil 表示该周期不限制
+type UsageQuota struct {
+	SubjectType  string `json:"subject_type" db:"subject_type"`
+	SubjectID    string `json:"subject_id" db:"subject_id"`
+	DailyLimit   *int64 `json:"daily_limit" db:"daily_limit"`
+	MonthlyLimit *int64 `json:"monthly_limit" db:"monthly_limit"`
+}
+
+// UsageReportQuery 用量报表查询：[From, To) 内的调用按时间桶和 GroupBy 中的维度汇总
+type UsageReportQuery struct {
+	From    time.Time
+	To      time.Time
+	Bucket  string   // hour、day、week、month
+	GroupBy []string // key、user、caller、server、tool
+
+	// 过滤条件，空字符串表示不过滤
+	ServerID string
+	ToolName string
+	KeyID    string
+	UserID   string
+}
+
+// UsageReportRow 用量报表的一行，未参与分组的维度为空
+type UsageReportRow struct {
+	Bucket          time.Time `json:"bucket"`
+	KeyID           string    `json:"key_id,omitempty"`
+	UserID          string    `json:"user_id,omitempty"`
+	Caller          string    `json:"caller,omitempty"`
+	ServerID        string    `json:"server_id,omitempty"`
+	ToolName        string    `json:"tool_name,omitempty"`
+	Calls           int64     `json:"calls"`
+	Errors          int64     `json:"errors"`
+	TotalDurationMs int64     `json:"total_duration_ms"`
+	AvgDurationMs   float64   `json:"avg_duration_ms"`
+	BytesIn         int64     `json:"bytes_in"`
+	BytesOut        int64     `json:"bytes_out"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserKey 表示 user_keys 表中的密钥及其所属用户（users 表）的信息
+type UserKey struct {
+	KeyID       string          `json:"key_id" db:"key_id"`
+	UserID      string          `json:"user_id" db:"user_id"`
+	Username    string          `json:"username" db:"username"`
+	UserName    string          `json:"user_name" db:"user_name"`
+	UserStatus  string          `json:"user_status" db:"user_status"`
+	KeyName     string          `json:"key_name" db:"key_name"`
+	KeyType     string          `json:"key_type" db:"key_type"`
+	Status      string          `json:"status" db:"status"`
+	Permissions json.RawMessage `json:"permissions" db:"permissions"`
+	ExpiresAt   *time.Time      `json:"expires_at" db:"expires_at"`
+}
+
+// IsGatewayCredential 密钥类型是否可用于调用网关：只有 api 和 access_token，
+// refresh_token、secret 等其他类型的密钥不能直接作为凭证
+func (k *UserKey) IsGatewayCredential() bool {
+	return k.KeyType == "api" || k.KeyType == "access_token"
+}
+
+// IsExpired 判断密钥在给定时间是否已过期
+func (k *UserKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+)
+
+// 限流范围
+const (
+	ScopeRequest  = "request"   // 发往 MCP 端点的 HTTP 请求
+	ScopeToolCall = "tool_call" // 工具调用
+)
+
+// 计数维度
+const (
+	PerCaller = "caller"
+	PerServer = "server"
+	PerTool   = "tool"
+)
+
+// sweepInterval 清理已补满的令牌桶的间隔，补满的桶与新建的桶等价
+const sweepInterval = time.Minute
+
+// Key 被限流的请求
+type Key struct {
+	Caller   string // 调用方标识
+	ServerID string
+	Tool     string // 仅 tool_call
+}
+
+// Decision 限流结果，被拒绝时 Rule 为拒绝它的规则，RetryAfter 为该规则下一个令牌的等待时间
+type Decision struct {
+	Allowed    bool
+	Rule       string
+	RetryAfter time.Duration
+}
+
+// rule 校验后的限流规则
+type rule struct {
+	config.RateLimitRule
+	perCaller, perServer, perTool bool
+	interval                      time.Duration // 补充一个令牌的时间
+}
+
+// matches 规则是否适用于该请求
+func (r *rule) matches(scope string, key Key) bool {
+	if r.Scope != scope || !matchAny(r.Servers, key.ServerID) {
+		return false
+	}
+	return scope != ScopeToolCall || matchAny(r.Tools, key.Tool)
+}
+
+// bucketKey 令牌桶的键：规则名称加上按 per 选取的维度
+func (r *rule) bucketKey(key Key) string {
+	parts := []string{r.Name}
+	if r.perCaller {
+		parts = append(parts, key.Caller)
+	}
+	if r.perServer {
+		parts = append(parts, key.ServerID)
+	}
+	if r.perTool {
+		parts = append(parts, key.Tool)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// bucket 令牌桶，tokens 为 updated 时刻的令牌数
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rule    *rule
+}
+
+// refill 按经过的时间补充令牌，不超过桶容量
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.rule.Burst), b.tokens+float64(elapsed)/float64(b.rule.interval))
+		b.updated = now
+	}
+}
+
+// Limiter 按调用方、服务和工具计数的令牌桶限流器，状态只保存在本进程内
+type Limiter struct {
+	rules []*rule
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter 校验配置并创建限流器
+func NewLimiter(cfg *config.RateLimitConfig) (*Limiter, error) {
+	limiter := &Limiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+
+	names := make(map[string]bool)
+	for i, ruleConfig := range cfg.Rules {
+		r := &rule{RateLimitRule: ruleConfig}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rate_limit.rules[%d]: duplicate name %q", i, r.Name)
+		}
+		names[r.Name] = true
+
+		if r.Scope != ScopeRequest && r.Scope != ScopeToolCall {
+			return nil, fmt.Errorf("rate_limit.rules[%d]: scope must be %s or %s", i, ScopeRequest, ScopeToolCall)
+		}
+		if r.Rate <= 0 || r.Period <= 0 || r.Burst <= 0 {
+			return nil, fmt.Errorf("rate_limit.rules[%d]: rate, period and burst must be positive", i)
+		}
+		if r.Scope == ScopeRequest && len(r.Tools) > 0 {
+			return nil, fmt.Errorf("rate_limit.rules[%d]: tools only applies to scope %s", i, ScopeToolCall)
+		}
+		for _, per := range r.Per {
+			switch per {
+			case PerCaller:
+				r.perCaller = true
+			case PerServer:
+				r.perServer = true
+			case PerTool:
+				if r.Scope != ScopeToolCall {
+					return nil, fmt.Errorf("rate_limit.rules[%d]: per %s only applies to scope %s", i, PerTool, ScopeToolCall)
+				}
+				r.perTool = true
+			default:
+				return nil, fmt.Errorf("rate_limit.rules[%d]: unknown per %q", i, per)
+			}
+		}
+		for _, pattern := range append(append([]string{}, r.Servers...), r.Tools...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rate_limit.rules[%d]: invalid pattern %q", i, pattern)
+			}
+		}
+
+		r.interval = r.Period / time.Duration(r.Rate)
+		limiter.rules = append(limiter.rules, r)
+	}
+	return limiter, nil
+}
+
+// HasScope 是否有该范围的规则，没有时调用方可以跳过提取请求中的工具调用
+func (l *Limiter) HasScope(scope string) bool {
+	for _, r := range l.rules {
+		if r.Scope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow 检查请求是否通过全部匹配的规则；只有全部通过时才消耗各规则的令牌，
+// 被拒绝的请求不占用其他规则的配额
+func (l *Limiter) Allow(scope string, key Key) Decision {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	var matched []*bucket
+	for _, r := range l.rules {
+		if !r.matches(scope, key) {
+			continue
+		}
+		bucketKey := r.bucketKey(key)
+		b, exists := l.buckets[bucketKey]
+		if !exists {
+			b = &bucket{tokens: float64(r.Burst), updated: now, rule: r}
+			l.buckets[bucketKey] = b
+		}
+		b.refill(now)
+		if b.tokens < 1 {
+			return Decision{
+				Rule:       r.Name,
+				RetryAfter: time.Duration((1 - b.tokens) * float64(r.interval)),
+			}
+		}
+		matched = append(matched, b)
+	}
+
+	for _, b := range matched {
+		b.tokens--
+	}
+	return Decision{Allowed: true}
+}
+
+// sweep 定期移除已补满的令牌桶，避免调用方众多时无限增长；调用方需持有锁
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// matchAny 模式列表为空时匹配全部
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package redact
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment JSON 路径的一段
+type segment struct {
+	key       string // 字段名，"*" 匹配任意字段
+	index     int    // 数组下标，-1 匹配任意元素
+	isIndex   bool
+	recursive bool // 以 .. 开头：匹配任意深度
+}
+
+// jsonPath 简化的 JSONPath：$.a.b、$.a[*].b、$.a[0]、$.*.b、$..token
+type jsonPath []segment
+
+// parseJSONPath 解析 JSON 路径，开头的 $ 可省略
+func parseJSONPath(expr string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	if rest == "" {
+		return nil, fmt.Errorf("empty JSON path %q", expr)
+	}
+	if rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var p jsonPath
+	for rest != "" {
+		var seg segment
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			seg.recursive = true
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in JSON path %q", expr)
+			}
+			inner := strings.Trim(rest[1:end], `'" `)
+			rest = rest[end+1:]
+			if inner == "*" {
+				seg.isIndex, seg.index = true, -1
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				seg.isIndex, seg.index = true, n
+			} else if inner != "" {
+				seg.key = inner
+			} else {
+				return nil, fmt.Errorf("empty [] in JSON path %q", expr)
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			seg.key = rest[:end]
+			rest = rest[end:]
+			if seg.key == "" {
+				return nil, fmt.Errorf("empty field name in JSON path %q", expr)
+			}
+		}
+		p = append(p, seg)
+	}
+	return p, nil
+}
+
+// redact 将匹配路径的值替换为 Mask，原地修改 map 和切片
+func (p jsonPath) redact(value interface{}) interface{} {
+	if len(p) == 0 {
+		return Mask
+	}
+	seg := p[0]
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if !seg.isIndex && (seg.key == "*" || seg.key == key) {
+				item = p[1:].redact(item)
+			} else if seg.recursive {
+				item = p.redact(item)
+			}
+			v[key] = item
+		}
+	case []interface{}:
+		for i, item := range v {
+			if seg.isIndex && (seg.index < 0 || seg.index == i) {
+				item = p[1:].redact(item)
+			} else if seg.recursive {
+				item = p.redact(item)
+			}
+			v[i] = item
+		}
+	}
+	return value
+}
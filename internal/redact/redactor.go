@@ -0,0 +1,163 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"McpServer/internal/config"
+)
+
+// Mask 遮蔽后的值
+const Mask = "[REDACTED]"
+
+// pattern 校验后的正则规则
+type pattern struct {
+	name        string
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// Redactor 按配置遮蔽敏感数据：请求头按名称（支持 * 通配，不区分大小写），
+// JSON 值按路径，字符串按正则。所有方法都不修改传入的值
+type Redactor struct {
+	headers  []string // 小写的名称模式
+	paths    []jsonPath
+	patterns []pattern
+}
+
+// New 校验配置并创建遮蔽器
+func New(cfg *config.RedactionConfig) (*Redactor, error) {
+	r := &Redactor{}
+	for i, header := range cfg.Headers {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if _, err := path.Match(header, ""); err != nil || header == "" {
+			return nil, fmt.Errorf("redaction.headers[%d]: invalid header pattern %q", i, cfg.Headers[i])
+		}
+		r.headers = append(r.headers, header)
+	}
+	for i, expr := range cfg.JSONPaths {
+		p, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("redaction.json_paths[%d]: %w", i, err)
+		}
+		r.paths = append(r.paths, p)
+	}
+	for i, p := range cfg.Patterns {
+		regex, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redaction.patterns[%d] (%s): invalid regex: %w", i, p.Name, err)
+		}
+		replacement := p.Replacement
+		if replacement == "" {
+			replacement = Mask
+		}
+		r.patterns = append(r.patterns, pattern{name: p.Name, regex: regex, replacement: replacement})
+	}
+	return r, nil
+}
+
+// SensitiveHeader 请求头的值是否需要遮蔽
+func (r *Redactor) SensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, header := range r.headers {
+		if ok, _ := path.Match(header, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers 返回遮蔽敏感头后的副本，其余头的值按正则遮蔽
+func (r *Redactor) Headers(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for name, values := range header {
+		masked := make([]string, len(values))
+		for i, value := range values {
+			if r.SensitiveHeader(name) {
+				masked[i] = Mask
+			} else {
+				masked[i] = r.String(value)
+			}
+		}
+		result[name] = masked
+	}
+	return result
+}
+
+// String 按正则规则遮蔽字符串
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		s = p.regex.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// Value 遮蔽已解码的 JSON 值（map[string]interface{}、[]interface{}、字符串等）：
+// 匹配 JSON 路径的字段整体遮蔽，其余字符串按正则遮蔽。返回副本
+func (r *Redactor) Value(value interface{}) interface{} {
+	value = copyValue(value)
+	for _, p := range r.paths {
+		value = p.redact(value)
+	}
+	return r.redactStrings(value)
+}
+
+// JSON 遮蔽 JSON 文本，无法解析时按正则遮蔽整段文本
+func (r *Redactor) JSON(data []byte) []byte {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []byte(r.String(string(data)))
+	}
+	result, err := json.Marshal(r.Value(value))
+	if err != nil {
+		return []byte(r.String(string(data)))
+	}
+	return result
+}
+
+// redactStrings 按正则遮蔽值中的全部字符串，原地修改
+func (r *Redactor) redactStrings(value interface{}) interface{} {
+	if len(r.patterns) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = r.redactStrings(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactStrings(item)
+		}
+	}
+	return value
+}
+
+// copyValue 深拷贝 JSON 值中的 map 和切片
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = copyValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = copyValue(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
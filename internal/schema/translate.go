@@ -0,0 +1,274 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+)
+
+// Draft2020 JSON Schema draft 2020-12 的 $schema 标识
+const Draft2020 = "https://json-schema.org/draft/2020-12/schema"
+
+// 包含单个子 schema 的关键字
+var singleSchemaKeywords = []string{
+	"additionalItems", "additionalProperties", "contains", "contentSchema",
+	"else", "if", "not", "propertyNames", "then",
+	"unevaluatedItems", "unevaluatedProperties",
+}
+
+// 包含 schema 数组的关键字
+var arraySchemaKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems"}
+
+// 包含 schema 映射的关键字
+var mapSchemaKeywords = []string{"$defs", "dependentSchemas", "patternProperties", "properties"}
+
+// FromMap 将原始 JSON Schema（任意草案版本）转换为 draft 2020-12 的 jsonschema.Schema
+func FromMap(raw map[string]interface{}) (*jsonschema.Schema, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(TranslateMap(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var s jsonschema.Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal translated schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Translate 将已解析的 schema 转换为 draft 2020-12，保留所有关键字（包括 Extra 中的未知关键字）
+func Translate(s *jsonschema.Schema) (*jsonschema.Schema, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode schema: %w", err)
+	}
+
+	return FromMap(raw)
+}
+
+// TranslateMap 返回 draft-04/06/07/2019-09 schema 的 draft 2020-12 深拷贝，输入不会被修改。
+// 转换规则：
+//   - definitions 合并到 $defs，$ref 中的 #/definitions/ 改写为 #/$defs/
+//   - 数组形式的 items 改为 prefixItems，additionalItems 改为 items
+//   - dependencies 拆分为 dependentRequired 和 dependentSchemas
+//   - draft-04 的布尔 exclusiveMinimum/exclusiveMaximum 改为数值形式，id 改为 $id
+//   - $recursiveRef/$recursiveAnchor 改为 $dynamicRef/$dynamicAnchor
+//
+// 其他关键字原样保留。
+func TranslateMap(raw map[string]interface{}) map[string]interface{} {
+	out := translateNode(raw)
+	if m, ok := out.(map[string]interface{}); ok {
+		return m
+	}
+	return nil
+}
+
+// translateNode 转换一个 schema 位置上的值（对象或布尔 schema）
+func translateNode(node interface{}) interface{} {
+	in, ok := node.(map[string]interface{})
+	if !ok {
+		// 布尔 schema 或非法值，原样保留
+		return deepCopy(node)
+	}
+
+	out := make(map[string]interface{}, len(in))
+	for key, value := range in {
+		out[key] = deepCopy(value)
+	}
+
+	// $schema 统一声明为 2020-12
+	if _, exists := out["$schema"]; exists {
+		out["$schema"] = Draft2020
+	}
+
+	// draft-04: id -> $id
+	if id, ok := out["id"].(string); ok {
+		if _, exists := out["$id"]; !exists {
+			out["$id"] = id
+			delete(out, "id")
+		}
+	}
+
+	// definitions -> $defs（$defs 中已有的同名条目优先）
+	if defs, ok := out["definitions"].(map[string]interface{}); ok {
+		merged, _ := out["$defs"].(map[string]interface{})
+		if merged == nil {
+			merged = make(map[string]interface{}, len(defs))
+		}
+		for name, def := range defs {
+			if _, exists := merged[name]; !exists {
+				merged[name] = def
+			}
+		}
+		out["$defs"] = merged
+		delete(out, "definitions")
+	}
+
+	// $ref 指针改写
+	if ref, ok := out["$ref"].(string); ok {
+		out["$ref"] = translateRef(ref)
+	}
+
+	// 2019-09: $recursiveRef / $recursiveAnchor
+	if ref, ok := out["$recursiveRef"].(string); ok {
+		if _, exists := out["$dynamicRef"]; !exists {
+			out["$dynamicRef"] = ref + "meta"
+			delete(out, "$recursiveRef")
+		}
+	}
+	if anchor, ok := out["$recursiveAnchor"].(bool); ok {
+		if anchor {
+			if _, exists := out["$dynamicAnchor"]; !exists {
+				out["$dynamicAnchor"] = "meta"
+			}
+		}
+		delete(out, "$recursiveAnchor")
+	}
+
+	// items 数组 -> prefixItems，additionalItems -> items
+	if items, ok := out["items"].([]interface{}); ok {
+		if _, exists := out["prefixItems"]; !exists {
+			out["prefixItems"] = items
+			delete(out, "items")
+			if additional, exists := out["additionalItems"]; exists {
+				out["items"] = additional
+				delete(out, "additionalItems")
+			}
+		}
+	}
+
+	// dependencies -> dependentRequired / dependentSchemas
+	if deps, ok := out["dependencies"].(map[string]interface{}); ok {
+		required, _ := out["dependentRequired"].(map[string]interface{})
+		schemas, _ := out["dependentSchemas"].(map[string]interface{})
+		for name, dep := range deps {
+			if list, isList := dep.([]interface{}); isList {
+				if required == nil {
+					required = make(map[string]interface{})
+				}
+				if _, exists := required[name]; !exists {
+					required[name] = list
+				}
+				continue
+			}
+			if schemas == nil {
+				schemas = make(map[string]interface{})
+			}
+			if _, exists := schemas[name]; !exists {
+				schemas[name] = dep
+			}
+		}
+		if required != nil {
+			out["dependentRequired"] = required
+		}
+		if schemas != nil {
+			out["dependentSchemas"] = schemas
+		}
+		delete(out, "dependencies")
+	}
+
+	// draft-04: 布尔 exclusiveMinimum / exclusiveMaximum
+	translateExclusive(out, "exclusiveMinimum", "minimum")
+	translateExclusive(out, "exclusiveMaximum", "maximum")
+
+	// 递归处理子 schema
+	for _, key := range singleSchemaKeywords {
+		if value, exists := out[key]; exists {
+			out[key] = translateNode(value)
+		}
+	}
+	if items, exists := out["items"]; exists {
+		out["items"] = translateNode(items)
+	}
+	for _, key := range arraySchemaKeywords {
+		if list, ok := out[key].([]interface{}); ok {
+			for i, item := range list {
+				list[i] = translateNode(item)
+			}
+		}
+	}
+	for _, key := range mapSchemaKeywords {
+		if m, ok := out[key].(map[string]interface{}); ok {
+			for name, sub := range m {
+				m[name] = translateNode(sub)
+			}
+		}
+	}
+
+	return out
+}
+
+// translateExclusive 将 draft-04 的布尔排他边界转换为数值形式
+func translateExclusive(out map[string]interface{}, exclusiveKey, boundKey string) {
+	exclusive, ok := out[exclusiveKey].(bool)
+	if !ok {
+		return
+	}
+	delete(out, exclusiveKey)
+	if !exclusive {
+		return
+	}
+	if bound, exists := out[boundKey]; exists {
+		out[exclusiveKey] = bound
+		delete(out, boundKey)
+	}
+}
+
+// translateRef 改写 $ref 片段中指向旧关键字的 JSON Pointer
+func translateRef(ref string) string {
+	idx := strings.Index(ref, "#/")
+	if idx < 0 {
+		return ref
+	}
+
+	segments := strings.Split(ref[idx+2:], "/")
+	for i, segment := range segments {
+		switch segment {
+		case "definitions":
+			segments[i] = "$defs"
+		case "items":
+			if i+1 < len(segments) {
+				if _, err := strconv.Atoi(segments[i+1]); err == nil {
+					segments[i] = "prefixItems"
+				}
+			}
+		}
+	}
+	return ref[:idx+2] + strings.Join(segments, "/")
+}
+
+// deepCopy 深拷贝 JSON 值
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = deepCopy(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopy(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
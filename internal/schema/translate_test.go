@@ -0,0 +1,143 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTranslateMap(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{
+			name:   "definitions to $defs",
+			schema: `{"definitions":{"pos":{"type":"integer"}},"properties":{"n":{"$ref":"#/definitions/pos"}}}`,
+			want:   `{"$defs":{"pos":{"type":"integer"}},"properties":{"n":{"$ref":"#/$defs/pos"}}}`,
+		},
+		{
+			name:   "existing $defs entry wins",
+			schema: `{"$defs":{"a":{"type":"string"}},"definitions":{"a":{"type":"integer"},"b":{"type":"boolean"}}}`,
+			want:   `{"$defs":{"a":{"type":"string"},"b":{"type":"boolean"}}}`,
+		},
+		{
+			name:   "items array to prefixItems",
+			schema: `{"type":"array","items":[{"type":"string"},{"type":"integer"}],"additionalItems":false}`,
+			want:   `{"type":"array","prefixItems":[{"type":"string"},{"type":"integer"}],"items":false}`,
+		},
+		{
+			name:   "items object unchanged",
+			schema: `{"type":"array","items":{"type":"string"}}`,
+			want:   `{"type":"array","items":{"type":"string"}}`,
+		},
+		{
+			name:   "dependencies split",
+			schema: `{"dependencies":{"card":["billing"],"name":{"required":["age"]}}}`,
+			want:   `{"dependentRequired":{"card":["billing"]},"dependentSchemas":{"name":{"required":["age"]}}}`,
+		},
+		{
+			name:   "$recursiveRef to $dynamicRef",
+			schema: `{"$recursiveAnchor":true,"properties":{"child":{"$recursiveRef":"#"}}}`,
+			want:   `{"$dynamicAnchor":"meta","properties":{"child":{"$dynamicRef":"#meta"}}}`,
+		},
+		{
+			name:   "exclusive bounds",
+			schema: `{"minimum":0,"exclusiveMinimum":true,"maximum":10,"exclusiveMaximum":false}`,
+			want:   `{"exclusiveMinimum":0,"maximum":10}`,
+		},
+		{
+			name:   "numeric exclusive bounds unchanged",
+			schema: `{"exclusiveMinimum":0,"exclusiveMaximum":10}`,
+			want:   `{"exclusiveMinimum":0,"exclusiveMaximum":10}`,
+		},
+		{
+			name:   "draft-04 id and $schema",
+			schema: `{"$schema":"http://json-schema.org/draft-04/schema#","id":"urn:example"}`,
+			want:   `{"$schema":"https://json-schema.org/draft/2020-12/schema","$id":"urn:example"}`,
+		},
+		{
+			name:   "nested subschemas",
+			schema: `{"anyOf":[{"items":[{"$ref":"#/definitions/a"}]}],"properties":{"p":{"not":{"definitions":{"x":{}}}}}}`,
+			want:   `{"anyOf":[{"prefixItems":[{"$ref":"#/$defs/a"}]}],"properties":{"p":{"not":{"$defs":{"x":{}}}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := mustSchema(t, tt.schema)
+			got := TranslateMap(raw)
+			if want := mustSchema(t, tt.want); !reflect.DeepEqual(got, want) {
+				data, _ := json.Marshal(got)
+				t.Errorf("TranslateMap() = %s, want %s", data, tt.want)
+			}
+			if original := mustSchema(t, tt.schema); !reflect.DeepEqual(raw, original) {
+				t.Errorf("TranslateMap() modified its input")
+			}
+		})
+	}
+}
+
+func TestTranslateRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "#/definitions/pos", want: "#/$defs/pos"},
+		{ref: "other.json#/definitions/pos", want: "other.json#/$defs/pos"},
+		{ref: "#/properties/list/items/0", want: "#/properties/list/prefixItems/0"},
+		{ref: "#/properties/list/items", want: "#/properties/list/items"},
+		{ref: "#/properties/items/type", want: "#/properties/items/type"},
+		{ref: "#/definitions/a/items/1/definitions/b", want: "#/$defs/a/prefixItems/1/$defs/b"},
+		{ref: "#anchor", want: "#anchor"},
+		{ref: "other.json", want: "other.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := translateRef(tt.ref); got != tt.want {
+				t.Errorf("translateRef(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateNodeBoolean(t *testing.T) {
+	for _, node := range []interface{}{true, false} {
+		if got := translateNode(node); got != node {
+			t.Errorf("translateNode(%v) = %v, want it unchanged", node, got)
+		}
+	}
+}
+
+func TestFromMapAndTranslate(t *testing.T) {
+	raw := mustSchema(t, `{"type":"object","definitions":{"pos":{"type":"integer","minimum":0,"exclusiveMinimum":true}},"properties":{"n":{"$ref":"#/definitions/pos"}}}`)
+
+	s, err := FromMap(raw)
+	if err != nil {
+		t.Fatalf("FromMap() error = %v", err)
+	}
+	pos := s.Defs["pos"]
+	if pos == nil || pos.ExclusiveMinimum == nil || *pos.ExclusiveMinimum != 0 || pos.Minimum != nil {
+		t.Fatalf("FromMap() $defs.pos = %+v, want exclusiveMinimum 0", pos)
+	}
+	if ref := s.Properties["n"].Ref; ref != "#/$defs/pos" {
+		t.Errorf("FromMap() properties.n.$ref = %q, want #/$defs/pos", ref)
+	}
+
+	again, err := Translate(s)
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if !reflect.DeepEqual(again, s) {
+		t.Errorf("Translate() of a 2020-12 schema = %+v, want it unchanged", again)
+	}
+
+	if s, err := FromMap(nil); s != nil || err != nil {
+		t.Errorf("FromMap(nil) = %v, %v, want nil, nil", s, err)
+	}
+	if s, err := Translate(nil); s != nil || err != nil {
+		t.Errorf("Translate(nil) = %v, %v, want nil, nil", s, err)
+	}
+}
@@ -0,0 +1,552 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Violation 描述一处不符合 schema 的参数
+type Violation struct {
+	Path    string `json:"path"`    // 实例中的 JSON Pointer，根为 ""
+	Keyword string `json:"keyword"` // 触发失败的 schema 关键字
+	Message string `json:"message"`
+
+	// schemaError 由 schema 自身的问题（无法解析的 $ref、嵌套过深、非法正则）导致，
+	// 出现在 anyOf/oneOf/not 等子 schema 中时同样上报，不能被当作"不匹配"而放行
+	schemaError bool
+}
+
+// String 返回便于阅读的错误描述
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s", path, v.Message)
+}
+
+// Validator 基于 draft 2020-12 schema 校验参数并收集全部违规项。
+// schema 中无法解析的 $ref、超过 maxDepth 的嵌套和非法正则视为校验失败，不放行实例
+type Validator struct {
+	root     map[string]interface{}
+	patterns sync.Map // pattern -> *regexp.Regexp
+}
+
+// NewValidator 根据原始 schema（任意草案版本）创建校验器
+func NewValidator(raw map[string]interface{}) *Validator {
+	if raw == nil {
+		return nil
+	}
+	return &Validator{root: TranslateMap(raw)}
+}
+
+// Validate 校验实例，返回全部违规项；实例合法时返回 nil
+func (v *Validator) Validate(instance interface{}) []Violation {
+	if v == nil {
+		return nil
+	}
+	var violations []Violation
+	v.validate(v.root, normalize(instance), "", &violations, 0)
+	return violations
+}
+
+// ApplyDefaults 为对象中缺失的属性填充 schema 中声明的 default 值（递归处理嵌套对象）
+func (v *Validator) ApplyDefaults(instance map[string]interface{}) {
+	if v == nil || instance == nil {
+		return
+	}
+	v.applyDefaults(v.root, instance, 0)
+}
+
+// maxDepth 防止 $ref 循环导致无限递归，超过时校验失败
+const maxDepth = 64
+
+func (v *Validator) applyDefaults(node interface{}, instance map[string]interface{}, depth int) {
+	s := v.deref(node, depth)
+	if s == nil || depth > maxDepth {
+		return
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	for name, prop := range properties {
+		propSchema := v.deref(prop, depth+1)
+		if propSchema == nil {
+			continue
+		}
+		if _, exists := instance[name]; !exists {
+			if def, ok := propSchema["default"]; ok {
+				instance[name] = deepCopy(def)
+			}
+		}
+		if child, ok := instance[name].(map[string]interface{}); ok {
+			v.applyDefaults(propSchema, child, depth+1)
+		}
+	}
+
+	if list, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range list {
+			v.applyDefaults(sub, instance, depth+1)
+		}
+	}
+}
+
+// deref 返回节点对应的 schema 对象；节点自身未声明 properties 时跟随本地 $ref
+func (v *Validator) deref(node interface{}, depth int) map[string]interface{} {
+	s, ok := node.(map[string]interface{})
+	if !ok || depth > maxDepth {
+		return nil
+	}
+	if _, hasProperties := s["properties"]; hasProperties {
+		return s
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		if target, found := v.resolveRef(ref); found {
+			return v.deref(target, depth+1)
+		}
+	}
+	return s
+}
+
+// resolveRef 解析本地 JSON Pointer 引用（形如 #/$defs/name）
+func (v *Validator) resolveRef(ref string) (interface{}, bool) {
+	if ref == "#" {
+		return v.root, true
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+
+	var current interface{} = v.root
+	for _, segment := range strings.Split(ref[2:], "/") {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, exists := node[segment]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (v *Validator) validate(node interface{}, instance interface{}, path string, out *[]Violation, depth int) {
+	if depth > maxDepth {
+		addSchemaError(out, Violation{Path: path, Keyword: "$ref", Message: fmt.Sprintf("schema nesting exceeds %d levels", maxDepth)})
+		return
+	}
+
+	// 布尔 schema
+	if b, ok := node.(bool); ok {
+		if !b {
+			*out = append(*out, Violation{Path: path, Keyword: "false", Message: "no value is allowed here"})
+		}
+		return
+	}
+	s, ok := node.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	addf := func(keyword, format string, args ...interface{}) {
+		*out = append(*out, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		if target, found := v.resolveRef(ref); found {
+			v.validate(target, instance, path, out, depth+1)
+		} else {
+			addSchemaError(out, Violation{Path: path, Keyword: "$ref", Message: fmt.Sprintf("schema reference %q cannot be resolved", ref)})
+		}
+	}
+
+	// type
+	if t, exists := s["type"]; exists {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []interface{}:
+			for _, item := range tv {
+				if str, ok := item.(string); ok {
+					types = append(types, str)
+				}
+			}
+		}
+		if len(types) > 0 && !matchesAnyType(instance, types) {
+			addf("type", "expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(instance))
+			// 类型不符时其余关键字的错误只会是噪音
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if equalJSON(candidate, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addf("enum", "must be one of %s", compactJSON(enum))
+		}
+	}
+	if constant, exists := s["const"]; exists && !equalJSON(constant, instance) {
+		addf("const", "must be %s", compactJSON(constant))
+	}
+
+	switch value := instance.(type) {
+	case float64:
+		v.validateNumber(s, value, addf)
+	case string:
+		v.validateString(s, value, path, out, addf)
+	case []interface{}:
+		v.validateArray(s, value, path, out, depth, addf)
+	case map[string]interface{}:
+		v.validateObject(s, value, path, out, depth, addf)
+	}
+
+	// 组合关键字
+	if list, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range list {
+			v.validate(sub, instance, path, out, depth+1)
+		}
+	}
+	if list, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range list {
+			if v.isValid(sub, instance, path, out, depth) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addf("anyOf", "must match at least one of the allowed schemas")
+		}
+	}
+	if list, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range list {
+			if v.isValid(sub, instance, path, out, depth) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			addf("oneOf", "must match exactly one of the allowed schemas (matched %d)", matches)
+		}
+	}
+	if not, exists := s["not"]; exists && v.isValid(not, instance, path, out, depth) {
+		addf("not", "must not match the disallowed schema")
+	}
+	if cond, exists := s["if"]; exists {
+		if v.isValid(cond, instance, path, out, depth) {
+			if then, ok := s["then"]; ok {
+				v.validate(then, instance, path, out, depth+1)
+			}
+		} else if els, ok := s["else"]; ok {
+			v.validate(els, instance, path, out, depth+1)
+		}
+	}
+}
+
+// isValid 判断实例是否满足子 schema，只记录其中由 schema 自身问题导致的违规项
+func (v *Validator) isValid(node interface{}, instance interface{}, path string, out *[]Violation, depth int) bool {
+	var violations []Violation
+	v.validate(node, instance, path, &violations, depth+1)
+	for _, violation := range violations {
+		if violation.schemaError {
+			addSchemaError(out, violation)
+		}
+	}
+	return len(violations) == 0
+}
+
+// addSchemaError 记录 schema 自身问题导致的违规项，同一问题只记录一次
+func addSchemaError(out *[]Violation, violation Violation) {
+	violation.schemaError = true
+	if !slices.Contains(*out, violation) {
+		*out = append(*out, violation)
+	}
+}
+
+func (v *Validator) validateNumber(s map[string]interface{}, value float64, addf func(string, string, ...interface{})) {
+	if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+		if q := value / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			addf("multipleOf", "must be a multiple of %v", m)
+		}
+	}
+	if limit, ok := s["minimum"].(float64); ok && value < limit {
+		addf("minimum", "must be >= %v", limit)
+	}
+	if limit, ok := s["maximum"].(float64); ok && value > limit {
+		addf("maximum", "must be <= %v", limit)
+	}
+	if limit, ok := s["exclusiveMinimum"].(float64); ok && value <= limit {
+		addf("exclusiveMinimum", "must be > %v", limit)
+	}
+	if limit, ok := s["exclusiveMaximum"].(float64); ok && value >= limit {
+		addf("exclusiveMaximum", "must be < %v", limit)
+	}
+}
+
+func (v *Validator) validateString(s map[string]interface{}, value string, path string, out *[]Violation, addf func(string, string, ...interface{})) {
+	length := utf8.RuneCountInString(value)
+	if limit, ok := intKeyword(s, "minLength"); ok && length < limit {
+		addf("minLength", "must be at least %d characters long", limit)
+	}
+	if limit, ok := intKeyword(s, "maxLength"); ok && length > limit {
+		addf("maxLength", "must be at most %d characters long", limit)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if re := v.compile(pattern); re == nil {
+			addSchemaError(out, Violation{Path: path, Keyword: "pattern", Message: fmt.Sprintf("schema pattern %q is not a valid regular expression", pattern)})
+		} else if !re.MatchString(value) {
+			addf("pattern", "must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *Validator) validateArray(s map[string]interface{}, value []interface{}, path string, out *[]Violation, depth int, addf func(string, string, ...interface{})) {
+	if limit, ok := intKeyword(s, "minItems"); ok && len(value) < limit {
+		addf("minItems", "must contain at least %d items", limit)
+	}
+	if limit, ok := intKeyword(s, "maxItems"); ok && len(value) > limit {
+		addf("maxItems", "must contain at most %d items", limit)
+	}
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+	outer:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if equalJSON(value[i], value[j]) {
+					addf("uniqueItems", "items at index %d and %d are equal", i, j)
+					break outer
+				}
+			}
+		}
+	}
+
+	prefix, _ := s["prefixItems"].([]interface{})
+	for i, item := range value {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(prefix) {
+			v.validate(prefix[i], item, itemPath, out, depth+1)
+		} else if items, exists := s["items"]; exists {
+			v.validate(items, item, itemPath, out, depth+1)
+		}
+	}
+
+	if contains, exists := s["contains"]; exists {
+		matches := 0
+		for i, item := range value {
+			if v.isValid(contains, item, path+"/"+strconv.Itoa(i), out, depth) {
+				matches++
+			}
+		}
+		minContains, hasMin := intKeyword(s, "minContains")
+		if !hasMin {
+			minContains = 1
+		}
+		if matches < minContains {
+			addf("contains", "must contain at least %d matching items (found %d)", minContains, matches)
+		}
+		if maxContains, ok := intKeyword(s, "maxContains"); ok && matches > maxContains {
+			addf("maxContains", "must contain at most %d matching items (found %d)", maxContains, matches)
+		}
+	}
+}
+
+func (v *Validator) validateObject(s map[string]interface{}, value map[string]interface{}, path string, out *[]Violation, depth int, addf func(string, string, ...interface{})) {
+	if limit, ok := intKeyword(s, "minProperties"); ok && len(value) < limit {
+		addf("minProperties", "must have at least %d properties", limit)
+	}
+	if limit, ok := intKeyword(s, "maxProperties"); ok && len(value) > limit {
+		addf("maxProperties", "must have at most %d properties", limit)
+	}
+
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, name := range required {
+			if str, ok := name.(string); ok {
+				if _, exists := value[str]; !exists {
+					*out = append(*out, Violation{
+						Path:    path + "/" + escapePointer(str),
+						Keyword: "required",
+						Message: "required property is missing",
+					})
+				}
+			}
+		}
+	}
+
+	if deps, ok := s["dependentRequired"].(map[string]interface{}); ok {
+		for name, list := range deps {
+			if _, exists := value[name]; !exists {
+				continue
+			}
+			names, _ := list.([]interface{})
+			for _, dep := range names {
+				if str, ok := dep.(string); ok {
+					if _, exists := value[str]; !exists {
+						addf("dependentRequired", "property %q is required when %q is present", str, name)
+					}
+				}
+			}
+		}
+	}
+	if deps, ok := s["dependentSchemas"].(map[string]interface{}); ok {
+		for name, sub := range deps {
+			if _, exists := value[name]; exists {
+				v.validate(sub, value, path, out, depth+1)
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patternProperties, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	propertyNames, hasPropertyNames := s["propertyNames"]
+
+	// 按名称排序，保证违规项顺序稳定
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := value[name]
+		itemPath := path + "/" + escapePointer(name)
+
+		if hasPropertyNames && !v.isValid(propertyNames, name, itemPath, out, depth) {
+			*out = append(*out, Violation{Path: itemPath, Keyword: "propertyNames", Message: "property name is not allowed"})
+		}
+
+		matched := false
+		if prop, exists := properties[name]; exists {
+			matched = true
+			v.validate(prop, item, itemPath, out, depth+1)
+		}
+		for pattern, sub := range patternProperties {
+			re := v.compile(pattern)
+			if re == nil {
+				addSchemaError(out, Violation{Path: path, Keyword: "patternProperties", Message: fmt.Sprintf("schema pattern %q is not a valid regular expression", pattern)})
+				continue
+			}
+			if re.MatchString(name) {
+				matched = true
+				v.validate(sub, item, itemPath, out, depth+1)
+			}
+		}
+		if !matched && hasAdditional {
+			if b, ok := additional.(bool); ok && !b {
+				*out = append(*out, Violation{Path: itemPath, Keyword: "additionalProperties", Message: "unknown property"})
+			} else {
+				v.validate(additional, item, itemPath, out, depth+1)
+			}
+		}
+	}
+}
+
+// compile 编译并缓存正则表达式，非法正则返回 nil
+func (v *Validator) compile(pattern string) *regexp.Regexp {
+	if cached, ok := v.patterns.Load(pattern); ok {
+		re, _ := cached.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	v.patterns.Store(pattern, re)
+	return re
+}
+
+// normalize 将实例统一为 encoding/json 解码后的表示形式（数字为 float64）
+func normalize(instance interface{}) interface{} {
+	switch instance.(type) {
+	case nil, bool, float64, string, map[string]interface{}, []interface{}:
+		return instance
+	}
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return instance
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return instance
+	}
+	return out
+}
+
+func matchesAnyType(instance interface{}, types []string) bool {
+	actual := jsonTypeOf(instance)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(instance interface{}) string {
+	switch value := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) && !math.IsInf(value, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", instance)
+	}
+}
+
+func intKeyword(s map[string]interface{}, key string) (int, bool) {
+	if f, ok := s[key].(float64); ok {
+		return int(f), true
+	}
+	return 0, false
+}
+
+func equalJSON(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func escapePointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
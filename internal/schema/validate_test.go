@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustSchema(t *testing.T, text string) map[string]interface{} {
+	t.Helper()
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		keywords []string // 期望的违规项关键字，空表示合法
+	}{
+		{
+			name:     "valid object",
+			schema:   `{"type":"object","properties":{"n":{"type":"integer","minimum":1}},"required":["n"]}`,
+			instance: `{"n":3}`,
+		},
+		{
+			name:     "collects all violations",
+			schema:   `{"type":"object","properties":{"n":{"type":"integer","minimum":1},"s":{"type":"string","maxLength":2}},"required":["n","x"],"additionalProperties":false}`,
+			instance: `{"n":0,"s":"abc","extra":true}`,
+			keywords: []string{"required", "additionalProperties", "minimum", "maxLength"},
+		},
+		{
+			name:     "local ref",
+			schema:   `{"$defs":{"pos":{"type":"integer","minimum":0}},"type":"object","properties":{"n":{"$ref":"#/$defs/pos"}}}`,
+			instance: `{"n":-1}`,
+			keywords: []string{"minimum"},
+		},
+		{
+			name:     "draft-07 definitions ref",
+			schema:   `{"definitions":{"pos":{"type":"integer","minimum":0}},"type":"object","properties":{"n":{"$ref":"#/definitions/pos"}}}`,
+			instance: `{"n":-1}`,
+			keywords: []string{"minimum"},
+		},
+		{
+			name:     "recursive ref within depth",
+			schema:   `{"type":"object","properties":{"child":{"$ref":"#"},"v":{"type":"string"}}}`,
+			instance: `{"child":{"child":{"v":1}}}`,
+			keywords: []string{"type"},
+		},
+		{
+			name:     "unresolvable local ref",
+			schema:   `{"type":"object","properties":{"n":{"$ref":"#/$defs/missing"}}}`,
+			instance: `{"n":1}`,
+			keywords: []string{"$ref"},
+		},
+		{
+			name:     "remote ref",
+			schema:   `{"$ref":"https://example.com/schema.json"}`,
+			instance: `{}`,
+			keywords: []string{"$ref"},
+		},
+		{
+			name:     "unresolvable ref inside not",
+			schema:   `{"not":{"$ref":"#/$defs/missing"}}`,
+			instance: `{}`,
+			keywords: []string{"$ref"},
+		},
+		{
+			name:     "unresolvable ref inside anyOf",
+			schema:   `{"anyOf":[{"$ref":"#/$defs/missing"},{"$ref":"#/$defs/missing"}]}`,
+			instance: `{}`,
+			keywords: []string{"$ref", "anyOf"},
+		},
+		{
+			name:     "ref cycle exceeds max depth",
+			schema:   `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`,
+			instance: `{}`,
+			keywords: []string{"$ref"},
+		},
+		{
+			name:     "ref cycle inside not",
+			schema:   `{"$defs":{"loop":{"$ref":"#/$defs/loop"}},"not":{"$ref":"#/$defs/loop"}}`,
+			instance: `{}`,
+			keywords: []string{"$ref"},
+		},
+		{
+			name:     "invalid pattern",
+			schema:   `{"type":"string","pattern":"("}`,
+			instance: `"abc"`,
+			keywords: []string{"pattern"},
+		},
+		{
+			name:     "invalid patternProperties",
+			schema:   `{"type":"object","patternProperties":{"(":{"type":"string"}}}`,
+			instance: `{"a":1}`,
+			keywords: []string{"patternProperties"},
+		},
+		{
+			name:     "oneOf matches two",
+			schema:   `{"oneOf":[{"type":"integer"},{"type":"number"}]}`,
+			instance: `1`,
+			keywords: []string{"oneOf"},
+		},
+		{
+			name:     "if then else",
+			schema:   `{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["a"]},"else":{"required":["b"]}}`,
+			instance: `{"kind":"a"}`,
+			keywords: []string{"required"},
+		},
+		{
+			name:     "false schema",
+			schema:   `{"type":"object","properties":{"x":false}}`,
+			instance: `{"x":1}`,
+			keywords: []string{"false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var instance interface{}
+			if err := json.Unmarshal([]byte(tt.instance), &instance); err != nil {
+				t.Fatal(err)
+			}
+			violations := NewValidator(mustSchema(t, tt.schema)).Validate(instance)
+
+			got := make([]string, 0, len(violations))
+			for _, violation := range violations {
+				got = append(got, violation.Keyword)
+			}
+			if len(got) != len(tt.keywords) {
+				t.Fatalf("Validate() keywords = %v, want %v (%v)", got, tt.keywords, violations)
+			}
+			for i := range got {
+				if got[i] != tt.keywords[i] {
+					t.Fatalf("Validate() keywords = %v, want %v (%v)", got, tt.keywords, violations)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	v := NewValidator(mustSchema(t, `{
+		"$defs": {"opts": {"type": "object", "properties": {"depth": {"default": 2}}, "default": {}}},
+		"type": "object",
+		"properties": {
+			"limit": {"type": "integer", "default": 10},
+			"opts": {"$ref": "#/$defs/opts"}
+		}
+	}`))
+
+	args := map[string]interface{}{"limit": float64(5)}
+	v.ApplyDefaults(args)
+
+	data, _ := json.Marshal(args)
+	if want := `{"limit":5,"opts":{"depth":2}}`; string(data) != want {
+		t.Errorf("ApplyDefaults() = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"McpServer/internal/config"
+	"McpServer/internal/models"
+)
+
+// keySize 主密钥长度（AES-256）
+const keySize = 32
+
+// masterKey 一个主密钥
+type masterKey struct {
+	id   string // 密钥指纹，写入 secrets.key_id
+	aead cipher.AEAD
+}
+
+// keyRing 当前主密钥用于加密，轮换前的旧密钥只用于解密
+type keyRing struct {
+	current *masterKey
+	keys    map[string]*masterKey // key_id -> 密钥
+}
+
+// loadKeyRing 按配置读取主密钥：key_env 环境变量优先，其次 key_file；都未设置时返回 ErrNoKey。
+// 读取后从本进程的环境中删除 key_env，避免被启动的 stdio 进程继承
+func loadKeyRing(cfg *config.SecretsConfig) (*keyRing, error) {
+	var encoded, source string
+	if value := os.Getenv(cfg.KeyEnv); value != "" {
+		encoded, source = value, "environment variable "+cfg.KeyEnv
+		os.Unsetenv(cfg.KeyEnv)
+	} else if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets key file: %w", err)
+		}
+		encoded, source = string(data), cfg.KeyFile
+	} else {
+		return nil, ErrNoKey
+	}
+
+	current, err := newMasterKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key in %s: %w", source, err)
+	}
+	ring := &keyRing{
+		current: current,
+		keys:    map[string]*masterKey{current.id: current},
+	}
+
+	for _, file := range cfg.PreviousKeyFiles {
+		data, err1 := os.ReadFile(file)
+		if err1 != nil {
+			return nil, fmt.Errorf("failed to read previous secrets key file: %w", err1)
+		}
+		key, err1 := newMasterKey(string(data))
+		if err1 != nil {
+			return nil, fmt.Errorf("invalid previous secrets key in %s: %w", file, err1)
+		}
+		ring.keys[key.id] = key
+	}
+	return ring, nil
+}
+
+// newMasterKey 解析 base64 或 hex 编码的 32 字节密钥
+func newMasterKey(encoded string) (*masterKey, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	var raw []byte
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(encoded); err == nil && len(decoded) == keySize {
+			raw = decoded
+			break
+		}
+	}
+	if raw == nil {
+		if decoded, err := hex.DecodeString(encoded); err == nil && len(decoded) == keySize {
+			raw = decoded
+		}
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("key must be %d bytes encoded as base64 or hex", keySize)
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// encrypt 用当前主密钥加密，密钥名称作为附加数据，密文不能被挪用到其他名称下
+func (r *keyRing) encrypt(secret *models.Secret, plaintext string) error {
+	nonce := make([]byte, r.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	secret.Nonce = nonce
+	secret.Ciphertext = r.current.aead.Seal(nil, nonce, []byte(plaintext), []byte(secret.Name))
+	secret.KeyID = r.current.id
+	return nil
+}
+
+// decrypt 按 key_id 选择主密钥解密
+func (r *keyRing) decrypt(secret *models.Secret) (string, error) {
+	key, ok := r.keys[secret.KeyID]
+	if !ok {
+		return "", fmt.Errorf("secret %s is encrypted with unknown key %s", secret.Name, secret.KeyID)
+	}
+	plaintext, err := key.aead.Open(nil, secret.Nonce, secret.Ciphertext, []byte(secret.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", secret.Name, err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,250 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"McpServer/internal/config"
+	"McpServer/internal/logger"
+	"McpServer/internal/models"
+)
+
+// RefPrefix 配置值以此开头时表示引用 secrets 表中的密钥，如 secret://github-token
+const RefPrefix = "secret://"
+
+var (
+	// ErrNoKey 未配置主密钥，密钥存储不可用
+	ErrNoKey = errors.New("no secrets master key configured")
+	// ErrNotFound 密钥不存在
+	ErrNotFound = errors.New("secret not found")
+
+	// namePattern 密钥名称，与 secrets 表的约束一致
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+)
+
+// Store secrets 表的数据库操作，读取方法在记录不存在时返回 nil
+type Store interface {
+	GetSecret(name string) (*models.Secret, error)
+	ListSecrets() ([]models.Secret, error)
+	UpsertSecret(secret *models.Secret) error
+	ReencryptSecret(secret *models.Secret) (bool, error)
+	DeleteSecret(name string) (bool, error)
+}
+
+// cacheEntry 缓存的明文
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Manager 加密密钥存储：设置、轮换和解析 secret:// 引用。解密后的值会登记到日志遮蔽中
+type Manager struct {
+	store Store
+	keys  *keyRing
+	ttl   time.Duration
+
+	mutex sync.Mutex
+	cache map[string]cacheEntry // 名称 -> 明文
+}
+
+// NewManager 加载主密钥并创建密钥存储，未配置主密钥时返回 ErrNoKey
+func NewManager(cfg *config.SecretsConfig, store Store) (*Manager, error) {
+	keys, err := loadKeyRing(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Secrets store enabled (key: %s, previous keys: %d)", keys.current.id, len(keys.keys)-1)
+	return &Manager{
+		store: store,
+		keys:  keys,
+		ttl:   cfg.CacheTTL,
+		cache: make(map[string]cacheEntry),
+	}, nil
+}
+
+// ValidName 判断密钥名称是否合法
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// ParseRef 解析 secret://name 引用，不是引用时返回 false
+func ParseRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, RefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, RefPrefix), true
+}
+
+// Set 创建或替换密钥，返回不含明文的记录
+func (m *Manager) Set(name, description, value string) (*models.Secret, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid secret name %q", name)
+	}
+
+	secret := &models.Secret{Name: name, Description: description}
+	if err := m.keys.encrypt(secret, value); err != nil {
+		return nil, err
+	}
+	if err := m.store.UpsertSecret(secret); err != nil {
+		return nil, err
+	}
+
+	logger.RegisterSecret(value)
+	m.mutex.Lock()
+	m.cache[name] = cacheEntry{value: value, expiresAt: time.Now().Add(m.ttl)}
+	m.mutex.Unlock()
+
+	logger.Info("Secret %s set (version %d)", name, secret.Version)
+	return secret, nil
+}
+
+// Rotate 替换已存在密钥的值，保留描述；密钥不存在时返回 ErrNotFound
+func (m *Manager) Rotate(name, value string) (*models.Secret, error) {
+	existing, err := m.store.GetSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, ErrNotFound
+	}
+	return m.Set(name, existing.Description, value)
+}
+
+// Describe 返回密钥的元数据，不存在时返回 nil
+func (m *Manager) Describe(name string) (*models.Secret, error) {
+	return m.store.GetSecret(name)
+}
+
+// List 列出全部密钥的元数据
+func (m *Manager) List() ([]models.Secret, error) {
+	return m.store.ListSecrets()
+}
+
+// Delete 删除密钥，不存在时返回 false
+func (m *Manager) Delete(name string) (bool, error) {
+	found, err := m.store.DeleteSecret(name)
+	if err != nil {
+		return false, err
+	}
+	m.mutex.Lock()
+	delete(m.cache, name)
+	m.mutex.Unlock()
+	if found {
+		logger.Info("Secret %s deleted", name)
+	}
+	return found, nil
+}
+
+// Get 返回密钥明文，结果按 cache_ttl 缓存
+func (m *Manager) Get(name string) (string, error) {
+	now := time.Now()
+	m.mutex.Lock()
+	entry, ok := m.cache[name]
+	m.mutex.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	secret, err := m.store.GetSecret(name)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	value, err := m.keys.decrypt(secret)
+	if err != nil {
+		return "", err
+	}
+
+	logger.RegisterSecret(value)
+	m.mutex.Lock()
+	m.cache[name] = cacheEntry{value: value, expiresAt: now.Add(m.ttl)}
+	m.mutex.Unlock()
+	return value, nil
+}
+
+// Resolve 返回 values 的副本，其中的 secret://name 字符串（包括嵌套对象和数组中的）替换为密钥明文
+func (m *Manager) Resolve(values models.JSONB) (models.JSONB, error) {
+	if values == nil {
+		return nil, nil
+	}
+	resolved, err := m.resolveValue(values)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSONB(resolved.(map[string]interface{})), nil
+}
+
+func (m *Manager) resolveValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if name, ok := ParseRef(v); ok {
+			return m.Get(name)
+		}
+		return v, nil
+	case models.JSONB:
+		return m.resolveValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := m.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := m.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// Rekey 用当前主密钥重新加密其他主密钥加密的密钥，返回重新加密的数量。
+// 完成后即可从 previous_key_files 中移除旧密钥
+func (m *Manager) Rekey() (int, error) {
+	secrets, err := m.store.ListSecrets()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range secrets {
+		secret := &secrets[i]
+		if secret.KeyID == m.keys.current.id {
+			continue
+		}
+		value, err1 := m.keys.decrypt(secret)
+		if err1 != nil {
+			return count, err1
+		}
+		if err1 = m.keys.encrypt(secret, value); err1 != nil {
+			return count, err1
+		}
+		updated, err1 := m.store.ReencryptSecret(secret)
+		if err1 != nil {
+			return count, err1
+		}
+		if !updated {
+			logger.Warn("Secret %s changed during re-encryption, skipping it", secret.Name)
+			continue
+		}
+		count++
+	}
+
+	logger.Info("Re-encrypted %d secrets with key %s", count, m.keys.current.id)
+	return count, nil
+}
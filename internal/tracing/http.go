@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	spanKindServer = trace.SpanKindServer
+	spanKindClient = trace.SpanKindClient
+)
+
+// Middleware 为每个入站 HTTP 请求创建 server span：接受调用方的 traceparent，
+// 按 ServeMux 匹配到的路由命名，记录响应状态码
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := ExtractHeaders(r.Context(), r.Header)
+		ctx, span := Start(ctx, "HTTP "+r.Method, spanKindServer, httpRequestAttributes(r)...)
+		defer span.End()
+
+		recorder := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(recorder, r)
+
+		// ServeMux 在路由时设置 r.Pattern，如 "POST /admin/services/{id}"
+		if route := r.Pattern; route != "" {
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		setStatusCode(span, recorder.status)
+	})
+}
+
+// statusWriter 记录响应状态码，并保留 SSE 需要的 Flush
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func httpRequestAttributes(r *http.Request) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+		attribute.String("server.address", r.URL.Host),
+	}
+}
+
+// setStatusCode 记录响应状态码，5xx 标记为失败
+func setStatusCode(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		Fail(span, fmt.Sprintf("HTTP %d", status))
+	}
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithoutSpan 返回去掉 span 但保留其他值的 context。SSE 连接的 MCP 会话以连接请求的 context 运行，
+// 会话内的请求不应成为长连接 span 的子 span
+func WithoutSpan(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+}
+
+// InjectMessage 将 ctx 中的 trace 上下文写入 JSON-RPC 请求的 params._meta，
+// 使经 SSE 连接处理的 MCP 请求成为投递它的 HTTP 请求的子 span。
+// 消息已带 traceparent、不是带 params 对象的请求或 ctx 中没有 span 时原样返回；其余字段不重新编码
+func InjectMessage(ctx context.Context, body []byte) []byte {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return body
+	}
+
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(body, &message); err != nil || message["method"] == nil {
+		return body
+	}
+	var params map[string]json.RawMessage
+	if raw, ok := message["params"]; !ok || json.Unmarshal(raw, &params) != nil || params == nil {
+		return body
+	}
+	var meta map[string]any
+	if raw, ok := params["_meta"]; ok && json.Unmarshal(raw, &meta) != nil {
+		return body
+	}
+	if _, ok := meta["traceparent"]; ok {
+		return body
+	}
+
+	metaJSON, err := json.Marshal(InjectMeta(ctx, meta))
+	if err != nil {
+		return body
+	}
+	params["_meta"] = metaJSON
+	if message["params"], err = json.Marshal(params); err != nil {
+		return body
+	}
+	result, err := json.Marshal(message)
+	if err != nil {
+		return body
+	}
+	return result
+}
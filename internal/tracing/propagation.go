@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InjectHeaders 将 ctx 中的 trace 上下文写入 HTTP 头（traceparent、tracestate、baggage）
+func InjectHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractHeaders 从 HTTP 头读取调用方的 trace 上下文
+func ExtractHeaders(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// metaCarrier 以 MCP 请求的 _meta 为载体传播 trace 上下文，键与 HTTP 头相同（traceparent 等）
+type metaCarrier map[string]any
+
+func (c metaCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c metaCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectMeta 将 ctx 中的 trace 上下文写入 _meta，meta 为 nil 时新建；没有可传播的上下文时返回原 meta
+func InjectMeta(ctx context.Context, meta map[string]any) map[string]any {
+	carrier := metaCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return meta
+	}
+	if meta == nil {
+		meta = make(map[string]any, len(carrier))
+	}
+	for key, value := range carrier {
+		meta[key] = value
+	}
+	return meta
+}
+
+// ExtractMeta 从 MCP 请求的 _meta 读取调用方的 trace 上下文，没有时返回原 ctx
+func ExtractMeta(ctx context.Context, meta map[string]any) context.Context {
+	if len(meta) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, metaCarrier(meta))
+}
+
+// Transport 包装 RoundTripper，为每个出站请求创建 client span 并写入 trace 上下文头
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method, spanKindClient, httpRequestAttributes(req)...)
+	defer span.End()
+
+	// RoundTripper 不应修改原请求
+	req = req.Clone(ctx)
+	InjectHeaders(ctx, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	setStatusCode(span, resp.StatusCode)
+	return resp, nil
+}
+
+// Detach 返回只携带 ctx 中 span 的新 context，用于不应随入站请求取消、但仍属于同一 trace 的出站请求
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
@@ -1,24 +1,38 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"McpServer/internal/admin"
+	"McpServer/internal/audit"
 	"McpServer/internal/auth"
+	"McpServer/internal/breaker"
 	"McpServer/internal/config"
 	"McpServer/internal/database"
 	"McpServer/internal/handlers"
+	"McpServer/internal/health"
 	"McpServer/internal/logger"
 	"McpServer/internal/manager"
+	"McpServer/internal/metering"
+	"McpServer/internal/metrics"
+	"McpServer/internal/ratelimit"
+	"McpServer/internal/redact"
+	"McpServer/internal/secrets"
+	"McpServer/internal/tracing"
 )
 
 var (
-	configPath = flag.String("config", "config/config.dev.yaml", "path to config file")
+	configPath  = flag.String("config", "config/config.dev.yaml", "path to config file")
+	verifyAudit = flag.Bool("verify-audit", false, "verify the audit log hash chain and exit")
 )
 
 func main() {
@@ -33,11 +47,29 @@ func main() {
 	// 从环境变量覆盖配置
 	config.LoadConfigFromEnv(cfg)
 
-	// 配置日志级别
-	logger.SetLevelFromString(cfg.Logging.Level)
+	// 配置日志级别、格式和输出
+	if err = logger.Configure(&cfg.Logging); err != nil {
+		logger.Fatal("Failed to configure logging: %v", err)
+	}
+
+	// 日志和审计记录中的敏感数据遮蔽规则
+	redactor, err := redact.New(&cfg.Redaction)
+	if err != nil {
+		logger.Fatal("Invalid redaction config: %v", err)
+	}
+	logger.SetRedactor(redactor)
 
 	logger.Info("Starting MCP Server with config: %s:%d", cfg.Server.Host, cfg.Server.Port)
 
+	// 链路追踪，未启用时 span 为空操作
+	shutdownTracing, err := tracing.Init(&cfg.Tracing)
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing: %v", err)
+	}
+	if cfg.Tracing.Enabled {
+		logger.Info("Tracing enabled, exporting to %s (sample ratio: %g)", cfg.Tracing.Exporter, cfg.Tracing.SampleRatio)
+	}
+
 	// 创建数据库服务
 	db, err := database.NewDatabaseService(&cfg.Database)
 	if err != nil {
@@ -46,23 +78,137 @@ func main() {
 	}
 	defer db.Close()
 
+	// 只校验审计日志的哈希链，链断裂时以非零状态退出
+	if *verifyAudit {
+		result, err1 := audit.Verify(db)
+		if err1 != nil {
+			logger.Fatal("Failed to verify audit log: %v", err1)
+		}
+		json.NewEncoder(os.Stdout).Encode(result)
+		if !result.Valid {
+			logger.Error("Audit log chain broken at entry %d: %s", result.BrokenID, result.Reason)
+			os.Exit(1)
+		}
+		logger.Info("Audit log chain verified: %d entries, last entry %d", result.Entries, result.LastID)
+		return
+	}
+
 	// 创建处理器注册表
 	dbAdapter := handlers.NewDatabaseAdapter(db)
 	handlerRegistry := handlers.NewToolHandlerRegistry(dbAdapter)
 
 	// 创建 MCP 服务器管理器
 	mcpManager := manager.NewMCPServerManager(db, handlerRegistry)
+	mcpManager.SetValidateProxiedArgs(cfg.Tools.ValidateProxiedArgs)
+
+	// 加密密钥存储，需在加载服务之前启用，auto 启动的服务才能解析 secret:// 引用；主密钥不传给 stdio 进程
+	mcpManager.SetProtectedEnv(cfg.Secrets.KeyEnv)
+	secretStore, err := secrets.NewManager(&cfg.Secrets, db)
+	if errors.Is(err, secrets.ErrNoKey) {
+		logger.Info("Secrets store disabled: set %s or secrets.key_file to enable secret:// references", cfg.Secrets.KeyEnv)
+	} else if err != nil {
+		logger.Fatal("Failed to load secrets key: %v", err)
+	} else {
+		mcpManager.SetSecretResolver(secretStore)
+	}
+
+	// 连接远程服务和调用幂等工具的默认重试策略
+	mcpManager.SetRetryDefaults(cfg.Remote.DefaultRetryAttempts, cfg.Remote.DefaultRetryDelay, cfg.Remote.MaxRetryDelay)
+	mcpManager.SetRestartPolicy(cfg.Remote.RestartWindow, cfg.Remote.RestartDelay, cfg.Remote.MaxRetryDelay)
+
+	// 远程服务熔断
+	var breakers *breaker.Breakers
+	if cfg.Breaker.Enabled {
+		breakers = breaker.New(&cfg.Breaker)
+		mcpManager.SetCircuitBreaker(breakers)
+		logger.Info("Circuit breakers enabled (failure threshold: %d, cool down: %s)", cfg.Breaker.FailureThreshold, cfg.Breaker.CoolDown)
+	}
+
+	// 限流，需在加载服务之前启用
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		if limiter, err = ratelimit.NewLimiter(&cfg.RateLimit); err != nil {
+			logger.Fatal("Invalid rate limit config: %v", err)
+		}
+		mcpManager.SetRateLimiter(limiter)
+		logger.Info("Rate limiting enabled with %d rules", len(cfg.RateLimit.Rules))
+	}
+
+	// 工具调用计量和配额，需在加载服务之前启用
+	var meter *metering.Meter
+	if cfg.Metering.Enabled {
+		meter = metering.NewMeter(&cfg.Metering, db)
+		defer meter.Close()
+		mcpManager.SetUsageMeter(meter)
+		logger.Info("Tool usage metering enabled (flush interval: %s, batch size: %d)", cfg.Metering.FlushInterval, cfg.Metering.BatchSize)
+	}
+
+	// 审计日志，需在加载服务之前启用
+	var auditRecorder *audit.Recorder
+	if cfg.Audit.Enabled {
+		if auditRecorder, err = audit.NewRecorder(&cfg.Audit, db); err != nil {
+			logger.Fatal("Invalid audit config: %v", err)
+		}
+		defer auditRecorder.Close()
+		auditRecorder.SetRedactor(redactor)
+		mcpManager.SetAuditRecorder(auditRecorder)
+		logger.Info("Audit log enabled (arguments: %s)", cfg.Audit.Arguments)
+	}
 
 	// 从数据库加载内置服务器配置
 	if err = mcpManager.LoadServersFromDatabase(); err != nil {
-		logger.Fatal("Failed to load builtin servers from database", err)
+		logger.Fatal("Failed to load builtin servers from database: %v", err)
 	}
 
 	// 创建会话管理器
 	sessionManager := manager.NewSessionManager(mcpManager, db)
+	if limiter != nil {
+		sessionManager.SetRateLimiter(limiter)
+	}
+	if meter != nil {
+		sessionManager.SetUsageMeter(meter)
+	}
+	if auditRecorder != nil {
+		sessionManager.SetAuditRecorder(auditRecorder)
+	}
+
+	if breakers != nil {
+		sessionManager.SetCircuitBreaker(breakers)
+	}
+
+	// 远程 SSE 服务的主动健康检查，不健康的服务快速失败
+	var healthChecker *health.Checker
+	if cfg.Health.Enabled {
+		healthChecker = health.NewChecker(&cfg.Health, db, mcpManager)
+		defer healthChecker.Close()
+		mcpManager.SetHealthStatus(healthChecker)
+		sessionManager.SetHealthStatus(healthChecker)
+		logger.Info("Health checks enabled for remote SSE services (default interval: %s, unhealthy threshold: %d)",
+			cfg.Health.DefaultInterval, cfg.Health.UnhealthyThreshold)
+	}
 
 	// 创建认证中间件
 	authMiddleware := auth.NewAuthMiddleware(&cfg.Auth)
+	// 网关自身的凭证不透传给远程 SSE 服务
+	sessionManager.SetGatewayCredentialHeaders("Authorization", authMiddleware.GetHeaderName())
+	if cfg.Auth.DatabaseKeys {
+		authMiddleware.SetKeyStore(db)
+	}
+	if cfg.Auth.JWT.Enabled {
+		if err = authMiddleware.EnableJWT(); err != nil {
+			logger.Fatal("Failed to enable JWT authentication: %v", err)
+		}
+	}
+	if cfg.Auth.OAuth.Enabled {
+		if err = authMiddleware.EnableOAuth(); err != nil {
+			logger.Fatal("Failed to enable OAuth protected resource: %v", err)
+		}
+	}
+	if !cfg.Auth.Enabled {
+		logger.Warn("Authentication is disabled, the admin API is open to every caller")
+	} else if len(cfg.Auth.AdminKeys) == 0 && len(cfg.Auth.JWT.AdminScopes) == 0 && len(cfg.Auth.JWT.AdminGroups) == 0 {
+		logger.Warn("No auth.admin_keys, auth.jwt.admin_scopes or auth.jwt.admin_groups configured, the admin API is unreachable")
+	}
 
 	// 创建 HTTP 处理器
 	httpHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -95,12 +241,59 @@ func main() {
 	mux.Handle("/messages/", authMiddleware.Middleware(httpHandler))
 	mux.Handle("/message", authMiddleware.Middleware(httpHandler))
 
-	// 添加健康检查端点（不需要认证）
+	// 添加健康检查端点（不需要认证）：数据库不可用时返回 503；有远程服务未通过健康检查时为 degraded，仍返回 200
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+		status, code := "ok", http.StatusOK
+		checks := map[string]interface{}{}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err1 := db.Ping(ctx); err1 != nil {
+			logger.Error("Health check: %v", err1)
+			status, code = "unavailable", http.StatusServiceUnavailable
+			checks["database"] = map[string]interface{}{"status": "down"}
+		} else {
+			checks["database"] = map[string]interface{}{"status": "ok"}
+		}
+
+		if breakers != nil {
+			open := breakers.Open()
+			circuits := map[string]interface{}{"status": "ok", "open": open}
+			if len(open) > 0 {
+				circuits["status"] = "degraded"
+				if code == http.StatusOK {
+					status = "degraded"
+				}
+			}
+			checks["circuit_breakers"] = circuits
+		}
+
+		if healthChecker != nil {
+			unhealthy, checked := healthChecker.Unhealthy()
+			upstreams := map[string]interface{}{"status": "ok", "checked": checked, "unhealthy": unhealthy}
+			if len(unhealthy) > 0 {
+				upstreams["status"] = "degraded"
+				if code == http.StatusOK {
+					status = "degraded"
+				}
+			}
+			checks["upstreams"] = upstreams
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": status,
+			"checks": checks,
+		})
 	})
 
+	// OAuth 受保护资源元数据（不需要认证），MCP 客户端据此发现授权服务器
+	if cfg.Auth.OAuth.Enabled {
+		mux.HandleFunc(auth.ProtectedResourceMetadataPath, authMiddleware.ProtectedResourceMetadataHandler())
+		mux.HandleFunc(auth.ProtectedResourceMetadataPath+"/", authMiddleware.ProtectedResourceMetadataHandler())
+	}
+
 	// 添加认证信息端点（不需要认证，用于调试）
 	mux.HandleFunc("/auth/info", func(w http.ResponseWriter, r *http.Request) {
 		if authMiddleware.IsEnabled() {
@@ -110,8 +303,8 @@ func main() {
 		}
 	})
 
-	// 添加会话监控端点（需要认证）
-	mux.Handle("/admin/sessions", authMiddleware.Middleware(func(w http.ResponseWriter, r *http.Request) {
+	// 添加会话监控端点（需要管理员权限）
+	mux.Handle("/admin/sessions", authMiddleware.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		activeCount := sessionManager.GetActiveSessionCount()
 		sessionInfo := sessionManager.GetSessionInfo()
 
@@ -125,21 +318,149 @@ func main() {
 		json.NewEncoder(w).Encode(response)
 	}))
 
+	// 添加工具注册报告端点（需要管理员权限），列出 schema 无法转换或注册失败的工具
+	mux.Handle("/admin/tools/skipped", authMiddleware.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"skipped_tools": mcpManager.GetSkippedTools(),
+		})
+	}))
+
+	// 添加远程服务健康检查状态端点（需要管理员权限），包含每个服务最近的探测记录
+	mux.Handle("/admin/health", authMiddleware.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		services := []health.ServiceHealth{}
+		if healthChecker != nil {
+			services = healthChecker.Services()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":  healthChecker != nil,
+			"services": services,
+		})
+	}))
+
+	// 添加熔断器状态端点（需要管理员权限）
+	mux.Handle("/admin/circuit-breakers", authMiddleware.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		circuits := []breaker.Status{}
+		if breakers != nil {
+			circuits = breakers.Statuses()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":  breakers != nil,
+			"circuits": circuits,
+		})
+	}))
+
+	// 添加远程 stdio 进程状态端点（需要管理员权限），crash_looping 的进程已放弃自动重启
+	mux.Handle("/admin/stdio/processes", authMiddleware.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		processes := mcpManager.StdioProcesses()
+		crashLooping := []string{}
+		for _, process := range processes {
+			if process.State == manager.StdioProcessCrashLooping {
+				crashLooping = append(crashLooping, process.SessionKey)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"processes":     processes,
+			"crash_looping": crashLooping,
+		})
+	}))
+
+	// 添加 Prometheus 指标端点
+	if cfg.Metrics.Enabled {
+		metricsHandler := metrics.Handler(sessionManager, mcpManager)
+		if cfg.Metrics.RequireAuth {
+			mux.Handle(cfg.Metrics.Path, authMiddleware.Middleware(metricsHandler.ServeHTTP))
+		} else {
+			mux.Handle(cfg.Metrics.Path, metricsHandler)
+		}
+		logger.Info("Prometheus metrics available at %s", cfg.Metrics.Path)
+	}
+
+	// 添加服务、工具及适配器配置的管理接口（需要管理员权限）
+	adminHandler := admin.NewHandler(db, handlerRegistry, sessionManager)
+	if secretStore != nil {
+		adminHandler.SetSecrets(secretStore)
+	}
+	if meter != nil {
+		adminHandler.SetUsage(db)
+	}
+	if auditRecorder != nil {
+		adminHandler.SetAudit(auditRecorder)
+	}
+	adminHandler.Register(mux, authMiddleware.Middleware)
+
+	// 监听配置表变更，自动热重载受影响的服务
+	if cfg.Reload.ListenNotify {
+		listener, err1 := database.NewConfigChangeListener(&cfg.Database, cfg.Reload.Debounce)
+		if err1 != nil {
+			logger.Error("Failed to start config change listener, use POST /admin/reload instead: %v", err1)
+		} else {
+			defer listener.Close()
+			go listener.Run(func(serverIDs []string) {
+				for _, serverID := range serverIDs {
+					sessionManager.ReloadService(serverID)
+				}
+				if healthChecker != nil {
+					healthChecker.Refresh()
+				}
+			}, func() {
+				if _, err2 := sessionManager.ReloadAll(); err2 != nil {
+					logger.Error("Failed to reload services: %v", err2)
+				}
+				if healthChecker != nil {
+					healthChecker.Refresh()
+				}
+			})
+		}
+	}
+
 	addr := cfg.Server.GetServerAddr()
 	logger.Info("Server starting on %s", addr)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: tracing.Middleware(logger.Middleware(mux)),
+	}
 
-	// 设置优雅关闭
+	// 设置优雅关闭：不再接受新连接，等待进行中的工具调用完成后关闭下游连接、HTTP 服务和上游会话
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
 
 	go func() {
 		<-sigChan
-		logger.Info("Received shutdown signal")
+		logger.Info("Received shutdown signal, draining for up to %s", cfg.Server.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		sessionManager.StopAccepting()
+		if err1 := sessionManager.Drain(ctx); err1 != nil {
+			logger.Warn("Shutting down with unfinished tool calls: %v", err1)
+		}
+		sessionManager.CloseConnections()
+		if err1 := server.Shutdown(ctx); err1 != nil {
+			logger.Warn("HTTP server did not shut down cleanly: %v", err1)
+		}
+		mcpManager.Close()
 		sessionManager.Shutdown()
-		os.Exit(0)
+		authMiddleware.Close()
+
+		// 导出剩余的 span
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err1 := shutdownTracing(flushCtx); err1 != nil {
+			logger.Warn("Failed to flush traces: %v", err1)
+		}
+		flushCancel()
+		close(shutdownDone)
 	}()
 
-	if err = http.ListenAndServe(addr, mux); err != nil {
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("Server failed: %v", err)
+		return
 	}
+	// 等待关闭完成，之后由 defer 关闭计量、审计、健康检查和数据库
+	<-shutdownDone
+	logger.Info("Server stopped")
 }